@@ -0,0 +1,5 @@
+module github.com/SivaprasadTamatam/weather
+
+go 1.22
+
+require golang.org/x/sync v0.8.0
@@ -1,21 +1,319 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"./weather"
+	"github.com/SivaprasadTamatam/weather/weather"
+)
+
+// Build information, set at build time with
+// go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)".
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// Default server timeouts, used when the corresponding environment variable is unset or invalid.
+// The write timeout is part of the weather configuration instead, which keeps every endpoint timeout below it.
+const (
+	defaultReadTimeout = 10 * time.Second
+	defaultIdleTimeout = 60 * time.Second
+
+	// defaultShutdownTimeout is how long in-flight requests may take to complete once the server is shutting down.
+	defaultShutdownTimeout = 10 * time.Second
 )
 
 // main is the entry point of the application.
 // It sets up a simple HTTP server to handle incoming requests.
 func main() {
+	// Register Open-Meteo as a fallback provider that is queried when OpenWeatherMap fails or times out.
+	// It does not need an API key, which makes it a convenient secondary source.
+	weather.RegisterProvider(weather.OpenMeteoProvider{})
+
+	// Load the runtime configuration and the favorite locations that can be queried by name, e.g. /weather?location=home.
+	cfg, err := weather.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := weather.SetConfig(cfg); err != nil {
+		log.Fatal(err)
+	}
+	if err := reloadFavorites(); err != nil {
+		log.Fatal(err)
+	}
+
+	// OWM_API_KEYS rotates the requests without an X-API-Key header across several comma-separated API keys,
+	// skipping keys that were recently rate limited.
+	if keys := os.Getenv("OWM_API_KEYS"); keys != "" {
+		weather.SetAPIKeys(strings.Split(keys, ","))
+	}
+
+	// LOG_LEVEL=debug adds debug log lines, such as the upstream URLs being called with the API key redacted.
+	weather.SetDebugLogging(strings.EqualFold(os.Getenv("LOG_LEVEL"), "debug"))
+
+	// Attach the static headers from UPSTREAM_HEADERS to every OpenWeatherMap request, e.g. for an authenticating proxy.
+	headers, err := weather.LoadUpstreamHeadersFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	weather.SetUpstreamHeaders(headers)
+
+	// INSECURE_SKIP_TLS_VERIFY disables TLS certificate verification of upstream APIs for test environments with
+	// self-signed proxies. It is off by default and must never be enabled in production.
+	if insecure, _ := strconv.ParseBool(os.Getenv("INSECURE_SKIP_TLS_VERIFY")); insecure {
+		weather.SetInsecureSkipTLSVerify(true)
+	}
+
+	// UPSTREAM_TLS_MIN_VERSION raises or lowers the oldest TLS version accepted for upstream calls, 1.2 by default.
+	if value := os.Getenv("UPSTREAM_TLS_MIN_VERSION"); value != "" {
+		tlsVersion, err := weather.ParseTLSVersion(value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := weather.SetUpstreamTLSMinVersion(tlsVersion); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Tune the reuse of upstream connections with UPSTREAM_MAX_IDLE_CONNS, UPSTREAM_MAX_IDLE_CONNS_PER_HOST and
+	// UPSTREAM_IDLE_CONN_TIMEOUT; the defaults suit a single upstream host.
+	pool := weather.UpstreamPool{
+		MaxIdleConns:        intFromEnv("UPSTREAM_MAX_IDLE_CONNS", weather.DefaultUpstreamPool.MaxIdleConns),
+		MaxIdleConnsPerHost: intFromEnv("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", weather.DefaultUpstreamPool.MaxIdleConnsPerHost),
+		IdleConnTimeout:     durationFromEnv("UPSTREAM_IDLE_CONN_TIMEOUT", weather.DefaultUpstreamPool.IdleConnTimeout),
+	}
+	if err := weather.SetUpstreamPool(pool); err != nil {
+		log.Fatal(err)
+	}
+
+	// GEOLOCATOR_URL enables locating clients by IP address, e.g. "https://ipapi.co/{ip}/json/", see weather.HTTPGeolocator.
+	if url := os.Getenv("GEOLOCATOR_URL"); url != "" {
+		weather.SetGeolocator(weather.HTTPGeolocator{URL: url})
+	}
+
+	// TRUSTED_PROXIES lists the load balancers whose X-Forwarded-For and X-Real-IP headers reveal the client address.
+	trusted, err := weather.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	weather.SetTrustedProxies(trusted)
+
+	// Optionally check the API key before serving, so a misconfigured key is noticed on deploy rather than on the first request.
+	// The check is off by default to avoid coupling the startup to the availability of the upstream.
+	if validate, _ := strconv.ParseBool(os.Getenv("VALIDATE_KEY_ON_START")); validate {
+		validateAPIKey()
+	}
+
+	// Limit the number of concurrent upstream calls to protect the API quotas.
+	// Beyond the limit, calls wait for a free slot unless UPSTREAM_LIMIT_MODE is "fail", in which case they fail straight away.
+	failFast := os.Getenv("UPSTREAM_LIMIT_MODE") == "fail"
+	if err := weather.SetUpstreamLimit(intFromEnv("MAX_UPSTREAM_CALLS", weather.DefaultMaxUpstreamCalls), failFast); err != nil {
+		log.Fatal(err)
+	}
+
+	// Cap the upstream response bodies that are read at MAX_UPSTREAM_BODY_BYTES (4 MB by default).
+	if err := weather.SetMaxUpstreamBodyBytes(int64(intFromEnv("MAX_UPSTREAM_BODY_BYTES", weather.DefaultMaxUpstreamBodyBytes))); err != nil {
+		log.Fatal(err)
+	}
+
+	// Reload both on SIGHUP so settings can be changed without restarting the server.
+	go reloadOnSignal()
+
+	// Stop the background work and the server gracefully on SIGINT and SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// PREFETCH_INTERVAL keeps the cached weather of the favorite locations warm by refreshing it on that schedule.
+	// It is off by default.
+	if interval := durationFromEnv("PREFETCH_INTERVAL", 0); interval > 0 {
+		go weather.RunPrefetch(ctx, interval)
+	}
+
 	// Register the WeatherHandler function to handle requests to the "/weather" endpoint.
 	// This is achieved using the built-in http package's HandleFunc method, which associates a handler function with a specific URL pattern.
 	// For simplicity, we are using the basic capabilities of the standard http package instead of more advanced frameworks like GIN or MUX.
 	http.HandleFunc("/weather", weather.WeatherHandler)
 
+	// Register the CompareHandler function to compare the current weather of two locations side by side.
+	http.HandleFunc("/weather/compare", weather.CompareHandler)
+
+	// Expose the raw upstream response for troubleshooting only when DEBUG_ENDPOINTS is enabled, so it is off in production.
+	if debug, _ := strconv.ParseBool(os.Getenv("DEBUG_ENDPOINTS")); debug {
+		http.HandleFunc("/weather/raw", weather.RawHandler)
+	}
+
+	// Expose the cache statistics and flushing to operators only when ADMIN_ENDPOINTS is enabled.
+	if admin, _ := strconv.ParseBool(os.Getenv("ADMIN_ENDPOINTS")); admin {
+		http.HandleFunc("/admin/cache/stats", weather.CacheStatsHandler)
+	}
+
+	// Register the BatchHandler function to fetch the current weather of several locations in one request.
+	http.HandleFunc("/weather/batch", weather.BatchHandler)
+
+	// Register the StreamHandler function to push weather updates to live dashboards as Server-Sent Events.
+	http.HandleFunc("/weather/stream", weather.StreamHandler)
+
+	// Register the DigestHandler function to summarize the current weather of every favorite location.
+	http.HandleFunc("/digest", weather.DigestHandler)
+
+	// Register the ExportHandler function to download the current weather of every favorite location as CSV.
+	http.HandleFunc("/export.csv", weather.ExportHandler)
+
+	// Register the GeocodeHandler function to list the places matching an ambiguous city name.
+	http.HandleFunc("/geocode", weather.GeocodeHandler)
+
+	// Register the HistoryHandler function to serve the weather of a location at a past moment.
+	http.HandleFunc("/history", weather.HistoryHandler)
+
+	// Register the OneCallHandler function to serve current conditions, forecasts and alerts from the One Call API.
+	http.HandleFunc("/onecall", weather.OneCallHandler)
+
+	// Register the DeepHealthHandler function for readiness probes checking that the upstream is reachable with a valid key.
+	http.HandleFunc("/health/deep", weather.DeepHealthHandler)
+
+	// Report which build is deployed.
+	http.HandleFunc("/version", weather.VersionHandler(weather.BuildInfo{Version: version, Commit: commit, BuildDate: buildDate}))
+
+	// Serve a small HTML page at the root path so the service can be used from a browser.
+	http.HandleFunc("/", weather.IndexHandler)
+
 	// Start the HTTP server and listen for incoming requests on port 8080.
-	// The ListenAndServe function is a blocking call, so the program will continue to run and serve requests until it is terminated.
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	// The ListenAndServe method is a blocking call, so the program will continue to run and serve requests until it is terminated.
+	// Every endpoint is wrapped in the middleware below, outermost first:
+	//   - the logging middleware logs one line per request with its status, the size sent over the wire and the latency;
+	//   - responses are gzipped for clients that accept it once they reach COMPRESSION_MIN_BYTES (1 KB by default);
+	//   - request bodies are capped at MAX_BODY_BYTES (1 MB by default) so that oversized payloads cannot exhaust memory.
+	compressionMinBytes := intFromEnv("COMPRESSION_MIN_BYTES", weather.DefaultCompressionMinBytes)
+	maxBodyBytes := int64(intFromEnv("MAX_BODY_BYTES", weather.DefaultMaxBodyBytes))
+	handler := weather.Chain(http.DefaultServeMux,
+		weather.LoggingMiddleware,
+		func(next http.Handler) http.Handler { return weather.CompressionMiddleware(compressionMinBytes, next) },
+		func(next http.Handler) http.Handler { return weather.MaxBodyMiddleware(maxBodyBytes, next) },
+	)
+	server := newServer(":8080", handler, cfg.WriteTimeout)
+
+	logEffectiveConfig(server)
+	go shutdownOnDone(ctx, server)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// shutdownOnDone waits until ctx is done and then shuts the server down, giving in-flight requests up to
+// defaultShutdownTimeout to complete.
+func shutdownOnDone(ctx context.Context, server *http.Server) {
+	<-ctx.Done()
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Graceful shutdown failed: %v", err)
+	}
+}
+
+// validateAPIKey checks the configured OpenWeatherMap API key with a single upstream call.
+// A rejected key is fatal; any other failure only logs a warning, since the upstream may just be temporarily unavailable.
+func validateAPIKey() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	switch err := weather.ValidateAPIKey(ctx); {
+	case errors.Is(err, weather.ErrAPIKeyRejected):
+		log.Fatal("API key validation failed: OpenWeatherMap rejected the configured key")
+	case err != nil:
+		log.Printf("Warning: could not validate the API key: %v", err)
+	default:
+		log.Printf("API key validated")
+	}
+}
+
+// reloadFavorites loads the favorite locations from the environment and makes them the active ones.
+func reloadFavorites() error {
+	favorites, err := weather.LoadFavoritesFromEnv()
+	if err != nil {
+		return err
+	}
+	weather.SetFavorites(favorites)
+	return nil
+}
+
+// reloadOnSignal re-reads the configuration and the favorite locations every time the process receives SIGHUP.
+// A failed reload is logged and leaves the previous settings in place.
+func reloadOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		if err := weather.ReloadConfig(); err != nil {
+			log.Printf("Config reload failed: %v", err)
+			continue
+		}
+		if err := reloadFavorites(); err != nil {
+			log.Printf("Favorites reload failed: %v", err)
+			continue
+		}
+		log.Printf("Configuration reloaded")
+	}
+}
+
+// logEffectiveConfig logs the effective configuration of the server and the weather package once, with secrets
+// redacted, so deployment issues can be diagnosed from the logs.
+// It is on by default and can be turned off with LOG_CONFIG_ON_START=false.
+func logEffectiveConfig(server *http.Server) {
+	if show, err := strconv.ParseBool(os.Getenv("LOG_CONFIG_ON_START")); err != nil || show {
+		log.Printf("Effective configuration: addr=%s read_timeout=%v write_timeout=%v idle_timeout=%v %s",
+			server.Addr, server.ReadTimeout, server.WriteTimeout, server.IdleTimeout, weather.ConfigSummary())
+	}
+}
+
+// newServer constructs the HTTP server with explicit timeouts instead of relying on http.ListenAndServe,
+// whose server has no timeouts at all and is therefore exposed to slowloris-style resource exhaustion.
+// The timeouts can be overridden with the READ_TIMEOUT and IDLE_TIMEOUT environment variables, which accept Go
+// duration strings such as "10s" or "1m". The write timeout comes from the configuration, see weather.Config.WriteTimeout.
+func newServer(addr string, handler http.Handler, writeTimeout time.Duration) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  durationFromEnv("READ_TIMEOUT", defaultReadTimeout),
+		WriteTimeout: writeTimeout,
+		IdleTimeout:  durationFromEnv("IDLE_TIMEOUT", defaultIdleTimeout),
+	}
+}
+
+// durationFromEnv reads a duration from the named environment variable.
+// It returns the fallback when the variable is unset, and logs and returns the fallback when it cannot be parsed.
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Ignoring invalid %s value %q, using %v", name, value, fallback)
+		return fallback
+	}
+	return duration
+}
+
+// intFromEnv reads a positive integer from the named environment variable.
+// It returns the fallback when the variable is unset, and logs and returns the fallback when it cannot be parsed.
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		log.Printf("Ignoring invalid %s value %q, using %v", name, value, fallback)
+		return fallback
+	}
+	return number
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SivaprasadTamatam/weather/weather"
+)
+
+func TestNewServerTimeouts(t *testing.T) {
+	tests := []struct {
+		name               string
+		readTimeout        string
+		idleTimeout        string
+		writeTimeout       time.Duration
+		wantRead, wantIdle time.Duration
+	}{
+		{name: "defaults", wantRead: defaultReadTimeout, wantIdle: defaultIdleTimeout, writeTimeout: 15 * time.Second},
+		{name: "overridden", readTimeout: "2s", idleTimeout: "1m30s", wantRead: 2 * time.Second, wantIdle: 90 * time.Second, writeTimeout: 20 * time.Second},
+		{name: "invalid", readTimeout: "soon", idleTimeout: "-1s", wantRead: defaultReadTimeout, wantIdle: defaultIdleTimeout, writeTimeout: 15 * time.Second},
+		{name: "zero", readTimeout: "0s", idleTimeout: "0", wantRead: defaultReadTimeout, wantIdle: defaultIdleTimeout, writeTimeout: 15 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("READ_TIMEOUT", tt.readTimeout)
+			t.Setenv("IDLE_TIMEOUT", tt.idleTimeout)
+
+			server := newServer(":0", http.NotFoundHandler(), tt.writeTimeout)
+
+			if server.ReadTimeout != tt.wantRead || server.IdleTimeout != tt.wantIdle || server.WriteTimeout != tt.writeTimeout {
+				t.Errorf("timeouts = read %v, write %v, idle %v; want read %v, write %v, idle %v",
+					server.ReadTimeout, server.WriteTimeout, server.IdleTimeout, tt.wantRead, tt.writeTimeout, tt.wantIdle)
+			}
+		})
+	}
+}
+
+func TestLogEffectiveConfig(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		env     string
+		wantLog bool
+	}{
+		{env: "", wantLog: true},
+		{env: "true", wantLog: true},
+		{env: "sometimes", wantLog: true},
+		{env: "false", wantLog: false},
+		{env: "0", wantLog: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("LOG_CONFIG_ON_START", tt.env)
+			weather.SetAPIKeys([]string{secret})
+			weather.SetUpstreamHeaders(http.Header{"Proxy-Authorization": {"Basic " + secret}})
+			t.Cleanup(func() {
+				weather.SetAPIKeys(nil)
+				weather.SetUpstreamHeaders(nil)
+			})
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			logEffectiveConfig(newServer(":8080", http.NotFoundHandler(), 15*time.Second))
+
+			if got := strings.Contains(logs.String(), "Effective configuration: addr=:8080"); got != tt.wantLog {
+				t.Errorf("configuration logged = %v, want %v; log %q", got, tt.wantLog, logs.String())
+			}
+			if strings.Contains(logs.String(), secret) {
+				t.Errorf("log %q reveals the API key", logs.String())
+			}
+		})
+	}
+}
+
+func TestIntFromEnv(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{value: "", want: 16},
+		{value: "64", want: 64},
+		{value: "0", want: 16},
+		{value: "-4", want: 16},
+		{value: "many", want: 16},
+		{value: "1.5", want: 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", tt.value)
+			log.SetOutput(io.Discard)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			if got := intFromEnv("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", 16); got != tt.want {
+				t.Errorf("intFromEnv() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
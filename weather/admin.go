@@ -0,0 +1,40 @@
+package weather
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// CacheStatsHandler is an HTTP handler function for operators that reports the statistics of the active cache
+// backend as CacheStats JSON on GET and HEAD, and empties the cache on DELETE, answering with No Content (204).
+// Backends that keep no statistics result in a Not Implemented status code (501).
+// The endpoint is an administration aid and should only be exposed when explicitly enabled.
+func CacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	// Reject methods other than GET, HEAD and DELETE, advertising the supported ones in the Allow header
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cache, ok := currentCache().(StatsCache)
+	if !ok {
+		http.Error(w, "The cache backend keeps no statistics", http.StatusNotImplemented)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		cache.Flush()
+		log.Printf("Cache flushed on request from %s", clientIP(r))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	json.NewEncoder(w).Encode(cache.Stats())
+}
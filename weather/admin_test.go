@@ -0,0 +1,143 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCacheStatsHandler(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// lookup is a weather request made after the given time since the start of the test
+	type lookup struct {
+		query   string
+		elapsed time.Duration
+	}
+	tests := []struct {
+		name      string
+		lookups   []lookup
+		failing   bool // Whether the upstream fails every request after the first
+		flush     bool // Whether the cache is flushed after the lookups
+		want      CacheStats
+		wantCalls int
+	}{
+		{name: "before the first lookup", want: CacheStats{}},
+		{
+			name:      "miss then hit",
+			lookups:   []lookup{{query: "lat=51.51&lon=-0.13"}, {query: "lat=51.51&lon=-0.13", elapsed: time.Minute}},
+			want:      CacheStats{Hits: 1, Misses: 1, HitRatio: 0.5, Entries: 1},
+			wantCalls: 1,
+		},
+		{
+			name: "two locations",
+			lookups: []lookup{
+				{query: "lat=51.51&lon=-0.13"}, {query: "lat=48.86&lon=2.35"},
+				{query: "lat=51.51&lon=-0.13", elapsed: time.Minute}, {query: "lat=48.86&lon=2.35", elapsed: time.Minute},
+				{query: "lat=51.51&lon=-0.13", elapsed: 2 * time.Minute},
+			},
+			want:      CacheStats{Hits: 3, Misses: 2, HitRatio: 0.6, Entries: 2},
+			wantCalls: 2,
+		},
+		{
+			name:      "expired entry refetched",
+			lookups:   []lookup{{query: "lat=51.51&lon=-0.13"}, {query: "lat=51.51&lon=-0.13", elapsed: 11 * time.Minute}},
+			want:      CacheStats{Misses: 2, Entries: 1},
+			wantCalls: 2,
+		},
+		{
+			name:      "entry too old for the stale fallback refetched",
+			lookups:   []lookup{{query: "lat=51.51&lon=-0.13"}, {query: "lat=51.51&lon=-0.13", elapsed: 2 * time.Hour}},
+			want:      CacheStats{Misses: 2, Entries: 1, Evictions: 1},
+			wantCalls: 2,
+		},
+		{
+			name:      "entry too old for the stale fallback",
+			lookups:   []lookup{{query: "lat=51.51&lon=-0.13"}, {query: "lat=51.51&lon=-0.13", elapsed: 2 * time.Hour}},
+			failing:   true,
+			want:      CacheStats{Misses: 2, Evictions: 1},
+			wantCalls: 2,
+		},
+		{
+			name:      "flushed",
+			lookups:   []lookup{{query: "lat=51.51&lon=-0.13"}, {query: "lat=51.51&lon=-0.13", elapsed: time.Minute}},
+			flush:     true,
+			want:      CacheStats{Hits: 1, Misses: 1, HitRatio: 0.5},
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			MaxUpstreamAttempts = 1
+			configure(t, func(cfg *Config) {
+				cfg.CacheTTL = 10 * time.Minute
+				cfg.MaxStaleness = time.Hour
+			})
+			upstream := newUpstream(t, map[string]http.HandlerFunc{})
+			upstream.handle(currentWeatherPath, func(w http.ResponseWriter, r *http.Request) {
+				if tt.failing && len(upstream.calls(currentWeatherPath)) > 1 {
+					respond(http.StatusInternalServerError, `{}`)(w, r)
+					return
+				}
+				respond(http.StatusOK, sampleCurrentWeather)(w, r)
+			})
+			for _, lookup := range tt.lookups {
+				SetClock(FixedClock(start.Add(lookup.elapsed)))
+				serve(WeatherHandler, http.MethodGet, "/weather?"+lookup.query, nil)
+			}
+			if tt.flush {
+				if recorder := serve(CacheStatsHandler, http.MethodDelete, "/admin/cache/stats", nil); recorder.Code != http.StatusNoContent {
+					t.Fatalf("flush status = %d, want %d", recorder.Code, http.StatusNoContent)
+				}
+			}
+
+			recorder := serve(CacheStatsHandler, http.MethodGet, "/admin/cache/stats", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got CacheStats
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("stats = %+v, want %+v", got, tt.want)
+			}
+			if calls := len(upstream.calls(currentWeatherPath)); calls != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCacheStatsHandlerRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		cache      Cache
+		wantStatus int
+	}{
+		{name: "head", method: http.MethodHead, wantStatus: http.StatusOK},
+		{name: "unsupported method", method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed},
+		{name: "backend without statistics", method: http.MethodGet, cache: noCache{}, wantStatus: http.StatusNotImplemented},
+		{name: "flush of a backend without statistics", method: http.MethodDelete, cache: noCache{}, wantStatus: http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if tt.cache != nil {
+				SetCache(tt.cache)
+			}
+
+			recorder := serve(CacheStatsHandler, tt.method, "/admin/cache/stats", nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusMethodNotAllowed && recorder.Header().Get("Allow") != "GET, HEAD, DELETE" {
+				t.Errorf("Allow = %q, want the supported methods", recorder.Header().Get("Allow"))
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package weather
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitedKeyCooldown is how long an API key of the pool is skipped after OpenWeatherMap answered a request made
+// with it with Too Many Requests (429).
+const rateLimitedKeyCooldown = time.Minute
+
+// pooledAPIKey is the state of one API key of the pool. Keys are referred to by their position in logs, never by value.
+type pooledAPIKey struct {
+	key          string
+	limitedUntil time.Time // Zero unless the key was recently rate limited
+	quotaErrors  int       // Number of rate limit responses seen for the key so far
+}
+
+// apiKeyPool rotates the requests made with the server's own credentials across several OpenWeatherMap API keys,
+// e.g. to stretch free-tier quotas. Keys are handed out round-robin, skipping those rate limited within the last
+// rateLimitedKeyCooldown; when every key is, the one whose cooldown ends first is used.
+type apiKeyPool struct {
+	mu   sync.Mutex
+	keys []pooledAPIKey
+	next int
+}
+
+// activeAPIKeys is the pool used for requests that bring no API key of their own. It is empty unless set with
+// SetAPIKeys, in which case API_KEY is used instead.
+var activeAPIKeys = &apiKeyPool{}
+
+// SetAPIKeys replaces the OpenWeatherMap API keys rotated across for requests without an X-API-Key header of their
+// own. Empty entries are ignored, and an empty list restores the single API_KEY. Rate limit state starts afresh.
+func SetAPIKeys(keys []string) {
+	var pooled []pooledAPIKey
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			pooled = append(pooled, pooledAPIKey{key: key})
+		}
+	}
+	activeAPIKeys.mu.Lock()
+	defer activeAPIKeys.mu.Unlock()
+	activeAPIKeys.keys, activeAPIKeys.next = pooled, 0
+}
+
+// pick returns the key to use for the next request, or false when the pool is empty.
+func (p *apiKeyPool) pick() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.keys) == 0 {
+		return "", false
+	}
+
+	// Take the next key in turn that is not cooling down, remembering the one that recovers first as a fallback
+	current := now()
+	soonest := -1
+	for offset := range p.keys {
+		i := (p.next + offset) % len(p.keys)
+		if !p.keys[i].limitedUntil.After(current) {
+			p.next = (i + 1) % len(p.keys)
+			return p.keys[i].key, true
+		}
+		if soonest < 0 || p.keys[i].limitedUntil.Before(p.keys[soonest].limitedUntil) {
+			soonest = i
+		}
+	}
+	p.next = (soonest + 1) % len(p.keys)
+	return p.keys[soonest].key, true
+}
+
+// size returns the number of keys in the pool.
+func (p *apiKeyPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.keys)
+}
+
+// available reports whether any key of the pool is not cooling down.
+func (p *apiKeyPool) available() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current := now()
+	for _, pooled := range p.keys {
+		if !pooled.limitedUntil.After(current) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether the key belongs to the pool.
+func (p *apiKeyPool) contains(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pooled := range p.keys {
+		if pooled.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// reportStatus records the status code OpenWeatherMap answered a request made with the key with. A Too Many
+// Requests status takes the key out of rotation for rateLimitedKeyCooldown. Keys outside the pool are ignored.
+func (p *apiKeyPool) reportStatus(key string, code int) {
+	if code != http.StatusTooManyRequests {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.keys {
+		if p.keys[i].key == key {
+			p.keys[i].limitedUntil = now().Add(rateLimitedKeyCooldown)
+			p.keys[i].quotaErrors++
+			log.Printf("API key %d of %d was rate limited, skipping it for %v (%d quota errors so far)", i+1, len(p.keys), rateLimitedKeyCooldown, p.keys[i].quotaErrors)
+			return
+		}
+	}
+}
+
+// trackAPIKeyStatus is a helper function that reports the status code of an OpenWeatherMap response to the API key
+// pool, identifying the key by the appid parameter of the request.
+func trackAPIKeyStatus(request *http.Request, code int) {
+	activeAPIKeys.reportStatus(request.URL.Query().Get("appid"), code)
+}
+
+// repickAPIKey is a helper function that returns the OpenWeatherMap URL with its appid replaced by the next key of the
+// pool, so that a retry does not reuse the key whose status was just reported, which may now be cooling down.
+// URLs with a key from outside the pool, such as one from an X-API-Key header, are returned unchanged.
+func repickAPIKey(url string) string {
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return url
+	}
+	query := parsed.Query()
+	if !activeAPIKeys.contains(query.Get("appid")) {
+		return url
+	}
+	key, ok := activeAPIKeys.pick()
+	if !ok {
+		return url
+	}
+	query.Set("appid", key)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// retryableWithAnotherKey is a helper function that reports whether a call to the OpenWeatherMap URL that failed with
+// err is worth retrying with the next key of the pool, see repickAPIKey. That is the case when the key of the URL was
+// rate limited and the pool holds a key that is not cooling down, since the limit applies to the key rather than to
+// the server. A rate limited key from outside the pool would only be limited again.
+func retryableWithAnotherKey(url string, err error) bool {
+	if !errors.Is(err, ErrUpstreamRateLimited) {
+		return false
+	}
+	parsed, parseErr := neturl.Parse(url)
+	if parseErr != nil || !activeAPIKeys.contains(parsed.Query().Get("appid")) {
+		return false
+	}
+	return activeAPIKeys.available()
+}
@@ -0,0 +1,210 @@
+package weather
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pickKeys is a helper function that picks n keys from the active pool in turn.
+func pickKeys(t *testing.T, n int) []string {
+	t.Helper()
+	keys := make([]string, n)
+	for i := range keys {
+		key, ok := activeAPIKeys.pick()
+		if !ok {
+			t.Fatal("pick() found no key in the pool")
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+func TestAPIKeyPool(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		keys    []string
+		limited []string      // Keys answered with Too Many Requests a second apart before picking
+		elapsed time.Duration // Time passed between the first rate limiting and picking
+		want    []string
+	}{
+		{name: "round-robin", keys: []string{"k1", "k2", "k3"}, want: []string{"k1", "k2", "k3", "k1", "k2"}},
+		{name: "blank entries dropped", keys: []string{" k1 ", "", "k2", "  "}, want: []string{"k1", "k2", "k1"}},
+		{name: "rate limited key skipped", keys: []string{"k1", "k2", "k3"}, limited: []string{"k2"}, want: []string{"k1", "k3", "k1", "k3"}},
+		{
+			name:    "rate limited key still cooling down",
+			keys:    []string{"k1", "k2", "k3"},
+			limited: []string{"k2"},
+			elapsed: rateLimitedKeyCooldown - time.Second,
+			want:    []string{"k1", "k3", "k1"},
+		},
+		{
+			name:    "rate limited key back after the cooldown",
+			keys:    []string{"k1", "k2", "k3"},
+			limited: []string{"k2"},
+			elapsed: rateLimitedKeyCooldown,
+			want:    []string{"k1", "k2", "k3"},
+		},
+		// k2 was limited first, so its cooldown ends first
+		{name: "every key rate limited", keys: []string{"k1", "k2"}, limited: []string{"k2", "k1"}, want: []string{"k2", "k2"}},
+		{name: "key outside the pool", keys: []string{"k1", "k2"}, limited: []string{"caller-key"}, want: []string{"k1", "k2", "k1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			logs := captureLog(t)
+			SetAPIKeys(tt.keys)
+			for i, key := range tt.limited {
+				SetClock(FixedClock(start.Add(time.Duration(i) * time.Second)))
+				activeAPIKeys.reportStatus(key, http.StatusTooManyRequests)
+			}
+			SetClock(FixedClock(start.Add(tt.elapsed)))
+
+			if got := pickKeys(t, len(tt.want)); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("picked %q, want %q", got, tt.want)
+			}
+			for _, key := range tt.keys {
+				if key = strings.TrimSpace(key); key != "" && strings.Contains(logs.String(), key) {
+					t.Errorf("log %q contains the key %q", logs, key)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIKeyPoolQuotaErrors(t *testing.T) {
+	setupTest(t)
+	logs := captureLog(t)
+	SetAPIKeys([]string{"k1", "k2"})
+
+	for _, code := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		activeAPIKeys.reportStatus("k2", code)
+	}
+
+	if got := activeAPIKeys.keys[1].quotaErrors; got != 2 {
+		t.Errorf("quota errors of k2 = %d, want 2", got)
+	}
+	if got := activeAPIKeys.keys[0].quotaErrors; got != 0 {
+		t.Errorf("quota errors of k1 = %d, want 0", got)
+	}
+	if !strings.Contains(logs.String(), "API key 2 of 2 was rate limited") || !strings.Contains(logs.String(), "(2 quota errors so far)") {
+		t.Errorf("log %q, want the key referred to by its position", logs)
+	}
+
+	// A new pool starts afresh, and an empty one restores API_KEY
+	SetAPIKeys([]string{"k2"})
+	if got := activeAPIKeys.keys[0]; got.quotaErrors != 0 || !got.limitedUntil.IsZero() {
+		t.Errorf("key after SetAPIKeys = %+v, want no rate limit state", got)
+	}
+	SetAPIKeys(nil)
+	if got := (fetchOptions{}).withDefaults().apiKey; got != API_KEY {
+		t.Errorf("API key without a pool = %q, want API_KEY", got)
+	}
+}
+
+func TestRetryableWithAnotherKey(t *testing.T) {
+	rateLimited := fmt.Errorf("openweathermap: %w", ErrUpstreamRateLimited)
+	tests := []struct {
+		name    string
+		limited []string // Keys of the pool k1, k2 answered with Too Many Requests
+		url     string
+		err     error
+		want    bool
+	}{
+		{name: "another key available", limited: []string{"k1"}, url: "https://owm.example/data/2.5/weather?appid=k1", err: rateLimited, want: true},
+		{name: "every key cooling down", limited: []string{"k1", "k2"}, url: "https://owm.example/data/2.5/weather?appid=k1", err: rateLimited},
+		{name: "key outside the pool", url: "https://owm.example/data/2.5/weather?appid=caller-key", err: rateLimited},
+		{name: "not rate limited", limited: []string{"k1"}, url: "https://owm.example/data/2.5/weather?appid=k1", err: ErrLocationNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			captureLog(t)
+			SetAPIKeys([]string{"k1", "k2"})
+			for _, key := range tt.limited {
+				activeAPIKeys.reportStatus(key, http.StatusTooManyRequests)
+			}
+
+			if got := retryableWithAnotherKey(tt.url, tt.err); got != tt.want {
+				t.Errorf("retryableWithAnotherKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerAPIKeyRotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		statuses map[string]int // Status code answered per key, 200 when absent
+		want     []string       // Keys of the upstream calls in order
+	}{
+		{name: "round-robin", want: []string{"k1", "k2", "k3", "k1", "k2"}},
+		// The second request is rate limited with k2 and retried with k3, and the following requests skip k2
+		{name: "rate limited key skipped", statuses: map[string]int{"k2": http.StatusTooManyRequests}, want: []string{"k1", "k2", "k3", "k1", "k3", "k1"}},
+		{name: "rate limited first key", statuses: map[string]int{"k1": http.StatusTooManyRequests}, want: []string{"k1", "k2", "k3", "k2", "k3", "k2"}},
+		// Every call made with k1 fails and is retried with the next key
+		{name: "retry with the next key", statuses: map[string]int{"k1": http.StatusServiceUnavailable}, want: []string{"k1", "k2", "k3", "k1", "k2", "k3", "k1", "k2"}},
+		{name: "key of the caller", header: http.Header{"X-Api-Key": {"caller-key"}}, want: []string{"caller-key", "caller-key", "caller-key", "caller-key", "caller-key"}},
+		{
+			name:     "rate limited key of the caller not retried",
+			header:   http.Header{"X-Api-Key": {"caller-key"}},
+			statuses: map[string]int{"caller-key": http.StatusTooManyRequests},
+			want:     []string{"caller-key", "caller-key", "caller-key", "caller-key", "caller-key"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			logs := captureLog(t)
+			SetDebugLogging(true)
+			RetryBackoff = time.Millisecond
+			SetAPIKeys([]string{"k1", "k2", "k3"})
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+				if code, ok := tt.statuses[r.URL.Query().Get("appid")]; ok {
+					respond(code, `{"cod":"error"}`)(w, r)
+					return
+				}
+				respond(http.StatusOK, sampleCurrentWeather)(w, r)
+			}})
+
+			// Every request asks for another location, so none is served from the cache
+			for i := 0; i < 5; i++ {
+				serve(WeatherHandler, http.MethodGet, fmt.Sprintf("/weather?lat=%d&lon=-0.13", 10+i), tt.header)
+			}
+
+			var got []string
+			for _, call := range upstream.calls(currentWeatherPath) {
+				got = append(got, call.Query().Get("appid"))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("upstream calls made with %q, want %q", got, tt.want)
+			}
+			for _, key := range []string{"k1", "k2", "k3", "caller-key"} {
+				if strings.Contains(logs.String(), "appid="+key) {
+					t.Errorf("log %q contains the key %q", logs, key)
+				}
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerAPIKeyPoolSharesCache(t *testing.T) {
+	setupTest(t)
+	SetAPIKeys([]string{"k1", "k2"})
+	upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+	for i := 0; i < 3; i++ {
+		if recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil); recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+		}
+	}
+
+	// The keys of the pool stand for one account, so the data fetched with k1 is served to the requests picking k2
+	if calls := len(upstream.calls(currentWeatherPath)); calls != 1 {
+		t.Errorf("upstream calls = %d, want 1", calls)
+	}
+}
@@ -0,0 +1,172 @@
+package weather
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// maxBatchFetches is the maximum number of locations fetched at the same time by the /weather/batch endpoint.
+const maxBatchFetches = 4
+
+// BatchHandler is an HTTP handler function that fetches the current weather of several locations in one request.
+// The request body is a JSON array of {"lat": <latitude>, "lon": <longitude>} objects with at most the configured
+// MaxBatchSize elements. It accepts the same lang and units parameters and X-API-Key header as WeatherHandler.
+// The whole body is validated before anything is fetched: a body that is not an array, an empty or oversized array,
+// or elements whose coordinates are missing, not numbers or out of range result in a Bad Request status code (400)
+// listing every problem, with fields such as "locations[2].lat" naming the offending element.
+// The response is a JSON array with one entry per location in request order, shaped like the locations of
+// /weather/compare. Locations that fail are reported in their error field; when all of them fail, the error is
+// reported like in WeatherHandler. The locations are fetched concurrently, at most maxBatchFetches at a time.
+func BatchHandler(w http.ResponseWriter, r *http.Request) {
+	// Reject methods other than POST, advertising the supported one in the Allow header
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	// Validate the body and the parameters, reporting all problems in a single response
+	cfg := currentConfig()
+	v := &validator{}
+	locations := parseBatch(v, body, cfg)
+	opts := parseFetchOptions(v, r, cfg)
+	if !v.valid() {
+		v.write(w)
+		return
+	}
+
+	// Create a context with the configured timeout of the endpoint shared by all fetches
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout(EndpointBatch))
+	defer cancel()
+
+	errs := fetchBatch(ctx, locations, opts, getWeatherWithContext)
+
+	// Only fail the whole request when no location could be fetched
+	if countErrors(errs) == len(errs) {
+		writeFetchError(w, errors.Join(errs...))
+		return
+	}
+	for i, err := range errs {
+		if err != nil {
+			locations[i].Error, _ = describeFetchError(err)
+			continue
+		}
+		// Translate the unit labels into the requested language; the numbers stay the same
+		localizeWeatherData(locations[i].Weather, opts.lang)
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	json.NewEncoder(w).Encode(locations)
+}
+
+// parseBatch is a helper function that decodes and validates the body of a batch request against the given
+// configuration. Problems are recorded in v under the "locations" field for the array as a whole and under
+// "locations[<index>].lat" or "locations[<index>].lon" for single elements, with codes such as missing_lat or
+// lat_out_of_range that do not depend on the index. Elements are only checked once the size of the array is valid.
+// With the configured LenientCoordinates, longitudes beyond the antimeridian are wrapped, see normalizeLongitude.
+func parseBatch(v *validator, body []byte, cfg *Config) []ComparedLocation {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(body, &elements); err != nil || elements == nil {
+		v.invalid("locations", `Invalid request body, it must be a JSON array of {"lat": <latitude>, "lon": <longitude>} objects`)
+		return nil
+	}
+	switch {
+	case len(elements) == 0:
+		v.missing("locations", "The batch must contain at least one location")
+		return nil
+	case len(elements) > cfg.MaxBatchSize:
+		v.outOfRange("locations", fmt.Sprintf("The batch contains %d locations, at most %d are allowed", len(elements), cfg.MaxBatchSize))
+		return nil
+	}
+
+	locations := make([]ComparedLocation, len(elements))
+	for i, element := range elements {
+		field := fmt.Sprintf("locations[%d]", i)
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(element, &members); err != nil || members == nil {
+			v.add(field, "invalid_location", fmt.Sprintf(`Invalid %s, it must be an object like {"lat": 51.5, "lon": -0.12}`, field))
+			continue
+		}
+		lat := parseBatchCoordinate(v, members, field, "lat", "latitude", 90, false)
+		lon := parseBatchCoordinate(v, members, field, "lon", "longitude", 180, cfg.LenientCoordinates)
+		locations[i] = ComparedLocation{Lat: lat, Lon: lon}
+	}
+	return locations
+}
+
+// parseBatchCoordinate is a helper function that validates the named coordinate of a batch element the same way as
+// parseCoordinate validates query parameters, except that the value must be a JSON number: strings such as "51.5"
+// and null are rejected rather than converted. Problems are recorded in v under "<element>.<name>".
+func parseBatchCoordinate(v *validator, members map[string]json.RawMessage, element, name, label string, limit float64, wrap bool) float64 {
+	field := element + "." + name
+	raw, ok := members[name]
+	if !ok {
+		v.add(field, "missing_"+name, fmt.Sprintf("Missing %s in %s", label, element))
+		return 0
+	}
+	var coordinate float64
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) || json.Unmarshal(raw, &coordinate) != nil {
+		v.add(field, "invalid_"+name, fmt.Sprintf("Invalid %s in %s, it must be a number", label, element))
+		return 0
+	}
+	if wrap {
+		if wrapped, ok := normalizeLongitude(coordinate, true); ok {
+			return wrapped
+		}
+	}
+	if !inRange(coordinate, limit) {
+		v.add(field, name+"_out_of_range", fmt.Sprintf("Invalid %s in %s, it must be between %v and %v", label, element, -limit, limit))
+	}
+	return coordinate
+}
+
+// fetchBatch is a helper function that fetches the weather of every location with fetch, running at most
+// maxBatchFetches fetches at a time, and stores it in the location. It returns the error of every location in the
+// same order, nil for the ones that succeeded. Locations still waiting for a slot when ctx is done fail with its error.
+func fetchBatch(ctx context.Context, locations []ComparedLocation, opts fetchOptions, fetch weatherFetcher) []error {
+	errs := make([]error, len(locations))
+	slots := make(chan struct{}, maxBatchFetches)
+	var wg sync.WaitGroup
+	for i := range locations {
+		wg.Add(1)
+		go func(location *ComparedLocation, err *error) {
+			defer wg.Done()
+
+			// Wait for a free slot, giving up once the overall deadline has passed
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				*err = ctx.Err()
+				return
+			}
+
+			location.Weather, *err = fetch(ctx, location.Lat, location.Lon, opts)
+		}(&locations[i], &errs[i])
+	}
+	wg.Wait()
+	return errs
+}
+
+// countErrors is a helper function that returns the number of non-nil errors.
+func countErrors(errs []error) int {
+	count := 0
+	for _, err := range errs {
+		if err != nil {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,181 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBatchHandlerValidation(t *testing.T) {
+	// field is a problem expected in the response, without its message
+	type field struct{ name, code string }
+	tests := []struct {
+		name    string
+		target  string
+		body    string
+		lenient bool
+		want    []field
+	}{
+		{name: "not JSON", body: `lat=51.51`, want: []field{{"locations", "invalid_locations"}}},
+		{name: "object instead of array", body: `{"lat":51.51,"lon":-0.13}`, want: []field{{"locations", "invalid_locations"}}},
+		{name: "null", body: `null`, want: []field{{"locations", "invalid_locations"}}},
+		{name: "empty body", body: ``, want: []field{{"locations", "invalid_locations"}}},
+		{name: "empty array", body: `[]`, want: []field{{"locations", "missing_locations"}}},
+		{
+			name: "oversized batch",
+			body: `[{"lat":1,"lon":1},{"lat":2,"lon":2},{"lat":3,"lon":3},{"lat":91,"lon":4}]`,
+			want: []field{{"locations", "locations_out_of_range"}},
+		},
+		{name: "element not an object", body: `[{"lat":51.51,"lon":-0.13},[51.51,-0.13]]`, want: []field{{"locations[1]", "invalid_location"}}},
+		{name: "null element", body: `[null]`, want: []field{{"locations[0]", "invalid_location"}}},
+		{name: "missing coordinates", body: `[{}]`, want: []field{{"locations[0].lat", "missing_lat"}, {"locations[0].lon", "missing_lon"}}},
+		{name: "coordinate as string", body: `[{"lat":"51.51","lon":-0.13}]`, want: []field{{"locations[0].lat", "invalid_lat"}}},
+		{name: "null coordinate", body: `[{"lat":51.51,"lon":null}]`, want: []field{{"locations[0].lon", "invalid_lon"}}},
+		{
+			name: "coordinates out of range",
+			body: `[{"lat":51.51,"lon":-0.13},{"lat":-90.5,"lon":0},{"lat":0,"lon":181}]`,
+			want: []field{{"locations[1].lat", "lat_out_of_range"}, {"locations[2].lon", "lon_out_of_range"}},
+		},
+		{name: "longitude wrapped only when lenient", body: `[{"lat":0,"lon":181}]`, lenient: true},
+		{name: "latitude never wrapped", body: `[{"lat":91,"lon":0}]`, lenient: true, want: []field{{"locations[0].lat", "lat_out_of_range"}}},
+		{
+			name:   "body and parameters together",
+			target: "/weather/batch?units=kelvin",
+			body:   `[{"lat":"north","lon":0}]`,
+			want:   []field{{"locations[0].lat", "invalid_lat"}, {"units", "invalid_units"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) {
+				cfg.MaxBatchSize = 3
+				cfg.LenientCoordinates = tt.lenient
+			})
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+			target := tt.target
+			if target == "" {
+				target = "/weather/batch"
+			}
+			recorder := httptest.NewRecorder()
+
+			BatchHandler(recorder, httptest.NewRequest(http.MethodPost, target, strings.NewReader(tt.body)))
+
+			if tt.want == nil {
+				if recorder.Code != http.StatusOK {
+					t.Errorf("status = %d, want %d; body %s", recorder.Code, http.StatusOK, recorder.Body)
+				}
+				return
+			}
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, http.StatusBadRequest, recorder.Body)
+			}
+			var errs []FieldError
+			if err := json.Unmarshal(recorder.Body.Bytes(), &errs); err != nil {
+				t.Fatal(err)
+			}
+			var got []field
+			for _, err := range errs {
+				got = append(got, field{err.Field, err.Code})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %v, want %v", got, tt.want)
+			}
+			if calls := upstream.calls(currentWeatherPath); len(calls) != 0 {
+				t.Errorf("invalid batch made %d upstream calls", len(calls))
+			}
+		})
+	}
+}
+
+func TestBatchHandler(t *testing.T) {
+	// Reference https://openweathermap.org/current - Built-in API request by geographic coordinates section;
+	// Reykjavik reports freezing fog, every latitude not listed here is an unknown location
+	const reykjavik = `{"coord":{"lon":-21.9426,"lat":64.1466},"weather":[{"id":741,"main":"Fog","description":"fog","icon":"50n"}],` +
+		`"main":{"temp":-2.5,"feels_like":-6.1,"pressure":1012,"humidity":96},"wind":{"speed":3.2,"deg":90},` +
+		`"dt":1717243200,"timezone":0,"name":"Reykjavik"}`
+	bodies := map[string]string{"51.510000": sampleCurrentWeather, "64.146600": reykjavik}
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		wantStatus int
+		want       []string // Temperature or error of every location
+	}{
+		{
+			name:       "all succeed in request order",
+			body:       `[{"lat":64.1466,"lon":-21.9426},{"lat":51.51,"lon":-0.13}]`,
+			wantStatus: http.StatusOK,
+			want:       []string{"-2.5 Celsius", "18.4 Celsius"},
+		},
+		{
+			name:       "partial failure",
+			body:       `[{"lat":51.51,"lon":-0.13},{"lat":10,"lon":10},{"lat":64.1466,"lon":-21.9426}]`,
+			wantStatus: http.StatusOK,
+			want:       []string{"18.4 Celsius", "Location not found", "-2.5 Celsius"},
+		},
+		{
+			name:       "imperial labels",
+			target:     "/weather/batch?units=imperial",
+			body:       `[{"lat":51.51,"lon":-0.13}]`,
+			wantStatus: http.StatusOK,
+			want:       []string{"18.4 Fahrenheit"},
+		},
+		{name: "all fail", body: `[{"lat":10,"lon":10},{"lat":20,"lon":20}]`, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+				body, ok := bodies[r.URL.Query().Get("lat")]
+				if !ok {
+					respond(http.StatusNotFound, `{"cod":"404","message":"city not found"}`)(w, r)
+					return
+				}
+				respond(http.StatusOK, body)(w, r)
+			}})
+			target := tt.target
+			if target == "" {
+				target = "/weather/batch"
+			}
+			recorder := httptest.NewRecorder()
+
+			BatchHandler(recorder, httptest.NewRequest(http.MethodPost, target, strings.NewReader(tt.body)))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.want == nil {
+				return
+			}
+			var locations []ComparedLocation
+			if err := json.Unmarshal(recorder.Body.Bytes(), &locations); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, location := range locations {
+				if location.Weather != nil {
+					got = append(got, location.Weather.Temperature)
+				} else {
+					got = append(got, location.Error)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("locations = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchHandlerMethod(t *testing.T) {
+	setupTest(t)
+
+	recorder := serve(BatchHandler, http.MethodGet, "/weather/batch", nil)
+
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != "POST" {
+		t.Errorf("status = %d, Allow = %q; want %d and POST", recorder.Code, recorder.Header().Get("Allow"), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,214 @@
+package weather
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache is implemented by every weather data cache backend.
+// Get returns the cached data for key and whether it was found and still valid; Set stores data under key for ttl.
+// Implementations must be safe for concurrent use. The in-memory MemoryCache is used by default; a shared backend
+// such as Redis can be plugged in with SetCache when several instances should share one cache.
+type Cache interface {
+	Get(key string) (*WeatherData, bool)
+	Set(key string, data *WeatherData, ttl time.Duration)
+}
+
+// StaleCache is implemented by cache backends that can still hand out expired entries.
+// GetStale returns the data cached for key if it expired no longer than maxStaleness ago, so that it can be served
+// while the upstream is failing. Backends without it simply get no stale fallback.
+type StaleCache interface {
+	GetStale(key string, maxStaleness time.Duration) (*WeatherData, bool)
+}
+
+// RevalidatingCache is implemented by cache backends that can tell when an entry expired, as needed for serving
+// entries while they are refreshed in the background, see Config.StaleWhileRevalidate.
+// Peek returns the data cached for key, whether it expired or not, together with its expiry time. It must neither
+// remove the entry nor count as a lookup in the statistics. Backends without it are never revalidated in the background.
+type RevalidatingCache interface {
+	Peek(key string) (*WeatherData, time.Time, bool)
+}
+
+// CacheStats describes the effectiveness of a cache backend, as reported by the /admin/cache/stats endpoint.
+type CacheStats struct {
+	Hits      uint64  `json:"hits"`      // Lookups answered from the cache
+	Misses    uint64  `json:"misses"`    // Lookups that found no valid entry
+	HitRatio  float64 `json:"hit_ratio"` // Share of lookups answered from the cache, 0 before the first lookup
+	Entries   int     `json:"entries"`   // Entries currently held, including expired ones kept for the stale fallback
+	Evictions uint64  `json:"evictions"` // Entries removed because they expired or to make room for new ones
+}
+
+// StatsCache is implemented by cache backends that keep statistics and can be emptied by operators.
+type StatsCache interface {
+	Stats() CacheStats
+	Flush()
+}
+
+// activeCache is the cache backend used by the fetch path.
+var (
+	cacheMu     sync.RWMutex
+	activeCache Cache = NewMemoryCache()
+)
+
+// SetCache replaces the cache backend used by the fetch path.
+func SetCache(c Cache) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	activeCache = c
+}
+
+// currentCache returns the cache backend used by the fetch path.
+func currentCache() Cache {
+	cacheMu.RLock()
+	defer cacheMu.RUnlock()
+	return activeCache
+}
+
+// memoryCacheEntry is a cached value together with the time it expires.
+type memoryCacheEntry struct {
+	data      WeatherData
+	expiresAt time.Time
+}
+
+// DefaultMemoryCacheMaxEntries is the number of entries a MemoryCache holds at most.
+const DefaultMemoryCacheMaxEntries = 10000
+
+// MemoryCache is an in-process Cache, StaleCache, RevalidatingCache and StatsCache backend. Expired entries are kept
+// for the stale fallback and the background revalidation as long as the configured MaxStaleness or
+// StaleWhileRevalidate may still serve them, and removed when they are looked up after that. A cache holding
+// DefaultMemoryCacheMaxEntries entries first drops every such entry to make room for a new one, and then the entry
+// expiring soonest.
+type MemoryCache struct {
+	mu         sync.Mutex
+	entries    map[string]memoryCacheEntry
+	maxEntries int
+
+	// Statistics are updated atomically so that reading them never waits for the lock
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// NewMemoryCache creates an empty in-memory cache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]memoryCacheEntry), maxEntries: DefaultMemoryCacheMaxEntries}
+}
+
+// staleRetention is a helper function that returns how long expired entries may still be served, the longer of the
+// configured MaxStaleness and StaleWhileRevalidate.
+func staleRetention() time.Duration {
+	cfg := currentConfig()
+	return max(cfg.MaxStaleness, cfg.StaleWhileRevalidate)
+}
+
+// expired is a helper function that reports whether an entry can no longer be served at all, even as stale data.
+func (e memoryCacheEntry) expired(retention time.Duration) bool {
+	return now().After(e.expiresAt.Add(retention))
+}
+
+// Get returns a copy of the cached data for key if it exists and has not expired.
+// An entry that expired too long ago to be served as stale data is removed.
+func (c *MemoryCache) Get(key string) (*WeatherData, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok && entry.expired(staleRetention()) {
+		delete(c.entries, key)
+		c.evictions.Add(1)
+	}
+	if !ok || now().After(entry.expiresAt) {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	data := entry.data
+	return &data, true
+}
+
+// GetStale returns a copy of the cached data for key if it exists and expired no longer than maxStaleness ago.
+// Entries that are too old to ever be served are removed.
+func (c *MemoryCache) GetStale(key string, maxStaleness time.Duration) (*WeatherData, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if entry.expired(maxStaleness) {
+		delete(c.entries, key)
+		c.evictions.Add(1)
+		return nil, false
+	}
+	data := entry.data
+	return &data, true
+}
+
+// Peek returns a copy of the cached data for key and its expiry time, whether it expired or not.
+func (c *MemoryCache) Peek(key string) (*WeatherData, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	data := entry.data
+	return &data, entry.expiresAt, true
+}
+
+// Set stores a copy of data under key until ttl has elapsed, making room for it first when the cache is full.
+func (c *MemoryCache) Set(key string, data *WeatherData, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.makeRoom()
+	}
+	c.entries[key] = memoryCacheEntry{data: *data, expiresAt: now().Add(ttl)}
+}
+
+// makeRoom is a helper function that removes the entries that can no longer be served, or the entry expiring soonest
+// when every entry can still be served. The caller must hold the lock.
+func (c *MemoryCache) makeRoom() {
+	retention := staleRetention()
+	var soonest string
+	for key, entry := range c.entries {
+		if entry.expired(retention) {
+			delete(c.entries, key)
+			c.evictions.Add(1)
+		} else if soonest == "" || entry.expiresAt.Before(c.entries[soonest].expiresAt) {
+			soonest = key
+		}
+	}
+	if len(c.entries) >= c.maxEntries {
+		delete(c.entries, soonest)
+		c.evictions.Add(1)
+	}
+}
+
+// Stats returns the lookup counters since the cache was created and the current number of entries.
+func (c *MemoryCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	stats := CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Entries:   entries,
+		Evictions: c.evictions.Load(),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+// Flush removes every entry, so that the next lookups fetch fresh data. The statistics are kept.
+func (c *MemoryCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]memoryCacheEntry)
+}
@@ -0,0 +1,460 @@
+package weather
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		maxStaleness  time.Duration
+		revalidate    time.Duration // StaleWhileRevalidate
+		elapsed       time.Duration
+		wantHit       bool
+		wantEvictions uint64 // Entries removed by the lookup, which can no longer be served even as stale data
+	}{
+		{name: "fresh", maxStaleness: time.Hour, elapsed: 0, wantHit: true},
+		{name: "just before expiry", maxStaleness: time.Hour, elapsed: 10*time.Minute - time.Second, wantHit: true},
+		{name: "at expiry", maxStaleness: time.Hour, elapsed: 10 * time.Minute, wantHit: true},
+		{name: "expired", maxStaleness: time.Hour, elapsed: 10*time.Minute + time.Second, wantHit: false},
+		{name: "kept for the stale fallback", maxStaleness: time.Hour, elapsed: 70 * time.Minute},
+		{name: "beyond the stale fallback", maxStaleness: time.Hour, elapsed: 70*time.Minute + time.Second, wantEvictions: 1},
+		{name: "kept for revalidation", revalidate: 2 * time.Hour, elapsed: 2 * time.Hour},
+		{name: "beyond the revalidation window", maxStaleness: time.Hour, revalidate: 2 * time.Hour, elapsed: 3 * time.Hour, wantEvictions: 1},
+		{name: "nothing served stale", elapsed: 10*time.Minute + time.Second, wantEvictions: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) {
+				cfg.MaxStaleness = tt.maxStaleness
+				cfg.StaleWhileRevalidate = tt.revalidate
+			})
+			SetClock(FixedClock(start))
+			cache := NewMemoryCache()
+			cache.Set("key", &WeatherData{Temperature: "18.4 Celsius"}, 10*time.Minute)
+
+			SetClock(FixedClock(start.Add(tt.elapsed)))
+			got, ok := cache.Get("key")
+
+			if ok != tt.wantHit {
+				t.Fatalf("Get() found %v, want %v", ok, tt.wantHit)
+			}
+			if ok && got.Temperature != "18.4 Celsius" {
+				t.Errorf("Get() = %+v, want the stored data", got)
+			}
+			stats := cache.Stats()
+			if stats.Evictions != tt.wantEvictions || stats.Entries != 1-int(tt.wantEvictions) {
+				t.Errorf("stats = %+v, want %d evictions", stats, tt.wantEvictions)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheMaxEntries(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		ttls          map[string]time.Duration // Entries stored at the start, with their TTL
+		elapsed       time.Duration            // Time between storing them and storing "new"
+		wantKept      []string
+		wantEvictions uint64
+	}{
+		{
+			name:          "soonest expiring entry dropped",
+			ttls:          map[string]time.Duration{"a": 30 * time.Minute, "b": 10 * time.Minute, "c": 20 * time.Minute},
+			wantKept:      []string{"a", "c", "new"},
+			wantEvictions: 1,
+		},
+		{
+			name:          "entries beyond the stale fallback dropped first",
+			ttls:          map[string]time.Duration{"a": 10 * time.Minute, "b": 10 * time.Minute, "c": 3 * time.Hour},
+			elapsed:       2 * time.Hour,
+			wantKept:      []string{"c", "new"},
+			wantEvictions: 2,
+		},
+		{
+			name:     "overwriting an entry makes no room",
+			ttls:     map[string]time.Duration{"a": 10 * time.Minute, "b": 20 * time.Minute, "new": 30 * time.Minute},
+			wantKept: []string{"a", "b", "new"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetClock(FixedClock(start))
+			cache := NewMemoryCache()
+			cache.maxEntries = 3
+			for key, ttl := range tt.ttls {
+				cache.Set(key, &WeatherData{Temperature: key}, ttl)
+			}
+
+			SetClock(FixedClock(start.Add(tt.elapsed)))
+			cache.Set("new", &WeatherData{Temperature: "new"}, 10*time.Minute)
+
+			var kept []string
+			for _, key := range []string{"a", "b", "c", "new"} {
+				if _, _, ok := cache.Peek(key); ok {
+					kept = append(kept, key)
+				}
+			}
+			if strings.Join(kept, ",") != strings.Join(tt.wantKept, ",") {
+				t.Errorf("kept %q, want %q", kept, tt.wantKept)
+			}
+			if got := cache.Stats().Evictions; got != tt.wantEvictions {
+				t.Errorf("evictions = %d, want %d", got, tt.wantEvictions)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheReturnsCopies(t *testing.T) {
+	setupTest(t)
+	cache := NewMemoryCache()
+	data := &WeatherData{Temperature: "18.4 Celsius"}
+	cache.Set("key", data, time.Minute)
+
+	data.Temperature = "changed after Set"
+	got, _ := cache.Get("key")
+	got.Temperature = "changed after Get"
+
+	if again, _ := cache.Get("key"); again.Temperature != "18.4 Celsius" {
+		t.Errorf("cached temperature = %q, want it unaffected by changes to stored or returned data", again.Temperature)
+	}
+}
+
+// mapCache is a minimal Cache backend standing in for a shared one such as Redis, without expiry or stale entries.
+type mapCache struct {
+	mu      sync.Mutex
+	entries map[string]WeatherData
+	sets    int
+}
+
+func (c *mapCache) Get(key string) (*WeatherData, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.entries[key]
+	return &data, ok
+}
+
+func (c *mapCache) Set(key string, data *WeatherData, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = *data
+	c.sets++
+}
+
+func TestSetCache(t *testing.T) {
+	setupTest(t)
+	cache := &mapCache{entries: map[string]WeatherData{}}
+	SetCache(cache)
+	configure(t, func(cfg *Config) { cfg.MinFetchInterval = 0 })
+	upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+	for i := 0; i < 3; i++ {
+		if recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil); recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+		}
+	}
+
+	if got := len(upstream.calls(currentWeatherPath)); got != 1 || cache.sets != 1 {
+		t.Errorf("upstream calls = %d, cache sets = %d; want both 1 with later requests answered by the plugged-in cache", got, cache.sets)
+	}
+}
+
+func TestMemoryCacheGetStale(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		key     string
+		elapsed time.Duration // Time since the entry was stored with a TTL of 10 minutes
+		wantHit bool
+	}{
+		{name: "fresh", key: "key", elapsed: time.Minute, wantHit: true},
+		{name: "expired within the staleness", key: "key", elapsed: 30 * time.Minute, wantHit: true},
+		{name: "at the staleness limit", key: "key", elapsed: 70 * time.Minute, wantHit: true},
+		{name: "beyond the staleness", key: "key", elapsed: 70*time.Minute + time.Second},
+		{name: "never stored", key: "other", elapsed: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetClock(FixedClock(start))
+			cache := NewMemoryCache()
+			cache.Set("key", &WeatherData{Temperature: "18.4 Celsius"}, 10*time.Minute)
+
+			SetClock(FixedClock(start.Add(tt.elapsed)))
+			got, ok := cache.GetStale(tt.key, time.Hour)
+
+			if ok != tt.wantHit {
+				t.Fatalf("GetStale() found %v, want %v", ok, tt.wantHit)
+			}
+			if ok && got.Temperature != "18.4 Celsius" {
+				t.Errorf("GetStale() = %+v, want the stored data", got)
+			}
+			if _, kept := cache.entries["key"]; kept != (tt.key != "key" || tt.wantHit) {
+				t.Errorf("entry kept = %v, want it dropped only once it is too old to be served", kept)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerServesStale(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		cache        Cache
+		maxStaleness time.Duration
+		elapsed      time.Duration    // Time between the first request and the failing one, the cache TTL is 10 minutes
+		failure      http.HandlerFunc // Upstream response to the second request
+		wantStatus   int
+		wantXCache   string
+	}{
+		{name: "stale entry served", maxStaleness: time.Hour, elapsed: 30 * time.Minute, failure: respond(http.StatusInternalServerError, `{}`), wantStatus: http.StatusOK, wantXCache: "STALE"},
+		{name: "rate limited", maxStaleness: time.Hour, elapsed: 30 * time.Minute, failure: respond(http.StatusTooManyRequests, `{"cod":429}`), wantStatus: http.StatusOK, wantXCache: "STALE"},
+		{name: "too stale", maxStaleness: time.Hour, elapsed: 2 * time.Hour, failure: respond(http.StatusInternalServerError, `{}`), wantStatus: http.StatusBadGateway},
+		{name: "stale fallback disabled", elapsed: 30 * time.Minute, failure: respond(http.StatusInternalServerError, `{}`), wantStatus: http.StatusBadGateway},
+		{name: "location gone", maxStaleness: time.Hour, elapsed: 30 * time.Minute, failure: respond(http.StatusNotFound, `{"cod":"404","message":"city not found"}`), wantStatus: http.StatusNotFound},
+		{name: "backend without stale entries", cache: noStaleCache{NewMemoryCache()}, maxStaleness: time.Hour, elapsed: 30 * time.Minute, failure: respond(http.StatusInternalServerError, `{}`), wantStatus: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			RetryBackoff = time.Millisecond
+			if tt.cache != nil {
+				SetCache(tt.cache)
+			}
+			configure(t, func(cfg *Config) {
+				cfg.CacheTTL = 10 * time.Minute
+				cfg.MaxStaleness = tt.maxStaleness
+			})
+			var failing atomic.Bool
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+				if failing.Load() {
+					tt.failure(w, r)
+					return
+				}
+				respond(http.StatusOK, sampleCurrentWeather)(w, r)
+			}})
+			SetClock(FixedClock(start))
+			if recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil); recorder.Code != http.StatusOK {
+				t.Fatalf("first request status = %d; body %s", recorder.Code, recorder.Body)
+			}
+
+			SetClock(FixedClock(start.Add(tt.elapsed)))
+			failing.Store(true)
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if got := recorder.Header().Get("X-Cache"); got != tt.wantXCache {
+				t.Errorf("X-Cache = %q, want %q", got, tt.wantXCache)
+			}
+			if tt.wantXCache != "" && !strings.Contains(recorder.Body.String(), `"temperature":"18.4 Celsius"`) {
+				t.Errorf("body %s, want the cached data", recorder.Body)
+			}
+		})
+	}
+}
+
+// noStaleCache hides every method of a cache backend but those of Cache, like a backend without expired entries.
+type noStaleCache struct{ cache Cache }
+
+func (c noStaleCache) Get(key string) (*WeatherData, bool) { return c.cache.Get(key) }
+func (c noStaleCache) Set(key string, data *WeatherData, ttl time.Duration) {
+	c.cache.Set(key, data, ttl)
+}
+
+func TestOfflineMode(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		target     string
+		warmed     bool          // Whether the location was fetched before going offline
+		elapsed    time.Duration // Time between the warming and the offline request
+		wantStatus int
+		wantXCache string
+	}{
+		{name: "cache hit", handler: WeatherHandler, target: "/weather?lat=51.51&lon=-0.13", warmed: true, elapsed: time.Minute, wantStatus: http.StatusOK},
+		{name: "cache miss", handler: WeatherHandler, target: "/weather?lat=48.86&lon=2.35", warmed: true, wantStatus: http.StatusServiceUnavailable},
+		{name: "other options miss", handler: WeatherHandler, target: "/weather?lat=51.51&lon=-0.13&units=imperial", warmed: true, wantStatus: http.StatusServiceUnavailable},
+		{name: "expired entry served stale", handler: WeatherHandler, target: "/weather?lat=51.51&lon=-0.13", warmed: true, elapsed: 30 * time.Minute, wantStatus: http.StatusOK, wantXCache: "STALE"},
+		{name: "expired entry too old", handler: WeatherHandler, target: "/weather?lat=51.51&lon=-0.13", warmed: true, elapsed: 2 * time.Hour, wantStatus: http.StatusServiceUnavailable},
+		{name: "endpoint without cache", handler: GeocodeHandler, target: "/geocode?city=London", wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{
+				currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather),
+				geocodingPath:      respond(http.StatusOK, sampleGeocoding),
+			})
+			SetClock(FixedClock(start))
+			if tt.warmed {
+				if recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil); recorder.Code != http.StatusOK {
+					t.Fatalf("warming status = %d; body %s", recorder.Code, recorder.Body)
+				}
+			}
+			configure(t, func(cfg *Config) {
+				cfg.CacheTTL = 10 * time.Minute
+				cfg.MaxStaleness = time.Hour
+				cfg.Offline = true
+			})
+			SetClock(FixedClock(start.Add(tt.elapsed)))
+			warmingCalls := len(upstream.calls(currentWeatherPath))
+
+			recorder := serve(tt.handler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if got := recorder.Header().Get("X-Cache"); got != tt.wantXCache {
+				t.Errorf("X-Cache = %q, want %q", got, tt.wantXCache)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(recorder.Body.String(), `"temperature":"18.4 Celsius"`) {
+				t.Errorf("body %s, want the cached weather", recorder.Body)
+			}
+			if calls := len(upstream.calls(currentWeatherPath)) - warmingCalls + len(upstream.calls(geocodingPath)); calls != 0 {
+				t.Errorf("offline request made %d upstream calls", calls)
+			}
+		})
+	}
+}
+
+func TestMemoryCachePeek(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	setupTest(t)
+	SetClock(FixedClock(start))
+	cache := NewMemoryCache()
+	cache.Set("key", &WeatherData{Temperature: "18.4 Celsius"}, 10*time.Minute)
+
+	// Long expired entries are still returned, without counting as lookups
+	SetClock(FixedClock(start.Add(24 * time.Hour)))
+	got, expiresAt, ok := cache.Peek("key")
+	if !ok || got.Temperature != "18.4 Celsius" || !expiresAt.Equal(start.Add(10*time.Minute)) {
+		t.Errorf("Peek() = %+v, %v, %v; want the stored data expiring at %v", got, expiresAt, ok, start.Add(10*time.Minute))
+	}
+	got.Temperature = "changed after Peek"
+	if again, _, _ := cache.Peek("key"); again.Temperature != "18.4 Celsius" {
+		t.Errorf("cached temperature = %q, want it unaffected by changes to peeked data", again.Temperature)
+	}
+	if _, _, ok := cache.Peek("other"); ok {
+		t.Error("Peek() found a key that was never stored")
+	}
+	if stats := cache.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("Stats() = %+v, want no lookups counted", stats)
+	}
+}
+
+// waitForRefresh is a helper function that waits for the background fetch of the default options for the coordinates
+// to finish, if one is in flight.
+func waitForRefresh(lat, lon float64) {
+	flightGroup.Do(cacheKey(lat, lon, fetchOptions{}.withDefaults()), func() (interface{}, error) { return nil, nil })
+}
+
+func TestWeatherHandlerStaleWhileRevalidate(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	warmer := strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":21`, 1)
+	tests := []struct {
+		name        string
+		cache       Cache
+		window      time.Duration
+		elapsed     time.Duration    // Time between the first request and the second one, the cache TTL is 10 minutes
+		refresh     http.HandlerFunc // Upstream response to every later call
+		wantXCache  string
+		wantTemp    string // Temperature of the second response
+		wantRefresh bool   // Whether the data is refreshed in the background, and served to the third request
+	}{
+		{name: "fresh", window: 5 * time.Minute, elapsed: 5 * time.Minute, refresh: respond(http.StatusOK, warmer), wantTemp: "18.4 Celsius"},
+		{name: "at expiry", window: 5 * time.Minute, elapsed: 10 * time.Minute, refresh: respond(http.StatusOK, warmer), wantTemp: "18.4 Celsius"},
+		{name: "stale with refresh", window: 5 * time.Minute, elapsed: 12 * time.Minute, refresh: respond(http.StatusOK, warmer), wantXCache: "STALE", wantTemp: "18.4 Celsius", wantRefresh: true},
+		{name: "at the end of the window", window: 5 * time.Minute, elapsed: 15 * time.Minute, refresh: respond(http.StatusOK, warmer), wantXCache: "STALE", wantTemp: "18.4 Celsius", wantRefresh: true},
+		{name: "fully expired", window: 5 * time.Minute, elapsed: 15*time.Minute + time.Second, refresh: respond(http.StatusOK, warmer), wantTemp: "21.0 Celsius"},
+		{name: "window disabled", elapsed: 12 * time.Minute, refresh: respond(http.StatusOK, warmer), wantTemp: "21.0 Celsius"},
+		{name: "backend without expiry times", cache: noStaleCache{NewMemoryCache()}, window: 5 * time.Minute, elapsed: 12 * time.Minute, refresh: respond(http.StatusOK, warmer), wantTemp: "21.0 Celsius"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if tt.cache != nil {
+				SetCache(tt.cache)
+			}
+			configure(t, func(cfg *Config) {
+				cfg.CacheTTL = 10 * time.Minute
+				cfg.StaleWhileRevalidate = tt.window
+			})
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+			SetClock(FixedClock(start))
+			serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			SetClock(FixedClock(start.Add(tt.elapsed)))
+			upstream.handle(currentWeatherPath, tt.refresh)
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			if got := recorder.Header().Get("X-Cache"); got != tt.wantXCache {
+				t.Errorf("X-Cache = %q, want %q", got, tt.wantXCache)
+			}
+			if want := `"temperature":"` + tt.wantTemp + `"`; !strings.Contains(recorder.Body.String(), want) {
+				t.Errorf("body %s, want %s", recorder.Body, want)
+			}
+			if !tt.wantRefresh {
+				want := 1
+				if tt.wantTemp == "21.0 Celsius" {
+					want = 2
+				}
+				if calls := len(upstream.calls(currentWeatherPath)); calls != want {
+					t.Errorf("upstream calls = %d, want %d", calls, want)
+				}
+				return
+			}
+
+			waitForRefresh(51.51, -0.13)
+			refreshed := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+			if refreshed.Header().Get("X-Cache") != "" || !strings.Contains(refreshed.Body.String(), `"temperature":"21.0 Celsius"`) {
+				t.Errorf("response after the refresh = %s with X-Cache %q, want the fresh data", refreshed.Body, refreshed.Header().Get("X-Cache"))
+			}
+			if calls := len(upstream.calls(currentWeatherPath)); calls != 2 {
+				t.Errorf("upstream calls = %d, want 2", calls)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerStaleWhileRevalidateFailure(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	setupTest(t)
+	captureLog(t)
+	MaxUpstreamAttempts = 1
+	configure(t, func(cfg *Config) {
+		cfg.CacheTTL = 10 * time.Minute
+		cfg.StaleWhileRevalidate = 5 * time.Minute
+	})
+	upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+	SetClock(FixedClock(start))
+	serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+	// A failed refresh leaves the stale data in place, so it keeps being served while the window lasts
+	SetClock(FixedClock(start.Add(12 * time.Minute)))
+	upstream.handle(currentWeatherPath, respond(http.StatusInternalServerError, `{}`))
+	for i := 0; i < 2; i++ {
+		recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+		if recorder.Code != http.StatusOK || recorder.Header().Get("X-Cache") != "STALE" || !strings.Contains(recorder.Body.String(), `"temperature":"18.4 Celsius"`) {
+			t.Errorf("response %d = %d %s with X-Cache %q, want the stale data", i, recorder.Code, recorder.Body, recorder.Header().Get("X-Cache"))
+		}
+		waitForRefresh(51.51, -0.13)
+	}
+	if calls := len(upstream.calls(currentWeatherPath)); calls != 3 {
+		t.Errorf("upstream calls = %d, want the first fetch and one refresh per stale response", calls)
+	}
+}
@@ -0,0 +1,16 @@
+package weather
+
+import "net/http"
+
+// Middleware wraps a handler with behavior shared by every endpoint, such as LoggingMiddleware.
+type Middleware func(next http.Handler) http.Handler
+
+// Chain wraps h in the given middleware. The first middleware is the outermost one: it sees the request first and the
+// response last, so Chain(h, a, b) handles requests as a(b(h)). List middleware that must observe everything, such as
+// logging, first, and middleware that shapes the request for the handlers, such as body limits, last.
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
@@ -0,0 +1,155 @@
+package weather
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	// tracing is a middleware that records when it sees the request and when it sees the response
+	tracing := func(name string, trace *[]string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				*trace = append(*trace, name+" in")
+				next.ServeHTTP(w, r)
+				*trace = append(*trace, name+" out")
+			})
+		}
+	}
+	// rejecting is a middleware that answers the request itself without calling the next handler
+	rejecting := func(name string, trace *[]string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				*trace = append(*trace, name+" rejects")
+				w.WriteHeader(http.StatusForbidden)
+			})
+		}
+	}
+	tests := []struct {
+		name       string
+		middleware func(trace *[]string) []Middleware
+		wantStatus int
+		want       []string
+	}{
+		{name: "no middleware", middleware: func(trace *[]string) []Middleware { return nil }, wantStatus: http.StatusOK, want: []string{"handler"}},
+		{
+			name:       "one middleware",
+			middleware: func(trace *[]string) []Middleware { return []Middleware{tracing("a", trace)} },
+			wantStatus: http.StatusOK,
+			want:       []string{"a in", "handler", "a out"},
+		},
+		{
+			name: "first middleware is the outermost",
+			middleware: func(trace *[]string) []Middleware {
+				return []Middleware{tracing("a", trace), tracing("b", trace), tracing("c", trace)}
+			},
+			wantStatus: http.StatusOK,
+			want:       []string{"a in", "b in", "c in", "handler", "c out", "b out", "a out"},
+		},
+		{
+			name: "middleware answering the request",
+			middleware: func(trace *[]string) []Middleware {
+				return []Middleware{tracing("a", trace), rejecting("b", trace), tracing("c", trace)}
+			},
+			wantStatus: http.StatusForbidden,
+			want:       []string{"a in", "b rejects", "a out"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var trace []string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { trace = append(trace, "handler") })
+			recorder := httptest.NewRecorder()
+
+			Chain(handler, tt.middleware(&trace)...).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/weather", nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if strings.Join(trace, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("trace = %q, want %q", trace, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainServerMiddleware(t *testing.T) {
+	const minBytes = 100
+	logging := Middleware(LoggingMiddleware)
+	compression := func(next http.Handler) http.Handler { return CompressionMiddleware(minBytes, next) }
+	maxBody := func(next http.Handler) http.Handler { return MaxBodyMiddleware(16, next) }
+	tests := []struct {
+		name           string
+		middleware     []Middleware
+		method         string
+		target         string
+		body           string
+		wantStatus     int
+		wantCompressed bool
+		wantLogged     bool // Whether the log line reports the size of the compressed body
+	}{
+		// The order used by main: logging sees the response as sent over the wire
+		{
+			name:           "logging outside compression",
+			middleware:     []Middleware{logging, compression, maxBody},
+			method:         http.MethodGet,
+			target:         "/weather?lat=51.51&lon=-0.13",
+			wantStatus:     http.StatusOK,
+			wantCompressed: true,
+			wantLogged:     true,
+		},
+		{
+			name:           "logging inside compression",
+			middleware:     []Middleware{compression, logging, maxBody},
+			method:         http.MethodGet,
+			target:         "/weather?lat=51.51&lon=-0.13",
+			wantStatus:     http.StatusOK,
+			wantCompressed: true,
+		},
+		// A body rejected by the innermost middleware is still logged by the outermost one
+		{
+			name:       "body too large",
+			middleware: []Middleware{logging, compression, maxBody},
+			method:     http.MethodPost,
+			target:     "/weather/batch",
+			body:       `[{"lat":51.51,"lon":-0.13}]`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			logs := captureLog(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+			mux := http.NewServeMux()
+			mux.HandleFunc("/weather", WeatherHandler)
+			mux.HandleFunc("/weather/batch", BatchHandler)
+			request := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			request.Header.Set("Accept-Encoding", "gzip")
+			recorder := httptest.NewRecorder()
+
+			Chain(mux, tt.middleware...).ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if compressed := recorder.Header().Get("Content-Encoding") == "gzip"; compressed != tt.wantCompressed {
+				t.Errorf("Content-Encoding = %q, want compressed %v", recorder.Header().Get("Content-Encoding"), tt.wantCompressed)
+			}
+			if !strings.Contains(logs.String(), "status="+strconv.Itoa(tt.wantStatus)) {
+				t.Errorf("log %q, want the status %d", logs, tt.wantStatus)
+			}
+			sent := fmt.Sprintf("bytes=%d ", recorder.Body.Len())
+			if tt.wantCompressed && strings.Contains(logs.String(), sent) != tt.wantLogged {
+				t.Errorf("log %q, want %s logged %v", logs, sent, tt.wantLogged)
+			}
+			if tt.wantStatus != http.StatusOK && len(upstream.calls(currentWeatherPath)) != 0 {
+				t.Errorf("rejected request called the upstream")
+			}
+		})
+	}
+}
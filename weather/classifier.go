@@ -0,0 +1,46 @@
+package weather
+
+import "sync"
+
+// Classifier is implemented by every scheme that sorts weather into the categories reported as WeatherType, so that
+// applications can plug in their own, e.g. activity-based or clothing recommendations, with SetClassifier.
+// Classify is called by the fetch path once the rest of the weather data has been filled in, and its result is
+// cached together with the data.
+type Classifier interface {
+	Classify(weatherData WeatherData) string
+}
+
+// DefaultClassifier is the Classifier used unless another one is set. It sorts the temperature into "cold" (up to
+// 10 Celsius), "moderate" (up to 25 Celsius) and "hot" whatever the requested units.
+type DefaultClassifier struct{}
+
+// Classify returns the temperature category of the weather data.
+func (DefaultClassifier) Classify(weatherData WeatherData) string {
+	return classifyWeather(weatherData.TemperatureCelsius())
+}
+
+// TemperatureCelsius returns the temperature of the weather data in Celsius, whatever units it was fetched in.
+func (d WeatherData) TemperatureCelsius() float64 {
+	return toCelsius(d.temperature, d.units)
+}
+
+// activeClassifier is the classifier used by the fetch path.
+var (
+	classifierMu     sync.RWMutex
+	activeClassifier Classifier = DefaultClassifier{}
+)
+
+// SetClassifier replaces the classifier used for newly fetched weather data. Data already in the cache keeps the
+// category it was fetched with until it expires.
+func SetClassifier(c Classifier) {
+	classifierMu.Lock()
+	defer classifierMu.Unlock()
+	activeClassifier = c
+}
+
+// currentClassifier returns the classifier used by the fetch path.
+func currentClassifier() Classifier {
+	classifierMu.RLock()
+	defer classifierMu.RUnlock()
+	return activeClassifier
+}
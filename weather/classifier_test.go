@@ -0,0 +1,159 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// clothingClassifier recommends what to wear, recording the weather data it is asked to classify.
+type clothingClassifier struct {
+	mu   sync.Mutex
+	seen []WeatherData
+}
+
+func (c *clothingClassifier) Classify(weatherData WeatherData) string {
+	c.mu.Lock()
+	c.seen = append(c.seen, weatherData)
+	c.mu.Unlock()
+	switch {
+	case strings.Contains(weatherData.WeatherDescription, "rain"):
+		return "umbrella"
+	case weatherData.TemperatureCelsius() < 15:
+		return "jacket"
+	}
+	return "t-shirt"
+}
+
+func TestDefaultClassifier(t *testing.T) {
+	tests := []struct {
+		temperature float64
+		units       string
+		want        string
+	}{
+		{temperature: -5, units: UnitsMetric, want: "cold"},
+		{temperature: 10, units: UnitsMetric, want: "cold"},
+		{temperature: 10.1, units: UnitsMetric, want: "moderate"},
+		{temperature: 25, units: UnitsMetric, want: "moderate"},
+		{temperature: 25.1, units: UnitsMetric, want: "hot"},
+		{temperature: 50, units: UnitsImperial, want: "cold"},
+		{temperature: 77, units: UnitsImperial, want: "moderate"},
+		{temperature: 80, units: UnitsImperial, want: "hot"},
+		{temperature: 283.15, units: UnitsStandard, want: "cold"},
+		{temperature: 300, units: UnitsStandard, want: "hot"},
+	}
+	for _, tt := range tests {
+		if got := (DefaultClassifier{}).Classify(WeatherData{temperature: tt.temperature, units: tt.units}); got != tt.want {
+			t.Errorf("Classify(%v %s) = %q, want %q", tt.temperature, tt.units, got, tt.want)
+		}
+	}
+}
+
+func TestWeatherHandlerClassifier(t *testing.T) {
+	rainy := strings.Replace(sampleOneCall, "broken clouds", "light rain", 1)
+	tests := []struct {
+		name       string
+		classifier bool // Whether the clothing classifier replaces the default one
+		provider   Provider
+		version    string
+		path       string
+		body       string
+		units      string
+		want       string
+	}{
+		{name: "default", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather, units: UnitsMetric, want: "moderate"},
+		{name: "current weather", classifier: true, provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather, units: UnitsMetric, want: "t-shirt"},
+		// 18.4 Fahrenheit is freezing, so the classifier must see the temperature in Celsius
+		{name: "imperial units", classifier: true, provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather, units: UnitsImperial, want: "jacket"},
+		{name: "one call", classifier: true, provider: OpenWeatherMapProvider{}, version: OWMAPIVersion30, path: oneCallPath, body: rainy, units: UnitsMetric, want: "umbrella"},
+		{name: "open-meteo", classifier: true, provider: OpenMeteoProvider{}, version: OWMAPIVersion25, path: openMeteoPath, body: sampleOpenMeteo, units: UnitsMetric, want: "t-shirt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			providersMu.Lock()
+			providers = []Provider{tt.provider}
+			providersMu.Unlock()
+			classifier := &clothingClassifier{}
+			if tt.classifier {
+				SetClassifier(classifier)
+			}
+			newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13&units="+tt.units, nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.WeatherType != tt.want {
+				t.Errorf("weather type = %q, want %q", got.WeatherType, tt.want)
+			}
+			if !tt.classifier {
+				return
+			}
+			// The classifier is called once the rest of the data is filled in
+			if len(classifier.seen) != 1 || classifier.seen[0].Humidity == "" || classifier.seen[0].WindSpeed == "" || classifier.seen[0].WeatherType != "" {
+				t.Errorf("classifier saw %+v, want one complete observation", classifier.seen)
+			}
+		})
+	}
+}
+
+func TestOneCallHandlerClassifier(t *testing.T) {
+	// The sample extended by a chilly hour and a rainy day
+	forecasts := `"hourly":[{"dt":1717246800,"temp":12.5,"humidity":70,"weather":[{"description":"few clouds"}]}],` +
+		`"daily":[{"dt":1717239600,"temp":{"day":19.2,"min":11.5,"max":21.3},"weather":[{"description":"moderate rain"}],"rain":4.2}],`
+	setupTest(t)
+	SetClassifier(&clothingClassifier{})
+	newUpstream(t, map[string]http.HandlerFunc{oneCallPath: respond(http.StatusOK, strings.Replace(sampleOneCall, `"current":`, forecasts+`"current":`, 1))})
+
+	recorder := serve(OneCallHandler, http.MethodGet, "/onecall?lat=51.51&lon=-0.13", nil)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+	}
+	var data OneCallData
+	if err := json.Unmarshal(recorder.Body.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	if data.Current != nil {
+		got = append(got, data.Current.WeatherType)
+	}
+	for _, hour := range data.Hourly {
+		got = append(got, hour.WeatherType)
+	}
+	for _, day := range data.Daily {
+		got = append(got, day.WeatherType)
+	}
+	if want := []string{"t-shirt", "jacket", "umbrella"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("current, hourly and daily weather types = %q, want %q", got, want)
+	}
+}
+
+func TestSetClassifierKeepsCachedData(t *testing.T) {
+	setupTest(t)
+	upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+	serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+	SetClassifier(&clothingClassifier{})
+	cached := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+	fresh := serve(WeatherHandler, http.MethodGet, "/weather?lat=48.86&lon=2.35", nil)
+
+	if !strings.Contains(cached.Body.String(), `"weather_type":"moderate"`) {
+		t.Errorf("cached body %s, want the category it was fetched with", cached.Body)
+	}
+	if !strings.Contains(fresh.Body.String(), `"weather_type":"t-shirt"`) {
+		t.Errorf("fresh body %s, want the category of the new classifier", fresh.Body)
+	}
+	if calls := len(upstream.calls(currentWeatherPath)); calls != 2 {
+		t.Errorf("upstream calls = %d, want 2", calls)
+	}
+}
@@ -0,0 +1,40 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// GetWeather retrieves the current weather for the given latitude and longitude in metric units.
+// It is the library entry point for Go programs that want weather data without running the HTTP server,
+// and it uses the same fetch path as WeatherHandler: the registered providers are tried in order and
+// concurrent identical calls share one upstream request. The call is bounded by ctx.
+func GetWeather(ctx context.Context, lat, lon float64) (*WeatherData, error) {
+	return GetWeatherWithUnits(ctx, lat, lon, UnitsMetric)
+}
+
+// GetWeatherWithUnits is like GetWeather but returns temperatures in the given unit system,
+// which must be one of UnitsMetric, UnitsImperial or UnitsStandard.
+func GetWeatherWithUnits(ctx context.Context, lat, lon float64, units string) (*WeatherData, error) {
+	if !validUnits(units) {
+		return nil, fmt.Errorf("weather: unsupported units %q", units)
+	}
+	return getWeatherWithContext(ctx, lat, lon, fetchOptions{units: units})
+}
+
+// ErrAPIKeyRejected is returned by ValidateAPIKey when OpenWeatherMap rejects the configured API key.
+var ErrAPIKeyRejected = errors.New("weather: OpenWeatherMap rejected the API key")
+
+// ValidateAPIKey makes one lightweight call to OpenWeatherMap with the configured default API key to check that it works.
+// The call bypasses the cache and the fallback providers. It returns ErrAPIKeyRejected when the key is refused,
+// and the underlying error when the check could not be completed, e.g. because the upstream is unreachable.
+func ValidateAPIKey(ctx context.Context) error {
+	_, err := getWeather(ctx, 0, 0, fetchOptions{}.withDefaults())
+	var statusErr *upstreamStatusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusUnauthorized {
+		return ErrAPIKeyRejected
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetWeatherWithUnits(t *testing.T) {
+	tests := []struct {
+		units           string
+		wantTemperature string
+		wantErr         bool
+	}{
+		{units: UnitsMetric, wantTemperature: "18.4 Celsius"},
+		{units: UnitsImperial, wantTemperature: "18.4 Fahrenheit"},
+		{units: UnitsStandard, wantTemperature: "18.4 Kelvin"},
+		{units: "celsius", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.units, func(t *testing.T) {
+			setupTest(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			got, err := GetWeatherWithUnits(context.Background(), 51.51, -0.13, tt.units)
+
+			calls := upstream.calls(currentWeatherPath)
+			if tt.wantErr {
+				if err == nil || len(calls) != 0 {
+					t.Fatalf("GetWeatherWithUnits(%q) = %v, %d upstream calls; want an error without calls", tt.units, err, len(calls))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The upstream converts the temperature, which the sample leaves at the same number in every unit system
+			if got.Temperature != tt.wantTemperature || len(calls) != 1 || calls[0].Query().Get("units") != tt.units {
+				t.Errorf("temperature %q after calls %v, want %q from one call with units=%s", got.Temperature, calls, tt.wantTemperature, tt.units)
+			}
+		})
+	}
+}
+
+func TestValidateAPIKey(t *testing.T) {
+	rejected := `{"cod":401,"message":"Invalid API key. Please see https://openweathermap.org/faq#error401 for more info."}`
+	tests := []struct {
+		name     string
+		version  string
+		path     string
+		upstream http.HandlerFunc
+		wantErr  error
+	}{
+		{name: "accepted", version: OWMAPIVersion25, path: currentWeatherPath, upstream: respond(http.StatusOK, sampleCurrentWeather)},
+		{name: "rejected", version: OWMAPIVersion25, path: currentWeatherPath, upstream: respond(http.StatusUnauthorized, rejected), wantErr: ErrAPIKeyRejected},
+		{name: "rejected by one call", version: OWMAPIVersion30, path: oneCallPath, upstream: respond(http.StatusUnauthorized, rejected), wantErr: ErrAPIKeyRejected},
+		{name: "upstream unavailable", version: OWMAPIVersion25, path: currentWeatherPath, upstream: respond(http.StatusServiceUnavailable, `{}`), wantErr: ErrUpstreamUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			RetryBackoff = time.Millisecond
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			upstream := newUpstream(t, map[string]http.HandlerFunc{
+				currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather),
+				oneCallPath:        respond(http.StatusOK, sampleOneCall),
+			})
+			// A cached answer must not hide a key that stopped working
+			if recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=0&lon=0", nil); recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			upstream.handle(tt.path, tt.upstream)
+
+			err := ValidateAPIKey(context.Background())
+
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("ValidateAPIKey() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == ErrUpstreamUnavailable && errors.Is(err, ErrAPIKeyRejected) {
+				t.Errorf("ValidateAPIKey() reported an unavailable upstream as a rejected key")
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package weather
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// trustedProxies lists the networks of the load balancers and proxies whose forwarding headers are honored.
+// It is empty by default, so forwarding headers are ignored unless proxies are configured.
+var (
+	trustedProxiesMu sync.RWMutex
+	trustedProxies   []netip.Prefix
+)
+
+// ParseTrustedProxies parses a comma-separated list of CIDR ranges such as "10.0.0.0/8,192.168.1.10" into the form
+// taken by SetTrustedProxies. A bare address stands for that single address.
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// SetTrustedProxies replaces the networks whose X-Forwarded-For and X-Real-IP headers are honored by clientIP.
+// Forwarding headers from any other peer are ignored, since a client could otherwise spoof its address.
+func SetTrustedProxies(prefixes []netip.Prefix) {
+	trustedProxiesMu.Lock()
+	defer trustedProxiesMu.Unlock()
+	trustedProxies = prefixes
+}
+
+// isTrustedProxy is a helper function that reports whether addr belongs to one of the trusted proxy networks.
+func isTrustedProxy(addr netip.Addr) bool {
+	trustedProxiesMu.RLock()
+	defer trustedProxiesMu.RUnlock()
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is a helper function that returns the address of the client that sent the request.
+// Forwarding headers are only honored when the direct peer is a trusted proxy. X-Forwarded-For is then read from
+// right to left, skipping the trusted proxies that appended to it, so the first other address is the client as seen
+// by the outermost trusted proxy; entries further left were supplied by the client and cannot be trusted.
+// Without X-Forwarded-For, a valid X-Real-IP is used. In every other case the peer address of the connection is returned.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !isTrustedProxy(peer) {
+		return host
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				// A malformed entry cannot be attributed to anyone, so fall back to the peer address
+				break
+			}
+			if !isTrustedProxy(hop) || i == 0 {
+				return hop.Unmap().String()
+			}
+		}
+		return host
+	}
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap().String()
+	}
+	return host
+}
@@ -0,0 +1,106 @@
+package weather
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []netip.Prefix
+		wantErr bool
+	}{
+		{value: ""},
+		{value: "10.0.0.0/8", want: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+		{value: " 10.1.2.3/8 , 192.168.1.10,,", want: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.1.10/32")}},
+		{value: "::ffff:192.168.1.10", want: []netip.Prefix{netip.MustParsePrefix("192.168.1.10/32")}},
+		{value: "2001:db8::/32", want: []netip.Prefix{netip.MustParsePrefix("2001:db8::/32")}},
+		{value: "10.0.0.0/33", wantErr: true},
+		{value: "10.0.0.0/8,load-balancer", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTrustedProxies(tt.value)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTrustedProxies(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:51234", want: "203.0.113.7"},
+		{name: "untrusted peer with forwarding headers", remoteAddr: "203.0.113.7:51234", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1"}, "X-Real-Ip": {"198.51.100.2"}}, want: "203.0.113.7"},
+		{name: "trusted proxy without headers", remoteAddr: "10.0.0.5:443", want: "10.0.0.5"},
+		{name: "trusted proxy with X-Forwarded-For", remoteAddr: "10.0.0.5:443", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, want: "198.51.100.1"},
+		{name: "spoofed entries left of the client", remoteAddr: "10.0.0.5:443", headers: map[string][]string{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1"}}, want: "198.51.100.1"},
+		{name: "chain of trusted proxies", remoteAddr: "10.0.0.5:443", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1, 10.0.0.9", "10.0.0.8"}}, want: "198.51.100.1"},
+		{name: "only trusted proxies", remoteAddr: "10.0.0.5:443", headers: map[string][]string{"X-Forwarded-For": {"10.0.0.9, 10.0.0.8"}}, want: "10.0.0.9"},
+		{name: "malformed X-Forwarded-For", remoteAddr: "10.0.0.5:443", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1, unknown"}}, want: "10.0.0.5"},
+		{name: "trusted proxy with X-Real-IP", remoteAddr: "10.0.0.5:443", headers: map[string][]string{"X-Real-Ip": {" 198.51.100.2 "}}, want: "198.51.100.2"},
+		{name: "malformed X-Real-IP", remoteAddr: "10.0.0.5:443", headers: map[string][]string{"X-Real-Ip": {"client"}}, want: "10.0.0.5"},
+		{name: "X-Forwarded-For wins over X-Real-IP", remoteAddr: "10.0.0.5:443", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1"}, "X-Real-Ip": {"198.51.100.2"}}, want: "198.51.100.1"},
+		{name: "IPv6 client of a trusted proxy", remoteAddr: "[2001:db8::5]:443", headers: map[string][]string{"X-Forwarded-For": {"2001:db8:1::7"}}, want: "2001:db8:1::7"},
+		{name: "mapped IPv4 client", remoteAddr: "10.0.0.5:443", headers: map[string][]string{"X-Forwarded-For": {"::ffff:198.51.100.1"}}, want: "198.51.100.1"},
+		{name: "peer without a port", remoteAddr: "203.0.113.7", want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			trusted, err := ParseTrustedProxies("10.0.0.0/8,2001:db8::/48")
+			if err != nil {
+				t.Fatal(err)
+			}
+			SetTrustedProxies(trusted)
+			r := httptest.NewRequest(http.MethodGet, "/weather", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.headers {
+				r.Header[name] = values
+			}
+
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggingMiddlewareClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted string
+		want    string
+	}{
+		{name: "untrusted peer", want: "client=192.0.2.1 "},
+		{name: "trusted peer", trusted: "192.0.2.0/24", want: "client=198.51.100.1 "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			trusted, err := ParseTrustedProxies(tt.trusted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			SetTrustedProxies(trusted)
+			logs := captureLog(t)
+			// httptest requests come from 192.0.2.1
+			r := httptest.NewRequest(http.MethodGet, "/weather", nil)
+			r.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+			LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), r)
+
+			if !strings.Contains(logs.String(), tt.want) {
+				t.Errorf("log %q does not contain %s", logs, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package weather
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time. Time-dependent behavior such as cache expiry, smoothing state, day and night detection
+// and timezone offsets reads the time through the active Clock, so it can be pinned with SetClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the default Clock, backed by time.Now.
+type realClock struct{}
+
+// Now returns the current wall-clock time.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock is a Clock that always reports the same time, e.g. SetClock(FixedClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))).
+type FixedClock time.Time
+
+// Now returns the fixed time.
+func (c FixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// activeClock is the clock used by the package.
+var (
+	clockMu     sync.RWMutex
+	activeClock Clock = realClock{}
+)
+
+// SetClock replaces the clock used by the package. A nil clock restores the real clock.
+func SetClock(c Clock) {
+	if c == nil {
+		c = realClock{}
+	}
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	activeClock = c
+}
+
+// now is a helper function that returns the current time according to the active clock.
+func now() time.Time {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
+	return activeClock.Now()
+}
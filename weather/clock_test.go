@@ -0,0 +1,73 @@
+package weather
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSetClock(t *testing.T) {
+	fixed := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		clock     Clock
+		wantFixed bool
+	}{
+		{name: "fixed", clock: FixedClock(fixed), wantFixed: true},
+		{name: "nil restores the real clock", clock: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetClock(FixedClock(fixed.Add(-time.Hour)))
+
+			SetClock(tt.clock)
+
+			got := now()
+			if tt.wantFixed && !got.Equal(fixed) {
+				t.Errorf("now() = %v, want %v", got, fixed)
+			}
+			if !tt.wantFixed && time.Since(got).Abs() > time.Minute {
+				t.Errorf("now() = %v, want the current time", got)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerFollowsClock(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		elapsed     time.Duration // Time passed between the two requests
+		wantCalls   int
+		wantExpires time.Duration // Expiry of the second response, after start
+	}{
+		{name: "within the cache TTL", elapsed: defaultCacheTTL - time.Second, wantCalls: 1, wantExpires: defaultCacheTTL},
+		{name: "past the cache TTL", elapsed: defaultCacheTTL + time.Second, wantCalls: 2, wantExpires: 2*defaultCacheTTL + time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			for i, at := range []time.Time{start, start.Add(tt.elapsed)} {
+				SetClock(FixedClock(at))
+				recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+				if recorder.Code != http.StatusOK {
+					t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+				}
+				expires := start.Add(defaultCacheTTL)
+				if i > 0 {
+					expires = start.Add(tt.wantExpires)
+				}
+				if got, want := recorder.Header().Get("Expires"), expires.Format(http.TimeFormat); got != want {
+					t.Errorf("Expires = %q, want %q", got, want)
+				}
+			}
+
+			if got := len(upstream.calls(currentWeatherPath)); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
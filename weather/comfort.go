@@ -0,0 +1,91 @@
+package weather
+
+import "math"
+
+// Thresholds selecting the index behind the comfort level. The heat index is only defined from 80 Fahrenheit and the
+// wind chill only up to 10 Celsius with winds above 4.8 km/h, following the definitions of the US National Weather
+// Service and Environment Canada; in between, the air temperature itself is used.
+const (
+	heatIndexFrom     = 80.0 // Fahrenheit
+	windChillUpTo     = 10.0 // Celsius
+	windChillMinSpeed = 4.8  // Kilometers per hour
+)
+
+// comfortLevels maps apparent temperatures in Celsius onto the labels reported as ComfortLevel, loosely following
+// the heat index caution categories of the National Weather Service on the warm side.
+var comfortLevels = []struct {
+	below float64
+	label string
+}{
+	{-10, "frigid"},
+	{0, "cold"},
+	{10, "chilly"},
+	{27, "comfortable"},
+	{32, "warm"},
+	{41, "muggy"},
+}
+
+// comfortLevel is a helper function that describes how the weather feels, e.g. "comfortable" or "frigid", from the
+// temperature in Celsius, the relative humidity in percent and the wind speed in meters per second.
+// The heat index is used at heatIndexFrom and above and the wind chill at windChillUpTo and below, see
+// apparentTemperature. It returns an empty label when the reading the selected index needs is missing.
+func comfortLevel(temperature, humidity float64, hasHumidity bool, windSpeed float64, hasWind bool) string {
+	apparent, ok := apparentTemperature(temperature, humidity, hasHumidity, windSpeed, hasWind)
+	if !ok {
+		return ""
+	}
+	for _, level := range comfortLevels {
+		if apparent < level.below {
+			return level.label
+		}
+	}
+	return "oppressive"
+}
+
+// apparentTemperature is a helper function that returns the temperature in Celsius the weather feels like: the heat
+// index for hot weather, which needs the humidity, the wind chill for cold weather, which needs the wind speed, and
+// the air temperature otherwise. It reports false when the needed reading is missing. Cold weather with winds too
+// light for the wind chill feels like the air temperature.
+func apparentTemperature(temperature, humidity float64, hasHumidity bool, windSpeed float64, hasWind bool) (float64, bool) {
+	switch {
+	case fromCelsius(temperature, UnitsImperial) >= heatIndexFrom:
+		if !hasHumidity {
+			return 0, false
+		}
+		return heatIndex(temperature, humidity), true
+	case temperature <= windChillUpTo:
+		if !hasWind {
+			return 0, false
+		}
+		if kmh := windSpeed * 3.6; kmh > windChillMinSpeed {
+			return windChill(temperature, kmh), true
+		}
+	}
+	return temperature, true
+}
+
+// heatIndex is a helper function that calculates the heat index in Celsius from the temperature in Celsius and the
+// relative humidity in percent with the regression of Rothfusz (1990) and the adjustments used by the National
+// Weather Service, falling back to Steadman's simple formula where the regression does not apply.
+func heatIndex(temperature, humidity float64) float64 {
+	t, rh := fromCelsius(temperature, UnitsImperial), humidity
+	if simple := 0.5 * (t + 61 + (t-68)*1.2 + rh*0.094); (simple+t)/2 < heatIndexFrom {
+		return toCelsius(simple, UnitsImperial)
+	}
+	hi := -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh - 0.00683783*t*t - 0.05481717*rh*rh +
+		0.00122874*t*t*rh + 0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+	switch {
+	case rh < 13 && t >= 80 && t <= 112:
+		hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+	case rh > 85 && t >= 80 && t <= 87:
+		hi += (rh - 85) / 10 * (87 - t) / 5
+	}
+	return toCelsius(hi, UnitsImperial)
+}
+
+// windChill is a helper function that calculates the wind chill in Celsius from the temperature in Celsius and the
+// wind speed in kilometers per hour with the formula of Environment Canada and the National Weather Service (2001).
+func windChill(temperature, windSpeed float64) float64 {
+	v := math.Pow(windSpeed, 0.16)
+	return 13.12 + 0.6215*temperature - 11.37*v + 0.3965*temperature*v
+}
@@ -0,0 +1,176 @@
+package weather
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHeatIndex(t *testing.T) {
+	// Reference values from the heat index chart of the National Weather Service, in Fahrenheit
+	tests := []struct {
+		temperature, humidity, want float64
+	}{
+		{temperature: 80, humidity: 40, want: 80},
+		{temperature: 86, humidity: 90, want: 105},
+		{temperature: 90, humidity: 70, want: 106},
+		{temperature: 100, humidity: 40, want: 109},
+		{temperature: 104, humidity: 55, want: 137},
+	}
+	for _, tt := range tests {
+		got := fromCelsius(heatIndex(toCelsius(tt.temperature, UnitsImperial), tt.humidity), UnitsImperial)
+		if math.Abs(got-tt.want) > 1 {
+			t.Errorf("heatIndex(%v F, %v%%) = %.1f F, want %v F", tt.temperature, tt.humidity, got, tt.want)
+		}
+	}
+}
+
+func TestWindChill(t *testing.T) {
+	// Reference values from the wind chill chart of Environment Canada
+	tests := []struct {
+		temperature, windSpeed, want float64
+	}{
+		{temperature: 0, windSpeed: 10, want: -3},
+		{temperature: -10, windSpeed: 20, want: -18},
+		{temperature: -20, windSpeed: 30, want: -33},
+		{temperature: -35, windSpeed: 40, want: -54},
+	}
+	for _, tt := range tests {
+		if got := windChill(tt.temperature, tt.windSpeed); math.Abs(got-tt.want) > 0.5 {
+			t.Errorf("windChill(%v C, %v km/h) = %.1f C, want %v C", tt.temperature, tt.windSpeed, got, tt.want)
+		}
+	}
+}
+
+func TestComfortLevel(t *testing.T) {
+	tests := []struct {
+		name        string
+		temperature float64
+		humidity    float64 // Missing when negative
+		windSpeed   float64 // Missing when negative
+		want        string
+	}{
+		{name: "mild", temperature: 18.4, humidity: 64, windSpeed: 4.1, want: "comfortable"},
+		{name: "mild without humidity or wind", temperature: 18.4, humidity: -1, windSpeed: -1, want: "comfortable"},
+		// 80 Fahrenheit is 26.67 Celsius
+		{name: "just below the heat index", temperature: 26.6, humidity: -1, windSpeed: 4.1, want: "comfortable"},
+		{name: "heat index without humidity", temperature: 26.7, humidity: -1, windSpeed: 4.1},
+		{name: "heat index of dry air", temperature: 27, humidity: 40, windSpeed: -1, want: "comfortable"},
+		{name: "warm", temperature: 30, humidity: 50, windSpeed: 4.1, want: "warm"},
+		{name: "muggy", temperature: 32, humidity: 50, windSpeed: 4.1, want: "muggy"},
+		{name: "oppressive", temperature: 35, humidity: 60, windSpeed: 4.1, want: "oppressive"},
+		{name: "just above the wind chill", temperature: 10.1, humidity: 64, windSpeed: -1, want: "comfortable"},
+		{name: "wind chill without wind", temperature: 10, humidity: 64, windSpeed: -1},
+		// 4.8 km/h is 1.33 meters per second, the air temperature applies up to it
+		{name: "light wind", temperature: 5, humidity: 64, windSpeed: 4.8 / 3.6, want: "chilly"},
+		{name: "wind chill", temperature: 2, humidity: 64, windSpeed: 3, want: "cold"},
+		{name: "calm and cold", temperature: -10, humidity: 64, windSpeed: 0, want: "cold"},
+		{name: "calm and frigid", temperature: -10.1, humidity: 64, windSpeed: 0, want: "frigid"},
+		{name: "windy and frigid", temperature: -5, humidity: 64, windSpeed: 5.4, want: "frigid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := comfortLevel(tt.temperature, math.Max(tt.humidity, 0), tt.humidity >= 0, math.Max(tt.windSpeed, 0), tt.windSpeed >= 0)
+			if got != tt.want {
+				t.Errorf("comfortLevel(%v, %v, %v) = %q, want %q", tt.temperature, tt.humidity, tt.windSpeed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerComfortLevel(t *testing.T) {
+	mainOf := func(body, main string) string {
+		return strings.Replace(body, `"main":{"temp":18.4,"humidity":64}`, `"main":`+main, 1)
+	}
+	windless := strings.Replace(sampleCurrentWeather, `"wind":{"speed":4.1,"deg":250},`, "", 1)
+	tests := []struct {
+		name     string
+		provider Provider
+		version  string
+		path     string
+		body     string
+		query    string
+		want     string
+	}{
+		{name: "not asked for", path: currentWeatherPath, body: sampleCurrentWeather},
+		{name: "comfortable", path: currentWeatherPath, body: sampleCurrentWeather, query: "&comfort=true", want: "comfortable"},
+		{name: "turned off", path: currentWeatherPath, body: sampleCurrentWeather, query: "&comfort=false"},
+		{name: "muggy", path: currentWeatherPath, body: mainOf(sampleCurrentWeather, `{"temp":32,"humidity":50}`), query: "&comfort=true", want: "muggy"},
+		{name: "hot without humidity", path: currentWeatherPath, body: mainOf(sampleCurrentWeather, `{"temp":32}`), query: "&comfort=true"},
+		{name: "frigid", path: currentWeatherPath, body: mainOf(sampleCurrentWeather, `{"temp":-5,"humidity":80}`), query: "&comfort=true", want: "frigid"},
+		{name: "cold without wind", path: currentWeatherPath, body: mainOf(windless, `{"temp":-5,"humidity":80}`), query: "&comfort=true"},
+		// 95 Fahrenheit at 60 percent feels like 113 Fahrenheit
+		{name: "imperial heat", path: currentWeatherPath, body: mainOf(sampleCurrentWeather, `{"temp":95,"humidity":60}`), query: "&comfort=true&units=imperial", want: "oppressive"},
+		// 14 Fahrenheit in a wind of 12.4 mph feels like 0 Fahrenheit
+		{
+			name:  "imperial wind chill",
+			path:  currentWeatherPath,
+			body:  strings.Replace(mainOf(sampleCurrentWeather, `{"temp":14,"humidity":80}`), `"speed":4.1`, `"speed":12.4`, 1),
+			query: "&comfort=true&units=imperial",
+			want:  "frigid",
+		},
+		{
+			name:    "one call",
+			version: OWMAPIVersion30,
+			path:    oneCallPath,
+			body:    strings.Replace(sampleOneCall, `"temp":18.4,"humidity":64`, `"temp":32,"humidity":50`, 1),
+			query:   "&comfort=true",
+			want:    "muggy",
+		},
+		{
+			name:     "open-meteo",
+			provider: OpenMeteoProvider{},
+			path:     openMeteoPath,
+			body:     strings.Replace(sampleOpenMeteo, `"temperature_2m":18.4`, `"temperature_2m":-5`, 1),
+			query:    "&comfort=true",
+			want:     "frigid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if tt.version != "" {
+				configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			}
+			if tt.provider != nil {
+				providersMu.Lock()
+				providers = []Provider{tt.provider}
+				providersMu.Unlock()
+			}
+			newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13"+tt.query, nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.ComfortLevel != tt.want {
+				t.Errorf("comfort level = %q, want %q", got.ComfortLevel, tt.want)
+			}
+			if tt.want == "" && strings.Contains(recorder.Body.String(), "comfort_level") {
+				t.Errorf("body %s, want no comfort level", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerInvalidComfort(t *testing.T) {
+	setupTest(t)
+	newUpstream(t, map[string]http.HandlerFunc{})
+
+	recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13&comfort=sometimes", nil)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d; body %s", recorder.Code, http.StatusBadRequest, recorder.Body)
+	}
+	var errs []FieldError
+	if err := json.Unmarshal(recorder.Body.Bytes(), &errs); err != nil || len(errs) != 1 || errs[0].Code != "invalid_comfort" {
+		t.Errorf("errors = %s, want code invalid_comfort", recorder.Body)
+	}
+}
@@ -0,0 +1,131 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+)
+
+// ComparisonData represents the response of the /weather/compare endpoint.
+// The difference is only present when the weather of both locations could be retrieved.
+type ComparisonData struct {
+	Locations  [2]ComparedLocation `json:"locations"`            // The two queried locations, in query order
+	Difference *WeatherDifference  `json:"difference,omitempty"` // Comparison of the two locations
+}
+
+// ComparedLocation holds the coordinates of a compared location and either its weather or the reason it failed.
+type ComparedLocation struct {
+	Lat     float64      `json:"lat"`               // Latitude as queried
+	Lon     float64      `json:"lon"`               // Longitude as queried
+	Weather *WeatherData `json:"weather,omitempty"` // Current weather, when it could be retrieved
+	Error   string       `json:"error,omitempty"`   // Why the weather could not be retrieved
+}
+
+// WeatherDifference summarizes how the weather of the two compared locations differs.
+type WeatherDifference struct {
+	TemperatureDelta string `json:"temperature_delta"` // Temperature of the second location minus the first, in the requested units
+	Warmer           string `json:"warmer"`            // Which location is warmer: "first", "second" or "equal"
+}
+
+// CompareHandler is an HTTP handler function that fetches the current weather of two locations concurrently and
+// returns both side by side together with their temperature difference.
+// It expects lat1, lon1, lat2 and lon2 query parameters, plus the same lang and units parameters and X-API-Key header
+// as WeatherHandler. Invalid parameters result in a Bad Request status code (400).
+// When only one location fails, the response still succeeds and reports the failure in that location's error field;
+// when both fail, the error is reported like in WeatherHandler. Responses are always JSON.
+func CompareHandler(w http.ResponseWriter, r *http.Request) {
+	// Reject methods other than GET and HEAD, advertising the supported ones in the Allow header
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse both coordinate pairs from the request URL query parameters, reporting all problems in a single response
+	query := r.URL.Query()
+	cfg := currentConfig()
+	v := &validator{}
+	var comparison ComparisonData
+	for i := range comparison.Locations {
+		latName, lonName := fmt.Sprintf("lat%d", i+1), fmt.Sprintf("lon%d", i+1)
+		lat := parseCoordinate(v, query, latName, "latitude", 90, false)
+		lon := parseCoordinate(v, query, lonName, "longitude", 180, cfg.LenientCoordinates)
+		comparison.Locations[i] = ComparedLocation{Lat: lat, Lon: lon}
+	}
+	opts := parseFetchOptions(v, r, cfg)
+	if !v.valid() {
+		v.write(w)
+		return
+	}
+
+	// Create a context with the configured timeout of the endpoint shared by both fetches
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout(EndpointCompare))
+	defer cancel()
+
+	// Fetch both locations concurrently through the regular fetch path
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i := range comparison.Locations {
+		wg.Add(1)
+		go func(location *ComparedLocation, err *error) {
+			defer wg.Done()
+			location.Weather, *err = getWeatherWithContext(ctx, location.Lat, location.Lon, opts)
+		}(&comparison.Locations[i], &errs[i])
+	}
+	wg.Wait()
+
+	// Only fail the whole request when neither location could be fetched
+	if errs[0] != nil && errs[1] != nil {
+		writeFetchError(w, errors.Join(errs[0], errs[1]))
+		return
+	}
+	for i, err := range errs {
+		if err != nil {
+			comparison.Locations[i].Error, _ = describeFetchError(err)
+		}
+	}
+	if errs[0] == nil && errs[1] == nil {
+		comparison.Difference = compareWeather(comparison.Locations[0].Weather, comparison.Locations[1].Weather)
+	}
+
+	// Translate the unit labels into the requested language; the numbers stay the same
+	for _, location := range comparison.Locations {
+		if location.Weather != nil {
+			localizeWeatherData(location.Weather, opts.lang)
+		}
+	}
+	if comparison.Difference != nil {
+		comparison.Difference.TemperatureDelta = localizeLabel(comparison.Difference.TemperatureDelta, opts.lang)
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	json.NewEncoder(w).Encode(comparison)
+}
+
+// compareWeather is a helper function that computes the difference between the weather of two locations
+// fetched with the same units.
+func compareWeather(first, second *WeatherData) *WeatherDifference {
+	delta := second.temperature - first.temperature
+	warmer := "equal"
+	// Differences that round away at the configured precision count as equal, and are reported as 0 rather than -0
+	switch {
+	case formatNumber(math.Abs(delta)) == formatNumber(0):
+		delta = 0
+	case delta > 0:
+		warmer = "second"
+	default:
+		warmer = "first"
+	}
+	return &WeatherDifference{
+		TemperatureDelta: formatTemperature(delta, first.units),
+		Warmer:           warmer,
+	}
+}
@@ -0,0 +1,99 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompareHandler(t *testing.T) {
+	notFound := `{"cod":"404","message":"city not found"}`
+	withTemp := func(temp string) string {
+		return strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":`+temp, 1)
+	}
+	tests := []struct {
+		name          string
+		target        string
+		first, second string // Upstream bodies for the first and second location, not found when empty
+		wantStatus    int
+		wantDiff      *WeatherDifference
+		wantErrors    [2]string
+	}{
+		{
+			name:       "second warmer",
+			target:     "/weather/compare?lat1=10&lon1=10&lat2=20&lon2=20",
+			first:      withTemp("12.0"),
+			second:     withTemp("18.4"),
+			wantStatus: http.StatusOK,
+			wantDiff:   &WeatherDifference{TemperatureDelta: "6.4 Celsius", Warmer: "second"},
+		},
+		{
+			name:       "first warmer",
+			target:     "/weather/compare?lat1=10&lon1=10&lat2=20&lon2=20",
+			first:      withTemp("25"),
+			second:     withTemp("18.4"),
+			wantStatus: http.StatusOK,
+			wantDiff:   &WeatherDifference{TemperatureDelta: "-6.6 Celsius", Warmer: "first"},
+		},
+		{
+			name:       "difference rounding away",
+			target:     "/weather/compare?lat1=10&lon1=10&lat2=20&lon2=20",
+			first:      withTemp("18.41"),
+			second:     withTemp("18.4"),
+			wantStatus: http.StatusOK,
+			wantDiff:   &WeatherDifference{TemperatureDelta: "0.0 Celsius", Warmer: "equal"},
+		},
+		{
+			name:       "one location fails",
+			target:     "/weather/compare?lat1=10&lon1=10&lat2=20&lon2=20",
+			first:      sampleCurrentWeather,
+			wantStatus: http.StatusOK,
+			wantErrors: [2]string{"", "Location not found"},
+		},
+		{
+			name:       "both locations fail",
+			target:     "/weather/compare?lat1=10&lon1=10&lat2=20&lon2=20",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "missing coordinates",
+			target:     "/weather/compare?lat1=10&lon1=10",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			bodies := map[string]string{"10.000000": tt.first, "20.000000": tt.second}
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+				if body := bodies[r.URL.Query().Get("lat")]; body != "" {
+					respond(http.StatusOK, body)(w, r)
+					return
+				}
+				respond(http.StatusNotFound, notFound)(w, r)
+			}})
+
+			recorder := serve(CompareHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got ComparisonData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if (got.Difference == nil) != (tt.wantDiff == nil) || (got.Difference != nil && *got.Difference != *tt.wantDiff) {
+				t.Errorf("difference = %+v, want %+v", got.Difference, tt.wantDiff)
+			}
+			for i, location := range got.Locations {
+				if location.Error != tt.wantErrors[i] || (location.Weather == nil) != (tt.wantErrors[i] != "") {
+					t.Errorf("location %d = %+v, want error %q", i+1, location, tt.wantErrors[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package weather
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultCompressionMinBytes is the smallest response body compressed by default, 1 KB. Below it, the gzip header
+// and the CPU time spent outweigh what compression saves.
+const DefaultCompressionMinBytes = 1 << 10
+
+// CompressionMiddleware wraps a handler to gzip response bodies for clients that send Accept-Encoding: gzip.
+// Bodies smaller than minBytes are sent uncompressed: the response is buffered until it either reaches minBytes, at
+// which point compression starts, or the handler returns. Flushing, as done by StreamHandler, sends the buffered part
+// uncompressed and keeps the rest of the response that way so events are not held back. Responses that already carry
+// a Content-Encoding, responses to HEAD requests and responses without a body are sent uncompressed.
+// Every response names Accept-Encoding in its Vary header, added to whatever Vary the handler set.
+func CompressionMiddleware(minBytes int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enabled := r.Method != http.MethodHead && acceptsGzip(r.Header.Get("Accept-Encoding"))
+		writer := &compressWriter{ResponseWriter: w, minBytes: minBytes, enabled: enabled}
+		defer writer.close()
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// acceptsGzip is a helper function that reports whether an Accept-Encoding header value allows gzip, i.e. names gzip
+// or "*" without a zero quality.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(entry, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressWriter is the http.ResponseWriter of CompressionMiddleware. It holds the status code and the start of the
+// body back until it knows whether the body is large enough to be compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	minBytes int
+	enabled  bool // Whether the client accepts a gzipped body
+	status   int
+	buffer   bytes.Buffer
+	decided  bool         // Whether the headers were written and the body is being passed on
+	gzip     *gzip.Writer // Non-nil once compression started
+}
+
+// WriteHeader holds the status code back until the encoding of the body is known.
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write buffers the body until it reaches minBytes and then passes it on compressed.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.decided {
+		if w.gzip != nil {
+			return w.gzip.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buffer.Write(b)
+	if w.buffer.Len() >= w.minBytes {
+		if err := w.start(w.enabled && w.ResponseWriter.Header().Get("Content-Encoding") == ""); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends whatever was buffered uncompressed, unless compression already started, and flushes the wrapped writer.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.start(false)
+	}
+	if w.gzip != nil {
+		w.gzip.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the wrapped writer so that http.ResponseController can reach optional interfaces other than http.Flusher.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// start writes the headers, compressed or not, followed by the buffered part of the body.
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	header := w.ResponseWriter.Header()
+	header.Add("Vary", "Accept-Encoding")
+	if compress {
+		// Sniff the type of the uncompressed body, as the server would otherwise sniff the gzipped one
+		if _, ok := header["Content-Type"]; !ok {
+			header.Set("Content-Type", http.DetectContentType(w.buffer.Bytes()))
+		}
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gzip = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.gzip != nil {
+		_, err = w.gzip.Write(w.buffer.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buffer.Bytes())
+	}
+	w.buffer.Reset()
+	return err
+}
+
+// close sends a body that stayed below minBytes uncompressed, or finishes the compressed stream. A handler that wrote
+// nothing gets the headers written with the implicit OK status, so they name Accept-Encoding in Vary as well.
+func (w *compressWriter) close() {
+	switch {
+	case w.gzip != nil:
+		w.gzip.Close()
+	case !w.decided:
+		w.start(false)
+	}
+}
@@ -0,0 +1,287 @@
+package weather
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           bool
+	}{
+		{acceptEncoding: "gzip", want: true},
+		{acceptEncoding: "deflate, gzip;q=0.8, br", want: true},
+		{acceptEncoding: "GZIP", want: true},
+		{acceptEncoding: "*", want: true},
+		{acceptEncoding: "gzip;q=0", want: false},
+		{acceptEncoding: "gzip; q=0.0, br", want: false},
+		{acceptEncoding: "br, deflate", want: false},
+		{acceptEncoding: "identity", want: false},
+		{acceptEncoding: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.acceptEncoding); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.acceptEncoding, got, tt.want)
+		}
+	}
+}
+
+// gunzip is a helper function that decompresses a gzipped response body.
+func gunzip(t *testing.T, body io.Reader) string {
+	t.Helper()
+	reader, err := gzip.NewReader(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(decompressed)
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	const minBytes = 64
+	large := strings.Repeat("weather ", minBytes)
+	// writeChunks writes the body in the given pieces with the given status code, or the implicit one when zero
+	writeChunks := func(status int, contentType string, chunks ...string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if contentType != "" {
+				w.Header().Set("Content-Type", contentType)
+			}
+			if status != 0 {
+				w.WriteHeader(status)
+			}
+			for _, chunk := range chunks {
+				io.WriteString(w, chunk)
+			}
+		}
+	}
+	tests := []struct {
+		name            string
+		method          string
+		acceptEncoding  string
+		handler         http.HandlerFunc
+		wantStatus      int
+		wantCompressed  bool
+		wantBody        string
+		wantContentType string
+		wantVary        []string
+	}{
+		{
+			name:           "small body",
+			acceptEncoding: "gzip",
+			handler:        writeChunks(0, "text/plain", "sunny"),
+			wantStatus:     http.StatusOK,
+			wantBody:       "sunny",
+			wantVary:       []string{"Accept-Encoding"},
+		},
+		{
+			name:           "one byte below the threshold",
+			acceptEncoding: "gzip",
+			handler:        writeChunks(0, "text/plain", large[:minBytes-1]),
+			wantStatus:     http.StatusOK,
+			wantBody:       large[:minBytes-1],
+			wantVary:       []string{"Accept-Encoding"},
+		},
+		{
+			name:           "at the threshold",
+			acceptEncoding: "gzip",
+			handler:        writeChunks(0, "text/plain", large[:minBytes]),
+			wantStatus:     http.StatusOK,
+			wantCompressed: true,
+			wantBody:       large[:minBytes],
+			wantVary:       []string{"Accept-Encoding"},
+		},
+		{
+			name:           "large body written in pieces",
+			acceptEncoding: "gzip, br",
+			handler:        writeChunks(http.StatusNotFound, "text/plain", large[:10], large[10:100], large[100:]),
+			wantStatus:     http.StatusNotFound,
+			wantCompressed: true,
+			wantBody:       large,
+			wantVary:       []string{"Accept-Encoding"},
+		},
+		{
+			name:           "gzip not accepted",
+			acceptEncoding: "br",
+			handler:        writeChunks(0, "text/plain", large),
+			wantStatus:     http.StatusOK,
+			wantBody:       large,
+			wantVary:       []string{"Accept-Encoding"},
+		},
+		{
+			name:           "gzip refused",
+			acceptEncoding: "gzip;q=0",
+			handler:        writeChunks(0, "text/plain", large),
+			wantStatus:     http.StatusOK,
+			wantBody:       large,
+			wantVary:       []string{"Accept-Encoding"},
+		},
+		{
+			name:           "already encoded",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "br")
+				io.WriteString(w, large)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   large,
+			wantVary:   []string{"Accept-Encoding"},
+		},
+		{
+			name:           "vary of the handler",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Vary", "Accept")
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, large)
+			},
+			wantStatus:     http.StatusOK,
+			wantCompressed: true,
+			wantBody:       large,
+			wantVary:       []string{"Accept", "Accept-Encoding"},
+		},
+		// The type is sniffed from the uncompressed body rather than the gzipped one
+		{
+			name:            "sniffed content type",
+			acceptEncoding:  "gzip",
+			handler:         writeChunks(0, "", "<!DOCTYPE html><html>"+large+"</html>"),
+			wantStatus:      http.StatusOK,
+			wantCompressed:  true,
+			wantBody:        "<!DOCTYPE html><html>" + large + "</html>",
+			wantContentType: "text/html; charset=utf-8",
+			wantVary:        []string{"Accept-Encoding"},
+		},
+		{
+			name:       "no body",
+			handler:    func(w http.ResponseWriter, r *http.Request) {},
+			wantStatus: http.StatusOK,
+			wantVary:   []string{"Accept-Encoding"},
+		},
+		{
+			name:           "head",
+			method:         http.MethodHead,
+			acceptEncoding: "gzip",
+			handler:        writeChunks(0, "text/plain", large),
+			wantStatus:     http.StatusOK,
+			wantVary:       []string{"Accept-Encoding"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			// A real server, so that the headers seen are those sent over the wire
+			server := httptest.NewServer(CompressionMiddleware(minBytes, tt.handler))
+			defer server.Close()
+			request, err := http.NewRequest(method, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.acceptEncoding != "" {
+				request.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+
+			response, err := server.Client().Transport.RoundTrip(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+
+			if response.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", response.StatusCode, tt.wantStatus)
+			}
+			compressed := response.Header.Get("Content-Encoding") == "gzip"
+			if compressed != tt.wantCompressed {
+				t.Errorf("Content-Encoding = %q, want compressed %v", response.Header.Get("Content-Encoding"), tt.wantCompressed)
+			}
+			var body string
+			if compressed {
+				body = gunzip(t, response.Body)
+			} else {
+				raw, _ := io.ReadAll(response.Body)
+				body = string(raw)
+			}
+			if body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if tt.wantContentType != "" && response.Header.Get("Content-Type") != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", response.Header.Get("Content-Type"), tt.wantContentType)
+			}
+			if got := response.Header.Values("Vary"); strings.Join(got, ", ") != strings.Join(tt.wantVary, ", ") {
+				t.Errorf("Vary = %q, want %q", got, tt.wantVary)
+			}
+		})
+	}
+}
+
+func TestCompressionMiddlewareFlush(t *testing.T) {
+	handler := CompressionMiddleware(64, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "event: weather\n\n")
+		http.NewResponseController(w).Flush()
+		io.WriteString(w, strings.Repeat("data: sunny\n\n", 10))
+	}))
+	request := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, request)
+
+	// A flushed response stays uncompressed, so events are not held back by the gzip stream
+	if !recorder.Flushed || recorder.Header().Get("Content-Encoding") != "" {
+		t.Errorf("flushed %v with Content-Encoding %q, want a flushed uncompressed response", recorder.Flushed, recorder.Header().Get("Content-Encoding"))
+	}
+	if want := "event: weather\n\n" + strings.Repeat("data: sunny\n\n", 10); recorder.Body.String() != want {
+		t.Errorf("body = %q, want %q", recorder.Body, want)
+	}
+}
+
+func TestCompressionMiddlewareWeatherHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		minBytes       int
+		wantCompressed bool
+	}{
+		{name: "default threshold", minBytes: DefaultCompressionMinBytes},
+		{name: "low threshold", minBytes: 100, wantCompressed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+			request := httptest.NewRequest(http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+			request.Header.Set("Accept-Encoding", "gzip")
+			recorder := httptest.NewRecorder()
+
+			CompressionMiddleware(tt.minBytes, http.HandlerFunc(WeatherHandler)).ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			compressed := recorder.Header().Get("Content-Encoding") == "gzip"
+			if compressed != tt.wantCompressed {
+				t.Fatalf("Content-Encoding = %q for a %d byte threshold, want compressed %v", recorder.Header().Get("Content-Encoding"), tt.minBytes, tt.wantCompressed)
+			}
+			body := recorder.Body.String()
+			if compressed {
+				body = gunzip(t, recorder.Body)
+			}
+			var weatherData WeatherData
+			if err := json.Unmarshal([]byte(body), &weatherData); err != nil {
+				t.Fatal(err)
+			}
+			if weatherData.Temperature != "18.4 Celsius" || recorder.Header().Get("Content-Type") != contentTypeJSON {
+				t.Errorf("temperature %q with Content-Type %q, want the JSON weather data", weatherData.Temperature, recorder.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
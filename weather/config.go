@@ -0,0 +1,549 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default values of the reloadable settings.
+const (
+	defaultCacheTTL         = 10 * time.Minute // Matches how often OpenWeatherMap refreshes its current weather data
+	defaultSmoothingFactor  = 0.3
+	defaultMinFetchInterval = 5 * time.Second
+	defaultMaxStaleness     = time.Hour
+	defaultExtremeCold      = -10.0 // Celsius
+	defaultExtremeHot       = 40.0  // Celsius
+	defaultMaxBatchSize     = 20
+	defaultTrendDeadband    = 0.5 // Celsius
+	defaultHealthCacheTTL   = 30 * time.Second
+	defaultWriteTimeout     = 15 * time.Second
+	defaultNumberPrecision  = 1
+	maxNumberPrecision      = 6
+)
+
+// Endpoint names used as keys of Config.Timeouts.
+const (
+	EndpointWeather = "weather"
+	EndpointCompare = "compare"
+	EndpointRaw     = "raw"
+	EndpointStream  = "stream"
+	EndpointDigest  = "digest"
+	EndpointHistory = "history"
+	EndpointOneCall = "onecall"
+	EndpointGeocode = "geocode"
+	EndpointBatch   = "batch"
+	EndpointExport  = "export"
+	EndpointHealth  = "health"
+)
+
+// defaultTimeouts is how long each endpoint may take to fetch its data by default. Single lookups stay snappy, while
+// endpoints that make several upstream calls or query the slower One Call API are given more time.
+// The stream timeout applies to every event on its own. All of them stay below defaultWriteTimeout, so a fetch that
+// uses its whole budget still leaves time to write the response.
+var defaultTimeouts = map[string]time.Duration{
+	EndpointWeather: 5 * time.Second,
+	EndpointCompare: 8 * time.Second,
+	EndpointRaw:     5 * time.Second,
+	EndpointStream:  5 * time.Second,
+	EndpointDigest:  10 * time.Second,
+	EndpointHistory: 8 * time.Second,
+	EndpointOneCall: 8 * time.Second,
+	EndpointGeocode: 5 * time.Second,
+	EndpointBatch:   10 * time.Second,
+	EndpointExport:  10 * time.Second,
+	EndpointHealth:  5 * time.Second,
+}
+
+// Config holds the settings that can be changed at runtime without restarting the server.
+// A request reads the active Config once when it starts, so it sees a consistent snapshot even if a reload
+// happens while it is in flight. A Config must not be modified after it has been passed to SetConfig.
+type Config struct {
+	// CacheTTL is how long fetched weather data is served from the cache before the upstream is queried again.
+	CacheTTL time.Duration
+	// DefaultUnits is the unit system used when a request neither names one explicitly nor reveals its region
+	// through the Accept-Language header.
+	DefaultUnits string
+	// SmoothingFactor is the weight given to the newest reading when smoothing temperatures for repeated polls.
+	// Values closer to 1 follow the raw readings more closely; values closer to 0 smooth more aggressively.
+	SmoothingFactor float64
+	// MinFetchInterval is the shortest time between two upstream fetches for the same location and options.
+	// Identical requests within it are answered with the previous result, even when the cache has dropped it.
+	// Zero disables the guard.
+	MinFetchInterval time.Duration
+	// MaxStaleness is how long after expiry cached data may still be served when fetching fresh data fails, e.g.
+	// during an upstream outage. Zero disables serving stale data.
+	MaxStaleness time.Duration
+	// StaleWhileRevalidate is how long after expiry cached data is still served straight away while a background fetch
+	// refreshes it, so that requests for popular locations never wait for the upstream. CacheTTL is thus the fresh
+	// window and StaleWhileRevalidate the stale but usable one; data older than both is fetched before answering.
+	// Zero, the default, disables it.
+	StaleWhileRevalidate time.Duration
+	// ExtremeCold and ExtremeHot are the temperatures in Celsius below and above which a reading is flagged as extreme,
+	// so that clients can trigger alerts without hardcoding thresholds. They apply to every unit system.
+	ExtremeCold float64
+	ExtremeHot  float64
+	// NumberPrecision is the number of decimal places, from 0 to 6, used when formatting numeric fields such as
+	// temperature, dew point and wind speed, so that clients receive stable output like "21.3" instead of
+	// "21.34000000001". -1 formats every number with the shortest representation that round-trips it.
+	NumberPrecision int
+	// CoordinatePrecision is the number of decimal places, from 0 to 6, latitude and longitude are rounded to before
+	// they are written to logs or used as a key for caching and sharing upstream results. The default of 2 decimal
+	// places (~1km) keeps exact user locations out of logs while still grouping nearby requests together.
+	CoordinatePrecision int
+	// UpstreamCoordinatePrecision is the number of decimal places, from 0 to 6, of the latitude and longitude sent to
+	// the upstream APIs. The default of 6 decimal places (~0.1m) passes on the request as is. Fewer places keep exact
+	// user locations from the upstream, and from the upstream URLs in debug logs, at the cost of accuracy: 2 places
+	// (~1km) still tell neighborhoods apart, 1 place (~10km) only towns. Requests are already grouped by
+	// CoordinatePrecision for caching, so going below it has no effect on the cache hit rate; it only changes which
+	// point of the grouped area is queried.
+	UpstreamCoordinatePrecision int
+	// LenientCoordinates makes the endpoints wrap requested longitudes beyond the antimeridian, such as 181, into the
+	// range -180 to 180 instead of rejecting them. Latitudes outside -90 to 90 are rejected either way.
+	LenientCoordinates bool
+	// DefaultLocation is used by WeatherHandler when a request names no location at all, e.g. for a kiosk
+	// pointed at a fixed place. Explicit coordinates, ZIP codes and favorite locations always take precedence.
+	// When it is nil, requests without a location are rejected.
+	DefaultLocation *Location
+	// Geolocate makes WeatherHandler locate clients by IP address when a request names no location, as if it passed
+	// geolocate=true. It takes precedence over DefaultLocation and needs a Geolocator, see SetGeolocator.
+	Geolocate bool
+	// Offline disables every upstream call, for air-gapped test environments: data is only served from the cache,
+	// including expired entries within MaxStaleness, and anything else fails with a Service Unavailable status code (503).
+	Offline bool
+	// TrendDeadband is the largest temperature change in Celsius between two observations that is still reported as a
+	// steady trend rather than rising or falling, so that measurement noise does not flip the trend.
+	TrendDeadband float64
+	// OWMAPIVersion is the version of the OpenWeatherMap API the current weather is fetched from, one of the
+	// OWMAPIVersion constants. Each version is called at its own path and read with its own extraction logic.
+	OWMAPIVersion string
+	// HealthCacheTTL is how long the result of the upstream check made by DeepHealthHandler is reused for later probes.
+	// Zero checks the upstream on every probe.
+	HealthCacheTTL time.Duration
+	// MaxBatchSize is the largest number of locations a single request to the batch endpoint may ask for.
+	MaxBatchSize int
+	// Timeouts is how long each endpoint, keyed by the Endpoint constants, may take to fetch its data before the
+	// request fails with a Gateway Timeout status code (504). Every timeout must be shorter than WriteTimeout.
+	Timeouts map[string]time.Duration
+	// WriteTimeout is the write timeout of the HTTP server, after which a response that is still being written is cut
+	// off. It is only read from the environment, since the server cannot change it once started.
+	WriteTimeout time.Duration
+}
+
+// DefaultConfig returns the configuration used when nothing is configured.
+func DefaultConfig() *Config {
+	return &Config{
+		CacheTTL:                    defaultCacheTTL,
+		DefaultUnits:                UnitsMetric,
+		SmoothingFactor:             defaultSmoothingFactor,
+		MinFetchInterval:            defaultMinFetchInterval,
+		MaxStaleness:                defaultMaxStaleness,
+		ExtremeCold:                 defaultExtremeCold,
+		ExtremeHot:                  defaultExtremeHot,
+		MaxBatchSize:                defaultMaxBatchSize,
+		TrendDeadband:               defaultTrendDeadband,
+		OWMAPIVersion:               OWMAPIVersion25,
+		HealthCacheTTL:              defaultHealthCacheTTL,
+		Timeouts:                    maps.Clone(defaultTimeouts),
+		WriteTimeout:                defaultWriteTimeout,
+		NumberPrecision:             defaultNumberPrecision,
+		CoordinatePrecision:         defaultCoordinatePrecision,
+		UpstreamCoordinatePrecision: maxCoordinatePrecision,
+	}
+}
+
+// timeout returns the fetch timeout of the named endpoint, falling back to its default when it is not configured.
+func (c *Config) timeout(endpoint string) time.Duration {
+	if timeout, ok := c.Timeouts[endpoint]; ok {
+		return timeout
+	}
+	return defaultTimeouts[endpoint]
+}
+
+// validate reports the first setting of the configuration that is out of range.
+func (c *Config) validate() error {
+	if c.CacheTTL <= 0 {
+		return fmt.Errorf("cache TTL must be positive, got %v", c.CacheTTL)
+	}
+	if !validUnits(c.DefaultUnits) {
+		return fmt.Errorf("unsupported default units %q", c.DefaultUnits)
+	}
+	if math.IsNaN(c.SmoothingFactor) || c.SmoothingFactor <= 0 || c.SmoothingFactor > 1 {
+		return fmt.Errorf("smoothing factor must be in (0, 1], got %v", c.SmoothingFactor)
+	}
+	if c.MinFetchInterval < 0 {
+		return fmt.Errorf("minimum fetch interval must not be negative, got %v", c.MinFetchInterval)
+	}
+	if c.StaleWhileRevalidate < 0 {
+		return fmt.Errorf("stale-while-revalidate window must not be negative, got %v", c.StaleWhileRevalidate)
+	}
+	if c.MaxStaleness < 0 {
+		return fmt.Errorf("maximum staleness must not be negative, got %v", c.MaxStaleness)
+	}
+	if math.IsNaN(c.ExtremeCold) || math.IsInf(c.ExtremeCold, 0) || math.IsNaN(c.ExtremeHot) || math.IsInf(c.ExtremeHot, 0) {
+		return fmt.Errorf("extreme temperature thresholds must be finite, got %v and %v", c.ExtremeCold, c.ExtremeHot)
+	}
+	if c.ExtremeCold >= c.ExtremeHot {
+		return fmt.Errorf("extreme cold threshold must be below the extreme hot threshold, got %v and %v", c.ExtremeCold, c.ExtremeHot)
+	}
+	if c.NumberPrecision < -1 || c.NumberPrecision > maxNumberPrecision {
+		return fmt.Errorf("number precision must be -1 or from 0 to %d decimal places, got %d", maxNumberPrecision, c.NumberPrecision)
+	}
+	if c.CoordinatePrecision < 0 || c.CoordinatePrecision > maxCoordinatePrecision {
+		return fmt.Errorf("coordinate precision must be from 0 to %d decimal places, got %d", maxCoordinatePrecision, c.CoordinatePrecision)
+	}
+	if c.UpstreamCoordinatePrecision < 0 || c.UpstreamCoordinatePrecision > maxCoordinatePrecision {
+		return fmt.Errorf("upstream coordinate precision must be from 0 to %d decimal places, got %d", maxCoordinatePrecision, c.UpstreamCoordinatePrecision)
+	}
+	if c.TrendDeadband < 0 || math.IsNaN(c.TrendDeadband) {
+		return fmt.Errorf("trend deadband must not be negative, got %v", c.TrendDeadband)
+	}
+	if _, ok := owmAPIs[c.OWMAPIVersion]; !ok {
+		return fmt.Errorf("unsupported OpenWeatherMap API version %q, supported versions are %s and %s", c.OWMAPIVersion, OWMAPIVersion25, OWMAPIVersion30)
+	}
+	if c.HealthCacheTTL < 0 {
+		return fmt.Errorf("health cache TTL must not be negative, got %v", c.HealthCacheTTL)
+	}
+	if c.MaxBatchSize <= 0 {
+		return fmt.Errorf("maximum batch size must be positive, got %d", c.MaxBatchSize)
+	}
+	if l := c.DefaultLocation; l != nil && (l.Lat < -90 || l.Lat > 90 || l.Lon < -180 || l.Lon > 180) {
+		return fmt.Errorf("default location coordinates are out of range, got %v,%v", l.Lat, l.Lon)
+	}
+	if c.WriteTimeout <= 0 {
+		return fmt.Errorf("write timeout must be positive, got %v", c.WriteTimeout)
+	}
+	for endpoint, timeout := range c.Timeouts {
+		if _, ok := defaultTimeouts[endpoint]; !ok {
+			return fmt.Errorf("unknown endpoint %q in timeouts", endpoint)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("timeout of endpoint %q must be positive, got %v", endpoint, timeout)
+		}
+		if timeout >= c.WriteTimeout {
+			return fmt.Errorf("timeout of endpoint %q must be shorter than the write timeout %v, got %v", endpoint, c.WriteTimeout, timeout)
+		}
+	}
+	return nil
+}
+
+// activeConfig is the configuration used by new requests.
+var (
+	configMu     sync.RWMutex
+	activeConfig = DefaultConfig()
+)
+
+// currentConfig returns a snapshot of the active configuration.
+func currentConfig() *Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return activeConfig
+}
+
+// SetConfig validates the configuration and atomically makes it the active one for new requests.
+func SetConfig(c *Config) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	configMu.Lock()
+	defer configMu.Unlock()
+	activeConfig = c
+	return nil
+}
+
+// fileConfig mirrors the JSON configuration file. Fields left out of the file keep their previous value.
+type fileConfig struct {
+	CacheTTL                    *string           `json:"cache_ttl"`
+	DefaultUnits                *string           `json:"default_units"`
+	SmoothingFactor             *float64          `json:"smoothing_factor"`
+	DefaultLocation             *Location         `json:"default_location"`
+	MinFetchInterval            *string           `json:"min_fetch_interval"`
+	MaxStaleness                *string           `json:"max_staleness"`
+	StaleWhileRevalidate        *string           `json:"stale_while_revalidate"`
+	ExtremeCold                 *float64          `json:"extreme_cold"`
+	ExtremeHot                  *float64          `json:"extreme_hot"`
+	LenientCoordinates          *bool             `json:"lenient_coordinates"`
+	NumberPrecision             *int              `json:"number_precision"`
+	CoordinatePrecision         *int              `json:"coordinate_precision"`
+	UpstreamCoordinatePrecision *int              `json:"upstream_coordinate_precision"`
+	MaxBatchSize                *int              `json:"max_batch_size"`
+	TrendDeadband               *float64          `json:"trend_deadband"`
+	Offline                     *bool             `json:"offline"`
+	Geolocate                   *bool             `json:"geolocate"`
+	OWMAPIVersion               *string           `json:"owm_api_version"`
+	HealthCacheTTL              *string           `json:"health_cache_ttl"`
+	Timeouts                    map[string]string `json:"timeouts"`
+}
+
+// LoadConfig builds the configuration from the defaults, then the JSON file named by CONFIG_FILE (if set),
+// then the CACHE_TTL, DEFAULT_UNITS, SMOOTHING_FACTOR, MIN_FETCH_INTERVAL, MAX_STALENESS, STALE_WHILE_REVALIDATE,
+// EXTREME_COLD, EXTREME_HOT, LENIENT_COORDINATES, NUMBER_PRECISION, COORDINATE_PRECISION,
+// UPSTREAM_COORDINATE_PRECISION, MAX_BATCH_SIZE, TREND_DEADBAND, OFFLINE_MODE, GEOLOCATE, OWM_API_VERSION,
+// HEALTH_CACHE_TTL, DEFAULT_LAT/DEFAULT_LON, TIMEOUTS and WRITE_TIMEOUT environment variables, each overriding the
+// previous ones. The default location variables must be set together. Timeouts are merged per endpoint, so only
+// the endpoints named are changed; TIMEOUTS holds a comma-separated list such as "digest=20s,compare=10s".
+// A configuration file looks like {"cache_ttl": "5m", "default_units": "imperial", "smoothing_factor": 0.5,
+// "default_location": {"lat": 51.5, "lon": -0.12}, "timeouts": {"digest": "20s"}}.
+func LoadConfig() (*Config, error) {
+	c := DefaultConfig()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config: %w", err)
+		}
+		var file fileConfig
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("invalid config file: %w", err)
+		}
+		if file.CacheTTL != nil {
+			ttl, err := time.ParseDuration(*file.CacheTTL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cache_ttl: %w", err)
+			}
+			c.CacheTTL = ttl
+		}
+		if file.DefaultUnits != nil {
+			c.DefaultUnits = *file.DefaultUnits
+		}
+		if file.SmoothingFactor != nil {
+			c.SmoothingFactor = *file.SmoothingFactor
+		}
+		if file.DefaultLocation != nil {
+			c.DefaultLocation = file.DefaultLocation
+		}
+		if file.MinFetchInterval != nil {
+			interval, err := time.ParseDuration(*file.MinFetchInterval)
+			if err != nil {
+				return nil, fmt.Errorf("invalid min_fetch_interval: %w", err)
+			}
+			c.MinFetchInterval = interval
+		}
+		if file.MaxStaleness != nil {
+			staleness, err := time.ParseDuration(*file.MaxStaleness)
+			if err != nil {
+				return nil, fmt.Errorf("invalid max_staleness: %w", err)
+			}
+			c.MaxStaleness = staleness
+		}
+		if file.StaleWhileRevalidate != nil {
+			window, err := time.ParseDuration(*file.StaleWhileRevalidate)
+			if err != nil {
+				return nil, fmt.Errorf("invalid stale_while_revalidate: %w", err)
+			}
+			c.StaleWhileRevalidate = window
+		}
+		if file.ExtremeCold != nil {
+			c.ExtremeCold = *file.ExtremeCold
+		}
+		if file.ExtremeHot != nil {
+			c.ExtremeHot = *file.ExtremeHot
+		}
+		if file.LenientCoordinates != nil {
+			c.LenientCoordinates = *file.LenientCoordinates
+		}
+		if file.NumberPrecision != nil {
+			c.NumberPrecision = *file.NumberPrecision
+		}
+		if file.CoordinatePrecision != nil {
+			c.CoordinatePrecision = *file.CoordinatePrecision
+		}
+		if file.UpstreamCoordinatePrecision != nil {
+			c.UpstreamCoordinatePrecision = *file.UpstreamCoordinatePrecision
+		}
+		if file.MaxBatchSize != nil {
+			c.MaxBatchSize = *file.MaxBatchSize
+		}
+		if file.TrendDeadband != nil {
+			c.TrendDeadband = *file.TrendDeadband
+		}
+		if file.Offline != nil {
+			c.Offline = *file.Offline
+		}
+		if file.Geolocate != nil {
+			c.Geolocate = *file.Geolocate
+		}
+		if file.OWMAPIVersion != nil {
+			c.OWMAPIVersion = *file.OWMAPIVersion
+		}
+		if file.HealthCacheTTL != nil {
+			ttl, err := time.ParseDuration(*file.HealthCacheTTL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid health_cache_ttl: %w", err)
+			}
+			c.HealthCacheTTL = ttl
+		}
+		for endpoint, value := range file.Timeouts {
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeouts.%s: %w", endpoint, err)
+			}
+			c.Timeouts[endpoint] = timeout
+		}
+	}
+
+	if value := os.Getenv("CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CACHE_TTL: %w", err)
+		}
+		c.CacheTTL = ttl
+	}
+	if value := os.Getenv("DEFAULT_UNITS"); value != "" {
+		c.DefaultUnits = value
+	}
+	if value := os.Getenv("SMOOTHING_FACTOR"); value != "" {
+		factor, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMOOTHING_FACTOR: %w", err)
+		}
+		c.SmoothingFactor = factor
+	}
+	if value := os.Getenv("MIN_FETCH_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MIN_FETCH_INTERVAL: %w", err)
+		}
+		c.MinFetchInterval = interval
+	}
+	if value := os.Getenv("MAX_STALENESS"); value != "" {
+		staleness, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAX_STALENESS: %w", err)
+		}
+		c.MaxStaleness = staleness
+	}
+	if value := os.Getenv("STALE_WHILE_REVALIDATE"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid STALE_WHILE_REVALIDATE: %w", err)
+		}
+		c.StaleWhileRevalidate = window
+	}
+	if value := os.Getenv("EXTREME_COLD"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EXTREME_COLD: %w", err)
+		}
+		c.ExtremeCold = threshold
+	}
+	if value := os.Getenv("EXTREME_HOT"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EXTREME_HOT: %w", err)
+		}
+		c.ExtremeHot = threshold
+	}
+	if value := os.Getenv("LENIENT_COORDINATES"); value != "" {
+		lenient, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LENIENT_COORDINATES: %w", err)
+		}
+		c.LenientCoordinates = lenient
+	}
+	if value := os.Getenv("NUMBER_PRECISION"); value != "" {
+		places, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NUMBER_PRECISION: %w", err)
+		}
+		c.NumberPrecision = places
+	}
+	if value := os.Getenv("COORDINATE_PRECISION"); value != "" {
+		places, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid COORDINATE_PRECISION: %w", err)
+		}
+		c.CoordinatePrecision = places
+	}
+	if value := os.Getenv("UPSTREAM_COORDINATE_PRECISION"); value != "" {
+		places, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UPSTREAM_COORDINATE_PRECISION: %w", err)
+		}
+		c.UpstreamCoordinatePrecision = places
+	}
+	if value := os.Getenv("MAX_BATCH_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAX_BATCH_SIZE: %w", err)
+		}
+		c.MaxBatchSize = size
+	}
+	if value := os.Getenv("TREND_DEADBAND"); value != "" {
+		deadband, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TREND_DEADBAND: %w", err)
+		}
+		c.TrendDeadband = deadband
+	}
+	if value := os.Getenv("OFFLINE_MODE"); value != "" {
+		offline, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OFFLINE_MODE: %w", err)
+		}
+		c.Offline = offline
+	}
+	if value := os.Getenv("GEOLOCATE"); value != "" {
+		geolocate, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GEOLOCATE: %w", err)
+		}
+		c.Geolocate = geolocate
+	}
+	if value := os.Getenv("OWM_API_VERSION"); value != "" {
+		c.OWMAPIVersion = value
+	}
+	if value := os.Getenv("HEALTH_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HEALTH_CACHE_TTL: %w", err)
+		}
+		c.HealthCacheTTL = ttl
+	}
+	if latValue, lonValue := os.Getenv("DEFAULT_LAT"), os.Getenv("DEFAULT_LON"); latValue != "" || lonValue != "" {
+		lat, latErr := strconv.ParseFloat(latValue, 64)
+		lon, lonErr := strconv.ParseFloat(lonValue, 64)
+		if latErr != nil || lonErr != nil {
+			return nil, fmt.Errorf("invalid DEFAULT_LAT/DEFAULT_LON: both must be set to numbers, got %q and %q", latValue, lonValue)
+		}
+		c.DefaultLocation = &Location{Lat: lat, Lon: lon}
+	}
+	if value := os.Getenv("TIMEOUTS"); value != "" {
+		for _, entry := range strings.Split(value, ",") {
+			endpoint, durationValue, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			timeout, err := time.ParseDuration(durationValue)
+			if !ok || err != nil {
+				return nil, fmt.Errorf("invalid TIMEOUTS entry %q: it must look like endpoint=duration", entry)
+			}
+			c.Timeouts[endpoint] = timeout
+		}
+	}
+	if value := os.Getenv("WRITE_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WRITE_TIMEOUT: %w", err)
+		}
+		c.WriteTimeout = timeout
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return c, nil
+}
+
+// ReloadConfig re-reads the configuration with LoadConfig and swaps it in for new requests.
+// On error the active configuration is left unchanged.
+func ReloadConfig() error {
+	c, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	return SetConfig(c)
+}
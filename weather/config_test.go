@@ -0,0 +1,332 @@
+package weather
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withConfigFile is a helper function that writes contents to a configuration file and names it in CONFIG_FILE for
+// the rest of the test.
+func withConfigFile(t *testing.T, contents string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+}
+
+func TestLoadConfigNumberPrecision(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     string
+		want    int
+		wantErr bool
+	}{
+		{name: "default", want: defaultNumberPrecision},
+		{name: "file", file: `{"number_precision": 2}`, want: 2},
+		{name: "environment overrides file", file: `{"number_precision": 2}`, env: "3", want: 3},
+		{name: "shortest representation", env: "-1", want: -1},
+		{name: "whole numbers", env: "0", want: 0},
+		{name: "too many places", env: "7", wantErr: true},
+		{name: "below shortest representation", env: "-2", wantErr: true},
+		{name: "not a number", env: "two", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.file != "" {
+				withConfigFile(t, tt.file)
+			}
+			t.Setenv("NUMBER_PRECISION", tt.env)
+
+			cfg, err := LoadConfig()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LoadConfig() accepted number precision %q", tt.env)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.NumberPrecision != tt.want {
+				t.Errorf("NumberPrecision = %d, want %d", cfg.NumberPrecision, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigCoordinatePrecision(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     string
+		want    int
+		wantErr bool
+	}{
+		{name: "default", want: defaultCoordinatePrecision},
+		{name: "file", file: `{"coordinate_precision": 3}`, want: 3},
+		{name: "environment overrides file", file: `{"coordinate_precision": 3}`, env: "0", want: 0},
+		{name: "exact coordinates", env: "6", want: 6},
+		{name: "too many places", env: "7", wantErr: true},
+		{name: "negative", env: "-1", wantErr: true},
+		{name: "not a number", env: "two", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.file != "" {
+				withConfigFile(t, tt.file)
+			}
+			t.Setenv("COORDINATE_PRECISION", tt.env)
+
+			cfg, err := LoadConfig()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LoadConfig() accepted coordinate precision %q", tt.env)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.CoordinatePrecision != tt.want {
+				t.Errorf("CoordinatePrecision = %d, want %d", cfg.CoordinatePrecision, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		check   func(cfg *Config) bool
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			check: func(cfg *Config) bool { return cfg.CacheTTL == defaultCacheTTL && cfg.DefaultUnits == UnitsMetric },
+		},
+		{
+			name: "file",
+			file: `{"cache_ttl": "5m", "default_units": "imperial", "smoothing_factor": 0.5}`,
+			check: func(cfg *Config) bool {
+				return cfg.CacheTTL == 5*time.Minute && cfg.DefaultUnits == UnitsImperial && cfg.SmoothingFactor == 0.5
+			},
+		},
+		{
+			name:  "environment overrides file",
+			file:  `{"cache_ttl": "5m", "default_units": "imperial"}`,
+			env:   map[string]string{"CACHE_TTL": "90s"},
+			check: func(cfg *Config) bool { return cfg.CacheTTL == 90*time.Second && cfg.DefaultUnits == UnitsImperial },
+		},
+		{
+			name: "default location",
+			env:  map[string]string{"DEFAULT_LAT": "51.5", "DEFAULT_LON": "-0.12"},
+			check: func(cfg *Config) bool {
+				return cfg.DefaultLocation != nil && *cfg.DefaultLocation == Location{Lat: 51.5, Lon: -0.12}
+			},
+		},
+		{name: "offline mode", file: `{"offline": true}`, check: func(cfg *Config) bool { return cfg.Offline }},
+		{name: "offline mode turned off", file: `{"offline": true}`, env: map[string]string{"OFFLINE_MODE": "false"}, check: func(cfg *Config) bool { return !cfg.Offline }},
+		{name: "default API version", check: func(cfg *Config) bool { return cfg.OWMAPIVersion == OWMAPIVersion25 }},
+		{name: "API version", file: `{"owm_api_version": "3.0"}`, check: func(cfg *Config) bool { return cfg.OWMAPIVersion == OWMAPIVersion30 }},
+		{name: "API version from the environment", file: `{"owm_api_version": "3.0"}`, env: map[string]string{"OWM_API_VERSION": "2.5"}, check: func(cfg *Config) bool { return cfg.OWMAPIVersion == OWMAPIVersion25 }},
+		{name: "health cache TTL", file: `{"health_cache_ttl": "1m"}`, env: map[string]string{"HEALTH_CACHE_TTL": "10s"}, check: func(cfg *Config) bool { return cfg.HealthCacheTTL == 10*time.Second }},
+		{name: "health checks without caching", env: map[string]string{"HEALTH_CACHE_TTL": "0s"}, check: func(cfg *Config) bool { return cfg.HealthCacheTTL == 0 }},
+		{name: "stale-while-revalidate window", file: `{"stale_while_revalidate": "2m"}`, check: func(cfg *Config) bool { return cfg.StaleWhileRevalidate == 2*time.Minute }},
+		{name: "stale-while-revalidate window from the environment", file: `{"stale_while_revalidate": "2m"}`, env: map[string]string{"STALE_WHILE_REVALIDATE": "0s"}, check: func(cfg *Config) bool { return cfg.StaleWhileRevalidate == 0 }},
+		{name: "default upstream coordinate precision", check: func(cfg *Config) bool { return cfg.UpstreamCoordinatePrecision == maxCoordinatePrecision }},
+		{name: "upstream coordinate precision", file: `{"upstream_coordinate_precision": 3}`, env: map[string]string{"UPSTREAM_COORDINATE_PRECISION": "1"}, check: func(cfg *Config) bool { return cfg.UpstreamCoordinatePrecision == 1 }},
+		{name: "unreadable file", env: map[string]string{"CONFIG_FILE": filepath.Join(t.TempDir(), "missing.json")}, wantErr: true},
+		{name: "invalid file", file: `{"cache_ttl": 300}`, wantErr: true},
+		{name: "invalid duration", env: map[string]string{"CACHE_TTL": "often"}, wantErr: true},
+		{name: "out of range", env: map[string]string{"SMOOTHING_FACTOR": "1.5"}, wantErr: true},
+		{name: "unsupported units", env: map[string]string{"DEFAULT_UNITS": "kelvin"}, wantErr: true},
+		{name: "half a default location", env: map[string]string{"DEFAULT_LAT": "51.5"}, wantErr: true},
+		{name: "unsupported API version", env: map[string]string{"OWM_API_VERSION": "4.0"}, wantErr: true},
+		{name: "invalid health cache TTL", file: `{"health_cache_ttl": "soon"}`, wantErr: true},
+		{name: "negative health cache TTL", env: map[string]string{"HEALTH_CACHE_TTL": "-1s"}, wantErr: true},
+		{name: "negative stale-while-revalidate window", env: map[string]string{"STALE_WHILE_REVALIDATE": "-1m"}, wantErr: true},
+		{name: "too precise upstream coordinates", env: map[string]string{"UPSTREAM_COORDINATE_PRECISION": "7"}, wantErr: true},
+		{name: "negative upstream coordinate precision", file: `{"upstream_coordinate_precision": -1}`, wantErr: true},
+		{name: "invalid upstream coordinate precision", env: map[string]string{"UPSTREAM_COORDINATE_PRECISION": "two"}, wantErr: true},
+		{name: "invalid offline mode", env: map[string]string{"OFFLINE_MODE": "air-gapped"}, wantErr: true},
+		{name: "smoothing factor not a number", env: map[string]string{"SMOOTHING_FACTOR": "NaN"}, wantErr: true},
+		{name: "thresholds the wrong way round", env: map[string]string{"EXTREME_COLD": "30", "EXTREME_HOT": "20"}, wantErr: true},
+		{name: "infinite cold threshold", env: map[string]string{"EXTREME_COLD": "-Inf"}, wantErr: true},
+		{name: "infinite hot threshold", env: map[string]string{"EXTREME_HOT": "+Inf"}, wantErr: true},
+		{name: "hot threshold not a number", env: map[string]string{"EXTREME_HOT": "NaN"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.file != "" {
+				withConfigFile(t, tt.file)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := LoadConfig()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("LoadConfig() accepted an invalid configuration")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("LoadConfig() = %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantTTL time.Duration
+		wantErr bool
+	}{
+		{name: "valid change is applied", file: `{"cache_ttl": "2m"}`, wantTTL: 2 * time.Minute},
+		{name: "invalid change keeps the active configuration", file: `{"cache_ttl": "-2m"}`, wantTTL: 7 * time.Minute, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.CacheTTL = 7 * time.Minute })
+			withConfigFile(t, tt.file)
+
+			err := ReloadConfig()
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReloadConfig() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := currentConfig().CacheTTL; got != tt.wantTTL {
+				t.Errorf("active cache TTL = %v, want %v", got, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestLoadConfigTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		want    map[string]time.Duration // Expected timeouts of these endpoints, the rest keep their defaults
+		wantErr bool
+	}{
+		{name: "defaults", want: map[string]time.Duration{EndpointWeather: 5 * time.Second, EndpointBatch: 10 * time.Second}},
+		{name: "file", file: `{"timeouts": {"digest": "12s"}}`, want: map[string]time.Duration{EndpointDigest: 12 * time.Second}},
+		{
+			name: "environment merged per endpoint",
+			file: `{"timeouts": {"digest": "12s", "compare": "9s"}}`,
+			env:  map[string]string{"TIMEOUTS": "compare=3s,raw=2s"},
+			want: map[string]time.Duration{EndpointDigest: 12 * time.Second, EndpointCompare: 3 * time.Second, EndpointRaw: 2 * time.Second},
+		},
+		{
+			name: "longer write timeout",
+			env:  map[string]string{"WRITE_TIMEOUT": "40s", "TIMEOUTS": "batch=30s"},
+			want: map[string]time.Duration{EndpointBatch: 30 * time.Second},
+		},
+		{name: "unknown endpoint", env: map[string]string{"TIMEOUTS": "forecast=5s"}, wantErr: true},
+		{name: "malformed entry", env: map[string]string{"TIMEOUTS": "weather:5s"}, wantErr: true},
+		{name: "invalid duration in file", file: `{"timeouts": {"weather": "soon"}}`, wantErr: true},
+		{name: "not positive", env: map[string]string{"TIMEOUTS": "weather=0s"}, wantErr: true},
+		{name: "not shorter than the write timeout", env: map[string]string{"TIMEOUTS": "batch=15s"}, wantErr: true},
+		{name: "write timeout below a default", env: map[string]string{"WRITE_TIMEOUT": "6s"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.file != "" {
+				withConfigFile(t, tt.file)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := LoadConfig()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LoadConfig() accepted timeouts %v", cfg.Timeouts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for endpoint, def := range defaultTimeouts {
+				want, ok := tt.want[endpoint]
+				if !ok {
+					want = def
+				}
+				if got := cfg.timeout(endpoint); got != want {
+					t.Errorf("timeout of %s = %v, want %v", endpoint, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointTimeouts(t *testing.T) {
+	const timemachinePath = "/data/3.0/onecall/timemachine"
+	tests := []struct {
+		endpoint string
+		handler  http.HandlerFunc
+		target   string
+		path     string // Upstream path the endpoint calls
+		body     string
+	}{
+		{endpoint: EndpointWeather, handler: WeatherHandler, target: "/weather?lat=51.51&lon=-0.13", path: currentWeatherPath, body: sampleCurrentWeather},
+		{endpoint: EndpointRaw, handler: RawHandler, target: "/weather/raw?lat=51.51&lon=-0.13", path: currentWeatherPath, body: sampleCurrentWeather},
+		{endpoint: EndpointCompare, handler: CompareHandler, target: "/weather/compare?lat1=10&lon1=10&lat2=20&lon2=20", path: currentWeatherPath, body: sampleCurrentWeather},
+		{endpoint: EndpointOneCall, handler: OneCallHandler, target: "/onecall?lat=51.51&lon=-0.13", path: oneCallPath, body: sampleOneCall},
+		{endpoint: EndpointHistory, handler: HistoryHandler, target: "/history?lat=51.51&lon=-0.13&dt=1578390000", path: timemachinePath, body: `{"data":[{"dt":1578390000,"temp":7.6}]}`},
+	}
+	for _, tt := range tests {
+		for _, short := range []bool{true, false} {
+			name := tt.endpoint + " with its own timeout"
+			wantStatus := http.StatusGatewayTimeout
+			if !short {
+				name, wantStatus = tt.endpoint+" with the timeouts of other endpoints", http.StatusOK
+			}
+			t.Run(name, func(t *testing.T) {
+				setupTest(t)
+				// Only the endpoint under test, or every endpoint but it, gets a timeout shorter than the upstream delay
+				configure(t, func(cfg *Config) {
+					for endpoint := range cfg.Timeouts {
+						if (endpoint == tt.endpoint) == short {
+							cfg.Timeouts[endpoint] = 20 * time.Millisecond
+						}
+					}
+				})
+				newUpstream(t, map[string]http.HandlerFunc{tt.path: func(w http.ResponseWriter, r *http.Request) {
+					select {
+					case <-time.After(100 * time.Millisecond):
+						respond(http.StatusOK, tt.body)(w, r)
+					case <-r.Context().Done():
+					}
+				}})
+
+				recorder := serve(tt.handler, http.MethodGet, tt.target, nil)
+
+				if recorder.Code != wantStatus {
+					t.Errorf("status = %d, want %d; body %s", recorder.Code, wantStatus, recorder.Body)
+				}
+			})
+		}
+	}
+}
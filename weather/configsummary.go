@@ -0,0 +1,112 @@
+package weather
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// providerBaseURL is a helper function that returns the base URL of the API queried by a provider, or the type
+// name of the provider when it is not one of the built-in ones.
+func providerBaseURL(p Provider) string {
+	switch p.(type) {
+	case OpenWeatherMapProvider:
+		return openWeatherMapBaseURL
+	case OpenMeteoProvider:
+		return openMeteoBaseURL
+	}
+	return fmt.Sprintf("%T", p)
+}
+
+// ConfigSummary describes the effective configuration in a single line of space-separated key=value pairs, e.g.
+// "api_key=*** providers=https://api.openweathermap.org,https://api.open-meteo.com cache_ttl=10m0s ...", so that
+// operators can see at a glance which settings a deployment picked up.
+// Secrets are never included: the API key is only reported as set or unset, along with the size of the key pool,
+// and the values of the static upstream headers, which typically hold proxy credentials, are replaced by redactedValue.
+func ConfigSummary() string {
+	cfg := currentConfig()
+
+	// Report whether an API key is configured without revealing it
+	apiKey := redactedValue
+	if API_KEY == "" || API_KEY == "REPLACE_API_KEY" {
+		apiKey = "<unset>"
+	}
+	if activeAPIKeys.size() > 0 {
+		apiKey = redactedValue
+	}
+
+	var providerURLs []string
+	for _, provider := range registeredProviders() {
+		providerURLs = append(providerURLs, providerBaseURL(provider))
+	}
+
+	// Sort the endpoints and header names so the summary is the same on every start
+	var timeouts []string
+	for endpoint := range defaultTimeouts {
+		timeouts = append(timeouts, fmt.Sprintf("%s=%v", endpoint, cfg.timeout(endpoint)))
+	}
+	slices.Sort(timeouts)
+
+	upstreamHeadersMu.RLock()
+	var headers []string
+	for name := range upstreamHeaders {
+		headers = append(headers, http.CanonicalHeaderKey(name)+"="+redactedValue)
+	}
+	upstreamHeadersMu.RUnlock()
+	slices.Sort(headers)
+
+	trustedProxiesMu.RLock()
+	var proxies []string
+	for _, prefix := range trustedProxies {
+		proxies = append(proxies, prefix.String())
+	}
+	trustedProxiesMu.RUnlock()
+
+	defaultLocation := "<none>"
+	if cfg.DefaultLocation != nil {
+		defaultLocation = formatCoordinates(cfg.DefaultLocation.Lat, cfg.DefaultLocation.Lon)
+	}
+
+	upstreamClientMu.RLock()
+	settings := upstreamSettings
+	upstreamClientMu.RUnlock()
+
+	limiter := currentUpstreamLimiter()
+	fields := []string{
+		"api_key=" + apiKey,
+		fmt.Sprintf("api_key_pool=%d", activeAPIKeys.size()),
+		"providers=" + strings.Join(providerURLs, ","),
+		fmt.Sprintf("cache_ttl=%v", cfg.CacheTTL),
+		"default_units=" + cfg.DefaultUnits,
+		fmt.Sprintf("smoothing_factor=%v", cfg.SmoothingFactor),
+		fmt.Sprintf("min_fetch_interval=%v", cfg.MinFetchInterval),
+		fmt.Sprintf("max_staleness=%v", cfg.MaxStaleness),
+		fmt.Sprintf("stale_while_revalidate=%v", cfg.StaleWhileRevalidate),
+		fmt.Sprintf("extreme_cold=%v", cfg.ExtremeCold),
+		fmt.Sprintf("extreme_hot=%v", cfg.ExtremeHot),
+		fmt.Sprintf("lenient_coordinates=%v", cfg.LenientCoordinates),
+		fmt.Sprintf("number_precision=%d", cfg.NumberPrecision),
+		fmt.Sprintf("coordinate_precision=%d", cfg.CoordinatePrecision),
+		fmt.Sprintf("upstream_coordinate_precision=%d", cfg.UpstreamCoordinatePrecision),
+		"default_location=" + defaultLocation,
+		fmt.Sprintf("trend_deadband=%v", cfg.TrendDeadband),
+		fmt.Sprintf("offline=%v", cfg.Offline),
+		fmt.Sprintf("geolocate=%v", cfg.Geolocate),
+		fmt.Sprintf("owm_api_version=%s", cfg.OWMAPIVersion),
+		fmt.Sprintf("health_cache_ttl=%v", cfg.HealthCacheTTL),
+		fmt.Sprintf("max_batch_size=%d", cfg.MaxBatchSize),
+		"timeouts=" + strings.Join(timeouts, ","),
+		fmt.Sprintf("max_upstream_calls=%d", cap(limiter.slots)),
+		fmt.Sprintf("upstream_fail_fast=%v", limiter.failFast),
+		fmt.Sprintf("max_upstream_body_bytes=%d", currentMaxUpstreamBodyBytes()),
+		"upstream_tls_min_version=" + strings.ReplaceAll(tls.VersionName(settings.tlsMinVersion), " ", ""),
+		fmt.Sprintf("upstream_max_idle_conns=%d", settings.pool.MaxIdleConns),
+		fmt.Sprintf("upstream_max_idle_conns_per_host=%d", settings.pool.MaxIdleConnsPerHost),
+		fmt.Sprintf("upstream_idle_conn_timeout=%v", settings.pool.IdleConnTimeout),
+		"upstream_headers=" + strings.Join(headers, ","),
+		"trusted_proxies=" + strings.Join(proxies, ","),
+	}
+	return strings.Join(fields, " ")
+}
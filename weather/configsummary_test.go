@@ -0,0 +1,77 @@
+package weather
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigSummary(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T)
+		want    []string
+		wantNot []string
+	}{
+		{
+			name: "defaults",
+			want: []string{"api_key=<unset>", "api_key_pool=0", "providers=https://api.openweathermap.org ", "cache_ttl=10m0s", "default_units=metric", "upstream_headers= "},
+		},
+		{
+			name:    "key pool",
+			setup:   func(t *testing.T) { SetAPIKeys([]string{secret, "fedcba9876543210fedcba9876543210"}) },
+			want:    []string{"api_key=*** ", "api_key_pool=2"},
+			wantNot: []string{secret, "fedcba98"},
+		},
+		{
+			name: "upstream headers",
+			setup: func(t *testing.T) {
+				SetUpstreamHeaders(http.Header{"Proxy-Authorization": {"Basic " + secret}, "X-Tenant": {"acme"}})
+			},
+			want:    []string{"upstream_headers=Proxy-Authorization=***,X-Tenant=*** "},
+			wantNot: []string{secret, "acme"},
+		},
+		{
+			name: "configured settings",
+			setup: func(t *testing.T) {
+				configure(t, func(cfg *Config) {
+					cfg.CacheTTL = 5 * time.Minute
+					cfg.DefaultUnits = UnitsImperial
+					cfg.Timeouts[EndpointDigest] = 12 * time.Second
+					cfg.DefaultLocation = &Location{Lat: 51.5074, Lon: -0.1278}
+				})
+				providersMu.Lock()
+				providers = []Provider{OpenWeatherMapProvider{}, OpenMeteoProvider{}}
+				providersMu.Unlock()
+			},
+			want: []string{"providers=https://api.openweathermap.org,https://api.open-meteo.com ", "cache_ttl=5m0s", "default_units=imperial",
+				"digest=12s", "default_location=51.51,-0.13"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+
+			got := ConfigSummary()
+
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("summary %q does not contain %q", got, want)
+				}
+			}
+			for _, secret := range tt.wantNot {
+				if strings.Contains(got, secret) {
+					t.Errorf("summary %q reveals %q", got, secret)
+				}
+			}
+			if strings.Contains(got, "\n") {
+				t.Errorf("summary %q spans several lines", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package weather
+
+import (
+	"math"
+	"strconv"
+)
+
+// Default and largest values of the coordinate precision settings of Config, in decimal places.
+const (
+	defaultCoordinatePrecision = 2 // ~1km, see Config.CoordinatePrecision
+	maxCoordinatePrecision     = 6 // ~0.1m, which passes on the coordinates of a request as is
+)
+
+// formatUpstreamCoordinate is a helper function that formats a latitude or longitude for an upstream URL, rounded to
+// the configured UpstreamCoordinatePrecision. It is the only place where coordinates sent upstream are rounded.
+func formatUpstreamCoordinate(value float64) string {
+	places := currentConfig().UpstreamCoordinatePrecision
+	return strconv.FormatFloat(roundCoordinate(value, places), 'f', places, 64)
+}
+
+// roundCoordinate is a helper function that rounds a latitude or longitude to the given number of decimal places.
+// A negative number of places leaves the value unchanged.
+func roundCoordinate(value float64, places int) float64 {
+	if places < 0 {
+		return value
+	}
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
+
+// formatCoordinates is a helper function that formats a coordinate pair rounded to the configured
+// CoordinatePrecision, e.g. "51.51,-0.13". It is the only form in which coordinates should appear in logs and keys.
+func formatCoordinates(lat, lon float64) string {
+	places := currentConfig().CoordinatePrecision
+	format := func(value float64) string {
+		return strconv.FormatFloat(roundCoordinate(value, places), 'f', places, 64)
+	}
+	return format(lat) + "," + format(lon)
+}
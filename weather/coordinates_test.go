@@ -0,0 +1,227 @@
+package weather
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatCoordinates(t *testing.T) {
+	tests := []struct {
+		precision int
+		want      string
+	}{
+		{precision: 0, want: "52,-0"},
+		{precision: 2, want: "51.51,-0.13"},
+		{precision: 4, want: "51.5074,-0.1278"},
+		{precision: 6, want: "51.507351,-0.127758"},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.precision), func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.CoordinatePrecision = tt.precision })
+			if got := formatCoordinates(51.507351, -0.127758); got != tt.want {
+				t.Errorf("formatCoordinates() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatUpstreamCoordinate(t *testing.T) {
+	tests := []struct {
+		precision int
+		value     float64
+		want      string
+	}{
+		{precision: 0, value: 51.507351, want: "52"},
+		{precision: 0, value: -0.127758, want: "-0"},
+		{precision: 1, value: 51.507351, want: "51.5"},
+		{precision: 2, value: -0.127758, want: "-0.13"},
+		{precision: 2, value: 0.125, want: "0.13"},
+		{precision: 2, value: 180, want: "180.00"},
+		{precision: 6, value: 51.507351, want: "51.507351"},
+		{precision: 6, value: -0.1277584, want: "-0.127758"},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.precision), func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.UpstreamCoordinatePrecision = tt.precision })
+			if got := formatUpstreamCoordinate(tt.value); got != tt.want {
+				t.Errorf("formatUpstreamCoordinate(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamCoordinatePrecision(t *testing.T) {
+	const timeMachinePath = "/data/3.0/onecall/timemachine"
+	const timeMachine = `{"lat":51.51,"lon":-0.13,"timezone":"Europe/London","data":[{"dt":1578390000,"temp":7.6,` +
+		`"humidity":87,"wind_speed":4.6,"wind_deg":230,"weather":[{"description":"overcast clouds"}]}]}`
+	// A fetcher requests the weather at 51.507351,-0.127758 from the endpoint under test and returns the status code
+	type fetcher func(t *testing.T) int
+	handler := func(h http.HandlerFunc, target string) fetcher {
+		return func(t *testing.T) int { return serve(h, http.MethodGet, target, nil).Code }
+	}
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		fetch     fetcher
+		params    [2]string // Names of the latitude and longitude query parameters, lat and lon when empty
+		precision int
+		wantLat   string
+		wantLon   string
+	}{
+		{name: "current weather", path: currentWeatherPath, body: sampleCurrentWeather, fetch: handler(WeatherHandler, "/weather?lat=51.507351&lon=-0.127758"), precision: 6, wantLat: "51.507351", wantLon: "-0.127758"},
+		{name: "current weather rounded", path: currentWeatherPath, body: sampleCurrentWeather, fetch: handler(WeatherHandler, "/weather?lat=51.507351&lon=-0.127758"), precision: 2, wantLat: "51.51", wantLon: "-0.13"},
+		{name: "one call rounded", path: oneCallPath, body: sampleOneCall, fetch: handler(OneCallHandler, "/onecall?lat=51.507351&lon=-0.127758"), precision: 3, wantLat: "51.507", wantLon: "-0.128"},
+		{name: "history rounded", path: timeMachinePath, body: timeMachine, fetch: handler(HistoryHandler, "/history?lat=51.507351&lon=-0.127758&dt=1578390000"), precision: 1, wantLat: "51.5", wantLon: "-0.1"},
+		{
+			name: "open-meteo rounded",
+			path: openMeteoPath,
+			body: sampleOpenMeteo,
+			fetch: func(t *testing.T) int {
+				if _, err := (OpenMeteoProvider{}).Fetch(context.Background(), 51.507351, -0.127758); err != nil {
+					t.Fatal(err)
+				}
+				return http.StatusOK
+			},
+			params:    [2]string{"latitude", "longitude"},
+			precision: 0,
+			wantLat:   "52",
+			wantLon:   "-0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			logs := captureLog(t)
+			SetDebugLogging(true)
+			SetClock(FixedClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)))
+			configure(t, func(cfg *Config) { cfg.UpstreamCoordinatePrecision = tt.precision })
+			upstream := newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			if status := tt.fetch(t); status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+
+			params := tt.params
+			if params[0] == "" {
+				params = [2]string{"lat", "lon"}
+			}
+			calls := upstream.calls(tt.path)
+			if len(calls) != 1 || calls[0].Query().Get(params[0]) != tt.wantLat || calls[0].Query().Get(params[1]) != tt.wantLon {
+				t.Fatalf("upstream calls = %v, want one for %s,%s", calls, tt.wantLat, tt.wantLon)
+			}
+			// The exact location of the request stays out of the upstream URLs logged in debug mode
+			if tt.precision < 6 && strings.Contains(logs.String(), "51.507351") {
+				t.Errorf("log %q contains the exact latitude", logs)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerSharesNearbyLocations(t *testing.T) {
+	// Two points about 500m apart, which share a cache entry at two decimal places but not at four
+	tests := []struct {
+		precision int
+		wantCalls int
+	}{
+		{precision: 2, wantCalls: 1},
+		{precision: 4, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.precision), func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.CoordinatePrecision = tt.precision })
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			for _, target := range []string{"/weather?lat=51.5101&lon=-0.1301", "/weather?lat=51.5138&lon=-0.1302"} {
+				if recorder := serve(WeatherHandler, http.MethodGet, target, nil); recorder.Code != http.StatusOK {
+					t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+				}
+			}
+
+			if got := len(upstream.calls(currentWeatherPath)); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestNormalizeLongitude(t *testing.T) {
+	tests := []struct {
+		lon     float64
+		lenient bool
+		want    float64
+		wantOK  bool
+	}{
+		{lon: -0.13, want: -0.13, wantOK: true},
+		{lon: 180, want: 180, wantOK: true},
+		{lon: -180, want: -180, wantOK: true},
+		{lon: 181},
+		{lon: 181, lenient: true, want: -179, wantOK: true},
+		{lon: -181, lenient: true, want: 179, wantOK: true},
+		{lon: 359.87, lenient: true, want: -0.13, wantOK: true},
+		{lon: 540, lenient: true, want: -180, wantOK: true},
+		{lon: -900, lenient: true, want: -180, wantOK: true},
+		{lon: math.Inf(1), lenient: true},
+		{lon: math.NaN(), lenient: true},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeLongitude(tt.lon, tt.lenient)
+		if ok != tt.wantOK || (ok && math.Abs(got-tt.want) > 1e-9) {
+			t.Errorf("normalizeLongitude(%v, %v) = %v, %v; want %v, %v", tt.lon, tt.lenient, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestWeatherHandlerLenientCoordinates(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		lenient    bool
+		wantStatus int
+		wantLat    string // lat and lon of the upstream call
+		wantLon    string
+	}{
+		{name: "antimeridian east", query: "lat=0&lon=180", wantStatus: http.StatusOK, wantLat: "0.000000", wantLon: "180.000000"},
+		{name: "antimeridian west", query: "lat=0&lon=-180", wantStatus: http.StatusOK, wantLat: "0.000000", wantLon: "-180.000000"},
+		{name: "beyond the antimeridian in strict mode", query: "lat=0&lon=181", wantStatus: http.StatusBadRequest},
+		{name: "beyond the antimeridian in lenient mode", query: "lat=0&lon=181", lenient: true, wantStatus: http.StatusOK, wantLat: "0.000000", wantLon: "-179.000000"},
+		{name: "west of the antimeridian in lenient mode", query: "lat=0&lon=-181", lenient: true, wantStatus: http.StatusOK, wantLat: "0.000000", wantLon: "179.000000"},
+		{name: "latlon in lenient mode", query: "latlon=51.51,359.87", lenient: true, wantStatus: http.StatusOK, wantLat: "51.510000", wantLon: "-0.130000"},
+		{name: "north pole", query: "lat=90&lon=0", wantStatus: http.StatusOK, wantLat: "90.000000", wantLon: "0.000000"},
+		{name: "south pole", query: "lat=-90&lon=0", lenient: true, wantStatus: http.StatusOK, wantLat: "-90.000000", wantLon: "0.000000"},
+		{name: "beyond the pole in strict mode", query: "lat=91&lon=0", wantStatus: http.StatusBadRequest},
+		{name: "beyond the pole in lenient mode", query: "lat=91&lon=0", lenient: true, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.LenientCoordinates = tt.lenient })
+			routes := map[string]http.HandlerFunc{}
+			if tt.wantStatus == http.StatusOK {
+				routes[currentWeatherPath] = respond(http.StatusOK, sampleCurrentWeather)
+			}
+			upstream := newUpstream(t, routes)
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?"+tt.query, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			calls := upstream.calls(currentWeatherPath)
+			if len(calls) != 1 || calls[0].Query().Get("lat") != tt.wantLat || calls[0].Query().Get("lon") != tt.wantLon {
+				t.Errorf("upstream calls = %v, want one for %s,%s", calls, tt.wantLat, tt.wantLon)
+			}
+		})
+	}
+}
@@ -1,111 +1,658 @@
 package weather
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 const API_KEY = "REPLACE_API_KEY"
 
+// fetchOptions holds the per-request settings that are threaded from the handler down to the providers.
+type fetchOptions struct {
+	apiKey string // OpenWeatherMap API key, the next key of the pool set with SetAPIKeys or API_KEY when empty
+	units  string // Unit system (metric, imperial or standard), UnitsMetric when empty
+	lang   string // Language code for weather descriptions, defaultLang when empty
+
+	cacheTTL         time.Duration // How long fetched data is cached, the configured CacheTTL when zero
+	minFetchInterval time.Duration // Shortest time between identical upstream fetches, the configured MinFetchInterval when zero
+	maxStaleness     time.Duration // How long after expiry cached data may be served when fetching fails, the configured MaxStaleness when zero
+	revalidateWindow time.Duration // How long after expiry cached data is served while it is refreshed, the configured StaleWhileRevalidate when zero
+}
+
+// withDefaults returns a copy of the options with every unset field replaced by its default value.
+func (opts fetchOptions) withDefaults() fetchOptions {
+	if opts.apiKey == "" {
+		opts.apiKey = API_KEY
+		if key, ok := activeAPIKeys.pick(); ok {
+			opts.apiKey = key
+		}
+	}
+	if opts.units == "" {
+		opts.units = UnitsMetric
+	}
+	if opts.lang == "" {
+		opts.lang = defaultLang
+	}
+	if opts.cacheTTL == 0 {
+		opts.cacheTTL = currentConfig().CacheTTL
+	}
+	if opts.minFetchInterval == 0 {
+		opts.minFetchInterval = currentConfig().MinFetchInterval
+	}
+	if opts.maxStaleness == 0 {
+		opts.maxStaleness = currentConfig().MaxStaleness
+	}
+	if opts.revalidateWindow == 0 {
+		opts.revalidateWindow = currentConfig().StaleWhileRevalidate
+	}
+	return opts
+}
+
+// fetchOptionsContextKey is the context key under which the per-request fetch options are stored.
+type fetchOptionsContextKey struct{}
+
+// withFetchOptions returns a copy of ctx carrying the options to use for upstream calls made on behalf of this request.
+// Providers receive their options this way because the Provider interface only takes coordinates.
+func withFetchOptions(ctx context.Context, opts fetchOptions) context.Context {
+	return context.WithValue(ctx, fetchOptionsContextKey{}, opts)
+}
+
+// fetchOptionsFromContext returns the per-request fetch options stored in ctx, with defaults for anything unset.
+func fetchOptionsFromContext(ctx context.Context) fetchOptions {
+	opts, _ := ctx.Value(fetchOptionsContextKey{}).(fetchOptions)
+	return opts.withDefaults()
+}
+
 // getWeather is a function that retrieves weather data from the OpenWeatherMap API based on the provided latitude and longitude.
-// It constructs the API URL using the latitude, longitude, and API key, and sends an HTTP GET request to fetch the data.
-// If the HTTP request fails, it logs the error and returns nil and the error.
-// If the JSON response from the API cannot be decoded, it logs the error and returns nil and the error.
-// It then extracts relevant weather information such as description, temperature, visibility, wind speed, wind direction, cloud coverage, sunrise, and sunset from the JSON data.
-// Finally, it constructs a WeatherData struct with the extracted information and returns it along with a nil error.
-func getWeather(lat, lon float64) (*WeatherData, error) {
-	// Construct the API URL reference https://openweathermap.org/current - API call section
-	url := fmt.Sprintf("https://api.openweathermap.org/data/2.5/weather?lat=%.6f&lon=%.6f&appid=%s&units=metric", lat, lon, API_KEY)
+// It constructs the URL of the configured API version (see Config.OWMAPIVersion) using the latitude, longitude,
+// API key and units, and delegates the request to fetchOpenWeatherMap.
+func getWeather(ctx context.Context, lat, lon float64, opts fetchOptions) (*WeatherData, error) {
+	api := owmAPIs[currentConfig().OWMAPIVersion]
+	url := fmt.Sprintf(openWeatherMapBaseURL+"%s?lat=%s&lon=%s&appid=%s&units=%s&lang=%s%s", api.path, formatUpstreamCoordinate(lat), formatUpstreamCoordinate(lon), neturl.QueryEscape(opts.apiKey), opts.units, opts.lang, api.query)
+	return fetchOpenWeatherMap(ctx, url, opts.units, api.extract)
+}
+
+// fetchOpenWeatherMap is a function that retrieves weather data from the given OpenWeatherMap URL using
+// fetchOpenWeatherMapOnce, retrying transient failures as long as the deadline of ctx leaves room, see retryController.
+// Every retry of a call made with a key of the pool set with SetAPIKeys picks a fresh key, see repickAPIKey, which
+// makes a rate limited call worth retrying too while another key of the pool is not cooling down.
+func fetchOpenWeatherMap(ctx context.Context, url, units string, extract owmExtractor) (*WeatherData, error) {
+	attempts := 0
+	retryable := func(err error) bool { return isTransient(err) || retryableWithAnotherKey(url, err) }
+	return fetchWithRetries(ctx, retryable, func(ctx context.Context) (*WeatherData, error) {
+		if attempts++; attempts > 1 {
+			url = repickAPIKey(url)
+		}
+		return fetchOpenWeatherMapOnce(ctx, url, units, extract)
+	})
+}
+
+// fetchOpenWeatherMapOnce is a function that fetches the given OpenWeatherMap URL once with fetchOpenWeatherMapBody.
+// The units argument must match the units requested in the URL, since it determines how temperatures are labelled and classified.
+// The response body is mapped into WeatherData by extract, the extractor of the API version the URL belongs to, and
+// kept unmodified for RawHandler.
+func fetchOpenWeatherMapOnce(ctx context.Context, url, units string, extract owmExtractor) (*WeatherData, error) {
+	// Keep the whole body rather than decoding it on the fly, so the unmodified upstream JSON can be kept for RawHandler
+	body, err := fetchOpenWeatherMapBody(ctx, "openweathermap", url)
+	if err != nil {
+		return nil, err
+	}
+
+	weatherData, err := extract(body, units)
+	if err != nil {
+		return nil, err
+	}
+	weatherData.raw = body
+	return weatherData, nil
+}
+
+// fetchOpenWeatherMapBody is a helper function that sends an HTTP GET request bound to ctx to an OpenWeatherMap URL
+// and returns the body of the response. The api argument names the API in logs and errors, e.g. "openweathermap" or
+// "openweathermap geocoding". The call waits for a slot of the upstream limiter, see SetUpstreamLimit, and reports
+// the status code to the API key pool. If the HTTP request fails or the API responds with a non-200 status code, it
+// logs the error and returns it, categorized like every upstream failure, see upstreamStatus.
+func fetchOpenWeatherMapBody(ctx context.Context, api, url string) ([]byte, error) {
+	// Build an HTTP GET request that is cancelled together with the context
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		// The parse error quotes the URL, which embeds the API key, so it is not passed on
+		log.Printf("Failed to create HTTP request for %s", redactURL(url))
+		return nil, fmt.Errorf("%s: invalid request URL", api)
+	}
+	applyUpstreamHeaders(request)
+	debugf("Calling %s", redactURL(url))
+
+	// Wait for a free upstream call slot so that bursts of requests do not overwhelm the API quota
+	release, err := currentUpstreamLimiter().acquire(ctx)
+	if err != nil {
+		log.Printf("Upstream call to %s not attempted: %v", api, err)
+		return nil, err
+	}
+	defer release()
 
 	// Send HTTP GET request to the API
-	response, err := http.Get(url)
+	response, err := currentUpstreamClient().Do(request)
 	if err != nil {
+		// Drop the request URL from the error, since it embeds the API key
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = fmt.Errorf("%s %s: %w: %w", urlErr.Op, api, ErrUpstreamUnavailable, urlErr.Err)
+		}
 		log.Printf("HTTP request failed: %v", err)
 		return nil, err
 	}
 	defer response.Body.Close()
 
-	// Decode the JSON response
-	var data map[string]interface{}
-	if err := json.NewDecoder(response.Body).Decode(&data); err != nil {
-		log.Printf("Failed to decode JSON: %v", err)
+	// Treat any non-200 response as a failure so that fallback providers can be tried
+	trackAPIKeyStatus(request, response.StatusCode)
+	if response.StatusCode != http.StatusOK {
+		log.Printf("Unexpected status code from %s: %d", api, response.StatusCode)
+		return nil, upstreamStatus(api, response)
+	}
+
+	body, err := readUpstreamBody(api, response.Body)
+	if err != nil {
+		log.Printf("Failed to read response body: %v", err)
 		return nil, err
 	}
+	return body, nil
+}
+
+// fetchOpenWeatherMapJSON is a helper function that fetches an OpenWeatherMap URL with fetchOpenWeatherMapBody and
+// decodes the JSON response into target. A body that cannot be decoded is reported as ErrInvalidResponse.
+func fetchOpenWeatherMapJSON(ctx context.Context, api, url string, target interface{}) error {
+	body, err := fetchOpenWeatherMapBody(ctx, api, url)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, target); err != nil {
+		log.Printf("Failed to decode JSON: %v", err)
+		return fmt.Errorf("%s: %w: %v", api, ErrInvalidResponse, err)
+	}
+	return nil
+}
+
+// extractCurrentWeather is an owmExtractor for the current weather API 2.5 that decodes the JSON response and
+// extracts relevant weather information such as description, temperature, visibility, wind speed, wind direction,
+// cloud coverage, sunrise, and sunset from it.
+// If the JSON response cannot be decoded, it logs the error and returns nil and the error.
+// The temperature is the only mandatory field: a response without it is treated as a bad upstream response, while any
+// other missing field is simply left empty so that a partial response still returns everything that could be parsed.
+// Finally, it constructs a WeatherData struct with the extracted information and returns it along with a nil error.
+func extractCurrentWeather(body []byte, units string) (*WeatherData, error) {
+	// Decode the JSON response into the typed mirror of the OpenWeatherMap schema
+	var data owmResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		log.Printf("Failed to decode JSON: %v", err)
+		return nil, fmt.Errorf("openweathermap: %w: %v", ErrInvalidResponse, err)
+	}
+
+	// With debug logging, report the fields of the response that are dropped because nothing maps them
+	if debugLogging.Load() {
+		if unmapped := unmappedFields(body, &data); len(unmapped) > 0 {
+			debugf("OpenWeatherMap response fields not mapped into WeatherData: %s", strings.Join(unmapped, ", "))
+		}
+	}
 
 	// Extract weather information from the JSON data
-	weatherDescription, temperature := extractWeatherInfo(data)
-	visibility := extractVisibility(data)
-	windSpeed, windDirection := extractWindInfo(data)
-	cloudCoverage := extractCloudCoverage(data)
-	sunrise, sunset := extractSunriseSunset(data)
+	// Only the temperature is mandatory; the remaining fields are optional and left empty when missing
+	weatherDescription, temperature, err := extractWeatherInfo(&data)
+	if err != nil {
+		log.Printf("Incomplete response from OpenWeatherMap: %v", err)
+		return nil, fmt.Errorf("openweathermap: %w: %v", ErrInvalidResponse, err)
+	}
+	visibility := extractVisibility(&data, units)
+	windSpeed, windDirection := extractWindInfo(&data, units)
+	windDirectionLabel := extractWindDirectionLabel(&data)
+	cloudCoverage := extractCloudCoverage(&data)
+	humidity, hasHumidity := extractHumidity(&data)
+	rainVolume, snowVolume := extractPrecipitation(&data)
+	sunrise, sunset := extractSunriseSunset(&data)
+	timezone := extractTimezone(&data)
+	dataTimestamp := extractDataTimestamp(&data)
+	partOfDay := extractPartOfDay(&data, dataTimestamp, sunrise, sunset)
 
-	// Classify weather type based on temperature
-	weatherType := classifyWeather(temperature)
+	// Flag extreme temperatures based on the temperature in Celsius
+	temperatureCelsius := toCelsius(temperature, units)
+	extreme, extremeReason := classifyExtreme(temperatureCelsius, units, currentConfig())
 
 	// Construct WeatherData struct and return
-	return &WeatherData{
+	weatherData := &WeatherData{
 		WeatherDescription: weatherDescription,
-		Temperature:        fmt.Sprintf("%v Celsius", temperature),
-		WeatherType:        weatherType,
+		Temperature:        formatTemperature(temperature, units),
+		Summary:            extractSummary(&data, temperature, units),
+		Extreme:            extreme,
+		ExtremeReason:      extremeReason,
 		Visibility:         visibility,
 		WindSpeed:          windSpeed,
 		WindDirection:      windDirection,
+		WindDirectionLabel: windDirectionLabel,
 		CloudCoverage:      cloudCoverage,
+		RainVolume:         rainVolume,
+		SnowVolume:         snowVolume,
 		Sunrise:            sunrise,
 		Sunset:             sunset,
-	}, nil
+		DataTimestamp:      dataTimestamp,
+		PartOfDay:          partOfDay,
+		LocationName:       strings.TrimSpace(data.Name),
+		Timezone:           timezone,
+		temperature:        temperature,
+		units:              units,
+	}
+
+	// Humidity and dew point are only reported when the API provides a humidity reading
+	if hasHumidity {
+		weatherData.Humidity = fmt.Sprintf("%v percentage", humidity)
+		weatherData.DewPoint = formatDewPoint(temperatureCelsius, humidity, units)
+	}
+
+	// Judge the comfort from the heat index or wind chill, with the wind speed in meters per second
+	var windSpeedMetersPerSecond float64
+	hasWind := data.Wind != nil && data.Wind.Speed != nil
+	if hasWind {
+		windSpeedMetersPerSecond = toMetersPerSecond(*data.Wind.Speed, units)
+	}
+	weatherData.comfort = comfortLevel(temperatureCelsius, humidity, hasHumidity, windSpeedMetersPerSecond, hasWind)
+
+	// Classify the weather type once everything else is known, so custom classifiers can use any field
+	weatherData.WeatherType = currentClassifier().Classify(*weatherData)
+	return weatherData, nil
+}
+
+// defaultZipCountry is the country code used when a ZIP code is given without one, matching the OpenWeatherMap default.
+const defaultZipCountry = "us"
+
+// zipPattern matches a postal code optionally followed by a comma and an ISO 3166 two-letter country code.
+var zipPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9 -]{1,9})(?:,([A-Za-z]{2}))?$`)
+
+// parseZip is a helper function that validates a ZIP/postal code query such as "94040" or "94040,US".
+// It returns the normalized "<code>,<country>" form, defaulting the country to defaultZipCountry when omitted.
+func parseZip(zip string) (string, error) {
+	matches := zipPattern.FindStringSubmatch(strings.TrimSpace(zip))
+	if matches == nil {
+		return "", fmt.Errorf("invalid zip code %q", zip)
+	}
+	country := strings.ToLower(matches[2])
+	if country == "" {
+		country = defaultZipCountry
+	}
+	return matches[1] + "," + country, nil
+}
+
+// maxZipLocations bounds the number of ZIP codes whose coordinates are remembered, see resolveZip.
+const maxZipLocations = 10000
+
+// zipLocations remembers the coordinates of the ZIP codes resolved so far, keyed by their "<code>,<country>" form.
+var (
+	zipLocationsMu sync.Mutex
+	zipLocations   = map[string]zipLocation{}
+)
+
+// zipLocation mirrors the parts of the response of the geocoding API for ZIP codes that are used.
+type zipLocation struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// resolveZip is a helper function that resolves a ZIP code in the "<code>,<country>" form produced by parseZip into
+// coordinates, so that ZIP lookups go through the same cached fetch path as coordinates. Codes do not move, so each is
+// looked up with the geocoding API once and remembered; the memory is emptied once it holds maxZipLocations codes.
+// Reference https://openweathermap.org/api/geocoding-api - Coordinates by zip/post code section
+func resolveZip(ctx context.Context, zip string, opts fetchOptions) (float64, float64, error) {
+	zipLocationsMu.Lock()
+	location, ok := zipLocations[zip]
+	zipLocationsMu.Unlock()
+	if ok {
+		return location.Lat, location.Lon, nil
+	}
+
+	url := fmt.Sprintf(openWeatherMapBaseURL+"/geo/1.0/zip?zip=%s&appid=%s", neturl.QueryEscape(zip), neturl.QueryEscape(opts.apiKey))
+	if err := fetchOpenWeatherMapJSON(ctx, "openweathermap geocoding", url, &location); err != nil {
+		return 0, 0, err
+	}
+
+	zipLocationsMu.Lock()
+	defer zipLocationsMu.Unlock()
+	if len(zipLocations) >= maxZipLocations {
+		zipLocations = map[string]zipLocation{}
+	}
+	zipLocations[zip] = location
+	return location.Lat, location.Lon, nil
 }
 
-// extractWeatherInfo is a helper function that extracts weather description and temperature from the JSON data.
-func extractWeatherInfo(data map[string]interface{}) (string, float64) {
+// defaultLang is the language used for weather descriptions when the request does not ask for one.
+const defaultLang = "en"
+
+// langPattern matches the shape of the OpenWeatherMap language codes, e.g. "de", "zh_cn" or "pt_br".
+// Reference https://openweathermap.org/current - Multilingual support section
+var langPattern = regexp.MustCompile(`^[A-Za-z]{2}(?:_[A-Za-z]{2})?$`)
+
+// parseLang is a helper function that validates a language code and returns it in the lowercase form used by the API.
+// Only the shape of the code is checked; whether the language is supported is left to the API, which falls back to English.
+func parseLang(lang string) (string, error) {
+	if !langPattern.MatchString(lang) {
+		return "", fmt.Errorf("invalid language code %q", lang)
+	}
+	return strings.ToLower(lang), nil
+}
+
+// owmResponse mirrors the parts of the OpenWeatherMap current weather response that are mapped into WeatherData.
+// Every optional part is a pointer, so a field missing from a partial response can be told apart from a zero reading.
+// Reference https://openweathermap.org/current - JSON section
+type owmResponse struct {
+	Coord      *owmCoord         `json:"coord"`
+	Weather    []owmCondition    `json:"weather"`
+	Main       *owmMain          `json:"main"`
+	Visibility *float64          `json:"visibility"`
+	Wind       *owmWind          `json:"wind"`
+	Clouds     *owmClouds        `json:"clouds"`
+	Rain       *owmPrecipitation `json:"rain"`
+	Snow       *owmPrecipitation `json:"snow"`
+	Dt         *int64            `json:"dt"`
+	Sys        *owmSys           `json:"sys"`
+	Timezone   *int              `json:"timezone"` // Shift in seconds from UTC
+	Name       string            `json:"name"`     // Name of the location, empty when unknown
+}
+
+// owmCoord is the location of an OpenWeatherMap response.
+type owmCoord struct {
+	Lat *float64 `json:"lat"`
+	Lon *float64 `json:"lon"`
+}
+
+// owmCondition is one weather condition of an OpenWeatherMap response.
+type owmCondition struct {
+	Description string `json:"description"`
+	Icon        string `json:"icon"` // Icon code such as "10d", whose suffix tells day from night
+}
+
+// owmMain holds the main readings of an OpenWeatherMap response.
+type owmMain struct {
+	Temp     *float64 `json:"temp"`
+	Humidity *float64 `json:"humidity"`
+}
+
+// owmWind holds the wind readings of an OpenWeatherMap response.
+type owmWind struct {
+	Speed *float64 `json:"speed"`
+	Deg   *float64 `json:"deg"`
+}
+
+// owmClouds holds the cloud coverage of an OpenWeatherMap response.
+type owmClouds struct {
+	All *float64 `json:"all"`
+}
+
+// owmPrecipitation holds the rain or snow volume of an OpenWeatherMap response.
+type owmPrecipitation struct {
+	OneHour *float64 `json:"1h"` // Volume for the last hour in mm
+}
+
+// owmSys holds the sunrise and sunset times of an OpenWeatherMap response as Unix timestamps.
+type owmSys struct {
+	Sunrise *int64 `json:"sunrise"`
+	Sunset  *int64 `json:"sunset"`
+}
+
+// extractWeatherInfo is a helper function that extracts weather description and temperature from the response.
+// The temperature is mandatory, so an error is returned when it is missing; the description is optional and left
+// empty when the 'weather' field is missing.
+func extractWeatherInfo(data *owmResponse) (string, float64, error) {
 	// Extract weather description from the 'weather' field
-	weatherArray := data["weather"].([]interface{})
-	weatherDescription := weatherArray[0].(map[string]interface{})["description"].(string)
+	var weatherDescription string
+	if len(data.Weather) > 0 {
+		weatherDescription = data.Weather[0].Description
+	}
+
+	// Extract temperature from the 'main' field, naming what is missing so incomplete payloads are easy to diagnose
+	if data.Main == nil {
+		return "", 0, errors.New("missing temperature: no 'main' object in response")
+	}
+	if data.Main.Temp == nil {
+		return "", 0, errors.New("missing temperature: no numeric 'main.temp' in response")
+	}
+
+	return weatherDescription, *data.Main.Temp, nil
+}
+
+// extractVisibility is a helper function that extracts visibility from the response.
+// The API always reports it in meters, so it is converted into the distance unit of the given unit system.
+// It returns an empty string when the optional 'visibility' field is missing.
+func extractVisibility(data *owmResponse, units string) string {
+	return formatOptionalVisibility(data.Visibility, units)
+}
+
+// formatOptionalVisibility is a helper function that formats a visibility reading in meters with formatVisibility,
+// or returns an empty string when the reading is missing, so that it is never passed off as a visibility of zero.
+func formatOptionalVisibility(meters *float64, units string) string {
+	if meters == nil {
+		return ""
+	}
+	return formatVisibility(*meters, units)
+}
+
+// extractWindInfo is a helper function that extracts wind speed and direction from the response.
+// The speed is labeled with the unit the API uses for the given unit system, see windSpeedUnitLabel.
+// Each value is returned as an empty string when it is missing from the optional 'wind' field.
+func extractWindInfo(data *owmResponse, units string) (string, string) {
+	var windSpeed, windDirection string
+	if data.Wind == nil {
+		return windSpeed, windDirection
+	}
+	if data.Wind.Speed != nil {
+		windSpeed = formatWindSpeed(*data.Wind.Speed, units)
+	}
+	if data.Wind.Deg != nil {
+		windDirection = fmt.Sprintf("%v degrees", int(*data.Wind.Deg))
+	}
+	return windSpeed, windDirection
+}
+
+// extractWindDirectionLabel is a helper function that extracts the wind direction from the response as a compass label.
+// It returns an empty string when the direction is missing from the optional 'wind' field.
+func extractWindDirectionLabel(data *owmResponse) string {
+	if data.Wind == nil || data.Wind.Deg == nil {
+		return ""
+	}
+	return compassLabel(*data.Wind.Deg)
+}
+
+// compassPoints lists the 16 points of the compass, clockwise from north.
+var compassPoints = []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
 
-	// Extract temperature from the 'main' field
-	temperature := data["main"].(map[string]interface{})["temp"].(float64)
+// compassLabel is a helper function that converts a direction in degrees into the nearest of the 16 compass points.
+// Every point covers 22.5 degrees centered on its direction, so for example 11.25 up to 33.75 degrees is "NNE".
+func compassLabel(degrees float64) string {
+	degrees = math.Mod(degrees, 360)
+	if degrees < 0 {
+		degrees += 360
+	}
+	sector := int((degrees+11.25)/22.5) % len(compassPoints)
+	return compassPoints[sector]
+}
 
-	return weatherDescription, temperature
+// extractSummary is a helper function that describes the weather of the response in one sentence, see weatherSummary.
+// The description, wind and location name are left out of the sentence when the response does not report them.
+func extractSummary(data *owmResponse, temperature float64, units string) string {
+	description, _, _ := extractWeatherInfo(data)
+	var windSpeed float64
+	hasWind := data.Wind != nil && data.Wind.Speed != nil
+	if hasWind {
+		windSpeed = *data.Wind.Speed
+	}
+	return weatherSummary(description, temperature, units, windSpeed, hasWind, data.Name)
 }
 
-// extractVisibility is a helper function that extracts visibility from the JSON data.
-func extractVisibility(data map[string]interface{}) string {
-	// Extract visibility from the 'visibility' field and convert to kilometers
-	visibility := int(data["visibility"].(float64)) / 1000
-	return fmt.Sprintf("%v KM", visibility)
+// extractCloudCoverage is a helper function that extracts cloud coverage from the response.
+// It returns an empty string when the optional 'clouds' field is missing.
+func extractCloudCoverage(data *owmResponse) string {
+	if data.Clouds == nil || data.Clouds.All == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v percentage", int(*data.Clouds.All))
 }
 
-// extractWindInfo is a helper function that extracts wind speed and direction from the JSON data.
-func extractWindInfo(data map[string]interface{}) (string, string) {
-	// Extract wind speed and direction from the 'wind' field
-	windData := data["wind"].(map[string]interface{})
-	windSpeed := windData["speed"].(float64)
-	windDirection := int(windData["deg"].(float64))
-	return fmt.Sprintf("%v meter/sec", windSpeed), fmt.Sprintf("%v degrees", windDirection)
+// extractPrecipitation is a helper function that extracts the rain and snow volume for the last hour from the response.
+// Both fields are optional in the API response, so an empty string is returned for any volume that is not present.
+func extractPrecipitation(data *owmResponse) (string, string) {
+	// Format the '1h' volume of an optional precipitation object such as 'rain' or 'snow'
+	volume := func(precipitation *owmPrecipitation) string {
+		if precipitation == nil || precipitation.OneHour == nil {
+			return ""
+		}
+		return fmt.Sprintf("%s mm", formatNumber(*precipitation.OneHour))
+	}
+	return volume(data.Rain), volume(data.Snow)
 }
 
-// extractCloudCoverage is a helper function that extracts cloud coverage from the JSON data.
-func extractCloudCoverage(data map[string]interface{}) string {
-	// Extract cloud coverage from the 'clouds' field
-	cloudData := data["clouds"].(map[string]interface{})
-	cloudCoverage := int(cloudData["all"].(float64))
-	return fmt.Sprintf("%v percentage", cloudCoverage)
+// extractHumidity is a helper function that extracts the relative humidity from the response.
+// The second return value reports whether a humidity reading was present.
+func extractHumidity(data *owmResponse) (float64, bool) {
+	// The 'main' field may be missing in partial responses
+	if data.Main == nil || data.Main.Humidity == nil {
+		return 0, false
+	}
+	return *data.Main.Humidity, true
 }
 
-// extractSunriseSunset is a helper function that extracts sunrise and sunset times from the JSON data.
-func extractSunriseSunset(data map[string]interface{}) (time.Time, time.Time) {
-	// Extract sunrise and sunset times from the 'sys' field
-	sunriseUnix := int64(data["sys"].(map[string]interface{})["sunrise"].(float64))
-	sunsetUnix := int64(data["sys"].(map[string]interface{})["sunset"].(float64))
-	sunrise := time.Unix(sunriseUnix, 0)
-	sunset := time.Unix(sunsetUnix, 0)
+// extractSunriseSunset is a helper function that extracts sunrise and sunset times from the response.
+// A time missing from the optional 'sys' field is returned as the zero time.
+func extractSunriseSunset(data *owmResponse) (time.Time, time.Time) {
+	var sunrise, sunset time.Time
+	if data.Sys == nil {
+		return sunrise, sunset
+	}
+	if data.Sys.Sunrise != nil {
+		sunrise = time.Unix(*data.Sys.Sunrise, 0)
+	}
+	if data.Sys.Sunset != nil {
+		sunset = time.Unix(*data.Sys.Sunset, 0)
+	}
 	return sunrise, sunset
 }
 
-// classifyWeather is a helper function that classifies the weather type based on temperature.
+// extractDataTimestamp is a helper function that extracts the time of the observation from the 'dt' field of the response.
+// It returns the zero time when the field is missing.
+func extractDataTimestamp(data *owmResponse) time.Time {
+	if data.Dt == nil {
+		return time.Time{}
+	}
+	return time.Unix(*data.Dt, 0)
+}
+
+// Parts of the day reported in the PartOfDay field.
+const (
+	partOfDayDay   = "day"
+	partOfDayNight = "night"
+)
+
+// extractPartOfDay is a helper function that tells whether the response describes day or night.
+// The icon code of the first weather condition ends in 'd' or 'n' for day or night; when it is missing,
+// the observation time (or the current time if unknown) is compared against sunrise and sunset instead.
+func extractPartOfDay(data *owmResponse, observed, sunrise, sunset time.Time) string {
+	if len(data.Weather) > 0 {
+		if part := partOfDayFromIcon(data.Weather[0].Icon); part != "" {
+			return part
+		}
+	}
+	return partOfDayFromSun(observed, sunrise, sunset)
+}
+
+// partOfDayFromIcon is a helper function that reads the part of the day from an OpenWeatherMap icon code such as "10d".
+// It returns an empty string when the code carries no day or night suffix.
+func partOfDayFromIcon(icon string) string {
+	switch {
+	case strings.HasSuffix(icon, "d"):
+		return partOfDayDay
+	case strings.HasSuffix(icon, "n"):
+		return partOfDayNight
+	}
+	return ""
+}
+
+// partOfDayFromSun is a helper function that determines the part of the day by comparing a time against sunrise and sunset.
+// A zero time t stands for the current time. An empty string is returned when sunrise or sunset is unknown.
+func partOfDayFromSun(t, sunrise, sunset time.Time) string {
+	if sunrise.IsZero() || sunset.IsZero() {
+		return ""
+	}
+	if t.IsZero() {
+		t = now()
+	}
+	if !t.Before(sunrise) && t.Before(sunset) {
+		return partOfDayDay
+	}
+	return partOfDayNight
+}
+
+// extractTimezone is a helper function that resolves the IANA timezone name of the location in the response.
+// The API only reports the UTC offset in the 'timezone' field, so the name is looked up from the 'coord' field
+// and the offset using lookupTimezone. An empty string is returned when the coordinates are missing or no match is found.
+func extractTimezone(data *owmResponse) string {
+	if data.Coord == nil || data.Coord.Lat == nil || data.Coord.Lon == nil {
+		return ""
+	}
+	var offset int
+	if data.Timezone != nil {
+		offset = *data.Timezone
+	}
+	return lookupTimezone(*data.Coord.Lat, *data.Coord.Lon, offset, data.Timezone != nil)
+}
+
+// dewPoint is a helper function that calculates the dew point in Celsius from the temperature in Celsius and
+// the relative humidity in percent using the Magnus formula with the Sonntag (1990) coefficients.
+// It reports false for a humidity of zero or less, for which the formula has no finite result.
+func dewPoint(temperature, humidity float64) (float64, bool) {
+	if !(humidity > 0) {
+		return 0, false
+	}
+	const a, b = 17.62, 243.12
+	gamma := math.Log(humidity/100) + a*temperature/(b+temperature)
+	return b * gamma / (a - gamma), true
+}
+
+// formatDewPoint is a helper function that formats the dew point of a temperature in Celsius and a relative humidity
+// in percent in the given unit system, or returns an empty string when the humidity admits no dew point.
+func formatDewPoint(temperatureCelsius, humidity float64, units string) string {
+	point, ok := dewPoint(temperatureCelsius, humidity)
+	if !ok {
+		return ""
+	}
+	return formatTemperature(fromCelsius(point, units), units)
+}
+
+// formatNumber is a helper function that rounds a numeric value to the configured NumberPrecision decimal places and
+// formats it. A precision of -1 falls back to the shortest representation that round-trips the value.
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', currentConfig().NumberPrecision, 64)
+}
+
+// classifyExtreme is a helper function that tells whether a temperature in Celsius is outside the configured
+// ExtremeCold and ExtremeHot thresholds. The reason quotes the crossed threshold in the given unit system, e.g.
+// "Temperature below 14 Fahrenheit"; readings exactly at a threshold are not extreme.
+func classifyExtreme(temperatureCelsius float64, units string, cfg *Config) (bool, string) {
+	switch {
+	case temperatureCelsius < cfg.ExtremeCold:
+		return true, "Temperature below " + formatTemperature(fromCelsius(cfg.ExtremeCold, units), units)
+	case temperatureCelsius > cfg.ExtremeHot:
+		return true, "Temperature above " + formatTemperature(fromCelsius(cfg.ExtremeHot, units), units)
+	}
+	return false, ""
+}
+
+// classifyWeather is a helper function that classifies the weather type based on the temperature in Celsius,
+// see DefaultClassifier.
 func classifyWeather(temperature float64) string {
 	// Classify weather type based on temperature ranges
 	if temperature <= 10 {
@@ -0,0 +1,837 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDewPoint(t *testing.T) {
+	tests := []struct {
+		temperature, humidity float64
+		want                  float64
+		wantOK                bool
+	}{
+		{temperature: 20, humidity: 50, want: 9.255, wantOK: true},
+		{temperature: 0, humidity: 80, want: -3.040, wantOK: true},
+		{temperature: -10, humidity: 60, want: -16.305, wantOK: true},
+		{temperature: 30, humidity: 100, want: 30, wantOK: true},
+		{temperature: 20, humidity: 0},
+		{temperature: 20, humidity: -5},
+		{temperature: 20, humidity: math.NaN()},
+	}
+	for _, tt := range tests {
+		got, ok := dewPoint(tt.temperature, tt.humidity)
+		if ok != tt.wantOK || math.Abs(got-tt.want) > 0.001 {
+			t.Errorf("dewPoint(%v, %v) = %v, %v; want %v, %v", tt.temperature, tt.humidity, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestFormatDewPoint(t *testing.T) {
+	tests := []struct {
+		units    string
+		humidity float64
+		want     string
+	}{
+		{units: UnitsMetric, humidity: 50, want: "9.3 Celsius"},
+		{units: UnitsImperial, humidity: 50, want: "48.7 Fahrenheit"},
+		{units: UnitsStandard, humidity: 50, want: "282.4 Kelvin"},
+		{units: UnitsMetric, humidity: 0, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.units, func(t *testing.T) {
+			setupTest(t)
+			if got := formatDewPoint(20, tt.humidity, tt.units); got != tt.want {
+				t.Errorf("formatDewPoint(20, %v, %s) = %q, want %q", tt.humidity, tt.units, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerDewPoint(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "humidity reported",
+			body: sampleCurrentWeather,
+			want: []string{`"humidity":"64 percentage"`, `"dew_point":"11.5 Celsius"`},
+		},
+		{
+			name: "humidity missing",
+			body: strings.Replace(sampleCurrentWeather, `,"humidity":64`, "", 1),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			body := recorder.Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("body %s does not contain %s", body, want)
+				}
+			}
+			if tt.want == nil && (strings.Contains(body, `"humidity"`) || strings.Contains(body, `"dew_point"`)) {
+				t.Errorf("body %s reports a humidity or dew point the upstream did not send", body)
+			}
+		})
+	}
+}
+
+func TestParseZip(t *testing.T) {
+	tests := []struct {
+		zip     string
+		want    string
+		wantErr bool
+	}{
+		{zip: "94040", want: "94040,us"},
+		{zip: "94040,US", want: "94040,us"},
+		{zip: " SW1A 1AA,gb ", want: "SW1A 1AA,gb"},
+		{zip: "10115,de", want: "10115,de"},
+		{zip: "", wantErr: true},
+		{zip: "9", wantErr: true},
+		{zip: "94040,USA", wantErr: true},
+		{zip: "94040;DROP", wantErr: true},
+		{zip: "12345678901", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseZip(tt.zip)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseZip(%q) = %q, %v; want %q, error %v", tt.zip, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWeatherHandlerZip(t *testing.T) {
+	// Reference https://openweathermap.org/api/geocoding-api - Coordinates by zip/post code section
+	const zipLocationBody = `{"zip":"94040","name":"Mountain View","lat":37.3855,"lon":-122.088,"country":"US"}`
+
+	tests := []struct {
+		name       string
+		apiVersion string
+		target     string
+		wantStatus int
+		wantCalls  map[string]string // Query parameter checked on the single call expected for each upstream path
+	}{
+		{
+			name:       "current weather 2.5",
+			apiVersion: OWMAPIVersion25,
+			target:     "/weather?zip=94040",
+			wantStatus: http.StatusOK,
+			wantCalls:  map[string]string{"/geo/1.0/zip": "zip=94040,us", currentWeatherPath: "lat=37.385500"},
+		},
+		{
+			name:       "one call 3.0",
+			apiVersion: OWMAPIVersion30,
+			target:     "/weather?zip=94040,US",
+			wantStatus: http.StatusOK,
+			wantCalls:  map[string]string{"/geo/1.0/zip": "zip=94040,us", oneCallPath: "lat=37.385500"},
+		},
+		{
+			name:       "unknown code",
+			apiVersion: OWMAPIVersion25,
+			target:     "/weather?zip=00000",
+			wantStatus: http.StatusNotFound,
+			wantCalls:  map[string]string{"/geo/1.0/zip": "zip=00000,us"},
+		},
+		{
+			name:       "invalid code",
+			apiVersion: OWMAPIVersion25,
+			target:     "/weather?zip=9",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "code combined with coordinates",
+			apiVersion: OWMAPIVersion25,
+			target:     "/weather?zip=94040&lat=1&lon=2",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.apiVersion })
+			upstream := newUpstream(t, map[string]http.HandlerFunc{
+				currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather),
+				oneCallPath:        respond(http.StatusOK, sampleOneCall),
+				"/geo/1.0/zip": func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Query().Get("zip") == "00000,us" {
+						respond(http.StatusNotFound, `{"cod":"404","message":"not found"}`)(w, r)
+						return
+					}
+					respond(http.StatusOK, zipLocationBody)(w, r)
+				},
+			})
+
+			recorder := serve(WeatherHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			for path, param := range tt.wantCalls {
+				calls := upstream.calls(path)
+				name, value, _ := strings.Cut(param, "=")
+				if len(calls) != 1 || calls[0].Query().Get(name) != value {
+					t.Errorf("calls to %s = %v, want one with %s", path, calls, param)
+				}
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerZipFetchPath(t *testing.T) {
+	const zipLocationBody = `{"zip":"94040","name":"Mountain View","lat":37.3855,"lon":-122.088,"country":"US"}`
+	tests := []struct {
+		name        string
+		targets     []string       // Requests made in order
+		failing     bool           // Whether OpenWeatherMap fails every weather call
+		wantZip     int            // Calls to the geocoding API
+		wantWeather map[string]int // Calls per weather path
+	}{
+		{
+			name:        "repeated lookups share the cache",
+			targets:     []string{"/weather?zip=94040", "/weather?zip=94040,US"},
+			wantZip:     1,
+			wantWeather: map[string]int{currentWeatherPath: 1},
+		},
+		{
+			name:        "lookups by code and by coordinates share the cache",
+			targets:     []string{"/weather?zip=94040", "/weather?lat=37.3855&lon=-122.088"},
+			wantZip:     1,
+			wantWeather: map[string]int{currentWeatherPath: 1},
+		},
+		{
+			name:        "fallback provider",
+			targets:     []string{"/weather?zip=94040"},
+			failing:     true,
+			wantZip:     1,
+			wantWeather: map[string]int{currentWeatherPath: 1, openMeteoPath: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			MaxUpstreamAttempts = 1
+			RegisterProvider(OpenMeteoProvider{})
+			weather := respond(http.StatusOK, sampleCurrentWeather)
+			if tt.failing {
+				weather = respond(http.StatusServiceUnavailable, ``)
+			}
+			upstream := newUpstream(t, map[string]http.HandlerFunc{
+				"/geo/1.0/zip":     respond(http.StatusOK, zipLocationBody),
+				currentWeatherPath: weather,
+				openMeteoPath:      respond(http.StatusOK, sampleOpenMeteo),
+			})
+
+			for _, target := range tt.targets {
+				if recorder := serve(WeatherHandler, http.MethodGet, target, nil); recorder.Code != http.StatusOK {
+					t.Fatalf("%s status = %d; body %s", target, recorder.Code, recorder.Body)
+				}
+			}
+
+			if calls := len(upstream.calls("/geo/1.0/zip")); calls != tt.wantZip {
+				t.Errorf("geocoding calls = %d, want %d", calls, tt.wantZip)
+			}
+			for path, want := range tt.wantWeather {
+				if calls := len(upstream.calls(path)); calls != want {
+					t.Errorf("calls to %s = %d, want %d", path, calls, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		precision int
+		want      string
+	}{
+		{precision: -1, want: "21.347"},
+		{precision: 0, want: "21"},
+		{precision: 1, want: "21.3"},
+		{precision: 2, want: "21.35"},
+		{precision: 4, want: "21.3470"},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.precision), func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.NumberPrecision = tt.precision })
+			if got := formatNumber(21.347); got != tt.want {
+				t.Errorf("formatNumber(21.347) = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractCurrentWeatherPrecipitation(t *testing.T) {
+	tests := []struct {
+		name               string
+		precipitation      string
+		wantRain, wantSnow string
+	}{
+		{name: "none"},
+		{name: "rain", precipitation: `"rain":{"1h":2.73},`, wantRain: "2.7 mm"},
+		{name: "snow", precipitation: `"snow":{"1h":0.5},`, wantSnow: "0.5 mm"},
+		{name: "rain and snow", precipitation: `"rain":{"1h":1},"snow":{"1h":3.25},`, wantRain: "1.0 mm", wantSnow: "3.2 mm"},
+		{name: "three hour volume only", precipitation: `"rain":{"3h":4},`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			body := strings.Replace(sampleCurrentWeather, `"clouds":`, tt.precipitation+`"clouds":`, 1)
+
+			got, err := extractCurrentWeather([]byte(body), UnitsMetric)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.RainVolume != tt.wantRain || got.SnowVolume != tt.wantSnow {
+				t.Errorf("rain %q, snow %q; want %q, %q", got.RainVolume, got.SnowVolume, tt.wantRain, tt.wantSnow)
+			}
+		})
+	}
+}
+
+func TestParseLang(t *testing.T) {
+	tests := []struct {
+		lang    string
+		want    string
+		wantErr bool
+	}{
+		{lang: "de", want: "de"},
+		{lang: "FR", want: "fr"},
+		{lang: "zh_CN", want: "zh_cn"},
+		{lang: "pt_br", want: "pt_br"},
+		{lang: "", wantErr: true},
+		{lang: "german", wantErr: true},
+		{lang: "zh-cn", wantErr: true},
+		{lang: "d3", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLang(tt.lang)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseLang(%q) = %q, %v; want %q, error %v", tt.lang, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWeatherHandlerLang(t *testing.T) {
+	tests := []struct {
+		name       string
+		langs      []string // lang parameters of consecutive requests for the same location, "" for none
+		wantStatus int
+		wantLangs  []string // Languages requested from the upstream, in order
+	}{
+		{name: "default", langs: []string{""}, wantStatus: http.StatusOK, wantLangs: []string{defaultLang}},
+		{name: "explicit", langs: []string{"DE"}, wantStatus: http.StatusOK, wantLangs: []string{"de"}},
+		{name: "cached per language", langs: []string{"de", "fr", "de"}, wantStatus: http.StatusOK, wantLangs: []string{"de", "fr"}},
+		{name: "invalid", langs: []string{"deutsch"}, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			for _, lang := range tt.langs {
+				target := "/weather?lat=51.51&lon=-0.13"
+				if lang != "" {
+					target += "&lang=" + lang
+				}
+				if recorder := serve(WeatherHandler, http.MethodGet, target, nil); recorder.Code != tt.wantStatus {
+					t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+				}
+			}
+
+			var got []string
+			for _, call := range upstream.calls(currentWeatherPath) {
+				got = append(got, call.Query().Get("lang"))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantLangs, ",") {
+				t.Errorf("upstream languages = %q, want %q", got, tt.wantLangs)
+			}
+		})
+	}
+}
+
+func TestExtractCurrentWeatherPartialResponse(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		empty func(data *WeatherData) bool // Reports whether the fields of the missing part were left empty
+	}{
+		{
+			name:  "no conditions",
+			body:  strings.Replace(sampleCurrentWeather, `"weather":[{"id":803,"main":"Clouds","description":"broken clouds","icon":"04d"}],`, "", 1),
+			empty: func(data *WeatherData) bool { return data.WeatherDescription == "" },
+		},
+		{
+			name:  "no visibility",
+			body:  strings.Replace(sampleCurrentWeather, `"visibility":10000,`, "", 1),
+			empty: func(data *WeatherData) bool { return data.Visibility == "" },
+		},
+		{
+			name:  "no clouds",
+			body:  strings.Replace(sampleCurrentWeather, `"clouds":{"all":75},`, "", 1),
+			empty: func(data *WeatherData) bool { return data.CloudCoverage == "" },
+		},
+		{
+			name:  "no sunrise and sunset",
+			body:  strings.Replace(sampleCurrentWeather, `"sys":{"country":"GB","sunrise":1717213671,"sunset":1717272614},`, "", 1),
+			empty: func(data *WeatherData) bool { return data.Sunrise.IsZero() && data.Sunset.IsZero() },
+		},
+		{
+			name:  "no name",
+			body:  strings.Replace(sampleCurrentWeather, `"name":"London",`, "", 1),
+			empty: func(data *WeatherData) bool { return data.LocationName == "" },
+		},
+		{
+			name: "temperature only",
+			body: `{"main":{"temp":18.4}}`,
+			empty: func(data *WeatherData) bool {
+				return data.WeatherDescription == "" && data.Visibility == "" && data.WindSpeed == "" && data.CloudCoverage == "" &&
+					data.Humidity == "" && data.Sunrise.IsZero() && data.DataTimestamp.IsZero() && data.LocationName == ""
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+
+			got, err := extractCurrentWeather([]byte(tt.body), UnitsMetric)
+
+			if err != nil {
+				t.Fatalf("partial response failed: %v", err)
+			}
+			if got.Temperature != "18.4 Celsius" || got.WeatherType != "moderate" {
+				t.Errorf("temperature %q, type %q; want 18.4 Celsius, moderate", got.Temperature, got.WeatherType)
+			}
+			if !tt.empty(got) {
+				t.Errorf("fields of the missing part were filled in: %+v", got)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerDataTimestamp(t *testing.T) {
+	observed := time.Unix(1717243200, 0)
+	tests := []struct {
+		name     string
+		provider Provider
+		version  string
+		path     string
+		body     string
+		want     time.Time
+	}{
+		{name: "current weather 2.5", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather, want: observed},
+		{name: "current weather 2.5 without dt", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: strings.Replace(sampleCurrentWeather, `"dt":1717243200,`, "", 1)},
+		{name: "one call 3.0", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion30, path: oneCallPath, body: sampleOneCall, want: observed},
+		{name: "one call 3.0 without dt", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion30, path: oneCallPath, body: strings.Replace(sampleOneCall, `"dt":1717243200,`, "", 1)},
+		{name: "open-meteo", provider: OpenMeteoProvider{}, version: OWMAPIVersion25, path: openMeteoPath, body: sampleOpenMeteo, want: observed},
+		{name: "open-meteo without time", provider: OpenMeteoProvider{}, version: OWMAPIVersion25, path: openMeteoPath, body: strings.Replace(sampleOpenMeteo, `"time":1717243200,`, "", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			providersMu.Lock()
+			providers = []Provider{tt.provider}
+			providersMu.Unlock()
+			newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !got.DataTimestamp.Equal(tt.want) {
+				t.Errorf("data timestamp = %v, want %v", got.DataTimestamp, tt.want)
+			}
+			if tt.want.IsZero() && strings.Contains(recorder.Body.String(), `"data_timestamp"`) {
+				t.Errorf("body %s reports a timestamp the upstream did not send", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerVisibility(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		path    string
+		body    string
+		units   string
+		want    string // Reported visibility, absent when empty
+	}{
+		{name: "2.5 metric", version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather, units: UnitsMetric, want: "10.0 KM"},
+		{name: "2.5 imperial", version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather, units: UnitsImperial, want: "6.2 MI"},
+		{name: "2.5 missing", version: OWMAPIVersion25, path: currentWeatherPath, body: strings.Replace(sampleCurrentWeather, `"visibility":10000,`, "", 1), units: UnitsMetric},
+		{name: "3.0 metric", version: OWMAPIVersion30, path: oneCallPath, body: sampleOneCall, units: UnitsMetric, want: "10.0 KM"},
+		{name: "3.0 imperial", version: OWMAPIVersion30, path: oneCallPath, body: sampleOneCall, units: UnitsImperial, want: "6.2 MI"},
+		{name: "3.0 missing", version: OWMAPIVersion30, path: oneCallPath, body: strings.Replace(sampleOneCall, `"visibility":10000,`, "", 1), units: UnitsImperial},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13&units="+tt.units, nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Visibility != tt.want {
+				t.Errorf("visibility = %q, want %q", got.Visibility, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartOfDayFromSun(t *testing.T) {
+	sunrise, sunset := time.Unix(1717213671, 0), time.Unix(1717272614, 0)
+	tests := []struct {
+		name            string
+		t               time.Time
+		sunrise, sunset time.Time
+		clock           time.Time // Current time, used when t is zero
+		want            string
+	}{
+		{name: "before sunrise", t: sunrise.Add(-time.Minute), sunrise: sunrise, sunset: sunset, want: partOfDayNight},
+		{name: "at sunrise", t: sunrise, sunrise: sunrise, sunset: sunset, want: partOfDayDay},
+		{name: "daytime", t: sunrise.Add(6 * time.Hour), sunrise: sunrise, sunset: sunset, want: partOfDayDay},
+		{name: "at sunset", t: sunset, sunrise: sunrise, sunset: sunset, want: partOfDayNight},
+		{name: "current time", sunrise: sunrise, sunset: sunset, clock: sunset.Add(-time.Hour), want: partOfDayDay},
+		{name: "unknown sunrise", t: sunrise.Add(6 * time.Hour), sunset: sunset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetClock(FixedClock(tt.clock))
+			if got := partOfDayFromSun(tt.t, tt.sunrise, tt.sunset); got != tt.want {
+				t.Errorf("partOfDayFromSun() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerPartOfDay(t *testing.T) {
+	night := func(body string) string { return strings.Replace(body, `"icon":"04d"`, `"icon":"04n"`, 1) }
+	noIcon := func(body string) string { return strings.Replace(body, `,"icon":"04d"`, "", 1) }
+	afterSunset := func(body string) string { return strings.Replace(body, `"dt":1717243200`, `"dt":1717280000`, 1) }
+	tests := []struct {
+		name    string
+		version string
+		path    string
+		body    string
+		want    string
+	}{
+		{name: "2.5 day icon", version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather, want: partOfDayDay},
+		{name: "2.5 night icon", version: OWMAPIVersion25, path: currentWeatherPath, body: night(sampleCurrentWeather), want: partOfDayNight},
+		{name: "2.5 no icon by day", version: OWMAPIVersion25, path: currentWeatherPath, body: noIcon(sampleCurrentWeather), want: partOfDayDay},
+		{name: "2.5 no icon after sunset", version: OWMAPIVersion25, path: currentWeatherPath, body: afterSunset(noIcon(sampleCurrentWeather)), want: partOfDayNight},
+		{
+			name:    "2.5 no icon nor sunrise and sunset",
+			version: OWMAPIVersion25,
+			path:    currentWeatherPath,
+			body:    strings.Replace(noIcon(sampleCurrentWeather), `"sys":{"country":"GB","sunrise":1717213671,"sunset":1717272614},`, "", 1),
+		},
+		{name: "3.0 night icon", version: OWMAPIVersion30, path: oneCallPath, body: night(sampleOneCall), want: partOfDayNight},
+		{name: "3.0 no icon after sunset", version: OWMAPIVersion30, path: oneCallPath, body: afterSunset(noIcon(sampleOneCall)), want: partOfDayNight},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.PartOfDay != tt.want {
+				t.Errorf("part of day = %q, want %q", got.PartOfDay, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompassLabel(t *testing.T) {
+	tests := []struct {
+		degrees float64
+		want    string
+	}{
+		{degrees: 0, want: "N"},
+		{degrees: 11.24, want: "N"},
+		{degrees: 11.25, want: "NNE"},
+		{degrees: 33.74, want: "NNE"},
+		{degrees: 33.75, want: "NE"},
+		{degrees: 90, want: "E"},
+		{degrees: 120, want: "ESE"},
+		{degrees: 180, want: "S"},
+		{degrees: 250, want: "WSW"},
+		{degrees: 348.74, want: "NNW"},
+		{degrees: 348.75, want: "N"},
+		{degrees: 359.99, want: "N"},
+		{degrees: 360, want: "N"},
+		{degrees: 450, want: "E"},
+		{degrees: -90, want: "W"},
+	}
+	for _, tt := range tests {
+		if got := compassLabel(tt.degrees); got != tt.want {
+			t.Errorf("compassLabel(%v) = %q, want %q", tt.degrees, got, tt.want)
+		}
+	}
+}
+
+func TestExtractCurrentWeatherWindDirection(t *testing.T) {
+	tests := []struct {
+		name                   string
+		wind                   string
+		wantDegrees, wantLabel string
+	}{
+		{name: "reported", wind: `"wind":{"speed":4.1,"deg":120}`, wantDegrees: "120 degrees", wantLabel: "ESE"},
+		{name: "north", wind: `"wind":{"speed":4.1,"deg":0}`, wantDegrees: "0 degrees", wantLabel: "N"},
+		{name: "no direction", wind: `"wind":{"speed":4.1}`},
+		{name: "no wind", wind: `"wind":{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			body := strings.Replace(sampleCurrentWeather, `"wind":{"speed":4.1,"deg":250}`, tt.wind, 1)
+
+			got, err := extractCurrentWeather([]byte(body), UnitsMetric)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.WindDirection != tt.wantDegrees || got.WindDirectionLabel != tt.wantLabel {
+				t.Errorf("direction %q, label %q; want %q, %q", got.WindDirection, got.WindDirectionLabel, tt.wantDegrees, tt.wantLabel)
+			}
+		})
+	}
+}
+
+func TestProviderFetchMissingTemperature(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider Provider
+		version  string
+		path     string
+		body     string
+		wantMsg  string // Part of the error naming what is missing
+	}{
+		{name: "no main", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: strings.Replace(sampleCurrentWeather, `"main":{"temp":18.4,"humidity":64},`, "", 1), wantMsg: "no 'main' object"},
+		{name: "no main.temp", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: strings.Replace(sampleCurrentWeather, `"temp":18.4,`, "", 1), wantMsg: "no numeric 'main.temp'"},
+		{name: "null main.temp", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":null`, 1), wantMsg: "no numeric 'main.temp'"},
+		{name: "error payload", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: `{"cod":"200","message":"internal error"}`, wantMsg: "no 'main' object"},
+		{name: "one call without current.temp", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion30, path: oneCallPath, body: strings.Replace(sampleOneCall, `"temp":18.4,`, "", 1), wantMsg: "missing temperature"},
+		{name: "open-meteo without temperature_2m", provider: OpenMeteoProvider{}, version: OWMAPIVersion25, path: openMeteoPath, body: strings.Replace(sampleOpenMeteo, `"temperature_2m":18.4,`, "", 1), wantMsg: "missing current.temperature_2m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			got, err := tt.provider.Fetch(context.Background(), 51.51, -0.13)
+
+			if !errors.Is(err, ErrInvalidResponse) || !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Fatalf("Fetch() error = %v, want %v naming %q", err, ErrInvalidResponse, tt.wantMsg)
+			}
+			if got != nil {
+				t.Errorf("Fetch() = %+v, want no data rather than a zero temperature", got)
+			}
+		})
+	}
+}
+
+func TestExtractCurrentWeatherMistypedFields(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "temperature as a string", body: strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":"18.4"`, 1)},
+		{name: "main as a list", body: strings.Replace(sampleCurrentWeather, `"main":{"temp":18.4,"humidity":64}`, `"main":[18.4,64]`, 1)},
+		{name: "weather as an object", body: strings.Replace(sampleCurrentWeather, `"weather":[{"id":803,"main":"Clouds","description":"broken clouds","icon":"04d"}]`, `"weather":{"id":803}`, 1)},
+		{name: "sunrise as a date", body: strings.Replace(sampleCurrentWeather, `"sunrise":1717213671`, `"sunrise":"2024-06-01T04:47:51Z"`, 1)},
+		{name: "truncated", body: sampleCurrentWeather[:len(sampleCurrentWeather)/2]},
+		{name: "not an object", body: `[1,2,3]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractCurrentWeather([]byte(tt.body), UnitsMetric)
+
+			if !errors.Is(err, ErrInvalidResponse) || got != nil {
+				t.Errorf("extractCurrentWeather() = %+v, %v; want %v", got, err, ErrInvalidResponse)
+			}
+		})
+	}
+}
+
+func FuzzExtractCurrentWeather(f *testing.F) {
+	f.Add([]byte(sampleCurrentWeather))
+	f.Add([]byte(sampleCurrentWeather[:len(sampleCurrentWeather)/3]))
+	f.Add([]byte(`{"main":{"temp":18.4}}`))
+	f.Add([]byte(`{"main":{"temp":null},"weather":[null],"wind":{"deg":-1},"sys":{"sunrise":0}}`))
+	f.Add([]byte(`{"main":{"temp":1e308},"visibility":-5,"rain":{"1h":"x"}}`))
+	f.Add([]byte(`null`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		for _, units := range []string{UnitsMetric, UnitsImperial, UnitsStandard} {
+			got, err := extractCurrentWeather(body, units)
+			if err != nil {
+				if !errors.Is(err, ErrInvalidResponse) || got != nil {
+					t.Fatalf("extractCurrentWeather(%q) = %+v, %v; want only an %v", body, got, err, ErrInvalidResponse)
+				}
+				continue
+			}
+			if got == nil || got.Temperature == "" || got.WeatherType == "" {
+				t.Fatalf("extractCurrentWeather(%q) = %+v without a temperature", body, got)
+			}
+		}
+	})
+}
+
+func TestClassifyExtreme(t *testing.T) {
+	defaults := DefaultConfig()
+	custom := DefaultConfig()
+	custom.ExtremeCold, custom.ExtremeHot = 0, 30
+	tests := []struct {
+		name        string
+		celsius     float64
+		units       string
+		cfg         *Config
+		wantExtreme bool
+		wantReason  string
+	}{
+		{name: "mild", celsius: 18.4, units: UnitsMetric, cfg: defaults},
+		{name: "at the cold threshold", celsius: -10, units: UnitsMetric, cfg: defaults},
+		{name: "just below the cold threshold", celsius: -10.01, units: UnitsMetric, cfg: defaults, wantExtreme: true, wantReason: "Temperature below -10.0 Celsius"},
+		{name: "at the hot threshold", celsius: 40, units: UnitsMetric, cfg: defaults},
+		{name: "just above the hot threshold", celsius: 40.01, units: UnitsMetric, cfg: defaults, wantExtreme: true, wantReason: "Temperature above 40.0 Celsius"},
+		{name: "hot in imperial units", celsius: 45, units: UnitsImperial, cfg: defaults, wantExtreme: true, wantReason: "Temperature above 104.0 Fahrenheit"},
+		{name: "cold in standard units", celsius: -20, units: UnitsStandard, cfg: defaults, wantExtreme: true, wantReason: "Temperature below 263.1 Kelvin"},
+		{name: "custom cold threshold", celsius: -0.5, units: UnitsMetric, cfg: custom, wantExtreme: true, wantReason: "Temperature below 0.0 Celsius"},
+		{name: "custom hot threshold", celsius: 31, units: UnitsMetric, cfg: custom, wantExtreme: true, wantReason: "Temperature above 30.0 Celsius"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+
+			extreme, reason := classifyExtreme(tt.celsius, tt.units, tt.cfg)
+
+			if extreme != tt.wantExtreme || reason != tt.wantReason {
+				t.Errorf("classifyExtreme(%v, %s) = %v, %q; want %v, %q", tt.celsius, tt.units, extreme, reason, tt.wantExtreme, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerExtreme(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     string
+		path        string
+		body        string
+		query       string
+		wantExtreme bool
+		wantReason  string
+	}{
+		{name: "mild", version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather},
+		{name: "at the threshold", version: OWMAPIVersion25, path: currentWeatherPath, body: strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":40`, 1)},
+		{name: "heatwave", version: OWMAPIVersion25, path: currentWeatherPath, body: strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":41.2`, 1), wantExtreme: true, wantReason: "Temperature above 40.0 Celsius"},
+		// The upstream reports imperial temperatures in Fahrenheit: 12.2 is about -11 Celsius
+		{name: "cold in imperial units", version: OWMAPIVersion25, path: currentWeatherPath, body: strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":12.2`, 1), query: "&units=imperial", wantExtreme: true, wantReason: "Temperature below 14.0 Fahrenheit"},
+		{name: "mild in imperial units", version: OWMAPIVersion25, path: currentWeatherPath, body: strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":15`, 1), query: "&units=imperial"},
+		{name: "one call", version: OWMAPIVersion30, path: oneCallPath, body: strings.Replace(sampleOneCall, `"temp":18.4`, `"temp":-12`, 1), wantExtreme: true, wantReason: "Temperature below -10.0 Celsius"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13"+tt.query, nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Extreme != tt.wantExtreme || got.ExtremeReason != tt.wantReason {
+				t.Errorf("extreme = %v, %q; want %v, %q", got.Extreme, got.ExtremeReason, tt.wantExtreme, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerWindAbsent(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider Provider
+		version  string
+		path     string
+		body     string
+	}{
+		{name: "no wind object", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: strings.Replace(sampleCurrentWeather, `"wind":{"speed":4.1,"deg":250},`, "", 1)},
+		{name: "null wind object", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: strings.Replace(sampleCurrentWeather, `"wind":{"speed":4.1,"deg":250}`, `"wind":null`, 1)},
+		{name: "one call without wind", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion30, path: oneCallPath, body: strings.Replace(sampleOneCall, `"wind_speed":4.1,"wind_deg":250,`, "", 1)},
+		{name: "open-meteo without wind", provider: OpenMeteoProvider{}, version: OWMAPIVersion25, path: openMeteoPath, body: strings.Replace(sampleOpenMeteo, `"wind_speed_10m":4.1,"wind_direction_10m":250,`, "", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			providersMu.Lock()
+			providers = []Provider{tt.provider}
+			providersMu.Unlock()
+			newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.WindSpeed != "" || got.WindDirection != "" || got.WindDirectionLabel != "" {
+				t.Errorf("wind = %q, %q, %q; want it left empty", got.WindSpeed, got.WindDirection, got.WindDirectionLabel)
+			}
+			if got.Temperature != "18.4 Celsius" || got.Humidity == "" {
+				t.Errorf("weather = %+v, want the rest of the data", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// maxDigestFetches is the maximum number of favorite locations fetched at the same time by the /digest and
+// /export.csv endpoints.
+const maxDigestFetches = 4
+
+// DigestEntry is the one-line summary of a favorite location in the /digest response.
+// Either the weather fields or the error are set.
+type DigestEntry struct {
+	Name               string `json:"name"`                        // Name of the favorite location
+	Temperature        string `json:"temperature,omitempty"`       // Temperature in the requested units
+	WeatherDescription string `json:"weather_condition,omitempty"` // Description of the weather condition
+	WeatherType        string `json:"weather_type,omitempty"`      // Type of weather condition (e.g., cold, moderate, hot)
+	Error              string `json:"error,omitempty"`             // Why the weather could not be retrieved
+}
+
+// weatherFetcher retrieves the weather for coordinates; getWeatherWithContext is the production implementation.
+type weatherFetcher func(ctx context.Context, lat, lon float64, opts fetchOptions) (*WeatherData, error)
+
+// DigestHandler is an HTTP handler function that returns a one-line summary of the current weather for every
+// configured favorite location, in alphabetical order, e.g. for a morning-briefing display.
+// It accepts the same lang and units parameters and X-API-Key header as WeatherHandler. The locations are fetched
+// concurrently, at most maxDigestFetches at a time, within one overall deadline set by the configured digest timeout
+// (10 seconds by default, see Config.Timeouts). Locations that fail are reported with an error field while the others
+// are still returned. Responses are always JSON.
+func DigestHandler(w http.ResponseWriter, r *http.Request) {
+	// Reject methods other than GET and HEAD, advertising the supported ones in the Allow header
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := currentConfig()
+	v := &validator{}
+	opts := parseFetchOptions(v, r, cfg)
+	if !v.valid() {
+		v.write(w)
+		return
+	}
+
+	// Create a context with the configured timeout of the endpoint shared by all fetches
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout(EndpointDigest))
+	defer cancel()
+
+	digest := buildDigest(fetchFavorites(ctx, favoriteNames(), opts, getWeatherWithContext))
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	json.NewEncoder(w).Encode(digest)
+}
+
+// buildDigest is a helper function that turns the fetched weather of favorite locations into digest entries.
+func buildDigest(results []favoriteWeather) []DigestEntry {
+	digest := make([]DigestEntry, len(results))
+	for i, result := range results {
+		digest[i] = DigestEntry{Name: result.name, Error: result.err}
+		if result.weather != nil {
+			digest[i].Temperature = result.weather.Temperature
+			digest[i].WeatherDescription = result.weather.WeatherDescription
+			digest[i].WeatherType = result.weather.WeatherType
+		}
+	}
+	return digest
+}
+
+// favoriteWeather is the weather of a favorite location, or the client-facing reason it could not be retrieved.
+type favoriteWeather struct {
+	name    string
+	weather *WeatherData
+	err     string
+}
+
+// fetchFavorites is a helper function that fetches the weather of the named favorite locations with fetch, running
+// at most maxDigestFetches fetches at a time, and returns one result per name in the same order.
+// Locations that are no longer configured or fail to fetch before ctx is done get a result with the error set.
+func fetchFavorites(ctx context.Context, names []string, opts fetchOptions, fetch weatherFetcher) []favoriteWeather {
+	results := make([]favoriteWeather, len(names))
+	slots := make(chan struct{}, maxDigestFetches)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(result *favoriteWeather, name string) {
+			defer wg.Done()
+			result.name = name
+
+			location, ok := lookupFavorite(name)
+			if !ok {
+				result.err = "Unknown location"
+				return
+			}
+
+			// Wait for a free slot, giving up once the overall deadline has passed
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				result.err, _ = describeFetchError(ctx.Err())
+				return
+			}
+
+			weatherData, err := fetch(ctx, location.Lat, location.Lon, opts)
+			if err != nil {
+				result.err, _ = describeFetchError(err)
+				return
+			}
+			result.weather = weatherData
+		}(&results[i], name)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,163 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFetchFavorites(t *testing.T) {
+	locations := map[string]Location{"home": {Lat: 10, Lon: 10}, "office": {Lat: 20, Lon: 20}, "cabin": {Lat: 30, Lon: 30}}
+	tests := []struct {
+		name    string
+		names   []string
+		failing map[float64]error // Errors returned for the fetches of these latitudes
+		timeout time.Duration     // Overall deadline, none when zero
+		delay   time.Duration     // Time every fetch takes
+		want    []string          // Temperature or error of every result
+	}{
+		{name: "all succeed", names: []string{"cabin", "home", "office"}, want: []string{"30.0 Celsius", "10.0 Celsius", "20.0 Celsius"}},
+		{
+			name:    "partial failure",
+			names:   []string{"cabin", "home", "office"},
+			failing: map[float64]error{10: fmt.Errorf("stub: %w", ErrUpstreamUnavailable)},
+			want:    []string{"30.0 Celsius", "Weather provider unavailable", "20.0 Celsius"},
+		},
+		{name: "no longer configured", names: []string{"home", "garage"}, want: []string{"10.0 Celsius", "Unknown location"}},
+		{
+			name:    "overall deadline",
+			names:   []string{"cabin", "home"},
+			timeout: 20 * time.Millisecond,
+			delay:   time.Second,
+			want:    []string{"Timed out fetching weather data", "Timed out fetching weather data"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetFavorites(locations)
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			fetch := func(ctx context.Context, lat, lon float64, opts fetchOptions) (*WeatherData, error) {
+				select {
+				case <-time.After(tt.delay):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				if err := tt.failing[lat]; err != nil {
+					return nil, err
+				}
+				return &WeatherData{Temperature: formatTemperature(lat, opts.units)}, nil
+			}
+
+			results := fetchFavorites(ctx, tt.names, fetchOptions{units: UnitsMetric}, fetch)
+
+			var got []string
+			for i, result := range results {
+				if result.name != tt.names[i] {
+					t.Errorf("result %d is for %q, want %q", i, result.name, tt.names[i])
+				}
+				if result.weather != nil {
+					got = append(got, result.weather.Temperature)
+				} else {
+					got = append(got, result.err)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("results = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchFavoritesBoundsConcurrency(t *testing.T) {
+	setupTest(t)
+	locations := map[string]Location{}
+	var names []string
+	for i := 0; i < 3*maxDigestFetches; i++ {
+		name := fmt.Sprintf("place %d", i)
+		locations[name] = Location{Lat: float64(i), Lon: 0}
+		names = append(names, name)
+	}
+	SetFavorites(locations)
+	var mu sync.Mutex
+	running, peak := 0, 0
+	fetch := func(ctx context.Context, lat, lon float64, opts fetchOptions) (*WeatherData, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return &WeatherData{}, nil
+	}
+
+	fetchFavorites(context.Background(), names, fetchOptions{}, fetch)
+
+	if peak > maxDigestFetches {
+		t.Errorf("peak concurrent fetches = %d, want at most %d", peak, maxDigestFetches)
+	}
+}
+
+func TestDigestHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		favorites map[string]Location
+		want      []DigestEntry
+	}{
+		{
+			name:      "all succeed",
+			favorites: map[string]Location{"Home": {Lat: 10, Lon: 10}, "Office": {Lat: 20, Lon: 20}},
+			want: []DigestEntry{
+				{Name: "home", Temperature: "18.4 Celsius", WeatherDescription: "broken clouds", WeatherType: "moderate"},
+				{Name: "office", Temperature: "18.4 Celsius", WeatherDescription: "broken clouds", WeatherType: "moderate"},
+			},
+		},
+		{
+			name:      "partial failure",
+			favorites: map[string]Location{"Home": {Lat: 10, Lon: 10}, "Nowhere": {Lat: 40, Lon: 40}},
+			want: []DigestEntry{
+				{Name: "home", Temperature: "18.4 Celsius", WeatherDescription: "broken clouds", WeatherType: "moderate"},
+				{Name: "nowhere", Error: "Location not found"},
+			},
+		},
+		{name: "no favorites", want: []DigestEntry{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetFavorites(tt.favorites)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("lat") == "40.000000" {
+					respond(http.StatusNotFound, `{"cod":"404","message":"city not found"}`)(w, r)
+					return
+				}
+				respond(http.StatusOK, sampleCurrentWeather)(w, r)
+			}})
+
+			recorder := serve(DigestHandler, http.MethodGet, "/digest", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got []DigestEntry
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("digest = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
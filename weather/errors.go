@@ -0,0 +1,61 @@
+package weather
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors wrapped by every failed upstream call, so callers can tell the failure categories apart with errors.Is.
+var (
+	// ErrLocationNotFound means the upstream API does not know the requested location, e.g. an unknown ZIP code.
+	ErrLocationNotFound = errors.New("location not found")
+	// ErrUpstreamUnavailable means the upstream API could not be reached or answered with a rate limit or server error.
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+	// ErrUpstreamRateLimited means the upstream API answered with Too Many Requests (429). It is a special case of
+	// ErrUpstreamUnavailable, which such errors also match, so fallbacks and stale data treat them the same way; unlike
+	// other unavailable upstreams, they are not retried.
+	ErrUpstreamRateLimited = errors.New("upstream rate limited")
+	// ErrInvalidResponse means the upstream API answered with an unexpected status or a body that could not be used.
+	ErrInvalidResponse = errors.New("invalid upstream response")
+	// ErrOffline means the upstream API was not called because offline mode is enabled, see Config.Offline.
+	ErrOffline = errors.New("upstream disabled in offline mode")
+)
+
+// upstreamStatusError records the unexpected HTTP status code returned by an upstream API.
+// It can be retrieved with errors.As from the errors returned by the upstream calls.
+type upstreamStatusError struct {
+	code       int
+	retryAfter string // Retry-After header of a Too Many Requests response, empty when absent
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.code)
+}
+
+// upstreamStatus is a helper function that builds the error for an unexpected status response from the named provider,
+// wrapping both the status code and the matching error category. A rate limit also keeps the Retry-After header so
+// that it can be passed on to the client.
+func upstreamStatus(provider string, response *http.Response) error {
+	code := response.StatusCode
+	switch {
+	case code == http.StatusNotFound:
+		return fmt.Errorf("%s: %w: %w", provider, ErrLocationNotFound, &upstreamStatusError{code: code})
+	case code == http.StatusTooManyRequests:
+		statusErr := &upstreamStatusError{code: code, retryAfter: response.Header.Get("Retry-After")}
+		return fmt.Errorf("%s: %w: %w: %w", provider, ErrUpstreamRateLimited, ErrUpstreamUnavailable, statusErr)
+	case code >= 500:
+		return fmt.Errorf("%s: %w: %w", provider, ErrUpstreamUnavailable, &upstreamStatusError{code: code})
+	}
+	return fmt.Errorf("%s: %w: %w", provider, ErrInvalidResponse, &upstreamStatusError{code: code})
+}
+
+// upstreamRetryAfter is a helper function that returns the Retry-After header of the upstream rate limit wrapped in
+// err, or an empty string when there is none.
+func upstreamRetryAfter(err error) string {
+	var statusErr *upstreamStatusError
+	if errors.Is(err, ErrUpstreamRateLimited) && errors.As(err, &statusErr) {
+		return statusErr.retryAfter
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetWeatherErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		upstream   http.HandlerFunc
+		want       error
+		wantStatus int // Upstream status code recorded in the error, none when zero
+	}{
+		{name: "not found", upstream: respond(http.StatusNotFound, `{"cod":"404","message":"city not found"}`), want: ErrLocationNotFound, wantStatus: http.StatusNotFound},
+		{name: "server error", upstream: respond(http.StatusInternalServerError, `{}`), want: ErrUpstreamUnavailable, wantStatus: http.StatusInternalServerError},
+		{name: "rate limited", upstream: respond(http.StatusTooManyRequests, `{"cod":429}`), want: ErrUpstreamRateLimited, wantStatus: http.StatusTooManyRequests},
+		{name: "unexpected status", upstream: respond(http.StatusBadRequest, `{"cod":"400","message":"wrong latitude"}`), want: ErrInvalidResponse, wantStatus: http.StatusBadRequest},
+		{name: "malformed body", upstream: respond(http.StatusOK, `{"main":`), want: ErrInvalidResponse},
+		{name: "missing temperature", upstream: respond(http.StatusOK, strings.Replace(sampleCurrentWeather, `"temp":18.4,`, "", 1)), want: ErrInvalidResponse},
+		{
+			name: "connection dropped",
+			upstream: func(w http.ResponseWriter, r *http.Request) {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err == nil {
+					conn.Close()
+				}
+			},
+			want: ErrUpstreamUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			RetryBackoff = time.Millisecond
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: tt.upstream})
+
+			_, err := GetWeather(context.Background(), 51.51, -0.13)
+
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("GetWeather() error = %v, want %v", err, tt.want)
+			}
+			var statusErr *upstreamStatusError
+			if got := errors.As(err, &statusErr); got != (tt.wantStatus != 0) || (got && statusErr.code != tt.wantStatus) {
+				t.Errorf("GetWeather() error = %v, want upstream status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestUpstreamRateLimitPassthrough(t *testing.T) {
+	// rateLimited answers with Too Many Requests and the given Retry-After header, if any
+	rateLimited := func(retryAfter string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			respond(http.StatusTooManyRequests, `{"cod":429,"message":"Your account is temporary blocked"}`)(w, r)
+		}
+	}
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		target         string
+		path           string
+		upstream       http.HandlerFunc
+		wantStatus     int
+		wantRetryAfter string
+		wantCalls      int
+	}{
+		{name: "seconds", handler: WeatherHandler, target: "/weather?lat=51.51&lon=-0.13", path: currentWeatherPath, upstream: rateLimited("120"), wantStatus: http.StatusTooManyRequests, wantRetryAfter: "120", wantCalls: 1},
+		{
+			name:           "date",
+			handler:        WeatherHandler,
+			target:         "/weather?lat=51.51&lon=-0.13",
+			path:           currentWeatherPath,
+			upstream:       rateLimited("Sat, 01 Jun 2024 12:05:00 GMT"),
+			wantStatus:     http.StatusTooManyRequests,
+			wantRetryAfter: "Sat, 01 Jun 2024 12:05:00 GMT",
+			wantCalls:      1,
+		},
+		{name: "without Retry-After", handler: WeatherHandler, target: "/weather?lat=51.51&lon=-0.13", path: currentWeatherPath, upstream: rateLimited(""), wantStatus: http.StatusTooManyRequests, wantCalls: 1},
+		// Only rate limits pass the header on; other failures are retried and reported as a bad gateway
+		{
+			name:    "server error with Retry-After",
+			handler: WeatherHandler,
+			target:  "/weather?lat=51.51&lon=-0.13",
+			path:    currentWeatherPath,
+			upstream: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "120")
+				respond(http.StatusServiceUnavailable, ``)(w, r)
+			},
+			wantStatus: http.StatusBadGateway,
+			wantCalls:  3,
+		},
+		{name: "one call", handler: OneCallHandler, target: "/onecall?lat=51.51&lon=-0.13", path: oneCallPath, upstream: rateLimited("60"), wantStatus: http.StatusTooManyRequests, wantRetryAfter: "60", wantCalls: 1},
+		{name: "raw", handler: RawHandler, target: "/weather/raw?lat=51.51&lon=-0.13", path: currentWeatherPath, upstream: rateLimited("60"), wantStatus: http.StatusTooManyRequests, wantRetryAfter: "60", wantCalls: 1},
+		// Both locations are fetched and fail, and the joined error still carries the upstream header
+		{name: "comparison", handler: CompareHandler, target: "/weather/compare?lat1=10&lon1=10&lat2=20&lon2=20", path: currentWeatherPath, upstream: rateLimited("60"), wantStatus: http.StatusTooManyRequests, wantRetryAfter: "60", wantCalls: 2},
+		{name: "zip code", handler: WeatherHandler, target: "/weather?zip=94040", path: "/geo/1.0/zip", upstream: rateLimited("30"), wantStatus: http.StatusTooManyRequests, wantRetryAfter: "30", wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			captureLog(t)
+			RetryBackoff = time.Millisecond
+			upstream := newUpstream(t, map[string]http.HandlerFunc{tt.path: tt.upstream})
+
+			recorder := serve(tt.handler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if got := recorder.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if tt.wantStatus == http.StatusTooManyRequests && !strings.Contains(recorder.Body.String(), "rate limit") {
+				t.Errorf("body %q, want the rate limit reported", recorder.Body)
+			}
+			if strings.Contains(recorder.Body.String(), "temporary blocked") {
+				t.Errorf("body %q exposes the upstream message", recorder.Body)
+			}
+			if calls := len(upstream.calls(tt.path)); calls != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package weather
+
+import (
+	"context"
+	"encoding/csv"
+	"log"
+	"net/http"
+)
+
+// exportHeader is the header row of the /export.csv response.
+var exportHeader = []string{"location", "temperature", "description", "type", "wind_speed", "humidity", "error"}
+
+// ExportHandler is an HTTP handler function that returns the current weather of every configured favorite location as
+// CSV for import into spreadsheets, with a header row and one row per location in alphabetical order.
+// It accepts the same lang and units parameters and X-API-Key header as WeatherHandler. The locations are fetched like
+// for /digest; a location that fails gets a row with only its name and the error column set, while the others are
+// still exported. The response is offered for download as weather.csv.
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	// Reject methods other than GET and HEAD, advertising the supported ones in the Allow header
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := currentConfig()
+	v := &validator{}
+	opts := parseFetchOptions(v, r, cfg)
+	if !v.valid() {
+		v.write(w)
+		return
+	}
+
+	// Create a context with the configured timeout of the endpoint shared by all fetches
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout(EndpointExport))
+	defer cancel()
+
+	results := fetchFavorites(ctx, favoriteNames(), opts, getWeatherWithContext)
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="weather.csv"`)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write(exportHeader)
+	for _, result := range results {
+		row := []string{result.name, "", "", "", "", "", result.err}
+		if weatherData := result.weather; weatherData != nil {
+			row = []string{result.name, weatherData.Temperature, weatherData.WeatherDescription, weatherData.WeatherType,
+				weatherData.WindSpeed, weatherData.Humidity, ""}
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("Failed to write CSV export: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package weather
+
+import (
+	"encoding/csv"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportHandler(t *testing.T) {
+	// A description with a comma and quotes, which must survive the CSV encoding
+	const squall = `{"coord":{"lon":2.35,"lat":48.86},"weather":[{"id":771,"main":"Squall","description":"squalls, \"gusty\""}],` +
+		`"main":{"temp":12.2,"humidity":88},"wind":{"speed":14.3,"deg":270},"dt":1717243200,"name":"Paris"}`
+	bodies := map[string]string{"51.510000": sampleCurrentWeather, "48.860000": squall}
+	header := []string{"location", "temperature", "description", "type", "wind_speed", "humidity", "error"}
+	tests := []struct {
+		name      string
+		query     string
+		favorites map[string]Location
+		want      [][]string // Rows after the header
+	}{
+		{
+			name:      "all succeed",
+			favorites: map[string]Location{"London": {Lat: 51.51, Lon: -0.13}, "Paris": {Lat: 48.86, Lon: 2.35}},
+			want: [][]string{
+				{"london", "18.4 Celsius", "broken clouds", "moderate", "4.1 m/s", "64 percentage", ""},
+				{"paris", "12.2 Celsius", `squalls, "gusty"`, "moderate", "14.3 m/s", "88 percentage", ""},
+			},
+		},
+		{
+			name:      "partial failure",
+			favorites: map[string]Location{"London": {Lat: 51.51, Lon: -0.13}, "Atlantis": {Lat: 31, Lon: -24}},
+			want: [][]string{
+				{"atlantis", "", "", "", "", "", "Location not found"},
+				{"london", "18.4 Celsius", "broken clouds", "moderate", "4.1 m/s", "64 percentage", ""},
+			},
+		},
+		{
+			name:      "imperial units",
+			query:     "?units=imperial",
+			favorites: map[string]Location{"London": {Lat: 51.51, Lon: -0.13}},
+			want:      [][]string{{"london", "18.4 Fahrenheit", "broken clouds", "cold", "4.1 mph", "64 percentage", ""}},
+		},
+		{name: "no favorites"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetFavorites(tt.favorites)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+				body, ok := bodies[r.URL.Query().Get("lat")]
+				if !ok {
+					respond(http.StatusNotFound, `{"cod":"404","message":"city not found"}`)(w, r)
+					return
+				}
+				respond(http.StatusOK, body)(w, r)
+			}})
+
+			recorder := serve(ExportHandler, http.MethodGet, "/export.csv"+tt.query, nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			if got := recorder.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+				t.Errorf("Content-Type = %q, want text/csv", got)
+			}
+			if got := recorder.Header().Get("Content-Disposition"); got != `attachment; filename="weather.csv"` {
+				t.Errorf("Content-Disposition = %q, want the weather.csv attachment", got)
+			}
+			records, err := csv.NewReader(recorder.Body).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) == 0 || !reflect.DeepEqual(records[0], header) {
+				t.Fatalf("records = %q, want the header %q first", records, header)
+			}
+			if got := records[1:]; len(got) != len(tt.want) || len(got) > 0 && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportHandlerRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "head", method: http.MethodHead, target: "/export.csv", wantStatus: http.StatusOK},
+		{name: "unsupported method", method: http.MethodPost, target: "/export.csv", wantStatus: http.StatusMethodNotAllowed, wantBody: "Method not allowed\n"},
+		{name: "invalid units", method: http.MethodGet, target: "/export.csv?units=kelvin", wantStatus: http.StatusBadRequest, wantBody: `"code":"invalid_units"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetFavorites(map[string]Location{"London": {Lat: 51.51, Lon: -0.13}})
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(ExportHandler, tt.method, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantBody == "" && recorder.Body.Len() != 0 || !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("body %q, want %q", recorder.Body, tt.wantBody)
+			}
+			if tt.method == http.MethodHead && recorder.Header().Get("Content-Disposition") == "" {
+				t.Error("HEAD response without the Content-Disposition of the export")
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Location is a named coordinate pair, as configured for the favorite locations.
+type Location struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// favorites holds the configured favorite locations keyed by lowercase name.
+var (
+	favoritesMu sync.RWMutex
+	favorites   = map[string]Location{}
+)
+
+// SetFavorites replaces the configured favorite locations. Names are matched case-insensitively.
+func SetFavorites(locations map[string]Location) {
+	normalized := make(map[string]Location, len(locations))
+	for name, location := range locations {
+		normalized[strings.ToLower(name)] = location
+	}
+
+	favoritesMu.Lock()
+	defer favoritesMu.Unlock()
+	favorites = normalized
+}
+
+// lookupFavorite returns the favorite location with the given name, matched case-insensitively.
+func lookupFavorite(name string) (Location, bool) {
+	favoritesMu.RLock()
+	defer favoritesMu.RUnlock()
+	location, ok := favorites[strings.ToLower(name)]
+	return location, ok
+}
+
+// favoriteNames returns the names of the configured favorite locations in alphabetical order.
+func favoriteNames() []string {
+	favoritesMu.RLock()
+	defer favoritesMu.RUnlock()
+	names := make([]string, 0, len(favorites))
+	for name := range favorites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseFavorites decodes favorite locations from JSON of the form {"home": {"lat": 51.5, "lon": -0.12}}.
+// Every location must have coordinates within the valid latitude and longitude ranges.
+func ParseFavorites(data []byte) (map[string]Location, error) {
+	var locations map[string]Location
+	if err := json.Unmarshal(data, &locations); err != nil {
+		return nil, fmt.Errorf("invalid favorites: %w", err)
+	}
+	for name, location := range locations {
+		if name == "" {
+			return nil, fmt.Errorf("invalid favorites: empty location name")
+		}
+		if location.Lat < -90 || location.Lat > 90 || location.Lon < -180 || location.Lon > 180 {
+			return nil, fmt.Errorf("invalid favorites: coordinates of %q are out of range", name)
+		}
+	}
+	return locations, nil
+}
+
+// LoadFavoritesFromEnv loads the favorite locations from the environment.
+// FAVORITES_FILE names a JSON file in the format accepted by ParseFavorites; otherwise FAVORITES may hold the JSON
+// directly. When neither is set, no favorites are configured and an empty map is returned.
+func LoadFavoritesFromEnv() (map[string]Location, error) {
+	if path := os.Getenv("FAVORITES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading favorites: %w", err)
+		}
+		return ParseFavorites(data)
+	}
+	if value := os.Getenv("FAVORITES"); value != "" {
+		return ParseFavorites([]byte(value))
+	}
+	return map[string]Location{}, nil
+}
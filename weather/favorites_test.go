@@ -0,0 +1,109 @@
+package weather
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFavorites(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]Location
+		wantErr bool
+	}{
+		{name: "locations", data: `{"home": {"lat": 51.5, "lon": -0.12}, "Office": {"lat": 40.7, "lon": -74}}`,
+			want: map[string]Location{"home": {Lat: 51.5, Lon: -0.12}, "Office": {Lat: 40.7, Lon: -74}}},
+		{name: "none", data: `{}`, want: map[string]Location{}},
+		{name: "invalid JSON", data: `{"home": [51.5, -0.12]}`, wantErr: true},
+		{name: "empty name", data: `{"": {"lat": 1, "lon": 2}}`, wantErr: true},
+		{name: "latitude out of range", data: `{"pole": {"lat": 91, "lon": 0}}`, wantErr: true},
+		{name: "longitude out of range", data: `{"east": {"lat": 0, "lon": 181}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFavorites([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFavorites() error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseFavorites() = %v, want %v", got, tt.want)
+			}
+			for name, location := range tt.want {
+				if got[name] != location {
+					t.Errorf("location %q = %v, want %v", name, got[name], location)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFavoritesFromEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "favorites.json")
+	if err := os.WriteFile(file, []byte(`{"file": {"lat": 1, "lon": 2}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		path, value   string
+		wantLocations []string
+		wantErr       bool
+	}{
+		{name: "none"},
+		{name: "variable", value: `{"variable": {"lat": 3, "lon": 4}}`, wantLocations: []string{"variable"}},
+		{name: "file wins", path: file, value: `{"variable": {"lat": 3, "lon": 4}}`, wantLocations: []string{"file"}},
+		{name: "missing file", path: filepath.Join(t.TempDir(), "missing.json"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FAVORITES_FILE", tt.path)
+			t.Setenv("FAVORITES", tt.value)
+
+			got, err := LoadFavoritesFromEnv()
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadFavoritesFromEnv() error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.wantLocations) {
+				t.Errorf("LoadFavoritesFromEnv() = %v, want %v", got, tt.wantLocations)
+			}
+			for _, name := range tt.wantLocations {
+				if _, ok := got[name]; !ok {
+					t.Errorf("LoadFavoritesFromEnv() = %v, want %v", got, tt.wantLocations)
+				}
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerFavorite(t *testing.T) {
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantLat    string
+	}{
+		{target: "/weather?location=home", wantStatus: http.StatusOK, wantLat: "51.500000"},
+		{target: "/weather?location=HOME", wantStatus: http.StatusOK, wantLat: "51.500000"},
+		{target: "/weather?location=office", wantStatus: http.StatusNotFound},
+		{target: "/weather?location=home&lat=1&lon=2", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			setupTest(t)
+			SetFavorites(map[string]Location{"Home": {Lat: 51.5, Lon: -0.12}})
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			calls := upstream.calls(currentWeatherPath)
+			if tt.wantLat != "" && (len(calls) != 1 || calls[0].Query().Get("lat") != tt.wantLat) {
+				t.Errorf("upstream calls = %v, want one with lat=%s", calls, tt.wantLat)
+			}
+		})
+	}
+}
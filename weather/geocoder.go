@@ -0,0 +1,121 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"sync"
+)
+
+// Geocoder is implemented by every place name resolver.
+// Geocode resolves a free-form query such as "London,GB" into coordinates. A query that matches no place results in
+// an error wrapping ErrLocationNotFound.
+type Geocoder interface {
+	Geocode(ctx context.Context, query string) (lat, lon float64, err error)
+}
+
+// Place is a candidate location matching a geocoding query.
+type Place struct {
+	Name    string  `json:"name"`
+	Country string  `json:"country"`         // ISO 3166 country code
+	State   string  `json:"state,omitempty"` // State or region, when reported
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+}
+
+// PlaceSearcher is implemented by geocoders that can list several candidates for an ambiguous query such as
+// "Springfield", so that clients can pick one before fetching its weather.
+// Search returns up to limit places, best match first, and an empty list when nothing matches.
+type PlaceSearcher interface {
+	Search(ctx context.Context, query string, limit int) ([]Place, error)
+}
+
+// ReverseGeocoder is implemented by geocoders that can name the place nearest to a pair of coordinates, which
+// WeatherHandler uses with reverse_geocode=true when the weather data comes without a location name.
+// ReverseGeocode returns an error wrapping ErrLocationNotFound when no place is known near the coordinates.
+type ReverseGeocoder interface {
+	ReverseGeocode(ctx context.Context, lat, lon float64) (Place, error)
+}
+
+// OpenWeatherMapGeocoder is the default geocoder backed by the OpenWeatherMap Geocoding API.
+// The API key is taken from the fetch options in ctx, falling back to the configured default key.
+type OpenWeatherMapGeocoder struct{}
+
+// Geocode resolves the query with the direct geocoding endpoint, using the best match.
+func (g OpenWeatherMapGeocoder) Geocode(ctx context.Context, query string) (float64, float64, error) {
+	places, err := g.Search(ctx, query, 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(places) == 0 {
+		return 0, 0, fmt.Errorf("openweathermap geocoding: %w: no match for %q", ErrLocationNotFound, query)
+	}
+	return places[0].Lat, places[0].Lon, nil
+}
+
+// Search lists up to limit places matching the query with the direct geocoding endpoint, best match first.
+// Reference https://openweathermap.org/api/geocoding-api - Direct geocoding section
+func (OpenWeatherMapGeocoder) Search(ctx context.Context, query string, limit int) ([]Place, error) {
+	opts := fetchOptionsFromContext(ctx)
+	url := fmt.Sprintf(openWeatherMapBaseURL+"/geo/1.0/direct?q=%s&limit=%d&appid=%s", neturl.QueryEscape(query), limit, neturl.QueryEscape(opts.apiKey))
+
+	places := []Place{}
+	if err := fetchOpenWeatherMapJSON(ctx, "openweathermap geocoding", url, &places); err != nil {
+		return nil, err
+	}
+	return places, nil
+}
+
+// ReverseGeocode names the place nearest to the coordinates with the reverse geocoding endpoint.
+// Reference https://openweathermap.org/api/geocoding-api - Reverse geocoding section
+func (OpenWeatherMapGeocoder) ReverseGeocode(ctx context.Context, lat, lon float64) (Place, error) {
+	opts := fetchOptionsFromContext(ctx)
+	url := fmt.Sprintf(openWeatherMapBaseURL+"/geo/1.0/reverse?lat=%s&lon=%s&limit=1&appid=%s",
+		formatUpstreamCoordinate(lat), formatUpstreamCoordinate(lon), neturl.QueryEscape(opts.apiKey))
+
+	var places []Place
+	if err := fetchOpenWeatherMapJSON(ctx, "openweathermap geocoding", url, &places); err != nil {
+		return Place{}, err
+	}
+	if len(places) == 0 {
+		return Place{}, fmt.Errorf("openweathermap geocoding: %w: no place near %s", ErrLocationNotFound, formatCoordinates(lat, lon))
+	}
+	return places[0], nil
+}
+
+// nearestPlaceName is a helper function that names the place nearest to the coordinates with the given geocoder, or
+// returns false when the geocoder cannot reverse geocode or knows no place there. Failures are logged, not returned,
+// since the name is a nicety that must not fail the request.
+func nearestPlaceName(ctx context.Context, geocoder Geocoder, lat, lon float64) (string, bool) {
+	reverse, ok := geocoder.(ReverseGeocoder)
+	if !ok {
+		return "", false
+	}
+	place, err := reverse.ReverseGeocode(ctx, lat, lon)
+	if err != nil {
+		log.Printf("Reverse geocoding %s failed: %v", formatCoordinates(lat, lon), err)
+		return "", false
+	}
+	return place.Name, place.Name != ""
+}
+
+// activeGeocoder is the geocoder used to resolve place names.
+var (
+	geocoderMu     sync.RWMutex
+	activeGeocoder Geocoder = OpenWeatherMapGeocoder{}
+)
+
+// SetGeocoder replaces the geocoder used to resolve place names, e.g. with a stub in tests or another provider.
+func SetGeocoder(g Geocoder) {
+	geocoderMu.Lock()
+	defer geocoderMu.Unlock()
+	activeGeocoder = g
+}
+
+// currentGeocoder returns the geocoder used to resolve place names.
+func currentGeocoder() Geocoder {
+	geocoderMu.RLock()
+	defer geocoderMu.RUnlock()
+	return activeGeocoder
+}
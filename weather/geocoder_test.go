@@ -0,0 +1,305 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubGeocoder is a Geocoder resolving a fixed set of place names.
+type stubGeocoder struct {
+	places map[string]Location
+	err    error // Returned for every query when set
+
+	mu      sync.Mutex
+	queries []string
+}
+
+func (g *stubGeocoder) Geocode(ctx context.Context, query string) (float64, float64, error) {
+	g.mu.Lock()
+	g.queries = append(g.queries, query)
+	g.mu.Unlock()
+	if g.err != nil {
+		return 0, 0, g.err
+	}
+	place, ok := g.places[query]
+	if !ok {
+		return 0, 0, fmt.Errorf("stub geocoder: %w: %q", ErrLocationNotFound, query)
+	}
+	return place.Lat, place.Lon, nil
+}
+
+func TestWeatherHandlerGeocoder(t *testing.T) {
+	tests := []struct {
+		name       string
+		geocoder   *stubGeocoder
+		target     string
+		wantStatus int
+		wantLat    string // lat of the upstream call
+	}{
+		{
+			name:       "resolved",
+			geocoder:   &stubGeocoder{places: map[string]Location{"Paris,FR": {Lat: 48.8566, Lon: 2.3522}}},
+			target:     "/weather?city=Paris,FR",
+			wantStatus: http.StatusOK,
+			wantLat:    "48.856600",
+		},
+		{
+			name:       "not found",
+			geocoder:   &stubGeocoder{places: map[string]Location{}},
+			target:     "/weather?city=Atlantis",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "geocoder unavailable",
+			geocoder:   &stubGeocoder{err: fmt.Errorf("stub geocoder: %w", ErrUpstreamUnavailable)},
+			target:     "/weather?city=Paris,FR",
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetGeocoder(tt.geocoder)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if len(tt.geocoder.queries) != 1 {
+				t.Errorf("geocoder queries = %q, want one", tt.geocoder.queries)
+			}
+			calls := upstream.calls(currentWeatherPath)
+			if tt.wantLat == "" {
+				if len(calls) != 0 {
+					t.Errorf("unresolved request called the upstream")
+				}
+				return
+			}
+			if len(calls) != 1 || calls[0].Query().Get("lat") != tt.wantLat {
+				t.Errorf("upstream calls = %v, want one for lat %s", calls, tt.wantLat)
+			}
+		})
+	}
+}
+
+func TestOpenWeatherMapGeocoderGeocode(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream http.HandlerFunc
+		wantLat  float64
+		wantErr  error
+	}{
+		{name: "best match", upstream: respond(http.StatusOK, sampleGeocoding), wantLat: 51.5073219},
+		{name: "no match", upstream: respond(http.StatusOK, `[]`), wantErr: ErrLocationNotFound},
+		{name: "upstream failure", upstream: respond(http.StatusInternalServerError, `{}`), wantErr: ErrUpstreamUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			RetryBackoff = time.Millisecond
+			upstream := newUpstream(t, map[string]http.HandlerFunc{geocodingPath: tt.upstream})
+
+			lat, _, err := OpenWeatherMapGeocoder{}.Geocode(context.Background(), "London")
+
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("Geocode() error = %v, want %v", err, tt.wantErr)
+			}
+			if lat != tt.wantLat {
+				t.Errorf("Geocode() lat = %v, want %v", lat, tt.wantLat)
+			}
+			if calls := upstream.calls(geocodingPath); len(calls) == 0 || calls[0].Query().Get("q") != "London" || calls[0].Query().Get("limit") != "1" {
+				t.Errorf("upstream calls = %v, want one for q=London with limit=1", calls)
+			}
+		})
+	}
+}
+
+// nearestPlaceGeocoder is a ReverseGeocoder naming the same place for any coordinates, recording the ones asked for.
+type nearestPlaceGeocoder struct {
+	place Place
+	err   error // Returned for every lookup when set
+
+	mu      sync.Mutex
+	lookups []string
+}
+
+func (g *nearestPlaceGeocoder) Geocode(ctx context.Context, query string) (float64, float64, error) {
+	return 0, 0, fmt.Errorf("nearest place geocoder: %w: %q", ErrLocationNotFound, query)
+}
+
+func (g *nearestPlaceGeocoder) ReverseGeocode(ctx context.Context, lat, lon float64) (Place, error) {
+	g.mu.Lock()
+	g.lookups = append(g.lookups, fmt.Sprintf("%g,%g", lat, lon))
+	g.mu.Unlock()
+	return g.place, g.err
+}
+
+func TestWeatherHandlerReverseGeocode(t *testing.T) {
+	unnamed := strings.Replace(sampleCurrentWeather, `"name":"London"`, `"name":" "`, 1)
+	tests := []struct {
+		name        string
+		target      string
+		upstream    string
+		geocoder    Geocoder
+		wantStatus  int
+		wantName    string
+		wantLookups []string // Coordinates reverse geocoded, when the geocoder is a nearestPlaceGeocoder
+	}{
+		{
+			name:        "empty name",
+			target:      "/weather?lat=64.2&lon=-51.7&reverse_geocode=true",
+			upstream:    unnamed,
+			geocoder:    &nearestPlaceGeocoder{place: Place{Name: "Nuuk", Country: "GL"}},
+			wantStatus:  http.StatusOK,
+			wantName:    "Nuuk",
+			wantLookups: []string{"64.2,-51.7"},
+		},
+		{
+			name:       "populated name",
+			target:     "/weather?lat=51.51&lon=-0.13&reverse_geocode=true",
+			upstream:   sampleCurrentWeather,
+			geocoder:   &nearestPlaceGeocoder{place: Place{Name: "Westminster"}},
+			wantStatus: http.StatusOK,
+			wantName:   "London",
+		},
+		{
+			name:       "off by default",
+			target:     "/weather?lat=64.2&lon=-51.7",
+			upstream:   unnamed,
+			geocoder:   &nearestPlaceGeocoder{place: Place{Name: "Nuuk"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "no place nearby",
+			target:      "/weather?lat=64.2&lon=-51.7&reverse_geocode=true",
+			upstream:    unnamed,
+			geocoder:    &nearestPlaceGeocoder{err: fmt.Errorf("nearest place geocoder: %w", ErrLocationNotFound)},
+			wantStatus:  http.StatusOK,
+			wantLookups: []string{"64.2,-51.7"},
+		},
+		{
+			name:        "nameless place",
+			target:      "/weather?lat=64.2&lon=-51.7&reverse_geocode=true",
+			upstream:    unnamed,
+			geocoder:    &nearestPlaceGeocoder{place: Place{Country: "GL"}},
+			wantStatus:  http.StatusOK,
+			wantLookups: []string{"64.2,-51.7"},
+		},
+		{
+			name:       "geocoder without reverse geocoding",
+			target:     "/weather?lat=64.2&lon=-51.7&reverse_geocode=true",
+			upstream:   unnamed,
+			geocoder:   &stubGeocoder{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid flag",
+			target:     "/weather?lat=64.2&lon=-51.7&reverse_geocode=maybe",
+			geocoder:   &nearestPlaceGeocoder{place: Place{Name: "Nuuk"}},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			captureLog(t)
+			SetGeocoder(tt.geocoder)
+			routes := map[string]http.HandlerFunc{}
+			if tt.upstream != "" {
+				routes[currentWeatherPath] = respond(http.StatusOK, tt.upstream)
+			}
+			newUpstream(t, routes)
+
+			recorder := serve(WeatherHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus == http.StatusBadRequest {
+				var errs []FieldError
+				if err := json.Unmarshal(recorder.Body.Bytes(), &errs); err != nil || len(errs) != 1 || errs[0].Code != "invalid_reverse_geocode" {
+					t.Errorf("errors = %s, want code invalid_reverse_geocode", recorder.Body)
+				}
+				return
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.LocationName != tt.wantName {
+				t.Errorf("location name = %q, want %q", got.LocationName, tt.wantName)
+			}
+			if geocoder, ok := tt.geocoder.(*nearestPlaceGeocoder); ok && strings.Join(geocoder.lookups, " ") != strings.Join(tt.wantLookups, " ") {
+				t.Errorf("reverse geocoded %q, want %q", geocoder.lookups, tt.wantLookups)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerReverseGeocodeKeepsCache(t *testing.T) {
+	setupTest(t)
+	SetGeocoder(&nearestPlaceGeocoder{place: Place{Name: "Nuuk"}})
+	unnamed := strings.Replace(sampleCurrentWeather, `"name":"London"`, `"name":""`, 1)
+	upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, unnamed)})
+
+	// The name found for one request is not cached for the requests that did not ask for it
+	var names []string
+	for _, target := range []string{"/weather?lat=64.2&lon=-51.7&reverse_geocode=true", "/weather?lat=64.2&lon=-51.7"} {
+		var got WeatherData
+		if err := json.Unmarshal(serve(WeatherHandler, http.MethodGet, target, nil).Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, got.LocationName)
+	}
+
+	if names[0] != "Nuuk" || names[1] != "" {
+		t.Errorf("location names = %q, want Nuuk and none", names)
+	}
+	if calls := len(upstream.calls(currentWeatherPath)); calls != 1 {
+		t.Errorf("upstream calls = %d, want 1", calls)
+	}
+}
+
+func TestOpenWeatherMapGeocoderReverseGeocode(t *testing.T) {
+	const reversePath = "/geo/1.0/reverse"
+	tests := []struct {
+		name     string
+		upstream http.HandlerFunc
+		want     string
+		wantErr  error
+	}{
+		{name: "nearest place", upstream: respond(http.StatusOK, `[{"name":"Nuuk","lat":64.1814,"lon":-51.6941,"country":"GL"}]`), want: "Nuuk"},
+		{name: "no place nearby", upstream: respond(http.StatusOK, `[]`), wantErr: ErrLocationNotFound},
+		{name: "upstream failure", upstream: respond(http.StatusInternalServerError, `{}`), wantErr: ErrUpstreamUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			RetryBackoff = time.Millisecond
+			configure(t, func(cfg *Config) { cfg.UpstreamCoordinatePrecision = 2 })
+			upstream := newUpstream(t, map[string]http.HandlerFunc{reversePath: tt.upstream})
+
+			place, err := OpenWeatherMapGeocoder{}.ReverseGeocode(context.Background(), 64.181, -51.694)
+
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("ReverseGeocode() error = %v, want %v", err, tt.wantErr)
+			}
+			if place.Name != tt.want {
+				t.Errorf("ReverseGeocode() name = %q, want %q", place.Name, tt.want)
+			}
+			calls := upstream.calls(reversePath)
+			if len(calls) == 0 || calls[0].Query().Get("lat") != "64.18" || calls[0].Query().Get("lon") != "-51.69" || calls[0].Query().Get("limit") != "1" {
+				t.Errorf("upstream calls = %v, want one for 64.18,-51.69 with limit=1", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	neturl "net/url"
+	"strings"
+	"sync"
+)
+
+// Geolocator is implemented by every service that resolves a client IP address into approximate coordinates.
+// It is used by WeatherHandler to serve the weather near the client when a request names no location.
+type Geolocator interface {
+	Locate(ctx context.Context, ip string) (float64, float64, error)
+}
+
+// HTTPGeolocator is a Geolocator querying an HTTP API that answers with a JSON object holding numeric "latitude" and
+// "longitude" fields, as for example ipapi.co does. URL is the address of the lookup with "{ip}" standing for the
+// address to locate, e.g. "https://ipapi.co/{ip}/json/".
+type HTTPGeolocator struct {
+	URL string
+}
+
+// Locate resolves the IP address into coordinates. Private, loopback and other non-public addresses cannot be
+// located and fail with ErrLocationNotFound without calling the API.
+func (g HTTPGeolocator) Locate(ctx context.Context, ip string) (float64, float64, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return 0, 0, fmt.Errorf("geolocation: %w: %q is not a public address", ErrLocationNotFound, ip)
+	}
+	url := strings.ReplaceAll(g.URL, "{ip}", neturl.PathEscape(addr.Unmap().String()))
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("geolocation: invalid request URL: %w", err)
+	}
+	debugf("Calling %s", url)
+
+	// Wait for a free upstream call slot like the weather fetches do
+	release, err := currentUpstreamLimiter().acquire(ctx)
+	if err != nil {
+		log.Printf("Upstream call to the geolocation API not attempted: %v", err)
+		return 0, 0, err
+	}
+	defer release()
+
+	response, err := currentUpstreamClient().Do(request)
+	if err != nil {
+		log.Printf("HTTP request failed: %v", err)
+		return 0, 0, fmt.Errorf("geolocation: %w: %w", ErrUpstreamUnavailable, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		log.Printf("Unexpected status code from the geolocation API: %d", response.StatusCode)
+		return 0, 0, upstreamStatus("geolocation", response)
+	}
+
+	body, err := readUpstreamBody("geolocation", response.Body)
+	if err != nil {
+		return 0, 0, err
+	}
+	var location struct {
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+	}
+	if err := json.Unmarshal(body, &location); err != nil {
+		return 0, 0, fmt.Errorf("geolocation: %w: %v", ErrInvalidResponse, err)
+	}
+	if location.Latitude == nil || location.Longitude == nil {
+		return 0, 0, fmt.Errorf("geolocation: %w: no coordinates for %s", ErrLocationNotFound, ip)
+	}
+	return *location.Latitude, *location.Longitude, nil
+}
+
+// errNoGeolocator is returned when IP geolocation is requested but no Geolocator is configured.
+var errNoGeolocator = errors.New("geolocation: no geolocator configured")
+
+// activeGeolocator is the geolocator used to locate clients by IP address, nil when none is configured.
+var (
+	geolocatorMu     sync.RWMutex
+	activeGeolocator Geolocator
+)
+
+// SetGeolocator replaces the geolocator used to locate clients by IP address, e.g. with a stub in tests.
+// With none set, which is the default, IP geolocation requests fail.
+func SetGeolocator(g Geolocator) {
+	geolocatorMu.Lock()
+	defer geolocatorMu.Unlock()
+	activeGeolocator = g
+}
+
+// geolocateClient is a helper function that resolves the address of the client that sent the request, as determined
+// by clientIP, into coordinates with the active geolocator.
+func geolocateClient(ctx context.Context, r *http.Request) (float64, float64, error) {
+	geolocatorMu.RLock()
+	geolocator := activeGeolocator
+	geolocatorMu.RUnlock()
+	if geolocator == nil {
+		return 0, 0, errNoGeolocator
+	}
+	return geolocator.Locate(ctx, clientIP(r))
+}
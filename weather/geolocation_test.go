@@ -0,0 +1,179 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stubGeolocator locates the addresses it knows, recording every address it is asked for.
+type stubGeolocator struct {
+	locations map[string]Location
+
+	mu  sync.Mutex
+	ips []string
+}
+
+func (g *stubGeolocator) Locate(ctx context.Context, ip string) (float64, float64, error) {
+	g.mu.Lock()
+	g.ips = append(g.ips, ip)
+	g.mu.Unlock()
+	location, ok := g.locations[ip]
+	if !ok {
+		return 0, 0, fmt.Errorf("stub geolocator: %w", ErrLocationNotFound)
+	}
+	return location.Lat, location.Lon, nil
+}
+
+func TestWeatherHandlerGeolocate(t *testing.T) {
+	// httptest requests come from 192.0.2.1
+	locations := map[string]Location{"192.0.2.1": {Lat: 51.51, Lon: -0.13}, "198.51.100.1": {Lat: 48.86, Lon: 2.35}}
+	tests := []struct {
+		name         string
+		target       string
+		header       http.Header
+		noGeolocator bool
+		configured   bool // Whether Config.Geolocate is set
+		trusted      string
+		wantStatus   int
+		wantCode     string // Error code of a Bad Request
+		wantIP       string // Address passed to the geolocator, none when empty
+		wantLat      string // Latitude of the upstream call
+		wantPrivate  bool   // Whether the response is kept out of shared caches
+	}{
+		{name: "flag", target: "/weather?geolocate=true", wantStatus: http.StatusOK, wantIP: "192.0.2.1", wantLat: "51.510000", wantPrivate: true},
+		{name: "configured", target: "/weather", configured: true, wantStatus: http.StatusOK, wantIP: "192.0.2.1", wantLat: "51.510000", wantPrivate: true},
+		{name: "turned off per request", target: "/weather?geolocate=false", wantStatus: http.StatusBadRequest, wantCode: "missing_lat"},
+		{
+			name:        "client of a trusted proxy",
+			target:      "/weather?geolocate=true",
+			header:      http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			trusted:     "192.0.2.0/24",
+			wantStatus:  http.StatusOK,
+			wantIP:      "198.51.100.1",
+			wantLat:     "48.860000",
+			wantPrivate: true,
+		},
+		{
+			name:        "forwarding header of an untrusted peer",
+			target:      "/weather?geolocate=true",
+			header:      http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			wantStatus:  http.StatusOK,
+			wantIP:      "192.0.2.1",
+			wantLat:     "51.510000",
+			wantPrivate: true,
+		},
+		{
+			name:       "geolocation failure",
+			target:     "/weather?geolocate=true",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.9"}},
+			trusted:    "192.0.2.0/24",
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "geolocation_failed",
+			wantIP:     "203.0.113.9",
+		},
+		{name: "no geolocator", target: "/weather?geolocate=true", noGeolocator: true, wantStatus: http.StatusBadRequest, wantCode: "geolocation_failed"},
+		{name: "explicit coordinates win", target: "/weather?geolocate=true&lat=40.71&lon=-74.01", wantStatus: http.StatusOK, wantLat: "40.710000"},
+		{name: "explicit city wins", target: "/weather?city=Paris", configured: true, wantStatus: http.StatusOK, wantLat: "48.856600"},
+		{name: "invalid flag", target: "/weather?geolocate=maybe&lat=51.51&lon=-0.13", wantStatus: http.StatusBadRequest, wantCode: "invalid_geolocate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			captureLog(t)
+			configure(t, func(cfg *Config) { cfg.Geolocate = tt.configured })
+			geolocator := &stubGeolocator{locations: locations}
+			if !tt.noGeolocator {
+				SetGeolocator(geolocator)
+			}
+			SetGeocoder(&stubGeocoder{places: map[string]Location{"Paris": {Lat: 48.8566, Lon: 2.3522}}})
+			trusted, err := ParseTrustedProxies(tt.trusted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			SetTrustedProxies(trusted)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, tt.target, tt.header)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantCode != "" {
+				var errs []FieldError
+				if err := json.Unmarshal(recorder.Body.Bytes(), &errs); err != nil || len(errs) == 0 || errs[0].Code != tt.wantCode {
+					t.Errorf("errors = %s, want code %s", recorder.Body, tt.wantCode)
+				}
+			}
+			if tt.wantIP == "" && len(geolocator.ips) != 0 || tt.wantIP != "" && (len(geolocator.ips) != 1 || geolocator.ips[0] != tt.wantIP) {
+				t.Errorf("geolocated %q, want %q", geolocator.ips, tt.wantIP)
+			}
+			calls := upstream.calls(currentWeatherPath)
+			if tt.wantLat == "" && len(calls) != 0 || tt.wantLat != "" && (len(calls) != 1 || calls[0].Query().Get("lat") != tt.wantLat) {
+				t.Errorf("upstream calls = %v, want lat=%q", calls, tt.wantLat)
+			}
+			if cacheControl := recorder.Header().Get("Cache-Control"); tt.wantStatus == http.StatusOK && strings.HasPrefix(cacheControl, "private, ") != tt.wantPrivate {
+				t.Errorf("Cache-Control = %q, want private %v", cacheControl, tt.wantPrivate)
+			}
+		})
+	}
+}
+
+func TestHTTPGeolocatorLocate(t *testing.T) {
+	// Reference https://ipapi.co/api/#complete-location, trimmed to the fields the geolocator reads
+	const located = `{"ip":"8.8.8.8","city":"Mountain View","country_code":"US","latitude":37.42301,"longitude":-122.083352}`
+	tests := []struct {
+		name     string
+		ip       string
+		response http.HandlerFunc // Never called when nil
+		wantPath string
+		wantLat  float64
+		wantLon  float64
+		wantErr  error
+	}{
+		{name: "located", ip: "8.8.8.8", response: respond(http.StatusOK, located), wantPath: "/8.8.8.8/json/", wantLat: 37.42301, wantLon: -122.083352},
+		{name: "mapped IPv4 address", ip: "::ffff:8.8.8.8", response: respond(http.StatusOK, located), wantPath: "/8.8.8.8/json/", wantLat: 37.42301, wantLon: -122.083352},
+		{name: "IPv6 address", ip: "2001:4860:4860::8888", response: respond(http.StatusOK, located), wantPath: "/2001:4860:4860::8888/json/", wantLat: 37.42301, wantLon: -122.083352},
+		{name: "private address", ip: "10.0.0.5", wantErr: ErrLocationNotFound},
+		{name: "loopback address", ip: "127.0.0.1", wantErr: ErrLocationNotFound},
+		{name: "not an address", ip: "localhost", wantErr: ErrLocationNotFound},
+		{name: "reserved range without coordinates", ip: "8.8.8.8", response: respond(http.StatusOK, `{"ip":"8.8.8.8","reserved":true}`), wantPath: "/8.8.8.8/json/", wantErr: ErrLocationNotFound},
+		{name: "rate limited", ip: "8.8.8.8", response: respond(http.StatusTooManyRequests, `{"error":true}`), wantPath: "/8.8.8.8/json/", wantErr: ErrUpstreamRateLimited},
+		{name: "server error", ip: "8.8.8.8", response: respond(http.StatusBadGateway, ``), wantPath: "/8.8.8.8/json/", wantErr: ErrUpstreamUnavailable},
+		{name: "not JSON", ip: "8.8.8.8", response: respond(http.StatusOK, `Mountain View`), wantPath: "/8.8.8.8/json/", wantErr: ErrInvalidResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			captureLog(t)
+			var paths []string
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				paths = append(paths, r.URL.Path)
+				if tt.response == nil {
+					t.Errorf("unexpected geolocation call %s", r.URL)
+					return
+				}
+				tt.response(w, r)
+			}))
+			defer api.Close()
+
+			lat, lon, err := HTTPGeolocator{URL: api.URL + "/{ip}/json/"}.Locate(context.Background(), tt.ip)
+
+			if !errors.Is(err, tt.wantErr) || tt.wantErr == nil && err != nil {
+				t.Fatalf("Locate(%q) error = %v, want %v", tt.ip, err, tt.wantErr)
+			}
+			if lat != tt.wantLat || lon != tt.wantLon {
+				t.Errorf("Locate(%q) = %v, %v; want %v, %v", tt.ip, lat, lon, tt.wantLat, tt.wantLon)
+			}
+			if tt.wantPath == "" && len(paths) != 0 || tt.wantPath != "" && (len(paths) != 1 || paths[0] != tt.wantPath) {
+				t.Errorf("geolocation calls = %q, want %q", paths, tt.wantPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package weather
+
+import (
+	"sync"
+	"time"
+)
+
+// fetchGuard remembers the most recent upstream result per fetch key so that identical requests arriving within the
+// minimum fetch interval are answered with it instead of calling the upstream again. Unlike the cache it does not
+// depend on the cache backend or TTL; it only protects the upstream from clients polling in a tight loop.
+type fetchGuard struct {
+	mu      sync.Mutex
+	entries map[string]guardEntry
+}
+
+// guardEntry is the result of an upstream fetch together with the time it was made.
+type guardEntry struct {
+	data      WeatherData
+	fetchedAt time.Time
+}
+
+// newFetchGuard is a helper function that creates an empty fetch guard.
+func newFetchGuard() *fetchGuard {
+	return &fetchGuard{entries: map[string]guardEntry{}}
+}
+
+// upstreamGuard is the fetch guard used by the fetch path.
+var upstreamGuard = newFetchGuard()
+
+// recent returns a copy of the result fetched for key within the last interval, if any.
+// A zero interval disables the guard.
+func (g *fetchGuard) recent(key string, interval time.Duration) (*WeatherData, bool) {
+	if interval <= 0 {
+		return nil, false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	entry, ok := g.entries[key]
+	if !ok || now().Sub(entry.fetchedAt) >= interval {
+		return nil, false
+	}
+	data := entry.data
+	return &data, true
+}
+
+// record stores a copy of a fresh upstream result for key and drops the entries older than interval,
+// so keys fetched once do not accumulate.
+func (g *fetchGuard) record(key string, data *WeatherData, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	current := now()
+	for k, entry := range g.entries {
+		if current.Sub(entry.fetchedAt) >= interval {
+			delete(g.entries, k)
+		}
+	}
+	g.entries[key] = guardEntry{data: *data, fetchedAt: current}
+}
@@ -0,0 +1,74 @@
+package weather
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// noCache is a Cache backend that stores nothing, so that every request reaches the fetch guard.
+type noCache struct{}
+
+func (noCache) Get(key string) (*WeatherData, bool)                  { return nil, false }
+func (noCache) Set(key string, data *WeatherData, ttl time.Duration) {}
+
+func TestWeatherHandlerMinFetchInterval(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		interval      time.Duration
+		second        string        // Query of the second request; the first is for lat=51.51&lon=-0.13
+		elapsed       time.Duration // Time between the two requests
+		wantCalls     int
+		wantCoalesced bool
+	}{
+		{name: "back to back", interval: 5 * time.Second, second: "lat=51.51&lon=-0.13", elapsed: time.Second, wantCalls: 1, wantCoalesced: true},
+		{name: "same rounded coordinates", interval: 5 * time.Second, second: "lat=51.5101&lon=-0.1301", wantCalls: 1, wantCoalesced: true},
+		{name: "interval passed", interval: 5 * time.Second, second: "lat=51.51&lon=-0.13", elapsed: 5 * time.Second, wantCalls: 2},
+		{name: "other location", interval: 5 * time.Second, second: "lat=48.86&lon=2.35", wantCalls: 2},
+		{name: "other units", interval: 5 * time.Second, second: "lat=51.51&lon=-0.13&units=imperial", wantCalls: 2},
+		{name: "disabled", second: "lat=51.51&lon=-0.13", wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetCache(noCache{})
+			configure(t, func(cfg *Config) { cfg.MinFetchInterval = tt.interval })
+			logs := captureLog(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			for i, query := range []string{"lat=51.51&lon=-0.13", tt.second} {
+				SetClock(FixedClock(start.Add(time.Duration(i) * tt.elapsed)))
+				if recorder := serve(WeatherHandler, http.MethodGet, "/weather?"+query, nil); recorder.Code != http.StatusOK {
+					t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+				}
+			}
+
+			if got := len(upstream.calls(currentWeatherPath)); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+			if got := strings.Contains(logs.String(), "Coalesced request"); got != tt.wantCoalesced {
+				t.Errorf("coalescing logged = %v, want %v", got, tt.wantCoalesced)
+			}
+		})
+	}
+}
+
+func TestFetchGuardRecordDropsOldEntries(t *testing.T) {
+	setupTest(t)
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	guard := newFetchGuard()
+	SetClock(FixedClock(start))
+	guard.record("old", &WeatherData{Temperature: "18.4 Celsius"}, time.Minute)
+
+	SetClock(FixedClock(start.Add(time.Minute)))
+	guard.record("new", &WeatherData{Temperature: "19.0 Celsius"}, time.Minute)
+
+	if _, ok := guard.entries["old"]; ok || len(guard.entries) != 1 {
+		t.Errorf("entries = %v, want only the new one", guard.entries)
+	}
+	if data, ok := guard.recent("new", time.Minute); !ok || data.Temperature != "19.0 Celsius" {
+		t.Errorf("recent(new) = %+v, %v; want the recorded data", data, ok)
+	}
+}
@@ -0,0 +1,62 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// upstreamHeaders holds the static headers attached to every request sent to OpenWeatherMap,
+// e.g. the credentials of an authenticating proxy in front of the API.
+var (
+	upstreamHeadersMu sync.RWMutex
+	upstreamHeaders   = http.Header{}
+)
+
+// SetUpstreamHeaders replaces the static headers attached to every request sent to OpenWeatherMap.
+func SetUpstreamHeaders(headers http.Header) {
+	upstreamHeadersMu.Lock()
+	defer upstreamHeadersMu.Unlock()
+	upstreamHeaders = headers.Clone()
+}
+
+// ParseUpstreamHeaders decodes static upstream headers from JSON of the form {"X-Proxy-Token": "secret"}.
+func ParseUpstreamHeaders(data []byte) (http.Header, error) {
+	var values map[string]string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("invalid upstream headers: %w", err)
+	}
+	headers := http.Header{}
+	for name, value := range values {
+		if name == "" {
+			return nil, fmt.Errorf("invalid upstream headers: empty header name")
+		}
+		headers.Set(name, value)
+	}
+	return headers, nil
+}
+
+// LoadUpstreamHeadersFromEnv loads the static upstream headers from the JSON in the UPSTREAM_HEADERS environment variable.
+// When it is unset, no headers are configured and an empty header set is returned.
+func LoadUpstreamHeadersFromEnv() (http.Header, error) {
+	if value := os.Getenv("UPSTREAM_HEADERS"); value != "" {
+		return ParseUpstreamHeaders([]byte(value))
+	}
+	return http.Header{}, nil
+}
+
+// applyUpstreamHeaders is a helper function that adds the configured static headers to an outbound request.
+// Headers already set on the request are left untouched, so the configured ones never clobber the headers managed by
+// the request itself. Headers the request leaves to the transport, such as User-Agent, can be overridden on purpose.
+func applyUpstreamHeaders(request *http.Request) {
+	upstreamHeadersMu.RLock()
+	defer upstreamHeadersMu.RUnlock()
+	for name, values := range upstreamHeaders {
+		if _, set := request.Header[name]; set {
+			continue
+		}
+		request.Header[name] = append([]string(nil), values...)
+	}
+}
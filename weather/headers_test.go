@@ -0,0 +1,139 @@
+package weather
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseUpstreamHeaders(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    http.Header
+		wantErr bool
+	}{
+		{data: `{}`, want: http.Header{}},
+		{data: `{"x-proxy-token": "secret"}`, want: http.Header{"X-Proxy-Token": {"secret"}}},
+		{data: `{"X-Proxy-Token": "secret", "User-Agent": "weather-service"}`, want: http.Header{"X-Proxy-Token": {"secret"}, "User-Agent": {"weather-service"}}},
+		{data: `{"": "secret"}`, wantErr: true},
+		{data: `{"X-Proxy-Token": 1}`, wantErr: true},
+		{data: `X-Proxy-Token: secret`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseUpstreamHeaders([]byte(tt.data))
+		if (err != nil) != tt.wantErr || (!tt.wantErr && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("ParseUpstreamHeaders(%s) = %v, %v; want %v, error %v", tt.data, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadUpstreamHeadersFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    http.Header
+		wantErr bool
+	}{
+		{name: "unset", want: http.Header{}},
+		{name: "set", value: `{"X-Proxy-Token": "secret"}`, want: http.Header{"X-Proxy-Token": {"secret"}}},
+		{name: "invalid", value: `secret`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("UPSTREAM_HEADERS", tt.value)
+
+			got, err := LoadUpstreamHeadersFromEnv()
+
+			if (err != nil) != tt.wantErr || (!tt.wantErr && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("LoadUpstreamHeadersFromEnv() = %v, %v; want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpstreamHeadersSent(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		path    string
+		body    string
+		headers http.Header
+		want    http.Header // Headers the upstream must receive
+	}{
+		{
+			name:    "current weather 2.5",
+			version: OWMAPIVersion25,
+			path:    currentWeatherPath,
+			body:    sampleCurrentWeather,
+			headers: http.Header{"X-Proxy-Token": {"secret"}},
+			want:    http.Header{"X-Proxy-Token": {"secret"}, "User-Agent": {"Go-http-client/1.1"}},
+		},
+		{
+			name:    "one call 3.0",
+			version: OWMAPIVersion30,
+			path:    oneCallPath,
+			body:    sampleOneCall,
+			headers: http.Header{"X-Proxy-Token": {"secret"}, "X-Tenant": {"a", "b"}},
+			want:    http.Header{"X-Proxy-Token": {"secret"}, "X-Tenant": {"a", "b"}},
+		},
+		{
+			name:    "user agent overridden on purpose",
+			version: OWMAPIVersion25,
+			path:    currentWeatherPath,
+			body:    sampleCurrentWeather,
+			headers: http.Header{"User-Agent": {"weather-service"}},
+			want:    http.Header{"User-Agent": {"weather-service"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			SetUpstreamHeaders(tt.headers)
+			var received http.Header
+			newUpstream(t, map[string]http.HandlerFunc{tt.path: func(w http.ResponseWriter, r *http.Request) {
+				received = r.Header.Clone()
+				respond(http.StatusOK, tt.body)(w, r)
+			}})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			for name, values := range tt.want {
+				if got := received.Values(name); !reflect.DeepEqual(got, values) {
+					t.Errorf("upstream header %s = %q, want %q", name, got, values)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyUpstreamHeaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured http.Header
+		request    http.Header // Headers set on the request before the configured ones are applied
+		want       http.Header
+	}{
+		{name: "added", configured: http.Header{"X-Proxy-Token": {"secret"}}, request: http.Header{"Accept": {"application/json"}}, want: http.Header{"X-Proxy-Token": {"secret"}, "Accept": {"application/json"}}},
+		{name: "request header kept", configured: http.Header{"If-None-Match": {`"stale"`}}, request: http.Header{"If-None-Match": {`"current"`}}, want: http.Header{"If-None-Match": {`"current"`}}},
+		{name: "none configured", configured: http.Header{}, request: http.Header{}, want: http.Header{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetUpstreamHeaders(tt.configured)
+			// Later changes to the configured set must not leak into requests
+			tt.configured.Set("X-Late", "changed")
+			request := &http.Request{Header: tt.request}
+
+			applyUpstreamHeaders(request)
+
+			if !reflect.DeepEqual(request.Header, tt.want) {
+				t.Errorf("request headers = %v, want %v", request.Header, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Values of DeepHealth.Status.
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+// DeepHealth is the result of an upstream health check as reported by DeepHealthHandler.
+type DeepHealth struct {
+	Status            string    `json:"status"`             // "ok" when the upstream answered with weather data, "unavailable" otherwise
+	UpstreamReachable bool      `json:"upstream_reachable"` // Whether OpenWeatherMap answered at all
+	APIKeyValid       bool      `json:"api_key_valid"`      // Whether OpenWeatherMap accepted the API key; false when it could not be reached
+	Error             string    `json:"error,omitempty"`    // Why the check failed, when it did
+	CheckedAt         time.Time `json:"checked_at"`         // Time the upstream was checked
+	Cached            bool      `json:"cached"`             // Whether the result was reused from an earlier probe
+}
+
+// healthChecker runs the upstream health check and remembers its result for the configured HealthCacheTTL, so that
+// frequent probes do not hammer the upstream. Probes arriving while a check runs wait for its result.
+type healthChecker struct {
+	mu    sync.Mutex
+	last  *DeepHealth
+	check func(ctx context.Context) error
+}
+
+// deepHealth is the health checker of DeepHealthHandler, checking the upstream the same way as ValidateAPIKey.
+var deepHealth = &healthChecker{check: ValidateAPIKey}
+
+// result returns the last result if it is younger than ttl, and otherwise checks the upstream within timeout.
+func (c *healthChecker) result(ttl, timeout time.Duration) DeepHealth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last != nil && now().Sub(c.last.CheckedAt) < ttl {
+		cached := *c.last
+		cached.Cached = true
+		return cached
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	health := describeHealth(c.check(ctx))
+	health.CheckedAt = now()
+	c.last = &health
+	return health
+}
+
+// describeHealth is a helper function that turns the error of an upstream check into a DeepHealth. A rejected API key,
+// other error statuses and unreadable responses still prove the upstream reachable; only a rejected key makes the key
+// invalid.
+func describeHealth(err error) DeepHealth {
+	if err == nil {
+		return DeepHealth{Status: healthOK, UpstreamReachable: true, APIKeyValid: true}
+	}
+	var statusErr *upstreamStatusError
+	reachable := errors.Is(err, ErrAPIKeyRejected) || errors.As(err, &statusErr) || errors.Is(err, ErrInvalidResponse)
+	return DeepHealth{
+		Status:            healthUnavailable,
+		UpstreamReachable: reachable,
+		APIKeyValid:       reachable && !errors.Is(err, ErrAPIKeyRejected),
+		Error:             err.Error(),
+	}
+}
+
+// DeepHealthHandler is an HTTP handler function for readiness probes that reports whether OpenWeatherMap is reachable
+// and accepts the configured API key, as DeepHealth JSON. It answers with 200 OK when healthy and with a Service
+// Unavailable status code (503) otherwise.
+// The check makes one upstream call bypassing the cache, and its result is reused for the configured HealthCacheTTL,
+// so probes can be frequent without spending the API quota.
+func DeepHealthHandler(w http.ResponseWriter, r *http.Request) {
+	// Reject methods other than GET and HEAD, advertising the supported ones in the Allow header
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := currentConfig()
+	health := deepHealth.result(cfg.HealthCacheTTL, cfg.timeout(EndpointHealth))
+	status := http.StatusOK
+	if health.Status != healthOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	// Probes must always see the current verdict rather than a copy kept by an intermediary
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	json.NewEncoder(w).Encode(health)
+}
@@ -0,0 +1,218 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDescribeHealth(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantStatus    string
+		wantReachable bool
+		wantKeyValid  bool
+	}{
+		{name: "healthy", wantStatus: healthOK, wantReachable: true, wantKeyValid: true},
+		{name: "key rejected", err: ErrAPIKeyRejected, wantStatus: healthUnavailable, wantReachable: true},
+		{name: "server error", err: fmt.Errorf("openweathermap: %w: %w", ErrUpstreamUnavailable, &upstreamStatusError{code: 502}), wantStatus: healthUnavailable, wantReachable: true, wantKeyValid: true},
+		{name: "unreadable response", err: fmt.Errorf("openweathermap: %w: unexpected EOF", ErrInvalidResponse), wantStatus: healthUnavailable, wantReachable: true, wantKeyValid: true},
+		{name: "network error", err: fmt.Errorf("openweathermap: %w: connection refused", ErrUpstreamUnavailable), wantStatus: healthUnavailable},
+		{name: "timeout", err: context.DeadlineExceeded, wantStatus: healthUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := describeHealth(tt.err)
+			if got.Status != tt.wantStatus || got.UpstreamReachable != tt.wantReachable || got.APIKeyValid != tt.wantKeyValid {
+				t.Errorf("describeHealth(%v) = %+v, want status %s, reachable %v, key valid %v", tt.err, got, tt.wantStatus, tt.wantReachable, tt.wantKeyValid)
+			}
+			if (got.Error != "") != (tt.err != nil) {
+				t.Errorf("error = %q, want the error of the check %v", got.Error, tt.err)
+			}
+		})
+	}
+}
+
+// closeConnection is an upstream handler that drops the connection without answering.
+func closeConnection(w http.ResponseWriter, r *http.Request) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func TestDeepHealthHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		upstream      http.HandlerFunc
+		wantStatus    int
+		wantReachable bool
+		wantKeyValid  bool
+		wantError     string
+	}{
+		{name: "healthy", upstream: respond(http.StatusOK, sampleCurrentWeather), wantStatus: http.StatusOK, wantReachable: true, wantKeyValid: true},
+		{
+			name:          "key rejected",
+			upstream:      respond(http.StatusUnauthorized, `{"cod":401,"message":"Invalid API key."}`),
+			wantStatus:    http.StatusServiceUnavailable,
+			wantReachable: true,
+			wantError:     ErrAPIKeyRejected.Error(),
+		},
+		{
+			name:          "upstream failing",
+			upstream:      respond(http.StatusServiceUnavailable, ``),
+			wantStatus:    http.StatusServiceUnavailable,
+			wantReachable: true,
+			wantKeyValid:  true,
+			wantError:     "503",
+		},
+		{
+			name:          "unreadable response",
+			upstream:      respond(http.StatusOK, `<html>maintenance</html>`),
+			wantStatus:    http.StatusServiceUnavailable,
+			wantReachable: true,
+			wantKeyValid:  true,
+			wantError:     ErrInvalidResponse.Error(),
+		},
+		{name: "upstream unreachable", upstream: closeConnection, wantStatus: http.StatusServiceUnavailable, wantError: ErrUpstreamUnavailable.Error()},
+		{name: "head", method: http.MethodHead, upstream: respond(http.StatusOK, sampleCurrentWeather), wantStatus: http.StatusOK},
+		{name: "unsupported method", method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			captureLog(t)
+			MaxUpstreamAttempts = 1
+			routes := map[string]http.HandlerFunc{}
+			if tt.upstream != nil {
+				routes[currentWeatherPath] = tt.upstream
+			}
+			upstream := newUpstream(t, routes)
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			recorder := serve(DeepHealthHandler, method, "/health/deep", nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.upstream == nil {
+				if calls := upstream.calls(currentWeatherPath); len(calls) != 0 {
+					t.Errorf("upstream calls = %v, want none", calls)
+				}
+				return
+			}
+			if got := recorder.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", got)
+			}
+			if method == http.MethodHead {
+				if recorder.Body.Len() != 0 {
+					t.Errorf("HEAD body = %q, want none", recorder.Body)
+				}
+				return
+			}
+			var health DeepHealth
+			if err := json.Unmarshal(recorder.Body.Bytes(), &health); err != nil {
+				t.Fatal(err)
+			}
+			if health.UpstreamReachable != tt.wantReachable || health.APIKeyValid != tt.wantKeyValid || health.Cached {
+				t.Errorf("health = %+v, want reachable %v, key valid %v, not cached", health, tt.wantReachable, tt.wantKeyValid)
+			}
+			if tt.wantError == "" && health.Error != "" || !strings.Contains(health.Error, tt.wantError) {
+				t.Errorf("error = %q, want %q", health.Error, tt.wantError)
+			}
+			if strings.Contains(recorder.Body.String(), API_KEY) {
+				t.Errorf("body %s contains the API key", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestDeepHealthHandlerCache(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		upstream  http.HandlerFunc
+		probes    []time.Duration // Time of each probe since the first
+		wantCalls int
+		want      []bool // Whether each probe was answered from the cache
+	}{
+		{name: "reused within the TTL", ttl: 30 * time.Second, upstream: respond(http.StatusOK, sampleCurrentWeather), probes: []time.Duration{0, 10 * time.Second, 29 * time.Second}, wantCalls: 1, want: []bool{false, true, true}},
+		{name: "checked again after the TTL", ttl: 30 * time.Second, upstream: respond(http.StatusOK, sampleCurrentWeather), probes: []time.Duration{0, 30 * time.Second, 40 * time.Second}, wantCalls: 2, want: []bool{false, false, true}},
+		{name: "unhealthy result reused", ttl: 30 * time.Second, upstream: respond(http.StatusUnauthorized, `{}`), probes: []time.Duration{0, 10 * time.Second}, wantCalls: 1, want: []bool{false, true}},
+		{name: "no caching", upstream: respond(http.StatusOK, sampleCurrentWeather), probes: []time.Duration{0, 0, 0}, wantCalls: 3, want: []bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			captureLog(t)
+			configure(t, func(cfg *Config) { cfg.HealthCacheTTL = tt.ttl })
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: tt.upstream})
+
+			var checked DeepHealth // Result of the last probe that checked the upstream
+			for i, offset := range tt.probes {
+				SetClock(FixedClock(start.Add(offset)))
+				recorder := serve(DeepHealthHandler, http.MethodGet, "/health/deep", nil)
+				var health DeepHealth
+				if err := json.Unmarshal(recorder.Body.Bytes(), &health); err != nil {
+					t.Fatal(err)
+				}
+				if !health.Cached {
+					checked = health
+				}
+				if health.Cached != tt.want[i] {
+					t.Errorf("probe %d cached = %v, want %v", i, health.Cached, tt.want[i])
+				}
+				// A cached result tells when the upstream was actually checked, and keeps the verdict
+				if health.Cached && (!health.CheckedAt.Equal(checked.CheckedAt) || health.Status != checked.Status) {
+					t.Errorf("probe %d = %+v, want the result of the last check %+v", i, health, checked)
+				}
+			}
+			if calls := len(upstream.calls(currentWeatherPath)); calls != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDeepHealthHandlerConcurrentProbes(t *testing.T) {
+	setupTest(t)
+	release := make(chan struct{})
+	upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		respond(http.StatusOK, sampleCurrentWeather)(w, r)
+	}})
+
+	// Probes arriving while the first check runs wait for its result instead of checking again
+	var wg sync.WaitGroup
+	statuses := make([]int, 5)
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i] = serve(DeepHealthHandler, http.MethodGet, "/health/deep", nil).Code
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, status := range statuses {
+		if status != http.StatusOK {
+			t.Errorf("probe %d status = %d, want %d", i, status, http.StatusOK)
+		}
+	}
+	if calls := len(upstream.calls(currentWeatherPath)); calls != 1 {
+		t.Errorf("upstream calls = %d, want 1", calls)
+	}
+}
@@ -0,0 +1,103 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"time"
+)
+
+// earliestHistory is the oldest moment the One Call time machine has data for.
+var earliestHistory = time.Date(1979, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// timeMachineResponse mirrors the parts of the One Call time machine response that are mapped into WeatherData.
+type timeMachineResponse struct {
+	Timezone string              `json:"timezone"`
+	Data     []oneCallConditions `json:"data"`
+}
+
+// HistoryHandler is an HTTP handler function that serves the weather of a location at a past moment.
+// It accepts the same lat, lon, lang and units parameters and X-API-Key header as WeatherHandler, plus a required dt
+// parameter with the Unix timestamp of the moment, which must lie in the past and no earlier than 1979-01-01.
+// The response is WeatherData JSON as returned by WeatherHandler for the current weather.
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	// Reject methods other than GET and HEAD, advertising the supported ones in the Allow header
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Validate every parameter, reporting all problems in a single response
+	query := r.URL.Query()
+	cfg := currentConfig()
+	v := &validator{}
+	lat, lon := parseLatLon(v, query, cfg)
+	opts := parseFetchOptions(v, r, cfg)
+	dt := parseHistoryTimestamp(v, query.Get("dt"))
+	if !v.valid() {
+		v.write(w)
+		return
+	}
+
+	// Create a context with the configured timeout of the endpoint
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout(EndpointHistory))
+	defer cancel()
+
+	weatherData, err := getHistory(ctx, lat, lon, dt, opts)
+	if err != nil {
+		writeFetchError(w, err)
+		return
+	}
+	localizeWeatherData(weatherData, opts.lang)
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	json.NewEncoder(w).Encode(weatherData)
+}
+
+// parseHistoryTimestamp is a helper function that parses the dt parameter of HistoryHandler as a Unix timestamp and
+// checks that it lies within the window covered by the time machine. Problems are recorded in v.
+func parseHistoryTimestamp(v *validator, value string) time.Time {
+	if value == "" {
+		v.missing("dt", "Missing dt, it must be a Unix timestamp")
+		return time.Time{}
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		v.invalid("dt", "Invalid dt, it must be a Unix timestamp")
+		return time.Time{}
+	}
+	dt := time.Unix(seconds, 0)
+	switch {
+	case !dt.Before(now()):
+		v.outOfRange("dt", "Invalid dt, it must be in the past")
+	case dt.Before(earliestHistory):
+		v.outOfRange("dt", fmt.Sprintf("Invalid dt, historical data is only available from %s", earliestHistory.Format("2006-01-02")))
+	}
+	return dt
+}
+
+// getHistory is a helper function that fetches the weather of the given location at the moment dt from the
+// OpenWeatherMap One Call time machine, bound to ctx and using the given fetch options.
+// Errors are reported with the same categories as getWeather.
+func getHistory(ctx context.Context, lat, lon float64, dt time.Time, opts fetchOptions) (*WeatherData, error) {
+	// Construct the API URL reference https://openweathermap.org/api/one-call-3 - Weather data for timestamp section
+	url := fmt.Sprintf(openWeatherMapBaseURL+"/data/3.0/onecall/timemachine?lat=%s&lon=%s&dt=%d&appid=%s&units=%s&lang=%s",
+		formatUpstreamCoordinate(lat), formatUpstreamCoordinate(lon), dt.Unix(), neturl.QueryEscape(opts.apiKey), opts.units, opts.lang)
+
+	var data timeMachineResponse
+	if err := fetchOpenWeatherMapJSON(ctx, "openweathermap", url, &data); err != nil {
+		return nil, err
+	}
+	if len(data.Data) == 0 {
+		return nil, fmt.Errorf("openweathermap: %w: no data for %s", ErrInvalidResponse, dt.UTC().Format(time.RFC3339))
+	}
+	return data.Data[0].toWeatherData(data.Timezone, opts.units)
+}
@@ -0,0 +1,71 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHistoryHandler(t *testing.T) {
+	// Reference https://openweathermap.org/api/one-call-3 - Weather data for timestamp section
+	const timeMachine = `{"lat":51.51,"lon":-0.13,"timezone":"Europe/London","timezone_offset":0,"data":[{"dt":1578390000,` +
+		`"sunrise":1578384285,"sunset":1578413272,"temp":7.6,"feels_like":4.2,"pressure":1021,"humidity":87,"dew_point":5.6,` +
+		`"uvi":0.3,"clouds":90,"visibility":9000,"wind_speed":4.6,"wind_deg":230,` +
+		`"weather":[{"id":804,"main":"Clouds","description":"overcast clouds","icon":"04d"}]}]}`
+	const timeMachinePath = "/data/3.0/onecall/timemachine"
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		query      string
+		upstream   string
+		wantStatus int
+		wantCode   string // Validation error code of a Bad Request
+		wantTemp   string
+	}{
+		{name: "past moment", query: "lat=51.51&lon=-0.13&dt=1578390000", upstream: timeMachine, wantStatus: http.StatusOK, wantTemp: "7.6 Celsius"},
+		{name: "in imperial units", query: "lat=51.51&lon=-0.13&dt=1578390000&units=imperial", upstream: timeMachine, wantStatus: http.StatusOK, wantTemp: "7.6 Fahrenheit"},
+		{name: "no data for the moment", query: "lat=51.51&lon=-0.13&dt=1578390000", upstream: `{"timezone":"Europe/London","data":[]}`, wantStatus: http.StatusBadGateway},
+		{name: "missing timestamp", query: "lat=51.51&lon=-0.13", wantStatus: http.StatusBadRequest, wantCode: "missing_dt"},
+		{name: "invalid timestamp", query: "lat=51.51&lon=-0.13&dt=yesterday", wantStatus: http.StatusBadRequest, wantCode: "invalid_dt"},
+		{name: "now", query: "lat=51.51&lon=-0.13&dt=1717243200", wantStatus: http.StatusBadRequest, wantCode: "dt_out_of_range"},
+		{name: "future", query: "lat=51.51&lon=-0.13&dt=1800000000", wantStatus: http.StatusBadRequest, wantCode: "dt_out_of_range"},
+		{name: "before the time machine", query: "lat=51.51&lon=-0.13&dt=283996799", wantStatus: http.StatusBadRequest, wantCode: "dt_out_of_range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetClock(FixedClock(at))
+			routes := map[string]http.HandlerFunc{}
+			if tt.upstream != "" {
+				routes[timeMachinePath] = respond(http.StatusOK, tt.upstream)
+			}
+			upstream := newUpstream(t, routes)
+
+			recorder := serve(HistoryHandler, http.MethodGet, "/history?"+tt.query, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			switch tt.wantStatus {
+			case http.StatusBadRequest:
+				var errs []FieldError
+				if err := json.Unmarshal(recorder.Body.Bytes(), &errs); err != nil || len(errs) != 1 || errs[0].Code != tt.wantCode {
+					t.Errorf("errors = %s, want one with code %s", recorder.Body, tt.wantCode)
+				}
+			case http.StatusOK:
+				var got WeatherData
+				if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+					t.Fatal(err)
+				}
+				if got.Temperature != tt.wantTemp || !got.DataTimestamp.Equal(time.Unix(1578390000, 0)) || got.Timezone != "Europe/London" {
+					t.Errorf("weather = %+v, want %s at the requested moment", got, tt.wantTemp)
+				}
+				if calls := upstream.calls(timeMachinePath); len(calls) != 1 || calls[0].Query().Get("dt") != "1578390000" {
+					t.Errorf("upstream calls = %v, want one with dt=1578390000", calls)
+				}
+			}
+		})
+	}
+}
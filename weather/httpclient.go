@@ -0,0 +1,184 @@
+package weather
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultMaxUpstreamBodyBytes is the default cap on the size of an upstream response body (4 MB), far above the few
+// kilobytes a regular response takes.
+const DefaultMaxUpstreamBodyBytes = 4 << 20
+
+// DefaultUpstreamTLSMinVersion is the oldest TLS version accepted for upstream calls by default. Every upstream API
+// supports TLS 1.2 and newer, so older versions are only a downgrade risk.
+const DefaultUpstreamTLSMinVersion = tls.VersionTLS12
+
+// UpstreamPool holds the connection pool settings of the upstream HTTP client.
+type UpstreamPool struct {
+	MaxIdleConns        int           // Idle connections kept across all hosts
+	MaxIdleConnsPerHost int           // Idle connections kept per host
+	IdleConnTimeout     time.Duration // How long an idle connection is kept before it is closed
+}
+
+// DefaultUpstreamPool is the connection pool used for upstream calls by default. Nearly all calls go to a single
+// host, so it keeps as many idle connections to it as there can be concurrent OpenWeatherMap calls, instead of the
+// standard library's two, so that bursts reuse connections rather than opening new ones.
+var DefaultUpstreamPool = UpstreamPool{
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: DefaultMaxUpstreamCalls,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// upstreamTransportSettings holds the settings the upstream HTTP client is built from.
+type upstreamTransportSettings struct {
+	skipVerify    bool
+	tlsMinVersion uint16
+	pool          UpstreamPool
+}
+
+// upstreamClient is the HTTP client used for every call to an upstream API, built from the settings next to it.
+var (
+	upstreamClientMu sync.RWMutex
+	upstreamSettings = upstreamTransportSettings{tlsMinVersion: DefaultUpstreamTLSMinVersion, pool: DefaultUpstreamPool}
+	upstreamClient   = newUpstreamClient(upstreamSettings)
+)
+
+// SetInsecureSkipTLSVerify switches the upstream HTTP client between verifying TLS certificates (the default) and
+// skipping the verification, e.g. for test environments fronting OpenWeatherMap with a self-signed proxy.
+// Skipping verification exposes the API key and the weather data to anyone able to intercept the traffic,
+// so it must never be enabled in production.
+func SetInsecureSkipTLSVerify(skip bool) {
+	if skip {
+		log.Printf("WARNING: TLS certificate verification of upstream APIs is disabled; traffic can be intercepted. Do not use this in production.")
+	}
+	upstreamClientMu.Lock()
+	defer upstreamClientMu.Unlock()
+	upstreamSettings.skipVerify = skip
+	upstreamClient = newUpstreamClient(upstreamSettings)
+}
+
+// SetUpstreamTLSMinVersion sets the oldest TLS version, such as tls.VersionTLS13, that upstream calls accept.
+// Connections to servers that only offer older versions fail. See ParseTLSVersion for reading it from configuration.
+func SetUpstreamTLSMinVersion(version uint16) error {
+	if version < tls.VersionTLS10 || version > tls.VersionTLS13 {
+		return fmt.Errorf("unsupported minimum TLS version %#04x", version)
+	}
+	upstreamClientMu.Lock()
+	defer upstreamClientMu.Unlock()
+	upstreamSettings.tlsMinVersion = version
+	upstreamClient = newUpstreamClient(upstreamSettings)
+	return nil
+}
+
+// SetUpstreamPool replaces the connection pool settings of the upstream HTTP client. Connections of the previous
+// client are not reused. Zero limits mean no limit, as for http.Transport, so every setting must be positive.
+func SetUpstreamPool(pool UpstreamPool) error {
+	if pool.MaxIdleConns <= 0 || pool.MaxIdleConnsPerHost <= 0 || pool.IdleConnTimeout <= 0 {
+		return fmt.Errorf("upstream connection pool settings must be positive, got %+v", pool)
+	}
+	upstreamClientMu.Lock()
+	defer upstreamClientMu.Unlock()
+	upstreamSettings.pool = pool
+	upstreamClient = newUpstreamClient(upstreamSettings)
+	return nil
+}
+
+// ParseTLSVersion parses a TLS version such as "1.2" or "1.3" into the form taken by SetUpstreamTLSMinVersion.
+func ParseTLSVersion(value string) (uint16, error) {
+	switch value {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("invalid TLS version %q, supported versions are 1.0, 1.1, 1.2 and 1.3", value)
+}
+
+// newUpstreamClient is a helper function that builds the upstream HTTP client on a copy of the default transport
+// with the given connection pool, accepting TLS versions from the minimum version on and, with skipVerify, not
+// verifying TLS certificates.
+// Upstream calls go through the proxy named by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func newUpstreamClient(settings upstreamTransportSettings) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: settings.tlsMinVersion, InsecureSkipVerify: settings.skipVerify}
+	transport.MaxIdleConns = settings.pool.MaxIdleConns
+	transport.MaxIdleConnsPerHost = settings.pool.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = settings.pool.IdleConnTimeout
+	// Keep routing through the environment's proxy explicitly, so restricted networks keep working even if the
+	// default transport this copy starts from is ever replaced by one without it
+	transport.Proxy = http.ProxyFromEnvironment
+	return &http.Client{Transport: transport}
+}
+
+// offlineTransport is an http.RoundTripper that fails every request with ErrOffline without sending it.
+type offlineTransport struct{}
+
+// RoundTrip fails the request with ErrOffline.
+func (offlineTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return nil, ErrOffline
+}
+
+// offlineClient is the upstream HTTP client used in offline mode.
+var offlineClient = &http.Client{Transport: offlineTransport{}}
+
+// currentUpstreamClient returns the HTTP client used for calls to upstream APIs.
+// In offline mode it is offlineClient, so that no upstream call leaves the process whatever the endpoint.
+func currentUpstreamClient() *http.Client {
+	if currentConfig().Offline {
+		return offlineClient
+	}
+	upstreamClientMu.RLock()
+	defer upstreamClientMu.RUnlock()
+	return upstreamClient
+}
+
+// maxUpstreamBodyBytes is the largest upstream response body that is read.
+var (
+	maxUpstreamBodyMu    sync.RWMutex
+	maxUpstreamBodyBytes int64 = DefaultMaxUpstreamBodyBytes
+)
+
+// SetMaxUpstreamBodyBytes caps the size of the upstream response bodies that are read, so that a broken or malicious
+// upstream cannot make the service buffer unbounded data. Larger bodies are treated as invalid upstream responses.
+func SetMaxUpstreamBodyBytes(limit int64) error {
+	if limit <= 0 {
+		return fmt.Errorf("upstream body limit must be positive, got %d", limit)
+	}
+	maxUpstreamBodyMu.Lock()
+	defer maxUpstreamBodyMu.Unlock()
+	maxUpstreamBodyBytes = limit
+	return nil
+}
+
+// currentMaxUpstreamBodyBytes returns the largest upstream response body that is read.
+func currentMaxUpstreamBodyBytes() int64 {
+	maxUpstreamBodyMu.RLock()
+	defer maxUpstreamBodyMu.RUnlock()
+	return maxUpstreamBodyBytes
+}
+
+// readUpstreamBody is a helper function that reads an upstream response body of the named provider, stopping at the
+// configured limit. A body larger than the limit results in an error wrapping ErrInvalidResponse, and a failed read
+// in one wrapping ErrUpstreamUnavailable.
+func readUpstreamBody(provider string, body io.Reader) ([]byte, error) {
+	limit := currentMaxUpstreamBodyBytes()
+
+	// Read one byte beyond the limit to tell a body of exactly the limit from a larger one
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", provider, ErrUpstreamUnavailable, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s: %w: response body exceeds %d bytes", provider, ErrInvalidResponse, limit)
+	}
+	return data, nil
+}
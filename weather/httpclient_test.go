@@ -0,0 +1,373 @@
+package weather
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetInsecureSkipTLSVerify(t *testing.T) {
+	tests := []struct {
+		name        string
+		skip        bool
+		wantWarning bool
+		wantErr     bool // Whether a call to a server with a self-signed certificate fails
+	}{
+		{name: "verified by default", skip: false, wantErr: true},
+		{name: "skipped", skip: true, wantWarning: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			logs := captureLog(t)
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer server.Close()
+
+			SetInsecureSkipTLSVerify(tt.skip)
+
+			transport := currentUpstreamClient().Transport.(*http.Transport)
+			if got := transport.TLSClientConfig.InsecureSkipVerify; got != tt.skip {
+				t.Errorf("InsecureSkipVerify = %v, want %v", got, tt.skip)
+			}
+			if got := transport.TLSClientConfig.MinVersion; got != DefaultUpstreamTLSMinVersion {
+				t.Errorf("MinVersion = %#04x, want it kept at %#04x", got, DefaultUpstreamTLSMinVersion)
+			}
+			if got := strings.Contains(logs.String(), "TLS certificate verification of upstream APIs is disabled"); got != tt.wantWarning {
+				t.Errorf("warning logged = %v, want %v; log %q", got, tt.wantWarning, logs)
+			}
+			response, err := currentUpstreamClient().Get(server.URL)
+			if err == nil {
+				response.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("call to a self-signed server error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetUpstreamTLSMinVersionKeepsSkipVerify(t *testing.T) {
+	setupTest(t)
+	captureLog(t)
+	SetInsecureSkipTLSVerify(true)
+
+	if err := SetUpstreamTLSMinVersion(tls.VersionTLS13); err != nil {
+		t.Fatal(err)
+	}
+
+	config := currentUpstreamClient().Transport.(*http.Transport).TLSClientConfig
+	if !config.InsecureSkipVerify || config.MinVersion != tls.VersionTLS13 {
+		t.Errorf("TLS config = skip verify %v, min version %#04x; want both settings kept", config.InsecureSkipVerify, config.MinVersion)
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    uint16
+		wantErr bool
+	}{
+		{value: "1.0", want: tls.VersionTLS10},
+		{value: "1.1", want: tls.VersionTLS11},
+		{value: "1.2", want: tls.VersionTLS12},
+		{value: "1.3", want: tls.VersionTLS13},
+		{value: "", wantErr: true},
+		{value: "1.4", wantErr: true},
+		{value: "TLS1.2", wantErr: true},
+		{value: "1.2 ", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTLSVersion(tt.value)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseTLSVersion(%q) = %#04x, %v; want %#04x, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSetUpstreamTLSMinVersion(t *testing.T) {
+	tests := []struct {
+		name          string
+		version       uint16
+		serverMax     uint16 // Newest TLS version offered by the upstream
+		wantMin       uint16 // MinVersion of the transport afterwards
+		wantErr       bool
+		wantHandshake bool
+	}{
+		{name: "default", version: DefaultUpstreamTLSMinVersion, serverMax: tls.VersionTLS12, wantMin: tls.VersionTLS12, wantHandshake: true},
+		{name: "raised above the upstream", version: tls.VersionTLS13, serverMax: tls.VersionTLS12, wantMin: tls.VersionTLS13},
+		{name: "raised to the upstream", version: tls.VersionTLS13, serverMax: tls.VersionTLS13, wantMin: tls.VersionTLS13, wantHandshake: true},
+		{name: "lowered", version: tls.VersionTLS10, serverMax: tls.VersionTLS12, wantMin: tls.VersionTLS10, wantHandshake: true},
+		{name: "SSL 3.0 rejected", version: 0x0300, serverMax: tls.VersionTLS12, wantMin: DefaultUpstreamTLSMinVersion, wantErr: true, wantHandshake: true},
+		{name: "unknown version rejected", version: 0x0305, serverMax: tls.VersionTLS12, wantMin: DefaultUpstreamTLSMinVersion, wantErr: true, wantHandshake: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			captureLog(t)
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.TLS = &tls.Config{MaxVersion: tt.serverMax}
+			server.StartTLS()
+			defer server.Close()
+			// The test server's certificate is self-signed
+			SetInsecureSkipTLSVerify(true)
+
+			err := SetUpstreamTLSMinVersion(tt.version)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetUpstreamTLSMinVersion(%#04x) error = %v, want error %v", tt.version, err, tt.wantErr)
+			}
+			if got := currentUpstreamClient().Transport.(*http.Transport).TLSClientConfig.MinVersion; got != tt.wantMin {
+				t.Errorf("MinVersion = %#04x, want %#04x", got, tt.wantMin)
+			}
+			response, err := currentUpstreamClient().Get(server.URL)
+			if err == nil {
+				response.Body.Close()
+			}
+			if (err == nil) != tt.wantHandshake {
+				t.Errorf("call to a server offering up to %#04x error = %v, want success %v", tt.serverMax, err, tt.wantHandshake)
+			}
+		})
+	}
+}
+
+func TestSetUpstreamPool(t *testing.T) {
+	tests := []struct {
+		name    string
+		pool    UpstreamPool
+		want    UpstreamPool // Settings of the transport afterwards
+		wantErr bool
+	}{
+		{name: "default", pool: DefaultUpstreamPool, want: DefaultUpstreamPool},
+		{
+			name: "tuned",
+			pool: UpstreamPool{MaxIdleConns: 20, MaxIdleConnsPerHost: 20, IdleConnTimeout: 30 * time.Second},
+			want: UpstreamPool{MaxIdleConns: 20, MaxIdleConnsPerHost: 20, IdleConnTimeout: 30 * time.Second},
+		},
+		{name: "no idle connections", pool: UpstreamPool{MaxIdleConns: 0, MaxIdleConnsPerHost: 4, IdleConnTimeout: time.Minute}, want: DefaultUpstreamPool, wantErr: true},
+		{name: "negative per host", pool: UpstreamPool{MaxIdleConns: 10, MaxIdleConnsPerHost: -1, IdleConnTimeout: time.Minute}, want: DefaultUpstreamPool, wantErr: true},
+		{name: "no idle timeout", pool: UpstreamPool{MaxIdleConns: 10, MaxIdleConnsPerHost: 4}, want: DefaultUpstreamPool, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if err := SetUpstreamTLSMinVersion(tls.VersionTLS13); err != nil {
+				t.Fatal(err)
+			}
+
+			err := SetUpstreamPool(tt.pool)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetUpstreamPool(%+v) error = %v, want error %v", tt.pool, err, tt.wantErr)
+			}
+			transport := currentUpstreamClient().Transport.(*http.Transport)
+			got := UpstreamPool{MaxIdleConns: transport.MaxIdleConns, MaxIdleConnsPerHost: transport.MaxIdleConnsPerHost, IdleConnTimeout: transport.IdleConnTimeout}
+			if got != tt.want {
+				t.Errorf("transport pool = %+v, want %+v", got, tt.want)
+			}
+			if transport.TLSClientConfig.MinVersion != tls.VersionTLS13 || transport.Proxy == nil {
+				t.Errorf("transport lost its TLS minimum version %#04x or proxy", transport.TLSClientConfig.MinVersion)
+			}
+		})
+	}
+}
+
+func TestUpstreamPoolReusesConnections(t *testing.T) {
+	tests := []struct {
+		name            string
+		idleTimeout     time.Duration
+		pause           time.Duration // Pause between the calls
+		wantConnections int
+	}{
+		{name: "reused", idleTimeout: time.Minute, wantConnections: 1},
+		{name: "closed after the idle timeout", idleTimeout: 10 * time.Millisecond, pause: 100 * time.Millisecond, wantConnections: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			var mu sync.Mutex
+			connections := 0
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					mu.Lock()
+					connections++
+					mu.Unlock()
+				}
+			}
+			server.Start()
+			defer server.Close()
+			if err := SetUpstreamPool(UpstreamPool{MaxIdleConns: 1, MaxIdleConnsPerHost: 1, IdleConnTimeout: tt.idleTimeout}); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				response, err := currentUpstreamClient().Get(server.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				io.Copy(io.Discard, response.Body)
+				response.Body.Close()
+				time.Sleep(tt.pause)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if connections != tt.wantConnections {
+				t.Errorf("connections = %d, want %d", connections, tt.wantConnections)
+			}
+		})
+	}
+}
+
+func TestUpstreamBodyLimit(t *testing.T) {
+	limit := int64(len(sampleCurrentWeather) + 16)
+	// Trailing whitespace keeps the padded bodies valid JSON, so only their size can make them fail
+	padded := func(body string, size int64) string { return body + strings.Repeat(" ", int(size)-len(body)) }
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		provider   Provider
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "under the limit", handler: WeatherHandler, provider: OpenWeatherMapProvider{}, path: currentWeatherPath, body: sampleCurrentWeather, wantStatus: http.StatusOK},
+		{name: "exactly the limit", handler: WeatherHandler, provider: OpenWeatherMapProvider{}, path: currentWeatherPath, body: padded(sampleCurrentWeather, limit), wantStatus: http.StatusOK},
+		{name: "one byte over", handler: WeatherHandler, provider: OpenWeatherMapProvider{}, path: currentWeatherPath, body: padded(sampleCurrentWeather, limit+1), wantStatus: http.StatusBadGateway},
+		{name: "far over", handler: WeatherHandler, provider: OpenWeatherMapProvider{}, path: currentWeatherPath, body: padded(sampleCurrentWeather, 64*limit), wantStatus: http.StatusBadGateway},
+		{name: "raw endpoint", handler: RawHandler, provider: OpenWeatherMapProvider{}, path: currentWeatherPath, body: padded(sampleCurrentWeather, limit+1), wantStatus: http.StatusBadGateway},
+		{name: "open-meteo", handler: WeatherHandler, provider: OpenMeteoProvider{}, path: openMeteoPath, body: padded(sampleOpenMeteo, limit+1), wantStatus: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if err := SetMaxUpstreamBodyBytes(limit); err != nil {
+				t.Fatal(err)
+			}
+			providersMu.Lock()
+			providers = []Provider{tt.provider}
+			providersMu.Unlock()
+			upstream := newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(tt.handler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if got := len(upstream.calls(tt.path)); got != 1 {
+				t.Errorf("upstream calls = %d, want an oversized body not to be retried", got)
+			}
+		})
+	}
+}
+
+// failingReader is an io.Reader whose every read fails, like a connection reset while the body is read.
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) { return 0, errors.New("connection reset by peer") }
+
+func TestReadUpstreamBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    io.Reader
+		want    string
+		wantErr error
+	}{
+		{name: "within the limit", body: strings.NewReader("0123456789"), want: "0123456789"},
+		{name: "over the limit", body: strings.NewReader("0123456789-"), wantErr: ErrInvalidResponse},
+		{name: "failed read", body: failingReader{}, wantErr: ErrUpstreamUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if err := SetMaxUpstreamBodyBytes(10); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readUpstreamBody("stub", tt.body)
+
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("readUpstreamBody() error = %v, want %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("readUpstreamBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetMaxUpstreamBodyBytes(t *testing.T) {
+	setupTest(t)
+	for _, limit := range []int64{0, -1} {
+		if err := SetMaxUpstreamBodyBytes(limit); err == nil {
+			t.Errorf("SetMaxUpstreamBodyBytes(%d) accepted a limit that is not positive", limit)
+		}
+	}
+	if got := currentMaxUpstreamBodyBytes(); got != DefaultMaxUpstreamBodyBytes {
+		t.Errorf("limit = %d after rejected changes, want %d", got, DefaultMaxUpstreamBodyBytes)
+	}
+}
+
+// proxyChildEnv names the proxy environment variable a child process of TestUpstreamProxyFromEnvironment sets.
+const proxyChildEnv = "WEATHER_TEST_PROXY_VARIABLE"
+
+func TestUpstreamProxyFromEnvironment(t *testing.T) {
+	// net/http reads the proxy environment variables once per process, so every case runs in a fresh child process
+	if variable := os.Getenv(proxyChildEnv); variable != "" {
+		checkUpstreamProxy(t, variable)
+		return
+	}
+	for _, variable := range []string{"HTTPS_PROXY", "https_proxy"} {
+		t.Run(variable, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestUpstreamProxyFromEnvironment$")
+			cmd.Env = append(os.Environ(), proxyChildEnv+"="+variable)
+			if output, err := cmd.CombinedOutput(); err != nil {
+				t.Errorf("child process with %s failed: %v\n%s", variable, err, output)
+			}
+		})
+	}
+}
+
+// checkUpstreamProxy is a helper function that sets the named proxy environment variable to a fake proxy and checks
+// that an upstream call of the default client tunnels through it.
+func checkUpstreamProxy(t *testing.T, variable string) {
+	var mu sync.Mutex
+	var tunnels []string
+	// The proxy refuses every tunnel, so the call fails without ever leaving the machine
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodConnect {
+			tunnels = append(tunnels, r.Host)
+		}
+		http.Error(w, "tunnels are not allowed", http.StatusForbidden)
+	}))
+	defer proxy.Close()
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv(variable, proxy.URL)
+	setupTest(t)
+	MaxUpstreamAttempts = 1
+
+	_, err := GetWeather(context.Background(), 51.51, -0.13)
+
+	if !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("GetWeather() error = %v, want the refused tunnel to fail with %v", err, ErrUpstreamUnavailable)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(tunnels) != 1 || tunnels[0] != "api.openweathermap.org:443" {
+		t.Errorf("tunnels through the proxy = %q, want one to api.openweathermap.org:443", tunnels)
+	}
+}
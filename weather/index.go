@@ -0,0 +1,92 @@
+package weather
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// indexTemplate is the self-contained HTML page served at the root path.
+// It lets a person look up the weather from a browser by submitting coordinates or a ZIP code to the /weather endpoint
+// and rendering the JSON result as a table, without any external assets.
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Weather</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; padding: 0 1em; }
+fieldset { margin-bottom: 1em; }
+label { display: inline-block; min-width: 6em; }
+table { border-collapse: collapse; }
+td { border-bottom: 1px solid #ddd; padding: 0.3em 0.6em; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Weather</h1>
+<form id="lookup" action="/weather" method="get">
+<fieldset>
+<legend>Coordinates</legend>
+<label for="lat">Latitude</label> <input id="lat" name="lat" placeholder="51.5074"><br>
+<label for="lon">Longitude</label> <input id="lon" name="lon" placeholder="-0.1278">
+</fieldset>
+<fieldset>
+<legend>or ZIP code</legend>
+<label for="zip">ZIP</label> <input id="zip" name="zip" placeholder="94040,US">
+</fieldset>
+<button type="submit">Get weather</button>
+</form>
+<div id="result"></div>
+<script>
+document.getElementById("lookup").addEventListener("submit", function (event) {
+	event.preventDefault();
+	var params = new URLSearchParams();
+	new FormData(event.target).forEach(function (value, name) {
+		if (value !== "") { params.append(name, value); }
+	});
+	var result = document.getElementById("result");
+	result.textContent = "Loading...";
+	fetch("/weather?" + params.toString(), { headers: { "Accept": "application/json" } })
+		.then(function (response) {
+			if (!response.ok) {
+				return response.text().then(function (text) { throw new Error(text); });
+			}
+			return response.json();
+		})
+		.then(function (data) {
+			var table = document.createElement("table");
+			Object.keys(data).forEach(function (name) {
+				var row = table.insertRow();
+				row.insertCell().textContent = name.replace(/_/g, " ");
+				row.insertCell().textContent = data[name];
+			});
+			result.replaceChildren(table);
+		})
+		.catch(function (error) {
+			result.innerHTML = "";
+			var message = document.createElement("p");
+			message.className = "error";
+			message.textContent = error.message;
+			result.appendChild(message);
+		});
+});
+</script>
+</body>
+</html>
+`))
+
+// IndexHandler is an HTTP handler function that serves a small HTML page for browsing the weather at the root path.
+// Since the root pattern matches every path, requests for anything other than "/" are answered with a Not Found status code (404).
+// The 404 body is JSON in the same FieldError format as validation errors, so API clients can handle every error alike.
+func IndexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeFieldErrors(w, http.StatusNotFound, []FieldError{{Field: "path", Code: "unknown_path", Message: "No endpoint at " + r.URL.Path}})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, nil); err != nil {
+		log.Printf("Failed to render index page: %v", err)
+	}
+}
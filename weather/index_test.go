@@ -0,0 +1,85 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndexHandler(t *testing.T) {
+	tests := []struct {
+		path            string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{path: "/", wantStatus: http.StatusOK, wantContentType: "text/html; charset=utf-8", wantBody: `<form id="lookup" action="/weather"`},
+		{path: "/?lat=51.51", wantStatus: http.StatusOK, wantContentType: "text/html; charset=utf-8", wantBody: "<title>Weather</title>"},
+		{path: "/forecast", wantStatus: http.StatusNotFound, wantContentType: contentTypeJSON, wantBody: `[{"field":"path","code":"unknown_path","message":"No endpoint at /forecast"}]`},
+		{path: "/index.html?lat=51.51", wantStatus: http.StatusNotFound, wantContentType: contentTypeJSON, wantBody: `"message":"No endpoint at /index.html"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			recorder := serve(IndexHandler, http.MethodGet, tt.path, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if got := recorder.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("body does not contain %s", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUnknownRoutes(t *testing.T) {
+	// The routes are registered like in main, where the root pattern catches every path without a handler of its own
+	mux := http.NewServeMux()
+	mux.HandleFunc("/weather", WeatherHandler)
+	mux.HandleFunc("/weather/compare", CompareHandler)
+	mux.HandleFunc("/", IndexHandler)
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantErrors []FieldError // Body of a Not Found response
+	}{
+		{path: "/weather?lat=51.51&lon=-0.13", wantStatus: http.StatusOK},
+		{path: "/weather/compare?lat1=51.51&lon1=-0.13&lat2=51.51&lon2=-0.13", wantStatus: http.StatusOK},
+		{path: "/", wantStatus: http.StatusOK},
+		{path: "/weather/", wantStatus: http.StatusNotFound, wantErrors: []FieldError{{Field: "path", Code: "unknown_path", Message: "No endpoint at /weather/"}}},
+		{path: "/weather/forecast", wantStatus: http.StatusNotFound, wantErrors: []FieldError{{Field: "path", Code: "unknown_path", Message: "No endpoint at /weather/forecast"}}},
+		{path: "/Weather", wantStatus: http.StatusNotFound, wantErrors: []FieldError{{Field: "path", Code: "unknown_path", Message: "No endpoint at /Weather"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+			recorder := httptest.NewRecorder()
+
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantErrors == nil {
+				return
+			}
+			if got := recorder.Header().Get("Content-Type"); got != contentTypeJSON {
+				t.Errorf("Content-Type = %q, want %q", got, contentTypeJSON)
+			}
+			var got []FieldError
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.wantErrors) {
+				t.Errorf("errors = %+v, want %+v", got, tt.wantErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package weather
+
+import "strings"
+
+// unitLabels translates the English unit labels used in response fields such as "65 percentage" or "9.7 KM" for the
+// languages selected with the lang parameter. Languages are keyed by their base code, e.g. "pt" also covers "pt_br";
+// labels that read the same in a language, such as "Celsius" or "mm" in German, are left out. Unsupported languages
+// and labels keep the English label.
+var unitLabels = map[string]map[string]string{
+	"de": {"percentage": "Prozent", "degrees": "Grad", "KM": "km", "MI": "mi"},
+	"es": {"percentage": "por ciento", "degrees": "grados", "KM": "km", "MI": "mi"},
+	"fr": {"percentage": "pour cent", "degrees": "degrés", "KM": "km", "MI": "mi"},
+	"it": {"percentage": "percento", "degrees": "gradi", "KM": "km", "MI": "mi"},
+	"pt": {"percentage": "por cento", "degrees": "graus", "KM": "km", "MI": "mi"},
+}
+
+// localizeLabel is a helper function that translates the unit label of a formatted value such as "65 percentage" into
+// the given language, leaving the number untouched. Values without a known label are returned unchanged.
+func localizeLabel(value, lang string) string {
+	number, label, found := strings.Cut(value, " ")
+	if !found {
+		return value
+	}
+	base, _, _ := strings.Cut(lang, "_")
+	if localized, ok := unitLabels[base][label]; ok {
+		return number + " " + localized
+	}
+	return value
+}
+
+// localizeWeatherData is a helper function that translates the unit labels of every formatted field of the weather
+// data into the given language, see localizeLabel. The weather description is already localized by the upstream.
+func localizeWeatherData(weatherData *WeatherData, lang string) {
+	for _, field := range []*string{
+		&weatherData.Temperature, &weatherData.Visibility, &weatherData.WindSpeed, &weatherData.WindDirection,
+		&weatherData.CloudCoverage, &weatherData.Humidity, &weatherData.DewPoint, &weatherData.RainVolume,
+		&weatherData.SnowVolume, &weatherData.SmoothedTemperature, &weatherData.TemperatureKelvin,
+	} {
+		*field = localizeLabel(*field, lang)
+	}
+}
+
+// localizeOneCallData is a helper function that translates the unit labels of every section of a One Call response
+// into the given language, see localizeLabel.
+func localizeOneCallData(oneCallData *OneCallData, lang string) {
+	if oneCallData.Current != nil {
+		localizeWeatherData(oneCallData.Current, lang)
+	}
+	for _, hour := range oneCallData.Hourly {
+		localizeWeatherData(hour, lang)
+	}
+	for i := range oneCallData.Daily {
+		day := &oneCallData.Daily[i]
+		for _, field := range []*string{
+			&day.TemperatureMin, &day.TemperatureMax, &day.Humidity, &day.WindSpeed, &day.CloudCoverage,
+			&day.RainVolume, &day.SnowVolume,
+		} {
+			*field = localizeLabel(*field, lang)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLocalizeLabel(t *testing.T) {
+	tests := []struct {
+		value, lang, want string
+	}{
+		{value: "64 percentage", lang: "de", want: "64 Prozent"},
+		{value: "250 degrees", lang: "fr", want: "250 degrés"},
+		{value: "10.0 KM", lang: "es", want: "10.0 km"},
+		{value: "6.2 MI", lang: "it", want: "6.2 mi"},
+		{value: "64 percentage", lang: "pt_br", want: "64 por cento"},
+		{value: "18.4 Celsius", lang: "de", want: "18.4 Celsius"},
+		{value: "64 percentage", lang: "ja", want: "64 percentage"},
+		{value: "64 percentage", lang: "en", want: "64 percentage"},
+		{value: "64 percentage", lang: "", want: "64 percentage"},
+		{value: "18.4", lang: "de", want: "18.4"},
+		{value: "", lang: "de", want: ""},
+	}
+	for _, tt := range tests {
+		if got := localizeLabel(tt.value, tt.lang); got != tt.want {
+			t.Errorf("localizeLabel(%q, %q) = %q, want %q", tt.value, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestWeatherHandlerLocalizedLabels(t *testing.T) {
+	// labels are the fields of the response that carry a unit label
+	type labels struct {
+		Temperature, Visibility, WindSpeed, WindDirection, CloudCoverage, Humidity string
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  labels
+	}{
+		{
+			name: "english",
+			want: labels{Temperature: "18.4 Celsius", Visibility: "10.0 KM", WindSpeed: "4.1 m/s", WindDirection: "250 degrees", CloudCoverage: "75 percentage", Humidity: "64 percentage"},
+		},
+		{
+			name:  "german",
+			query: "&lang=de",
+			want:  labels{Temperature: "18.4 Celsius", Visibility: "10.0 km", WindSpeed: "4.1 m/s", WindDirection: "250 Grad", CloudCoverage: "75 Prozent", Humidity: "64 Prozent"},
+		},
+		{
+			name:  "brazilian portuguese in imperial units",
+			query: "&lang=pt_br&units=imperial",
+			want:  labels{Temperature: "18.4 Fahrenheit", Visibility: "6.2 mi", WindSpeed: "4.1 mph", WindDirection: "250 graus", CloudCoverage: "75 por cento", Humidity: "64 por cento"},
+		},
+		{
+			name:  "language without a catalog",
+			query: "&lang=ja",
+			want:  labels{Temperature: "18.4 Celsius", Visibility: "10.0 KM", WindSpeed: "4.1 m/s", WindDirection: "250 degrees", CloudCoverage: "75 percentage", Humidity: "64 percentage"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			// The second response comes from the cache, which must keep the untranslated labels
+			for i := 0; i < 2; i++ {
+				recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13"+tt.query, nil)
+
+				if recorder.Code != http.StatusOK {
+					t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+				}
+				var got WeatherData
+				if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+					t.Fatal(err)
+				}
+				labelled := labels{got.Temperature, got.Visibility, got.WindSpeed, got.WindDirection, got.CloudCoverage, got.Humidity}
+				if labelled != tt.want {
+					t.Errorf("response %d labels = %+v, want %+v", i, labelled, tt.want)
+				}
+			}
+			if calls := len(upstream.calls(currentWeatherPath)); calls != 1 {
+				t.Errorf("upstream calls = %d, want 1", calls)
+			}
+		})
+	}
+}
+
+func TestOneCallHandlerLocalizedLabels(t *testing.T) {
+	daily := `"daily":[{"dt":1717239600,"temp":{"day":19.2,"min":11.5,"max":21.3},"humidity":58,"wind_speed":4.4,"clouds":60,` +
+		`"weather":[{"description":"couvert"}]}],`
+	setupTest(t)
+	newUpstream(t, map[string]http.HandlerFunc{oneCallPath: respond(http.StatusOK, strings.Replace(sampleOneCall, `"current":`, daily+`"current":`, 1))})
+
+	recorder := serve(OneCallHandler, http.MethodGet, "/onecall?lat=51.51&lon=-0.13&lang=fr", nil)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+	}
+	var data OneCallData
+	if err := json.Unmarshal(recorder.Body.Bytes(), &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Current == nil || data.Current.Humidity != "64 pour cent" || data.Current.WindDirection != "250 degrés" {
+		t.Errorf("current = %+v, want French labels", data.Current)
+	}
+	if len(data.Daily) != 1 || data.Daily[0].Humidity != "58 pour cent" || data.Daily[0].CloudCoverage != "60 pour cent" || data.Daily[0].TemperatureMax != "21.3 Celsius" {
+		t.Errorf("daily = %+v, want French labels", data.Daily)
+	}
+}
@@ -0,0 +1,74 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultMaxUpstreamCalls is the number of concurrent upstream calls allowed when nothing is configured.
+const DefaultMaxUpstreamCalls = 10
+
+// errUpstreamLimitReached is returned in fail-fast mode when every upstream call slot is taken.
+var errUpstreamLimitReached = errors.New("too many concurrent upstream calls")
+
+// upstreamLimiter is a counting semaphore bounding the number of upstream calls in flight at once, to OpenWeatherMap,
+// the fallback providers and the geolocation service alike, which protects the API quotas and the connection pool
+// under a burst of requests.
+type upstreamLimiter struct {
+	slots    chan struct{}
+	failFast bool // Fail immediately instead of waiting for a free slot
+}
+
+// newUpstreamLimiter is a helper function that creates a limiter allowing max concurrent calls.
+func newUpstreamLimiter(max int, failFast bool) *upstreamLimiter {
+	return &upstreamLimiter{slots: make(chan struct{}, max), failFast: failFast}
+}
+
+// acquire takes a call slot and returns the function releasing it.
+// When no slot is free it either fails with errUpstreamLimitReached or waits until one frees up or ctx is done,
+// in which case the context error is returned.
+func (l *upstreamLimiter) acquire(ctx context.Context) (func(), error) {
+	release := func() { <-l.slots }
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if l.failFast {
+		return nil, errUpstreamLimitReached
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// activeUpstreamLimiter is the limiter gating upstream calls.
+var (
+	upstreamLimiterMu     sync.RWMutex
+	activeUpstreamLimiter = newUpstreamLimiter(DefaultMaxUpstreamCalls, false)
+)
+
+// SetUpstreamLimit replaces the limit on concurrent upstream calls.
+// When failFast is true, calls beyond the limit fail straight away instead of waiting for a free slot.
+// Calls already holding a slot of the previous limiter are unaffected.
+func SetUpstreamLimit(max int, failFast bool) error {
+	if max <= 0 {
+		return fmt.Errorf("upstream call limit must be positive, got %d", max)
+	}
+	upstreamLimiterMu.Lock()
+	defer upstreamLimiterMu.Unlock()
+	activeUpstreamLimiter = newUpstreamLimiter(max, failFast)
+	return nil
+}
+
+// currentUpstreamLimiter returns the limiter gating upstream calls.
+func currentUpstreamLimiter() *upstreamLimiter {
+	upstreamLimiterMu.RLock()
+	defer upstreamLimiterMu.RUnlock()
+	return activeUpstreamLimiter
+}
@@ -0,0 +1,163 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpstreamLimiterAcquire(t *testing.T) {
+	tests := []struct {
+		name     string
+		failFast bool
+		freeSlot bool // Whether the held slot is released while the call waits
+		wantErr  error
+	}{
+		{name: "fail fast", failFast: true, wantErr: errUpstreamLimitReached},
+		{name: "wait until the context is done", wantErr: context.DeadlineExceeded},
+		{name: "wait for a free slot", freeSlot: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newUpstreamLimiter(1, tt.failFast)
+			releaseHeld, err := limiter.acquire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.freeSlot {
+				time.AfterFunc(20*time.Millisecond, releaseHeld)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			release, err := limiter.acquire(ctx)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("acquire() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				release()
+			}
+		})
+	}
+}
+
+func TestSetUpstreamLimit(t *testing.T) {
+	for _, max := range []int{0, -1} {
+		setupTest(t)
+		if err := SetUpstreamLimit(max, false); err == nil {
+			t.Errorf("SetUpstreamLimit(%d) accepted an invalid limit", max)
+		}
+	}
+}
+
+func TestWeatherHandlerUpstreamLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		failFast   bool
+		wantStatus int
+	}{
+		{name: "fail fast", failFast: true, wantStatus: http.StatusServiceUnavailable},
+		{name: "wait", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if err := SetUpstreamLimit(1, tt.failFast); err != nil {
+				t.Fatal(err)
+			}
+			started, unblock := make(chan struct{}, 1), make(chan struct{})
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("lat") == "10.000000" {
+					started <- struct{}{}
+					<-unblock
+				}
+				respond(http.StatusOK, sampleCurrentWeather)(w, r)
+			}})
+
+			// The first request holds the only slot until the upstream is unblocked
+			first := make(chan *httptest.ResponseRecorder)
+			go func() { first <- serve(WeatherHandler, http.MethodGet, "/weather?lat=10&lon=10", nil) }()
+			<-started
+			if !tt.failFast {
+				time.AfterFunc(50*time.Millisecond, func() { close(unblock) })
+			}
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=20&lon=20", nil)
+
+			if tt.failFast {
+				close(unblock)
+			}
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.failFast && !strings.Contains(recorder.Body.String(), "Too many concurrent requests") {
+				t.Errorf("body %s does not explain the limit", recorder.Body)
+			}
+			if held := <-first; held.Code != http.StatusOK {
+				t.Errorf("status of the request holding the slot = %d; body %s", held.Code, held.Body)
+			}
+		})
+	}
+}
+
+func TestUpstreamLimitGatesEveryUpstream(t *testing.T) {
+	const geolocationPath = "/8.8.8.8/json/"
+	tests := []struct {
+		name string
+		path string
+		call func(ctx context.Context) error
+	}{
+		{
+			name: "open-meteo",
+			path: openMeteoPath,
+			call: func(ctx context.Context) error {
+				_, err := OpenMeteoProvider{}.Fetch(ctx, 51.51, -0.13)
+				return err
+			},
+		},
+		{
+			name: "geolocation",
+			path: geolocationPath,
+			call: func(ctx context.Context) error {
+				_, _, err := HTTPGeolocator{URL: "https://ipapi.example/{ip}/json/"}.Locate(ctx, "8.8.8.8")
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			captureLog(t)
+			if err := SetUpstreamLimit(1, true); err != nil {
+				t.Fatal(err)
+			}
+			upstream := newUpstream(t, map[string]http.HandlerFunc{
+				openMeteoPath:   respond(http.StatusOK, sampleOpenMeteo),
+				geolocationPath: respond(http.StatusOK, `{"latitude":37.42301,"longitude":-122.083352}`),
+			})
+			release, err := currentUpstreamLimiter().acquire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = tt.call(context.Background())
+
+			if !errors.Is(err, errUpstreamLimitReached) {
+				t.Errorf("error = %v, want %v", err, errUpstreamLimitReached)
+			}
+			if calls := upstream.calls(tt.path); len(calls) != 0 {
+				t.Errorf("upstream calls = %v, want none while every slot is taken", calls)
+			}
+
+			release()
+			if err := tt.call(context.Background()); err != nil {
+				t.Errorf("error = %v once a slot is free", err)
+			}
+		})
+	}
+}
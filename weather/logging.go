@@ -0,0 +1,42 @@
+package weather
+
+import (
+	"log"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// debugLogging enables the debug log lines, which are off by default.
+var debugLogging atomic.Bool
+
+// SetDebugLogging turns the debug log lines, such as the upstream URLs being called, on or off.
+func SetDebugLogging(enabled bool) {
+	debugLogging.Store(enabled)
+}
+
+// debugf is a helper function that logs a message like log.Printf, but only when debug logging is enabled.
+func debugf(format string, args ...interface{}) {
+	if debugLogging.Load() {
+		log.Printf("DEBUG "+format, args...)
+	}
+}
+
+// redactedValue replaces secret query parameter values in logged URLs.
+const redactedValue = "***"
+
+// redactURL is a helper function that returns the URL with the value of its appid query parameter, which holds the
+// API key, replaced by redactedValue, so the URL can be logged safely. A URL that cannot be parsed is not returned at
+// all, since it could still contain the key.
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "<unparseable URL>"
+	}
+	query := parsed.Query()
+	if query.Has("appid") {
+		query.Set("appid", redactedValue)
+	}
+	parsed.RawQuery = strings.ReplaceAll(query.Encode(), url.QueryEscape(redactedValue), redactedValue)
+	return parsed.String()
+}
@@ -0,0 +1,65 @@
+package weather
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{
+			url:  "https://api.openweathermap.org/data/2.5/weather?lat=51.51&lon=-0.13&appid=secret",
+			want: "https://api.openweathermap.org/data/2.5/weather?appid=***&lat=51.51&lon=-0.13",
+		},
+		{
+			url:  "https://api.openweathermap.org/geo/1.0/direct?q=London&limit=1&appid=a%26b",
+			want: "https://api.openweathermap.org/geo/1.0/direct?appid=***&limit=1&q=London",
+		},
+		{url: "https://api.open-meteo.com/v1/forecast?latitude=51.51", want: "https://api.open-meteo.com/v1/forecast?latitude=51.51"},
+		{url: "https://api.openweathermap.org/data/2.5/weather?appid=secret\x7f", want: "<unparseable URL>"},
+	}
+	for _, tt := range tests {
+		if got := redactURL(tt.url); got != tt.want {
+			t.Errorf("redactURL(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestDebugLoggingRedactsAPIKey(t *testing.T) {
+	const key = "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name      string
+		debug     bool
+		upstream  http.HandlerFunc
+		wantDebug bool
+	}{
+		{name: "debug logging", debug: true, upstream: respond(http.StatusOK, sampleCurrentWeather), wantDebug: true},
+		{name: "debug logging of a failure", debug: true, upstream: respond(http.StatusInternalServerError, `{}`), wantDebug: true},
+		{name: "regular logging", upstream: respond(http.StatusOK, sampleCurrentWeather)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			RetryBackoff = time.Millisecond
+			SetDebugLogging(tt.debug)
+			logs := captureLog(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: tt.upstream})
+
+			serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", http.Header{"X-Api-Key": {key}})
+
+			output := logs.String()
+			if strings.Contains(output, key) {
+				t.Errorf("log contains the API key: %s", output)
+			}
+			logged := strings.Contains(output, "DEBUG Calling https://api.openweathermap.org/data/2.5/weather?appid=***&lang=en&lat=51.510000&lon=-0.130000&units=metric")
+			if logged != tt.wantDebug {
+				t.Errorf("redacted upstream URL logged = %v, want %v; log %s", logged, tt.wantDebug, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package weather
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statusRecorder wraps an http.ResponseWriter to capture the status code and the number of bytes written.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// WriteHeader records the status code before passing it on to the wrapped writer.
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the number of bytes written, treating a write without an explicit status code as 200 OK.
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap returns the wrapped writer so that http.ResponseController can reach optional interfaces such as http.Flusher.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// LoggingMiddleware wraps a handler to emit one structured log line per request with the client address, method, path,
+// query, status code, response size and total latency. Coordinates in the query are rounded to CoordinatePrecision.
+// The client address honors forwarding headers from trusted proxies only, see clientIP.
+// The coordinates and units resolved by the handler, e.g. from a favorite location or a city, are logged too when the
+// handler records them in the request context, with the coordinates rounded the same way.
+// Logging of upstream calls is done separately by the fetch path.
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		ctx := withRequestValues(r.Context())
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		// Add the values recorded by the handler
+		var resolved string
+		if lat, lon, ok := requestCoordinates(ctx); ok {
+			resolved += " location=" + formatCoordinates(lat, lon)
+		}
+		if units := requestUnits(ctx); units != "" {
+			resolved += " units=" + units
+		}
+
+		// A handler that never writes anything still results in a 200 OK response
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		log.Printf("client=%s method=%s path=%q query=%q%s status=%d bytes=%d duration=%s",
+			clientIP(r), r.Method, r.URL.Path, sanitizeQuery(r.URL.Query()), resolved, status, recorder.bytes, time.Since(start))
+	})
+}
+
+// DefaultMaxBodyBytes is the largest request body accepted by default, 1 MB.
+const DefaultMaxBodyBytes = 1 << 20
+
+// MaxBodyMiddleware wraps a handler so that request bodies larger than limit bytes are rejected with a Request Entity
+// Too Large status code (413) instead of exhausting memory. Requests announcing an oversized Content-Length are rejected
+// up front; other bodies are wrapped with http.MaxBytesReader, so reads beyond the limit fail and handlers that decode
+// the body should report them with writeBodyError.
+func MaxBodyMiddleware(limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeBodyError is a helper function that reports a failure to read or decode a request body.
+// Bodies cut off by MaxBodyMiddleware result in a Request Entity Too Large status code (413); anything else is a
+// Bad Request (400).
+func writeBodyError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Invalid request body", http.StatusBadRequest)
+}
+
+// sanitizeQuery is a helper function that encodes query parameters for logging, rounding the coordinate
+// parameters (lat, lon, latlon and the numbered lat1, lon1, lat2, lon2 of /weather/compare) to the
+// configured CoordinatePrecision so that exact locations do not end up in the logs.
+func sanitizeQuery(query url.Values) string {
+	sanitized := url.Values{}
+	for name, values := range query {
+		for _, value := range values {
+			switch name {
+			case "lat", "lon", "lat1", "lon1", "lat2", "lon2":
+				value = sanitizeCoordinate(value)
+			case "latlon":
+				if lat, lon, found := strings.Cut(value, ","); found {
+					value = sanitizeCoordinate(lat) + "," + sanitizeCoordinate(lon)
+				}
+			}
+			sanitized.Add(name, value)
+		}
+	}
+	return sanitized.Encode()
+}
+
+// sanitizeCoordinate is a helper function that rounds a coordinate given as text to the configured CoordinatePrecision.
+// Values that are not numbers are returned unchanged.
+func sanitizeCoordinate(value string) string {
+	coordinate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return value
+	}
+	return strconv.FormatFloat(roundCoordinate(coordinate, currentConfig().CoordinatePrecision), 'f', -1, 64)
+}
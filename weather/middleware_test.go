@@ -0,0 +1,138 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeQuery(t *testing.T) {
+	tests := []struct {
+		precision int
+		query     string
+		want      string
+	}{
+		{precision: 2, query: "lat=51.507351&lon=-0.127758&units=metric", want: "lat=51.51&lon=-0.13&units=metric"},
+		{precision: 1, query: "latlon=51.507351,-0.127758", want: "latlon=51.5%2C-0.1"},
+		{precision: 2, query: "lat1=1.23456&lon1=2.34567&lat2=3.45678&lon2=4.56789", want: "lat1=1.23&lat2=3.46&lon1=2.35&lon2=4.57"},
+		{precision: 2, query: "lat=north&lon=", want: "lat=north&lon="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.CoordinatePrecision = tt.precision })
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sanitizeQuery(query); got != tt.want {
+				t.Errorf("sanitizeQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		handler http.HandlerFunc
+		want    []string
+	}{
+		{
+			name:   "status and size",
+			target: "/weather?units=metric",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, "hello")
+			},
+			want: []string{`method=GET`, `path="/weather"`, `query="units=metric"`, "status=201", "bytes=5", "duration="},
+		},
+		{
+			name:    "nothing written",
+			target:  "/weather",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			want:    []string{"status=200", "bytes=0"},
+		},
+		{
+			name:    "coordinates in the query are rounded",
+			target:  "/weather?lat=51.507351&lon=-0.127758",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			want:    []string{`query="lat=51.51&lon=-0.13"`},
+		},
+		{
+			name:   "values resolved by the handler",
+			target: "/weather?location=home",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				setRequestCoordinates(r.Context(), 51.507351, -0.127758)
+				setRequestUnits(r.Context(), UnitsImperial)
+			},
+			want: []string{"location=51.51,-0.13", "units=imperial"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			logs := captureLog(t)
+
+			LoggingMiddleware(tt.handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			for _, want := range tt.want {
+				if !strings.Contains(logs.String(), want) {
+					t.Errorf("log %q does not contain %s", logs, want)
+				}
+			}
+			if strings.Contains(logs.String(), "51.507351") {
+				t.Errorf("log %q contains the exact coordinates", logs)
+			}
+		})
+	}
+}
+
+func TestMaxBodyMiddleware(t *testing.T) {
+	const limit = 64
+	small := `[{"lat":51.51,"lon":-0.13}]`
+	large := "[" + strings.Repeat(`{"lat":51.51,"lon":-0.13},`, 4) + `{"lat":51.51,"lon":-0.13}]`
+	tests := []struct {
+		name          string
+		body          string
+		unknownLength bool // Send the body without a Content-Length, as in a chunked upload
+		wantStatus    int
+	}{
+		{name: "within the limit", body: small, wantStatus: http.StatusOK},
+		{name: "within the limit without length", body: small, unknownLength: true, wantStatus: http.StatusOK},
+		{name: "announced as too large", body: large, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "too large without length", body: large, unknownLength: true, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded bool
+			handler := MaxBodyMiddleware(limit, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var locations []struct{ Lat, Lon float64 }
+				if err := json.NewDecoder(r.Body).Decode(&locations); err != nil {
+					writeBodyError(w, err)
+					return
+				}
+				decoded = true
+			}))
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.unknownLength {
+				request.ContentLength = -1
+			}
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if decoded != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("body decoded = %v, want %v", decoded, tt.wantStatus == http.StatusOK)
+			}
+		})
+	}
+}
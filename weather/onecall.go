@@ -0,0 +1,393 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// OneCallData represents the response of the /onecall endpoint, built from the OpenWeatherMap One Call 3.0 API.
+// Current conditions and hourly forecasts use the same WeatherData shape as the /weather endpoint;
+// sections excluded by the client are omitted.
+type OneCallData struct {
+	Timezone string                  `json:"timezone"`           // IANA timezone name of the location
+	Current  *WeatherData            `json:"current,omitempty"`  // Current weather conditions
+	Minutely []MinutelyPrecipitation `json:"minutely,omitempty"` // Precipitation forecast for the next hour, where available
+	Hourly   []*WeatherData          `json:"hourly,omitempty"`   // Hourly forecasts, starting with the current hour
+	Daily    []DailyWeather          `json:"daily,omitempty"`    // Daily forecast summaries, starting with today
+	Alerts   []Alert                 `json:"alerts"`             // Government weather alerts, empty when there are none or they are excluded
+}
+
+// Alert represents a government weather alert, such as a severe weather warning, from the One Call response.
+type Alert struct {
+	Event       string    `json:"event"`       // Name of the alert event
+	Sender      string    `json:"sender"`      // Name of the agency that issued the alert
+	Start       time.Time `json:"start"`       // Time the alert takes effect
+	End         time.Time `json:"end"`         // Time the alert expires
+	Description string    `json:"description"` // Full description of the alert
+}
+
+// MinutelyPrecipitation represents the precipitation forecast for a single minute in the One Call response.
+type MinutelyPrecipitation struct {
+	Time          time.Time `json:"time"`          // Start of the minute
+	Precipitation string    `json:"precipitation"` // Precipitation intensity in millimeters per hour
+}
+
+// DailyWeather represents the forecast summary of a single day in the One Call response.
+type DailyWeather struct {
+	Date               time.Time `json:"date"`                     // Time of the forecasted data, noon local time
+	Summary            string    `json:"summary,omitempty"`        // Human-readable description of the day
+	WeatherDescription string    `json:"weather_condition"`        // Description of the weather condition
+	TemperatureMin     string    `json:"temperature_min"`          // Minimum daily temperature in the requested units
+	TemperatureMax     string    `json:"temperature_max"`          // Maximum daily temperature in the requested units
+	WeatherType        string    `json:"weather_type"`             // Type of weather condition based on the day temperature
+	Humidity           string    `json:"humidity,omitempty"`       // Relative humidity in percentage
+	WindSpeed          string    `json:"wind_speed"`               // Wind speed in meters per second, or miles per hour for imperial units
+	CloudCoverage      string    `json:"cloud_coverage,omitempty"` // Cloud coverage in percentage
+	RainVolume         string    `json:"rain_volume,omitempty"`    // Rain volume for the day in millimeters
+	SnowVolume         string    `json:"snow_volume,omitempty"`    // Snow volume for the day in millimeters
+	Sunrise            time.Time `json:"sunrise"`                  // Time of sunrise
+	Sunset             time.Time `json:"sunset"`                   // Time of sunset
+}
+
+// oneCallSections lists the sections of the One Call API response that can be excluded.
+var oneCallSections = []string{"current", "minutely", "hourly", "daily", "alerts"}
+
+// oneCallWeather mirrors the weather condition entries of the One Call API response.
+type oneCallWeather struct {
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+}
+
+// oneCallConditions mirrors the weather conditions at one moment, as found in the current and hourly sections of the
+// One Call response and in the data of the time machine response. Hourly entries carry no sunrise and sunset.
+type oneCallConditions struct {
+	Dt         int64              `json:"dt"`
+	Sunrise    int64              `json:"sunrise"`
+	Sunset     int64              `json:"sunset"`
+	Temp       *float64           `json:"temp"`
+	Humidity   *float64           `json:"humidity"`
+	Clouds     *float64           `json:"clouds"`
+	Visibility *float64           `json:"visibility"`
+	WindSpeed  *float64           `json:"wind_speed"`
+	WindDeg    *float64           `json:"wind_deg"`
+	UVI        *float64           `json:"uvi"`
+	Weather    []oneCallWeather   `json:"weather"`
+	Rain       map[string]float64 `json:"rain"`
+	Snow       map[string]float64 `json:"snow"`
+}
+
+// oneCallResponse mirrors the subset of the One Call 3.0 API response used by the /onecall endpoint.
+// Reference https://openweathermap.org/api/one-call-3
+type oneCallResponse struct {
+	Timezone string             `json:"timezone"`
+	Current  *oneCallConditions `json:"current"`
+	Minutely []struct {
+		Dt            int64   `json:"dt"`
+		Precipitation float64 `json:"precipitation"`
+	} `json:"minutely"`
+	Hourly []oneCallConditions `json:"hourly"`
+	Daily  []struct {
+		Dt      int64  `json:"dt"`
+		Sunrise int64  `json:"sunrise"`
+		Sunset  int64  `json:"sunset"`
+		Summary string `json:"summary"`
+		Temp    struct {
+			Day float64 `json:"day"`
+			Min float64 `json:"min"`
+			Max float64 `json:"max"`
+		} `json:"temp"`
+		Humidity  *float64         `json:"humidity"`
+		WindSpeed float64          `json:"wind_speed"`
+		Clouds    *float64         `json:"clouds"`
+		Weather   []oneCallWeather `json:"weather"`
+		Rain      float64          `json:"rain"`
+		Snow      float64          `json:"snow"`
+	} `json:"daily"`
+	Alerts []struct {
+		SenderName  string `json:"sender_name"`
+		Event       string `json:"event"`
+		Start       int64  `json:"start"`
+		End         int64  `json:"end"`
+		Description string `json:"description"`
+	} `json:"alerts"`
+}
+
+// OneCallHandler is an HTTP handler function that serves current conditions, forecasts and alerts for a location
+// using the OpenWeatherMap One Call 3.0 API.
+// It accepts the same lat, lon and lang query parameters and X-API-Key header as WeatherHandler, plus an optional
+// exclude parameter listing comma-separated sections (current, minutely, hourly, daily, alerts) to leave out.
+// Every section is returned by default; the exclusions are passed on upstream so they also shrink the upstream payload.
+// Invalid parameters result in a Bad Request status code (400); upstream failures are reported like in WeatherHandler.
+// As in WeatherHandler, HEAD requests are fetched like GET requests but answered with the headers only.
+func OneCallHandler(w http.ResponseWriter, r *http.Request) {
+	// Reject methods other than GET and HEAD, advertising the supported ones in the Allow header
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Validate every parameter, reporting all problems in a single response
+	query := r.URL.Query()
+	cfg := currentConfig()
+	v := &validator{}
+	lat, lon := parseLatLon(v, query, cfg)
+	opts := parseFetchOptions(v, r, cfg)
+	exclude, err := parseExclude(query.Get("exclude"))
+	if err != nil {
+		v.invalid("exclude", err.Error())
+	}
+	if !v.valid() {
+		v.write(w)
+		return
+	}
+
+	// Create a context with the configured timeout of the endpoint
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout(EndpointOneCall))
+	defer cancel()
+
+	oneCallData, err := getOneCall(ctx, lat, lon, exclude, opts)
+	if err != nil {
+		writeFetchError(w, err)
+		return
+	}
+	localizeOneCallData(oneCallData, opts.lang)
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	json.NewEncoder(w).Encode(oneCallData)
+}
+
+// parseExclude is a helper function that validates a comma-separated list of One Call sections to exclude.
+// Empty entries are ignored, duplicates are removed, and an unknown section name results in an error.
+func parseExclude(exclude string) ([]string, error) {
+	var sections []string
+	for _, section := range strings.Split(exclude, ",") {
+		section = strings.ToLower(strings.TrimSpace(section))
+		if section == "" || containsString(sections, section) {
+			continue
+		}
+		if !containsString(oneCallSections, section) {
+			return nil, fmt.Errorf("Invalid exclude section %q, supported sections are %s", section, strings.Join(oneCallSections, ", "))
+		}
+		sections = append(sections, section)
+	}
+	return sections, nil
+}
+
+// containsString is a helper function that reports whether values contains value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getOneCall is a function that retrieves current conditions, forecasts and alerts from the One Call 3.0 API.
+// The sections in exclude are passed on to the upstream, which leaves them out of its response.
+// Conditions without a temperature make the whole response a bad upstream response, see toWeatherData.
+func getOneCall(ctx context.Context, lat, lon float64, exclude []string, opts fetchOptions) (*OneCallData, error) {
+	// Construct the API URL reference https://openweathermap.org/api/one-call-3 - How to make an API call section
+	url := fmt.Sprintf(openWeatherMapBaseURL+"/data/3.0/onecall?lat=%s&lon=%s&appid=%s&units=%s&lang=%s",
+		formatUpstreamCoordinate(lat), formatUpstreamCoordinate(lon), neturl.QueryEscape(opts.apiKey), opts.units, opts.lang)
+	if len(exclude) > 0 {
+		url += "&exclude=" + strings.Join(exclude, ",")
+	}
+
+	var data oneCallResponse
+	if err := fetchOpenWeatherMapJSON(ctx, "openweathermap", url, &data); err != nil {
+		return nil, err
+	}
+	return data.toOneCallData(opts.units)
+}
+
+// toOneCallData converts the decoded One Call response into the OneCallData returned to clients,
+// formatting every field the same way as the current weather endpoint. It fails like toWeatherData when the current
+// conditions or an hourly entry lack a temperature.
+func (data *oneCallResponse) toOneCallData(units string) (*OneCallData, error) {
+	oneCallData := &OneCallData{Timezone: data.Timezone, Alerts: []Alert{}}
+
+	if data.Current != nil {
+		current, err := data.Current.toWeatherData(data.Timezone, units)
+		if err != nil {
+			return nil, err
+		}
+		oneCallData.Current = current
+	}
+
+	for _, minute := range data.Minutely {
+		oneCallData.Minutely = append(oneCallData.Minutely, MinutelyPrecipitation{
+			Time:          time.Unix(minute.Dt, 0),
+			Precipitation: fmt.Sprintf("%s mm/h", formatNumber(minute.Precipitation)),
+		})
+	}
+
+	for i := range data.Hourly {
+		hourly, err := data.Hourly[i].toWeatherData(data.Timezone, units)
+		if err != nil {
+			return nil, err
+		}
+		oneCallData.Hourly = append(oneCallData.Hourly, hourly)
+	}
+
+	// Days are classified like current conditions, from the description and the daytime temperature
+	for _, day := range data.Daily {
+		daily := DailyWeather{
+			Date:               time.Unix(day.Dt, 0),
+			Summary:            day.Summary,
+			WeatherDescription: oneCallDescription(day.Weather),
+			TemperatureMin:     formatTemperature(day.Temp.Min, units),
+			TemperatureMax:     formatTemperature(day.Temp.Max, units),
+			WeatherType:        currentClassifier().Classify(WeatherData{WeatherDescription: oneCallDescription(day.Weather), temperature: day.Temp.Day, units: units}),
+			WindSpeed:          formatWindSpeed(day.WindSpeed, units),
+			Sunrise:            time.Unix(day.Sunrise, 0),
+			Sunset:             time.Unix(day.Sunset, 0),
+		}
+		// Readings the day leaves out are left empty rather than reported as zero
+		if day.Humidity != nil {
+			daily.Humidity = fmt.Sprintf("%v percentage", *day.Humidity)
+		}
+		if day.Clouds != nil {
+			daily.CloudCoverage = fmt.Sprintf("%v percentage", int(*day.Clouds))
+		}
+		if day.Rain > 0 {
+			daily.RainVolume = fmt.Sprintf("%s mm", formatNumber(day.Rain))
+		}
+		if day.Snow > 0 {
+			daily.SnowVolume = fmt.Sprintf("%s mm", formatNumber(day.Snow))
+		}
+		oneCallData.Daily = append(oneCallData.Daily, daily)
+	}
+
+	for _, alert := range data.Alerts {
+		oneCallData.Alerts = append(oneCallData.Alerts, Alert{
+			Event:       alert.Event,
+			Sender:      alert.SenderName,
+			Start:       time.Unix(alert.Start, 0),
+			End:         time.Unix(alert.End, 0),
+			Description: alert.Description,
+		})
+	}
+	return oneCallData, nil
+}
+
+// toWeatherData converts the decoded conditions into the WeatherData returned to clients,
+// formatting every field the same way as the current weather endpoint. Missing sunrise and sunset times are left zero,
+// and a missing visibility, cloud coverage, wind or humidity is left empty, along with the dew point derived from the
+// humidity.
+// As for the current weather endpoint, the temperature is mandatory: conditions without it are treated as a bad
+// upstream response rather than reported as 0 degrees.
+func (c *oneCallConditions) toWeatherData(timezone, units string) (*WeatherData, error) {
+	if c.Temp == nil {
+		log.Printf("Incomplete response from OpenWeatherMap One Call: no numeric 'temp' in conditions")
+		return nil, fmt.Errorf("openweathermap: %w: missing temperature", ErrInvalidResponse)
+	}
+	temp := *c.Temp
+	temperatureCelsius := toCelsius(temp, units)
+	var sunrise, sunset time.Time
+	if c.Sunrise != 0 && c.Sunset != 0 {
+		sunrise, sunset = time.Unix(c.Sunrise, 0), time.Unix(c.Sunset, 0)
+	}
+	var observed time.Time
+	if c.Dt != 0 {
+		observed = time.Unix(c.Dt, 0)
+	}
+	weatherData := &WeatherData{
+		WeatherDescription: oneCallDescription(c.Weather),
+		Temperature:        formatTemperature(temp, units),
+		Visibility:         formatOptionalVisibility(c.Visibility, units),
+		Sunrise:            sunrise,
+		Sunset:             sunset,
+		DataTimestamp:      observed,
+		PartOfDay:          oneCallPartOfDay(c.Weather, observed, sunrise, sunset),
+		Timezone:           timezone,
+		temperature:        temp,
+		units:              units,
+	}
+	weatherData.Extreme, weatherData.ExtremeReason = classifyExtreme(temperatureCelsius, units, currentConfig())
+
+	// Wind readings are left empty when the conditions carry none, rather than passing them off as calm
+	var windSpeed float64
+	if c.WindSpeed != nil {
+		windSpeed = *c.WindSpeed
+		weatherData.WindSpeed = formatWindSpeed(windSpeed, units)
+	}
+	if c.WindDeg != nil {
+		weatherData.WindDirection = fmt.Sprintf("%v degrees", int(*c.WindDeg))
+		weatherData.WindDirectionLabel = compassLabel(*c.WindDeg)
+	}
+	if c.Clouds != nil {
+		weatherData.CloudCoverage = fmt.Sprintf("%v percentage", int(*c.Clouds))
+	}
+	// The One Call API reports no place names, so the summary leaves out the location
+	weatherData.Summary = weatherSummary(weatherData.WeatherDescription, temp, units, windSpeed, c.WindSpeed != nil, "")
+
+	// Humidity and dew point are only reported when the API provides a humidity reading
+	var humidity float64
+	if c.Humidity != nil {
+		humidity = *c.Humidity
+		weatherData.Humidity = fmt.Sprintf("%v percentage", humidity)
+		weatherData.DewPoint = formatDewPoint(temperatureCelsius, humidity, units)
+	}
+	weatherData.comfort = comfortLevel(temperatureCelsius, humidity, c.Humidity != nil, toMetersPerSecond(windSpeed, units), c.WindSpeed != nil)
+	if c.UVI != nil {
+		weatherData.UVIndex = formatNumber(*c.UVI)
+		weatherData.UVRisk = uvRisk(*c.UVI)
+	}
+	if rain, ok := c.Rain["1h"]; ok {
+		weatherData.RainVolume = fmt.Sprintf("%s mm", formatNumber(rain))
+	}
+	if snow, ok := c.Snow["1h"]; ok {
+		weatherData.SnowVolume = fmt.Sprintf("%s mm", formatNumber(snow))
+	}
+	weatherData.WeatherType = currentClassifier().Classify(*weatherData)
+	return weatherData, nil
+}
+
+// oneCallDescription is a helper function that returns the description of the first weather condition, if any.
+func oneCallDescription(conditions []oneCallWeather) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return conditions[0].Description
+}
+
+// oneCallPartOfDay is a helper function that determines the part of the day from the icon of the first weather
+// condition, falling back to comparing the observation time against sunrise and sunset.
+func oneCallPartOfDay(conditions []oneCallWeather, observed, sunrise, sunset time.Time) string {
+	if len(conditions) > 0 {
+		if part := partOfDayFromIcon(conditions[0].Icon); part != "" {
+			return part
+		}
+	}
+	return partOfDayFromSun(observed, sunrise, sunset)
+}
+
+// uvRisk is a helper function that maps a UV index onto the WHO risk categories:
+// low below 3, moderate below 6, high below 8, very high below 11 and extreme from 11 up.
+// The index is rounded to a whole number first, as the categories are defined for integer values.
+func uvRisk(index float64) string {
+	switch index = math.Round(index); {
+	case index < 3:
+		return "low"
+	case index < 6:
+		return "moderate"
+	case index < 8:
+		return "high"
+	case index < 11:
+		return "very high"
+	}
+	return "extreme"
+}
@@ -0,0 +1,366 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExclude(t *testing.T) {
+	tests := []struct {
+		exclude string
+		want    []string
+		wantErr bool
+	}{
+		{exclude: ""},
+		{exclude: "minutely", want: []string{"minutely"}},
+		{exclude: " Hourly, daily ,,hourly", want: []string{"hourly", "daily"}},
+		{exclude: "current,minutely,hourly,daily,alerts", want: oneCallSections},
+		{exclude: "weekly", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseExclude(tt.exclude)
+		if (err != nil) != tt.wantErr || strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("parseExclude(%q) = %q, %v; want %q, error %v", tt.exclude, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestOneCallHandler(t *testing.T) {
+	// The sample extended by one hour and one day of forecasts
+	forecasts := `"hourly":[{"dt":1717246800,"temp":19.1,"humidity":60,"clouds":40,"visibility":10000,"wind_speed":3.6,"wind_deg":240,` +
+		`"weather":[{"description":"scattered clouds","icon":"03d"}]}],` +
+		`"daily":[{"dt":1717239600,"sunrise":1717213671,"sunset":1717272614,"summary":"Expect a day of partly cloudy with clear spells",` +
+		`"temp":{"day":19.2,"min":11.5,"max":21.3},"humidity":58,"wind_speed":4.4,"clouds":60,"weather":[{"description":"broken clouds"}],"rain":0.4}],`
+	body := strings.Replace(sampleOneCall, `"current":`, forecasts+`"current":`, 1)
+
+	tests := []struct {
+		name        string
+		target      string
+		wantStatus  int
+		wantExclude string
+		check       func(t *testing.T, data *OneCallData)
+	}{
+		{
+			name:       "every section",
+			target:     "/onecall?lat=51.51&lon=-0.13",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, data *OneCallData) {
+				if data.Timezone != "Europe/London" || data.Current == nil || data.Current.Temperature != "18.4 Celsius" {
+					t.Errorf("timezone %q, current %+v; want Europe/London at 18.4 Celsius", data.Timezone, data.Current)
+				}
+				if len(data.Hourly) != 1 || data.Hourly[0].Temperature != "19.1 Celsius" || data.Hourly[0].WeatherDescription != "scattered clouds" {
+					t.Errorf("hourly = %+v, want one hour at 19.1 Celsius with scattered clouds", data.Hourly)
+				}
+				if len(data.Daily) != 1 || data.Daily[0].TemperatureMin != "11.5 Celsius" || data.Daily[0].TemperatureMax != "21.3 Celsius" ||
+					data.Daily[0].RainVolume != "0.4 mm" || data.Daily[0].WeatherType != "moderate" {
+					t.Errorf("daily = %+v, want one moderate day from 11.5 to 21.3 Celsius with 0.4 mm of rain", data.Daily)
+				}
+				if data.Alerts == nil || len(data.Alerts) != 0 {
+					t.Errorf("alerts = %v, want an empty list", data.Alerts)
+				}
+			},
+		},
+		{
+			name:        "excluded sections are passed on",
+			target:      "/onecall?lat=51.51&lon=-0.13&exclude=minutely,hourly",
+			wantStatus:  http.StatusOK,
+			wantExclude: "minutely,hourly",
+		},
+		{
+			name:       "unknown section",
+			target:     "/onecall?lat=51.51&lon=-0.13&exclude=weekly",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing coordinates",
+			target:     "/onecall",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{oneCallPath: respond(http.StatusOK, body)})
+
+			recorder := serve(OneCallHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if calls := upstream.calls(oneCallPath); len(calls) != 1 || calls[0].Query().Get("exclude") != tt.wantExclude {
+				t.Errorf("upstream calls = %v, want one with exclude=%q", calls, tt.wantExclude)
+			}
+			if tt.check != nil {
+				var data OneCallData
+				if err := json.Unmarshal(recorder.Body.Bytes(), &data); err != nil {
+					t.Fatal(err)
+				}
+				tt.check(t, &data)
+			}
+		})
+	}
+}
+
+func TestOneCallHandlerOptionalReadings(t *testing.T) {
+	tests := []struct {
+		name                           string
+		readings                       string // Humidity and clouds of the current conditions and the day
+		wantHumidity, wantClouds       string
+		wantDayHumidity, wantDayClouds string
+	}{
+		{
+			name:            "present",
+			readings:        `"humidity":64,"clouds":75`,
+			wantHumidity:    "64 percentage",
+			wantClouds:      "75 percentage",
+			wantDayHumidity: "64 percentage",
+			wantDayClouds:   "75 percentage",
+		},
+		{
+			name:            "clear and bone dry",
+			readings:        `"humidity":0,"clouds":0`,
+			wantHumidity:    "0 percentage",
+			wantClouds:      "0 percentage",
+			wantDayHumidity: "0 percentage",
+			wantDayClouds:   "0 percentage",
+		},
+		{name: "missing", readings: `"uvi":4.2`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			body := `{"lat":51.51,"lon":-0.13,"timezone":"Europe/London",` +
+				`"current":{"dt":1717243200,"temp":18.4,` + tt.readings + `,"weather":[{"description":"broken clouds"}]},` +
+				`"daily":[{"dt":1717239600,"temp":{"day":19.2,"min":11.5,"max":21.3},` + tt.readings + `,"weather":[{"description":"broken clouds"}]}]}`
+			newUpstream(t, map[string]http.HandlerFunc{oneCallPath: respond(http.StatusOK, body)})
+
+			recorder := serve(OneCallHandler, http.MethodGet, "/onecall?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var data OneCallData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &data); err != nil {
+				t.Fatal(err)
+			}
+			if data.Current == nil || len(data.Daily) != 1 {
+				t.Fatalf("response %s, want the current conditions and one day", recorder.Body)
+			}
+			if data.Current.Humidity != tt.wantHumidity || data.Current.CloudCoverage != tt.wantClouds {
+				t.Errorf("current humidity %q, clouds %q; want %q, %q", data.Current.Humidity, data.Current.CloudCoverage, tt.wantHumidity, tt.wantClouds)
+			}
+			if day := data.Daily[0]; day.Humidity != tt.wantDayHumidity || day.CloudCoverage != tt.wantDayClouds {
+				t.Errorf("daily humidity %q, clouds %q; want %q, %q", day.Humidity, day.CloudCoverage, tt.wantDayHumidity, tt.wantDayClouds)
+			}
+			if tt.wantDayHumidity == "" && strings.Contains(recorder.Body.String(), `"humidity"`) {
+				t.Errorf("body %s reports a missing humidity", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestUVRisk(t *testing.T) {
+	tests := []struct {
+		index float64
+		want  string
+	}{
+		{index: 0, want: "low"},
+		{index: 2.49, want: "low"},
+		{index: 2.5, want: "moderate"},
+		{index: 5.4, want: "moderate"},
+		{index: 5.5, want: "high"},
+		{index: 7.4, want: "high"},
+		{index: 7.5, want: "very high"},
+		{index: 10.4, want: "very high"},
+		{index: 10.5, want: "extreme"},
+		{index: 14, want: "extreme"},
+	}
+	for _, tt := range tests {
+		if got := uvRisk(tt.index); got != tt.want {
+			t.Errorf("uvRisk(%v) = %q, want %q", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestWeatherHandlerUVIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   string
+		path      string
+		body      string
+		wantIndex string
+		wantRisk  string
+	}{
+		{name: "one call", version: OWMAPIVersion30, path: oneCallPath, body: sampleOneCall, wantIndex: "4.2", wantRisk: "moderate"},
+		{name: "one call at night", version: OWMAPIVersion30, path: oneCallPath, body: strings.Replace(sampleOneCall, `"uvi":4.2`, `"uvi":0`, 1), wantIndex: "0.0", wantRisk: "low"},
+		{name: "one call without index", version: OWMAPIVersion30, path: oneCallPath, body: strings.Replace(sampleOneCall, `"uvi":4.2,`, "", 1)},
+		{name: "current weather", version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.UVIndex != tt.wantIndex || got.UVRisk != tt.wantRisk {
+				t.Errorf("UV index %q, risk %q; want %q, %q", got.UVIndex, got.UVRisk, tt.wantIndex, tt.wantRisk)
+			}
+		})
+	}
+}
+
+func TestOneCallHandlerAlerts(t *testing.T) {
+	// Reference https://openweathermap.org/api/one-call-3 - alerts section
+	const alerts = `"alerts":[{"sender_name":"Met Office","event":"Yellow thunderstorm warning","start":1717261200,"end":1717297200,` +
+		`"description":"Thunderstorms may bring localised flooding.","tags":["Thunderstorm"]}],`
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		want   []Alert
+	}{
+		{
+			name:   "one alert",
+			target: "/onecall?lat=51.51&lon=-0.13",
+			body:   strings.Replace(sampleOneCall, `"current":`, alerts+`"current":`, 1),
+			want: []Alert{{
+				Event:       "Yellow thunderstorm warning",
+				Sender:      "Met Office",
+				Start:       time.Unix(1717261200, 0),
+				End:         time.Unix(1717297200, 0),
+				Description: "Thunderstorms may bring localised flooding.",
+			}},
+		},
+		{name: "no alerts", target: "/onecall?lat=51.51&lon=-0.13", body: sampleOneCall, want: []Alert{}},
+		{name: "empty alerts", target: "/onecall?lat=51.51&lon=-0.13", body: strings.Replace(sampleOneCall, `"current":`, `"alerts":[],"current":`, 1), want: []Alert{}},
+		{name: "alerts excluded", target: "/onecall?lat=51.51&lon=-0.13&exclude=alerts", body: sampleOneCall, want: []Alert{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{oneCallPath: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(OneCallHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			// No alerts are an empty list rather than null, so clients can iterate without checking
+			if len(tt.want) == 0 && !strings.Contains(recorder.Body.String(), `"alerts":[]`) {
+				t.Errorf("body %s does not contain an empty alerts list", recorder.Body)
+			}
+			var data OneCallData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &data); err != nil {
+				t.Fatal(err)
+			}
+			if len(data.Alerts) != len(tt.want) {
+				t.Fatalf("alerts = %+v, want %+v", data.Alerts, tt.want)
+			}
+			for i, alert := range data.Alerts {
+				want := tt.want[i]
+				if alert.Event != want.Event || alert.Sender != want.Sender || !alert.Start.Equal(want.Start) || !alert.End.Equal(want.End) ||
+					alert.Description != want.Description {
+					t.Errorf("alert %d = %+v, want %+v", i, alert, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOneCallHandlerExclude(t *testing.T) {
+	// Every section of the One Call response, served by an upstream that leaves out the excluded ones like the real API
+	sections := map[string]json.RawMessage{
+		"lat":      json.RawMessage(`51.51`),
+		"lon":      json.RawMessage(`-0.13`),
+		"timezone": json.RawMessage(`"Europe/London"`),
+		"current":  json.RawMessage(`{"dt":1717243200,"temp":18.4,"humidity":64,"weather":[{"description":"broken clouds"}]}`),
+		"minutely": json.RawMessage(`[{"dt":1717243200,"precipitation":0.2}]`),
+		"hourly":   json.RawMessage(`[{"dt":1717246800,"temp":19.1,"humidity":60}]`),
+		"daily":    json.RawMessage(`[{"dt":1717239600,"temp":{"day":19.2,"min":11.5,"max":21.3},"weather":[{"description":"broken clouds"}]}]`),
+		"alerts":   json.RawMessage(`[{"sender_name":"Met Office","event":"Yellow rain warning","start":1717261200,"end":1717297200}]`),
+	}
+	honorExclude := func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]json.RawMessage{}
+		for name, section := range sections {
+			body[name] = section
+		}
+		for _, name := range strings.Split(r.URL.Query().Get("exclude"), ",") {
+			delete(body, name)
+		}
+		w.Header().Set("Content-Type", contentTypeJSON)
+		json.NewEncoder(w).Encode(body)
+	}
+
+	tests := []struct {
+		name         string
+		exclude      string
+		wantStatus   int
+		wantExclude  string   // exclude of the upstream call
+		wantSections []string // Sections of the response with data
+	}{
+		{name: "nothing excluded", wantStatus: http.StatusOK, wantSections: []string{"current", "minutely", "hourly", "daily", "alerts"}},
+		{name: "current", exclude: "current", wantStatus: http.StatusOK, wantExclude: "current", wantSections: []string{"minutely", "hourly", "daily", "alerts"}},
+		{name: "forecasts", exclude: "minutely,hourly,daily", wantStatus: http.StatusOK, wantExclude: "minutely,hourly,daily", wantSections: []string{"current", "alerts"}},
+		{name: "alerts", exclude: "alerts", wantStatus: http.StatusOK, wantExclude: "alerts", wantSections: []string{"current", "minutely", "hourly", "daily"}},
+		{name: "normalized", exclude: "Daily,%20daily,", wantStatus: http.StatusOK, wantExclude: "daily", wantSections: []string{"current", "minutely", "hourly", "alerts"}},
+		{name: "every section", exclude: "current,minutely,hourly,daily,alerts", wantStatus: http.StatusOK, wantExclude: "current,minutely,hourly,daily,alerts"},
+		{name: "unknown section among valid ones", exclude: "hourly,forecast", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			routes := map[string]http.HandlerFunc{}
+			if tt.wantStatus == http.StatusOK {
+				routes[oneCallPath] = honorExclude
+			}
+			upstream := newUpstream(t, routes)
+
+			recorder := serve(OneCallHandler, http.MethodGet, "/onecall?lat=51.51&lon=-0.13&exclude="+tt.exclude, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if calls := upstream.calls(oneCallPath); len(calls) != 1 || calls[0].Query().Get("exclude") != tt.wantExclude {
+				t.Errorf("upstream calls = %v, want one with exclude=%q", calls, tt.wantExclude)
+			}
+			var data OneCallData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &data); err != nil {
+				t.Fatal(err)
+			}
+			present := map[string]bool{
+				"current":  data.Current != nil,
+				"minutely": len(data.Minutely) > 0,
+				"hourly":   len(data.Hourly) > 0,
+				"daily":    len(data.Daily) > 0,
+				"alerts":   len(data.Alerts) > 0,
+			}
+			var got []string
+			for _, name := range oneCallSections {
+				if present[name] {
+					got = append(got, name)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantSections, ",") {
+				t.Errorf("sections with data = %q, want %q", got, tt.wantSections)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// Versions of the OpenWeatherMap API that current weather can be fetched from, selected with Config.OWMAPIVersion.
+const (
+	OWMAPIVersion25 = "2.5" // Current weather API, the default
+	OWMAPIVersion30 = "3.0" // Current section of the One Call API 3.0, which needs a One Call subscription
+)
+
+// owmExtractor maps the body of a successful OpenWeatherMap response into WeatherData in the given unit system.
+type owmExtractor func(body []byte, units string) (*WeatherData, error)
+
+// owmAPI describes how one version of the OpenWeatherMap API is asked for the current weather and how its answer
+// is read, so that a version can be switched by configuration without touching the fetch path.
+type owmAPI struct {
+	path    string       // Path of the endpoint below openWeatherMapBaseURL
+	query   string       // Query parameters appended to every request, starting with '&'
+	extract owmExtractor // Maps the response body into WeatherData
+}
+
+// owmAPIs lists the supported OpenWeatherMap API versions by their Config.OWMAPIVersion value.
+var owmAPIs = map[string]owmAPI{
+	// Reference https://openweathermap.org/current - API call section
+	OWMAPIVersion25: {path: "/data/2.5/weather", extract: extractCurrentWeather},
+	// Reference https://openweathermap.org/api/one-call-3 - How to make an API call section
+	OWMAPIVersion30: {path: "/data/3.0/onecall", query: "&exclude=minutely,hourly,daily,alerts", extract: extractOneCallCurrent},
+}
+
+// extractOneCallCurrent is an owmExtractor for the One Call API 3.0 that maps the current section of the response
+// the same way as OneCallHandler does. A response without it, or without a temperature in it, is treated as a bad
+// upstream response.
+func extractOneCallCurrent(body []byte, units string) (*WeatherData, error) {
+	var data oneCallResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		log.Printf("Failed to decode JSON: %v", err)
+		return nil, fmt.Errorf("openweathermap: %w: %v", ErrInvalidResponse, err)
+	}
+	if data.Current == nil {
+		log.Printf("Incomplete response from OpenWeatherMap One Call: no 'current' object")
+		return nil, fmt.Errorf("openweathermap: %w: missing current", ErrInvalidResponse)
+	}
+	return data.Current.toWeatherData(data.Timezone, units)
+}
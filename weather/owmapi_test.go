@@ -0,0 +1,159 @@
+package weather
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOWMExtractors(t *testing.T) {
+	tests := []struct {
+		name      string
+		extract   owmExtractor
+		body      string
+		units     string
+		want      string // Temperature label
+		wantPlace string // Location name
+		wantErr   error
+	}{
+		{name: "2.5 current weather", extract: extractCurrentWeather, body: sampleCurrentWeather, units: UnitsMetric, want: "18.4 Celsius", wantPlace: "London"},
+		{name: "2.5 in imperial units", extract: extractCurrentWeather, body: sampleCurrentWeather, units: UnitsImperial, want: "18.4 Fahrenheit", wantPlace: "London"},
+		// The One Call API reports no place names
+		{name: "3.0 current section", extract: extractOneCallCurrent, body: sampleOneCall, units: UnitsMetric, want: "18.4 Celsius"},
+		{name: "3.0 without a current section", extract: extractOneCallCurrent, body: `{"lat":51.51,"lon":-0.13,"timezone":"Europe/London"}`, units: UnitsMetric, wantErr: ErrInvalidResponse},
+		{name: "3.0 without a temperature", extract: extractOneCallCurrent, body: strings.Replace(sampleOneCall, `"temp":18.4,`, "", 1), units: UnitsMetric, wantErr: ErrInvalidResponse},
+		{name: "3.0 not JSON", extract: extractOneCallCurrent, body: `<html>`, units: UnitsMetric, wantErr: ErrInvalidResponse},
+		// Each extractor only understands the schema of its own version
+		{name: "2.5 reading a 3.0 response", extract: extractCurrentWeather, body: sampleOneCall, units: UnitsMetric, wantErr: ErrInvalidResponse},
+		{name: "3.0 reading a 2.5 response", extract: extractOneCallCurrent, body: sampleCurrentWeather, units: UnitsMetric, wantErr: ErrInvalidResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			captureLog(t)
+
+			got, err := tt.extract([]byte(tt.body), tt.units)
+
+			if !errors.Is(err, tt.wantErr) || tt.wantErr == nil && err != nil {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.Temperature != tt.want || got.LocationName != tt.wantPlace {
+				t.Errorf("temperature, location = %q, %q; want %q, %q", got.Temperature, got.LocationName, tt.want, tt.wantPlace)
+			}
+			if got.Humidity != "64 percentage" || got.WindDirection != "250 degrees" {
+				t.Errorf("humidity, wind direction = %q, %q; want both mapped", got.Humidity, got.WindDirection)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerOWMAPIVersion(t *testing.T) {
+	// The One Call sample with its own description, to tell which response the result was extracted from
+	oneCall := strings.Replace(sampleOneCall, "broken clouds", "overcast clouds", 1)
+	tests := []struct {
+		name            string
+		version         string // Left at the default when empty
+		wantPath        string
+		wantQuery       map[string]string // Query parameters of the upstream call, empty values must be absent
+		wantDescription string
+	}{
+		{
+			name:            "default",
+			wantPath:        currentWeatherPath,
+			wantQuery:       map[string]string{"lat": "51.510000", "units": "imperial", "lang": "de", "exclude": ""},
+			wantDescription: "broken clouds",
+		},
+		{
+			name:            "2.5",
+			version:         OWMAPIVersion25,
+			wantPath:        currentWeatherPath,
+			wantQuery:       map[string]string{"lat": "51.510000", "units": "imperial", "lang": "de", "exclude": ""},
+			wantDescription: "broken clouds",
+		},
+		{
+			name:            "3.0",
+			version:         OWMAPIVersion30,
+			wantPath:        oneCallPath,
+			wantQuery:       map[string]string{"lat": "51.510000", "units": "imperial", "lang": "de", "exclude": "minutely,hourly,daily,alerts"},
+			wantDescription: "overcast clouds",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if tt.version != "" {
+				configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			}
+			upstream := newUpstream(t, map[string]http.HandlerFunc{
+				currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather),
+				oneCallPath:        respond(http.StatusOK, oneCall),
+			})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13&units=imperial&lang=de", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.WeatherDescription != tt.wantDescription || got.Temperature != "18.4 Fahrenheit" {
+				t.Errorf("description, temperature = %q, %q; want %q, 18.4 Fahrenheit", got.WeatherDescription, got.Temperature, tt.wantDescription)
+			}
+			for _, path := range []string{currentWeatherPath, oneCallPath} {
+				calls := upstream.calls(path)
+				if path != tt.wantPath {
+					if len(calls) != 0 {
+						t.Errorf("calls to %s = %v, want none", path, calls)
+					}
+					continue
+				}
+				if len(calls) != 1 {
+					t.Fatalf("calls to %s = %v, want one", path, calls)
+				}
+				for name, want := range tt.wantQuery {
+					if value := calls[0].Query().Get(name); value != want {
+						t.Errorf("query parameter %s = %q, want %q", name, value, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRawHandlerOWMAPIVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		path    string
+		body    string
+	}{
+		{version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather},
+		{version: OWMAPIVersion30, path: oneCallPath, body: sampleOneCall},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(RawHandler, http.MethodGet, "/raw?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got RawWeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if string(got.Upstream) != tt.body {
+				t.Errorf("upstream = %s, want the response of the %s API unmodified", got.Upstream, tt.version)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxPlaces is the largest number of candidates the geocoding API returns for one query.
+const maxPlaces = 5
+
+// GeocodeHandler is an HTTP handler function that lists the places matching a city parameter such as "Springfield",
+// so that clients can disambiguate before fetching the weather of the chosen coordinates.
+// An optional limit parameter caps the number of candidates (maxPlaces by default and at most). The API key can be
+// passed in the X-API-Key header as for WeatherHandler.
+// The response is a JSON array of places with their names, countries and coordinates, best match first; a city that
+// matches nothing results in an empty array rather than an error.
+func GeocodeHandler(w http.ResponseWriter, r *http.Request) {
+	// Reject methods other than GET and HEAD, advertising the supported ones in the Allow header
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Validate every parameter, reporting all problems in a single response
+	query := r.URL.Query()
+	cfg := currentConfig()
+	v := &validator{}
+	opts := parseFetchOptions(v, r, cfg)
+	city := strings.TrimSpace(query.Get("city"))
+	if city == "" {
+		v.missing("city", "Missing city")
+	}
+	limit := maxPlaces
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		switch {
+		case err != nil:
+			v.invalid("limit", "Invalid limit, it must be a whole number")
+		case limit < 1 || limit > maxPlaces:
+			v.outOfRange("limit", fmt.Sprintf("Invalid limit, it must be between 1 and %d", maxPlaces))
+		}
+	}
+	if !v.valid() {
+		v.write(w)
+		return
+	}
+
+	// Create a context with the configured timeout of the endpoint
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout(EndpointGeocode))
+	defer cancel()
+
+	places, err := searchPlaces(withFetchOptions(ctx, opts), currentGeocoder(), city, limit)
+	if err != nil {
+		writeFetchError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	json.NewEncoder(w).Encode(places)
+}
+
+// searchPlaces is a helper function that lists up to limit places matching the query with the given geocoder.
+// Geocoders that cannot list candidates contribute their single best match. Nothing matching results in an empty,
+// non-nil list.
+func searchPlaces(ctx context.Context, geocoder Geocoder, query string, limit int) ([]Place, error) {
+	if searcher, ok := geocoder.(PlaceSearcher); ok {
+		places, err := searcher.Search(ctx, query, limit)
+		if err != nil {
+			return nil, err
+		}
+		if places == nil {
+			places = []Place{}
+		}
+		return places, nil
+	}
+
+	lat, lon, err := geocoder.Geocode(ctx, query)
+	if errors.Is(err, ErrLocationNotFound) {
+		return []Place{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []Place{{Name: query, Lat: lat, Lon: lon}}, nil
+}
@@ -0,0 +1,113 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGeocodeHandler(t *testing.T) {
+	// Reference https://openweathermap.org/api/geocoding-api - Direct geocoding section
+	const springfields = `[{"name":"Springfield","lat":39.7990175,"lon":-89.6439575,"country":"US","state":"Illinois"},` +
+		`{"name":"Springfield","lat":37.2081729,"lon":-93.2922715,"country":"US","state":"Missouri"},` +
+		`{"name":"Springfield","lat":42.1018764,"lon":-72.5886727,"country":"US","state":"Massachusetts"}]`
+	tests := []struct {
+		name       string
+		target     string
+		upstream   http.HandlerFunc // Geocoding endpoint, never called when nil
+		wantStatus int
+		wantLimit  string // limit of the upstream call
+		want       []Place
+	}{
+		{
+			name:       "several candidates",
+			target:     "/geocode?city=Springfield",
+			upstream:   respond(http.StatusOK, springfields),
+			wantStatus: http.StatusOK,
+			wantLimit:  "5",
+			want: []Place{
+				{Name: "Springfield", Country: "US", State: "Illinois", Lat: 39.7990175, Lon: -89.6439575},
+				{Name: "Springfield", Country: "US", State: "Missouri", Lat: 37.2081729, Lon: -93.2922715},
+				{Name: "Springfield", Country: "US", State: "Massachusetts", Lat: 42.1018764, Lon: -72.5886727},
+			},
+		},
+		{
+			name:       "limited",
+			target:     "/geocode?city=Springfield&limit=1",
+			upstream:   respond(http.StatusOK, `[{"name":"Springfield","lat":39.7990175,"lon":-89.6439575,"country":"US","state":"Illinois"}]`),
+			wantStatus: http.StatusOK,
+			wantLimit:  "1",
+			want:       []Place{{Name: "Springfield", Country: "US", State: "Illinois", Lat: 39.7990175, Lon: -89.6439575}},
+		},
+		{name: "nothing matches", target: "/geocode?city=Atlantis", upstream: respond(http.StatusOK, `[]`), wantStatus: http.StatusOK, wantLimit: "5", want: []Place{}},
+		{name: "upstream failure", target: "/geocode?city=Springfield", upstream: respond(http.StatusInternalServerError, `{}`), wantStatus: http.StatusBadGateway, wantLimit: "5"},
+		{name: "missing city", target: "/geocode?city=%20", wantStatus: http.StatusBadRequest},
+		{name: "invalid limit", target: "/geocode?city=Springfield&limit=few", wantStatus: http.StatusBadRequest},
+		{name: "limit out of range", target: "/geocode?city=Springfield&limit=6", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			RetryBackoff = time.Millisecond
+			routes := map[string]http.HandlerFunc{}
+			if tt.upstream != nil {
+				routes[geocodingPath] = tt.upstream
+			}
+			upstream := newUpstream(t, routes)
+
+			recorder := serve(GeocodeHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.upstream != nil {
+				if calls := upstream.calls(geocodingPath); len(calls) == 0 || calls[0].Query().Get("limit") != tt.wantLimit {
+					t.Errorf("upstream calls = %v, want limit=%s", calls, tt.wantLimit)
+				}
+			}
+			if tt.want == nil {
+				return
+			}
+			var got []Place
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("places = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchPlacesWithoutSearcher(t *testing.T) {
+	paris := Location{Lat: 48.8566, Lon: 2.3522}
+	tests := []struct {
+		name    string
+		query   string
+		err     error // Returned by the geocoder for every query
+		want    []Place
+		wantErr bool
+	}{
+		{name: "best match", query: "Paris", want: []Place{{Name: "Paris", Lat: paris.Lat, Lon: paris.Lon}}},
+		{name: "nothing matches", query: "Atlantis", want: []Place{}},
+		{name: "geocoder failure", query: "Paris", err: fmt.Errorf("stub geocoder: %w", ErrUpstreamUnavailable), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			geocoder := &stubGeocoder{places: map[string]Location{"Paris": paris}, err: tt.err}
+
+			got, err := searchPlaces(context.Background(), geocoder, tt.query, maxPlaces)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("searchPlaces() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("searchPlaces() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package weather
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunPrefetch keeps the cached weather of every favorite location warm by refreshing it from the upstream right
+// away and then every interval, so that requests for them, e.g. from a kiosk, are answered from the cache.
+// The data is fetched with the configured default units, English descriptions and the default API key, which are the
+// options of requests that specify none of them; requests with other options are cached separately and not warmed.
+// Locations are refreshed one at a time, so the prefetch never holds more than one slot of the upstream call limit.
+// It blocks until ctx is done and is meant to be run in its own goroutine.
+func RunPrefetch(ctx context.Context, interval time.Duration) {
+	runPrefetch(ctx, interval, refreshWeather)
+}
+
+// runPrefetch is a helper function that implements RunPrefetch, refreshing the favorite locations with refresh.
+func runPrefetch(ctx context.Context, interval time.Duration, refresh weatherFetcher) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		prefetchFavorites(ctx, refresh)
+
+		// Wait for the next tick or stop once the server shuts down
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prefetchFavorites is a helper function that refreshes every favorite location once with refresh, taking the options
+// and the timeout of each refresh from the active configuration. Failures are logged and do not stop the others.
+func prefetchFavorites(ctx context.Context, refresh weatherFetcher) {
+	cfg := currentConfig()
+	opts := fetchOptions{units: cfg.DefaultUnits}.withDefaults()
+	for _, name := range favoriteNames() {
+		if ctx.Err() != nil {
+			return
+		}
+		location, ok := lookupFavorite(name)
+		if !ok {
+			continue
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, cfg.timeout(EndpointWeather))
+		_, err := refresh(fetchCtx, location.Lat, location.Lon, opts)
+		cancel()
+		if err != nil {
+			log.Printf("Prefetch of favorite location %q failed: %v", name, err)
+		}
+	}
+}
+
+// refreshWeather is a helper function that fetches the weather of the given coordinates from the registered providers
+// regardless of the cache and stores it in the active cache under the same key as getWeatherWithContext, so that the
+// next request is a cache hit.
+func refreshWeather(ctx context.Context, lat, lon float64, opts fetchOptions) (*WeatherData, error) {
+	opts = opts.withDefaults()
+	key := cacheKey(lat, lon, opts)
+
+	weatherData, err := fetchFromProviders(withFetchOptions(ctx, opts), registeredProviders(), lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	weatherData.raw = nil
+	weatherData.cachedUntil = now().Add(opts.cacheTTL)
+	currentCache().Set(key, weatherData, opts.cacheTTL)
+	upstreamGuard.record(key, weatherData, opts.minFetchInterval)
+	return weatherData, nil
+}
@@ -0,0 +1,156 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunPrefetch(t *testing.T) {
+	const interval = 10 * time.Millisecond
+	tests := []struct {
+		name      string
+		favorites map[string]Location
+		failing   float64 // Latitude whose refreshes fail, none when zero
+		wantLog   string
+	}{
+		{name: "every favorite", favorites: map[string]Location{"Home": {Lat: 10, Lon: 10}, "Office": {Lat: 20, Lon: 20}}},
+		{
+			name:      "failing favorite",
+			favorites: map[string]Location{"Home": {Lat: 10, Lon: 10}, "Cabin": {Lat: 30, Lon: 30}},
+			failing:   30,
+			wantLog:   `Prefetch of favorite location "cabin" failed`,
+		},
+		{name: "no favorites"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.DefaultUnits = UnitsImperial })
+			SetFavorites(tt.favorites)
+			logs := captureLog(t)
+			// The refreshes must warm the cache entries of requests without parameters
+			requestOpts := parseFetchOptions(&validator{}, httptest.NewRequest(http.MethodGet, "/weather", nil), currentConfig())
+			var mu sync.Mutex
+			refreshes := map[float64]int{}
+			refresh := func(ctx context.Context, lat, lon float64, opts fetchOptions) (*WeatherData, error) {
+				if _, ok := ctx.Deadline(); !ok {
+					t.Errorf("refresh of %v without a deadline", lat)
+				}
+				if key, want := cacheKey(lat, lon, opts), cacheKey(lat, lon, requestOpts); key != want {
+					t.Errorf("refresh of %v caches under %q, want %q", lat, key, want)
+				}
+				mu.Lock()
+				refreshes[lat]++
+				mu.Unlock()
+				if lat == tt.failing {
+					return nil, fmt.Errorf("stub: %w", ErrUpstreamUnavailable)
+				}
+				return &WeatherData{}, nil
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				runPrefetch(ctx, interval, refresh)
+			}()
+
+			// Wait until every favorite has been refreshed right away and on two ticks
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				mu.Lock()
+				warm := true
+				for _, location := range tt.favorites {
+					warm = warm && refreshes[location.Lat] >= 3
+				}
+				mu.Unlock()
+				if warm || time.Now().After(deadline) {
+					break
+				}
+				time.Sleep(interval / 2)
+			}
+			cancel()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("prefetch did not stop after the context was canceled")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for name, location := range tt.favorites {
+				if refreshes[location.Lat] < 3 {
+					t.Errorf("%s refreshed %d times, want periodic refreshes", name, refreshes[location.Lat])
+				}
+			}
+			if len(refreshes) != len(tt.favorites) {
+				t.Errorf("refreshed %v, want only the favorites", refreshes)
+			}
+			if tt.wantLog != "" && !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("log %q does not contain %q", logs, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestPrefetchFavoritesCanceled(t *testing.T) {
+	setupTest(t)
+	SetFavorites(map[string]Location{"Home": {Lat: 10, Lon: 10}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	prefetchFavorites(ctx, func(ctx context.Context, lat, lon float64, opts fetchOptions) (*WeatherData, error) {
+		t.Errorf("refreshed %v after shutdown", lat)
+		return nil, nil
+	})
+}
+
+func TestRefreshWeather(t *testing.T) {
+	tests := []struct {
+		name          string
+		upstream      http.HandlerFunc
+		cached        bool // Whether the location is already cached before the refresh
+		wantErr       bool
+		wantTemp      string // Temperature served from the cache afterwards
+		wantUpstreams int    // Upstream calls including the request made after the refresh
+	}{
+		{name: "cold cache", upstream: respond(http.StatusOK, sampleCurrentWeather), wantTemp: "18.4 Celsius", wantUpstreams: 1},
+		{
+			name:          "warm cache refreshed",
+			upstream:      respond(http.StatusOK, strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":19.6`, 1)),
+			cached:        true,
+			wantTemp:      "19.6 Celsius",
+			wantUpstreams: 1,
+		},
+		{name: "upstream failure", upstream: respond(http.StatusInternalServerError, `{}`), wantErr: true, wantTemp: "Weather provider unavailable", wantUpstreams: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			MaxUpstreamAttempts = 1
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: tt.upstream})
+			opts := fetchOptions{units: UnitsMetric}.withDefaults()
+			if tt.cached {
+				currentCache().Set(cacheKey(51.51, -0.13, opts), &WeatherData{Temperature: "12.0 Celsius"}, time.Hour)
+			}
+
+			_, err := refreshWeather(context.Background(), 51.51, -0.13, opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("refreshWeather() error = %v, want error %v", err, tt.wantErr)
+			}
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if !strings.Contains(recorder.Body.String(), tt.wantTemp) {
+				t.Errorf("body %s, want %q", recorder.Body, tt.wantTemp)
+			}
+			if calls := len(upstream.calls(currentWeatherPath)); calls != tt.wantUpstreams {
+				t.Errorf("upstream calls = %d, want %d", calls, tt.wantUpstreams)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Base URLs of the upstream APIs.
+const (
+	openWeatherMapBaseURL = "https://api.openweathermap.org"
+	openMeteoBaseURL      = "https://api.open-meteo.com"
+)
+
+// providerShare is the share of the fetch budget a provider is given before the next provider in the chain is tried,
+// e.g. 3 seconds of the default 5 second weather timeout. It leaves a fallback provider time to answer; the last
+// provider in the chain gets whatever is left.
+const providerShare = 0.6
+
+// Provider is implemented by every weather data source.
+// Fetch retrieves the current weather for the given latitude and longitude and normalizes it into a WeatherData struct.
+type Provider interface {
+	Fetch(ctx context.Context, lat, lon float64) (*WeatherData, error)
+}
+
+// OpenWeatherMapProvider is the primary provider backed by the OpenWeatherMap current weather API.
+type OpenWeatherMapProvider struct{}
+
+// Fetch retrieves weather data from OpenWeatherMap using the getWeather function.
+// The API key and units are taken from the fetch options in ctx, falling back to their defaults.
+func (OpenWeatherMapProvider) Fetch(ctx context.Context, lat, lon float64) (*WeatherData, error) {
+	return getWeather(ctx, lat, lon, fetchOptionsFromContext(ctx))
+}
+
+// providers holds the registered providers in the order they are queried.
+// OpenWeatherMap is always the primary provider; additional providers are registered with RegisterProvider.
+var (
+	providersMu sync.RWMutex
+	providers   = []Provider{OpenWeatherMapProvider{}}
+)
+
+// RegisterProvider appends a fallback provider to the chain.
+// Providers are queried in registration order whenever the previous ones fail or time out.
+func RegisterProvider(p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers = append(providers, p)
+}
+
+// registeredProviders returns a snapshot of the currently registered providers.
+func registeredProviders() []Provider {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	return append([]Provider(nil), providers...)
+}
+
+// fetchFromProviders tries each provider in order and returns the first successful result.
+// Every provider but the last gets providerShare of the time left until the deadline of ctx, so a hanging primary does
+// not consume the whole request deadline. If all providers fail, the errors of all attempts are joined and returned.
+func fetchFromProviders(ctx context.Context, chain []Provider, lat, lon float64) (*WeatherData, error) {
+	var errs []error
+	for i, provider := range chain {
+		// Stop trying further providers once the caller has given up
+		if ctx.Err() != nil {
+			break
+		}
+
+		timeout := fetchBudget(ctx)
+		if i < len(chain)-1 {
+			timeout = time.Duration(float64(timeout) * providerShare)
+		}
+		providerCtx, cancel := context.WithTimeout(ctx, timeout)
+		weatherData, err := provider.Fetch(providerCtx, lat, lon)
+		cancel()
+		if err == nil {
+			return weatherData, nil
+		}
+		log.Printf("Provider %T failed for %s: %v", provider, formatCoordinates(lat, lon), err)
+		errs = append(errs, err)
+	}
+
+	// Report the caller's context error if no provider could be attempted
+	if len(errs) == 0 {
+		return nil, ctx.Err()
+	}
+	return nil, errors.Join(errs...)
+}
+
+// OpenMeteoProvider is a fallback provider backed by the Open-Meteo forecast API, which does not need an API key.
+type OpenMeteoProvider struct{}
+
+// openMeteoResponse mirrors the subset of the Open-Meteo forecast response used by OpenMeteoProvider.
+// Reference https://open-meteo.com/en/docs
+type openMeteoResponse struct {
+	Timezone string `json:"timezone"`
+	Current  struct {
+		Time          int64    `json:"time"`
+		IsDay         int      `json:"is_day"`
+		Temperature   *float64 `json:"temperature_2m"`
+		Humidity      *float64 `json:"relative_humidity_2m"`
+		WeatherCode   int      `json:"weather_code"`
+		CloudCover    *float64 `json:"cloud_cover"`
+		WindSpeed     *float64 `json:"wind_speed_10m"`
+		WindDirection *float64 `json:"wind_direction_10m"`
+		Visibility    *float64 `json:"visibility"`
+		Rain          *float64 `json:"rain"`
+		Snowfall      *float64 `json:"snowfall"`
+	} `json:"current"`
+	Daily struct {
+		Sunrise []int64 `json:"sunrise"`
+		Sunset  []int64 `json:"sunset"`
+	} `json:"daily"`
+}
+
+// Fetch retrieves weather data from Open-Meteo and normalizes it into the same WeatherData format produced by OpenWeatherMap.
+// Temperatures and wind speeds are always requested in Celsius and meters per second and converted into the units
+// from the fetch options in ctx.
+func (OpenMeteoProvider) Fetch(ctx context.Context, lat, lon float64) (*WeatherData, error) {
+	units := fetchOptionsFromContext(ctx).units
+
+	// Construct the API URL, requesting metric units and Unix timestamps to match the OpenWeatherMap output
+	url := fmt.Sprintf(openMeteoBaseURL+"/v1/forecast?latitude=%s&longitude=%s"+
+		"&current=is_day,temperature_2m,relative_humidity_2m,weather_code,cloud_cover,wind_speed_10m,wind_direction_10m,visibility,rain,snowfall"+
+		"&daily=sunrise,sunset&forecast_days=1&wind_speed_unit=ms&timeformat=unixtime&timezone=auto", formatUpstreamCoordinate(lat), formatUpstreamCoordinate(lon))
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Share the upstream call slots with OpenWeatherMap, since a fallback is tried during the bursts of failures
+	release, err := currentUpstreamLimiter().acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	response, err := currentUpstreamClient().Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("open-meteo: %w: %w", ErrUpstreamUnavailable, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, upstreamStatus("open-meteo", response)
+	}
+
+	body, err := readUpstreamBody("open-meteo", response.Body)
+	if err != nil {
+		return nil, err
+	}
+	var data openMeteoResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("open-meteo: %w: %v", ErrInvalidResponse, err)
+	}
+
+	// Sunrise and sunset are reported per forecast day; only today is requested.
+	// With timezone=auto the day boundaries follow the location's own timezone, whose name is reported back
+	var sunrise, sunset time.Time
+	if len(data.Daily.Sunrise) > 0 && len(data.Daily.Sunset) > 0 {
+		sunrise = time.Unix(data.Daily.Sunrise[0], 0)
+		sunset = time.Unix(data.Daily.Sunset[0], 0)
+	}
+
+	// The temperature is the core datum; defaulting it to zero would misclassify the weather as cold
+	current := data.Current
+	if current.Temperature == nil {
+		return nil, fmt.Errorf("open-meteo: %w: missing current.temperature_2m", ErrInvalidResponse)
+	}
+	temperature := *current.Temperature
+	var observed time.Time
+	if current.Time != 0 {
+		observed = time.Unix(current.Time, 0)
+	}
+	weatherData := &WeatherData{
+		WeatherDescription: describeWeatherCode(current.WeatherCode),
+		Temperature:        formatTemperature(fromCelsius(temperature, units), units),
+		Visibility:         formatOptionalVisibility(current.Visibility, units),
+		Sunrise:            sunrise,
+		Sunset:             sunset,
+		DataTimestamp:      observed,
+		PartOfDay:          partOfDayNight,
+		Timezone:           data.Timezone,
+		temperature:        fromCelsius(temperature, units),
+		units:              units,
+	}
+	weatherData.Extreme, weatherData.ExtremeReason = classifyExtreme(temperature, units, currentConfig())
+
+	// Wind readings are left empty when the station reports none, rather than passing them off as calm.
+	// Wind speeds are always requested in meters per second and converted like the temperature
+	var windSpeed float64
+	if current.WindSpeed != nil {
+		windSpeed = fromMetersPerSecond(*current.WindSpeed, units)
+		weatherData.WindSpeed = formatWindSpeed(windSpeed, units)
+	}
+	if current.WindDirection != nil {
+		weatherData.WindDirection = fmt.Sprintf("%v degrees", int(*current.WindDirection))
+		weatherData.WindDirectionLabel = compassLabel(*current.WindDirection)
+	}
+
+	// Open-Meteo reports no place names, so the summary leaves out the location
+	weatherData.Summary = weatherSummary(weatherData.WeatherDescription, fromCelsius(temperature, units), units, windSpeed, current.WindSpeed != nil, "")
+
+	// Readings the response leaves out are left empty rather than reported as zero
+	if current.CloudCover != nil {
+		weatherData.CloudCoverage = fmt.Sprintf("%v percentage", int(*current.CloudCover))
+	}
+
+	// Open-Meteo flags daylight with is_day=1
+	if current.IsDay == 1 {
+		weatherData.PartOfDay = partOfDayDay
+	}
+
+	// Humidity and dew point are only reported when the response holds a humidity reading
+	var humidity float64
+	if current.Humidity != nil {
+		humidity = *current.Humidity
+		weatherData.Humidity = fmt.Sprintf("%v percentage", humidity)
+		weatherData.DewPoint = formatDewPoint(temperature, humidity, units)
+	}
+	var windSpeedMetersPerSecond float64
+	if current.WindSpeed != nil {
+		windSpeedMetersPerSecond = *current.WindSpeed
+	}
+	weatherData.comfort = comfortLevel(temperature, humidity, current.Humidity != nil, windSpeedMetersPerSecond, current.WindSpeed != nil)
+
+	// Open-Meteo reports the preceding hour's precipitation, with snowfall in centimeters. Dry hours are reported as
+	// zero and left empty like OpenWeatherMap does, which leaves out the precipitation objects then
+	if current.Rain != nil && *current.Rain > 0 {
+		weatherData.RainVolume = fmt.Sprintf("%s mm", formatNumber(*current.Rain))
+	}
+	if current.Snowfall != nil && *current.Snowfall > 0 {
+		weatherData.SnowVolume = fmt.Sprintf("%s mm", formatNumber(*current.Snowfall*10))
+	}
+	weatherData.WeatherType = currentClassifier().Classify(*weatherData)
+	return weatherData, nil
+}
+
+// describeWeatherCode is a helper function that converts a WMO weather interpretation code into a description
+// worded like the OpenWeatherMap descriptions.
+func describeWeatherCode(code int) string {
+	switch code {
+	case 0:
+		return "clear sky"
+	case 1:
+		return "mainly clear"
+	case 2:
+		return "partly cloudy"
+	case 3:
+		return "overcast clouds"
+	case 45, 48:
+		return "fog"
+	case 51, 53, 55:
+		return "drizzle"
+	case 56, 57:
+		return "freezing drizzle"
+	case 61:
+		return "light rain"
+	case 63:
+		return "moderate rain"
+	case 65:
+		return "heavy intensity rain"
+	case 66, 67:
+		return "freezing rain"
+	case 71:
+		return "light snow"
+	case 73:
+		return "snow"
+	case 75:
+		return "heavy snow"
+	case 77:
+		return "snow grains"
+	case 80, 81, 82:
+		return "shower rain"
+	case 85, 86:
+		return "shower snow"
+	case 95:
+		return "thunderstorm"
+	case 96, 99:
+		return "thunderstorm with hail"
+	}
+	return "unknown"
+}
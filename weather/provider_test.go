@@ -0,0 +1,188 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchFromProvidersFallsBack(t *testing.T) {
+	// hang is an upstream handler that never answers, leaving the provider to time out
+	hang := func(w http.ResponseWriter, r *http.Request) { <-r.Context().Done() }
+
+	tests := []struct {
+		name           string
+		openWeatherMap http.HandlerFunc
+		openMeteo      http.HandlerFunc
+		wantStatus     int
+		wantBody       string
+	}{
+		{
+			name:           "primary answers",
+			openWeatherMap: respond(http.StatusOK, sampleCurrentWeather),
+			openMeteo:      respond(http.StatusOK, sampleOpenMeteo),
+			wantStatus:     http.StatusOK,
+			wantBody:       `"weather_condition":"broken clouds"`,
+		},
+		{
+			name:           "primary fails",
+			openWeatherMap: respond(http.StatusInternalServerError, `{"cod":500}`),
+			openMeteo:      respond(http.StatusOK, sampleOpenMeteo),
+			wantStatus:     http.StatusOK,
+			wantBody:       `"weather_condition":"overcast clouds"`,
+		},
+		{
+			name:           "primary hangs",
+			openWeatherMap: hang,
+			openMeteo:      respond(http.StatusOK, sampleOpenMeteo),
+			wantStatus:     http.StatusOK,
+			wantBody:       `"weather_condition":"overcast clouds"`,
+		},
+		{
+			name:           "all providers fail",
+			openWeatherMap: respond(http.StatusServiceUnavailable, `{"cod":503}`),
+			openMeteo:      respond(http.StatusInternalServerError, `{"error":true}`),
+			wantStatus:     http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			MaxUpstreamAttempts = 1
+			RegisterProvider(OpenMeteoProvider{})
+			configure(t, func(cfg *Config) { cfg.Timeouts[EndpointWeather] = 500 * time.Millisecond })
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: tt.openWeatherMap, openMeteoPath: tt.openMeteo})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("body %s does not contain %s", recorder.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestOpenMeteoProviderFetch(t *testing.T) {
+	tests := []struct {
+		name    string
+		units   string
+		body    string
+		want    WeatherData
+		wantErr error
+	}{
+		{
+			name:  "metric",
+			units: UnitsMetric,
+			body:  sampleOpenMeteo,
+			want:  WeatherData{Temperature: "18.4 Celsius", WindSpeed: "4.1 m/s", Visibility: "10.0 KM", Humidity: "64 percentage", CloudCoverage: "75 percentage", PartOfDay: partOfDayDay},
+		},
+		{
+			name:  "imperial",
+			units: UnitsImperial,
+			body:  sampleOpenMeteo,
+			want:  WeatherData{Temperature: "65.1 Fahrenheit", WindSpeed: "9.2 mph", Visibility: "6.2 MI", Humidity: "64 percentage", CloudCoverage: "75 percentage", PartOfDay: partOfDayDay},
+		},
+		{
+			name:  "missing visibility",
+			units: UnitsMetric,
+			body:  strings.Replace(sampleOpenMeteo, `"visibility":10000,`, "", 1),
+			want:  WeatherData{Temperature: "18.4 Celsius", WindSpeed: "4.1 m/s", Humidity: "64 percentage", CloudCoverage: "75 percentage", PartOfDay: partOfDayDay},
+		},
+		{
+			name:  "missing humidity",
+			units: UnitsMetric,
+			body:  strings.Replace(sampleOpenMeteo, `"relative_humidity_2m":64,`, "", 1),
+			want:  WeatherData{Temperature: "18.4 Celsius", WindSpeed: "4.1 m/s", Visibility: "10.0 KM", CloudCoverage: "75 percentage", PartOfDay: partOfDayDay},
+		},
+		{
+			name:  "missing wind and humidity",
+			units: UnitsMetric,
+			body:  strings.NewReplacer(`"wind_speed_10m":4.1,"wind_direction_10m":250,`, "", `"relative_humidity_2m":64,`, "").Replace(sampleOpenMeteo),
+			want:  WeatherData{Temperature: "18.4 Celsius", Visibility: "10.0 KM", CloudCoverage: "75 percentage", PartOfDay: partOfDayDay},
+		},
+		{
+			name:  "bone dry air",
+			units: UnitsMetric,
+			body:  strings.Replace(sampleOpenMeteo, `"relative_humidity_2m":64,`, `"relative_humidity_2m":0,`, 1),
+			want:  WeatherData{Temperature: "18.4 Celsius", WindSpeed: "4.1 m/s", Visibility: "10.0 KM", Humidity: "0 percentage", CloudCoverage: "75 percentage", PartOfDay: partOfDayDay},
+		},
+		{
+			name:  "missing cloud cover",
+			units: UnitsMetric,
+			body:  strings.Replace(sampleOpenMeteo, `"cloud_cover":75,`, "", 1),
+			want:  WeatherData{Temperature: "18.4 Celsius", WindSpeed: "4.1 m/s", Visibility: "10.0 KM", Humidity: "64 percentage", PartOfDay: partOfDayDay},
+		},
+		{
+			name:    "missing temperature",
+			units:   UnitsMetric,
+			body:    strings.Replace(sampleOpenMeteo, `"temperature_2m":18.4,`, "", 1),
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name:    "not JSON",
+			units:   UnitsMetric,
+			body:    `overcast`,
+			wantErr: ErrInvalidResponse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{openMeteoPath: respond(http.StatusOK, tt.body)})
+			ctx := withFetchOptions(context.Background(), fetchOptions{units: tt.units})
+
+			got, err := OpenMeteoProvider{}.Fetch(ctx, 51.51, -0.13)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Temperature != tt.want.Temperature || got.WindSpeed != tt.want.WindSpeed || got.Visibility != tt.want.Visibility ||
+				got.Humidity != tt.want.Humidity || got.CloudCoverage != tt.want.CloudCoverage || got.PartOfDay != tt.want.PartOfDay {
+				t.Errorf("got temperature %q, wind %q, visibility %q, humidity %q, clouds %q, part of day %q; want %q, %q, %q, %q, %q, %q",
+					got.Temperature, got.WindSpeed, got.Visibility, got.Humidity, got.CloudCoverage, got.PartOfDay,
+					tt.want.Temperature, tt.want.WindSpeed, tt.want.Visibility, tt.want.Humidity, tt.want.CloudCoverage, tt.want.PartOfDay)
+			}
+		})
+	}
+}
+
+func TestOpenMeteoProviderPrecipitation(t *testing.T) {
+	tests := []struct {
+		name               string
+		precipitation      string // Precipitation fields of the current readings
+		wantRain, wantSnow string
+	}{
+		{name: "none", precipitation: `,"rain":0,"snowfall":0`},
+		{name: "rain", precipitation: `,"rain":1.2,"snowfall":0`, wantRain: "1.2 mm"},
+		{name: "snowfall in centimeters", precipitation: `,"rain":0,"snowfall":0.7`, wantSnow: "7.0 mm"},
+		{name: "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			body := strings.Replace(sampleOpenMeteo, `,"rain":0,"snowfall":0`, tt.precipitation, 1)
+			newUpstream(t, map[string]http.HandlerFunc{openMeteoPath: respond(http.StatusOK, body)})
+
+			got, err := OpenMeteoProvider{}.Fetch(context.Background(), 51.51, -0.13)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.RainVolume != tt.wantRain || got.SnowVolume != tt.wantSnow {
+				t.Errorf("rain %q, snow %q; want %q, %q", got.RainVolume, got.SnowVolume, tt.wantRain, tt.wantSnow)
+			}
+		})
+	}
+}
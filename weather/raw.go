@@ -0,0 +1,55 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// RawWeatherData represents the response of the /weather/raw debug endpoint.
+type RawWeatherData struct {
+	Weather  *WeatherData    `json:"weather"`  // Weather data parsed from the upstream response
+	Upstream json.RawMessage `json:"upstream"` // Unmodified JSON body returned by OpenWeatherMap
+}
+
+// RawHandler is an HTTP handler function meant for troubleshooting that returns the unmodified OpenWeatherMap response
+// next to the WeatherData parsed from it. It accepts the same lat, lon, lang and units parameters and X-API-Key header
+// as WeatherHandler. The call always goes to OpenWeatherMap, bypassing the cache and the fallback providers, so the
+// output shows what the upstream answers right now. Upstream failures are reported like in WeatherHandler.
+// The endpoint is a debugging aid and should only be exposed when explicitly enabled.
+func RawHandler(w http.ResponseWriter, r *http.Request) {
+	// Reject methods other than GET and HEAD, advertising the supported ones in the Allow header
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Validate every parameter, reporting all problems in a single response
+	query := r.URL.Query()
+	cfg := currentConfig()
+	v := &validator{}
+	lat, lon := parseLatLon(v, query, cfg)
+	opts := parseFetchOptions(v, r, cfg)
+	if !v.valid() {
+		v.write(w)
+		return
+	}
+
+	// Create a context with the configured timeout of the endpoint
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout(EndpointRaw))
+	defer cancel()
+
+	weatherData, err := getWeather(ctx, lat, lon, opts)
+	if err != nil {
+		writeFetchError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	json.NewEncoder(w).Encode(RawWeatherData{Weather: weatherData, Upstream: weatherData.raw})
+}
@@ -0,0 +1,90 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRawHandler(t *testing.T) {
+	// Fields the parser ignores must still show up in the raw output
+	unparsed := strings.Replace(sampleCurrentWeather, `"cod":200`, `"base":"stations","cod":200`, 1)
+	tests := []struct {
+		name        string
+		target      string
+		upstream    http.HandlerFunc
+		wantStatus  int
+		wantRaw     string
+		wantWeather string // Temperature of the parsed weather data
+	}{
+		{
+			name:        "returns the upstream body",
+			target:      "/weather/raw?lat=51.51&lon=-0.13",
+			upstream:    respond(http.StatusOK, unparsed),
+			wantStatus:  http.StatusOK,
+			wantRaw:     unparsed,
+			wantWeather: "18.4 Celsius",
+		},
+		{
+			name:        "in the requested units",
+			target:      "/weather/raw?lat=51.51&lon=-0.13&units=imperial",
+			upstream:    respond(http.StatusOK, strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":65.1`, 1)),
+			wantStatus:  http.StatusOK,
+			wantRaw:     strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":65.1`, 1),
+			wantWeather: "65.1 Fahrenheit",
+		},
+		{
+			name:       "upstream failure",
+			target:     "/weather/raw?lat=51.51&lon=-0.13",
+			upstream:   respond(http.StatusNotFound, `{"cod":"404","message":"city not found"}`),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid parameters",
+			target:     "/weather/raw?lat=91&lon=-0.13",
+			upstream:   respond(http.StatusOK, sampleCurrentWeather),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: tt.upstream})
+
+			recorder := serve(RawHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got RawWeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if string(got.Upstream) != tt.wantRaw {
+				t.Errorf("upstream = %s, want %s", got.Upstream, tt.wantRaw)
+			}
+			if got.Weather == nil || got.Weather.Temperature != tt.wantWeather {
+				t.Errorf("weather = %+v, want temperature %s", got.Weather, tt.wantWeather)
+			}
+		})
+	}
+}
+
+func TestRawHandlerBypassesCache(t *testing.T) {
+	setupTest(t)
+	upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+	for _, handler := range []http.HandlerFunc{WeatherHandler, RawHandler, RawHandler} {
+		if recorder := serve(handler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil); recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+		}
+	}
+
+	if got := len(upstream.calls(currentWeatherPath)); got != 3 {
+		t.Errorf("upstream calls = %d, want one per request", got)
+	}
+}
@@ -0,0 +1,51 @@
+package weather
+
+import "context"
+
+// requestValuesContextKey is the context key under which the values parsed from a request are stored.
+type requestValuesContextKey struct{}
+
+// requestValues holds what a handler parsed from its request, so that middleware and downstream functions can use
+// it without parsing the query string again. It is filled in by the handler after validation, on the goroutine
+// serving the request, and read once the handler has returned or further down the same call chain.
+type requestValues struct {
+	lat, lon       float64
+	hasCoordinates bool
+	units          string
+}
+
+// withRequestValues returns a copy of ctx carrying an empty set of request values for the handler to fill in.
+func withRequestValues(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestValuesContextKey{}, &requestValues{})
+}
+
+// setRequestCoordinates records the queried coordinates in the request values of ctx, if it carries any.
+func setRequestCoordinates(ctx context.Context, lat, lon float64) {
+	if values, ok := ctx.Value(requestValuesContextKey{}).(*requestValues); ok {
+		values.lat, values.lon, values.hasCoordinates = lat, lon, true
+	}
+}
+
+// setRequestUnits records the resolved unit system in the request values of ctx, if it carries any.
+func setRequestUnits(ctx context.Context, units string) {
+	if values, ok := ctx.Value(requestValuesContextKey{}).(*requestValues); ok {
+		values.units = units
+	}
+}
+
+// requestCoordinates returns the coordinates recorded in ctx, reporting whether the handler recorded any.
+func requestCoordinates(ctx context.Context) (float64, float64, bool) {
+	values, ok := ctx.Value(requestValuesContextKey{}).(*requestValues)
+	if !ok || !values.hasCoordinates {
+		return 0, 0, false
+	}
+	return values.lat, values.lon, true
+}
+
+// requestUnits returns the unit system recorded in ctx, or an empty string when the handler recorded none.
+func requestUnits(ctx context.Context) string {
+	if values, ok := ctx.Value(requestValuesContextKey{}).(*requestValues); ok {
+		return values.units
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package weather
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestValues(t *testing.T) {
+	t.Run("without request values", func(t *testing.T) {
+		ctx := context.Background()
+		setRequestCoordinates(ctx, 51.51, -0.13)
+		setRequestUnits(ctx, UnitsImperial)
+
+		if lat, lon, ok := requestCoordinates(ctx); ok {
+			t.Errorf("requestCoordinates() = %v, %v, true; want nothing recorded", lat, lon)
+		}
+		if units := requestUnits(ctx); units != "" {
+			t.Errorf("requestUnits() = %q, want nothing recorded", units)
+		}
+	})
+	t.Run("with request values", func(t *testing.T) {
+		ctx := withRequestValues(context.Background())
+		if _, _, ok := requestCoordinates(ctx); ok {
+			t.Error("requestCoordinates() reports coordinates before any were recorded")
+		}
+
+		// Zero coordinates are a valid location, told apart from unset ones
+		setRequestCoordinates(ctx, 0, 0)
+		setRequestUnits(ctx, UnitsStandard)
+
+		if lat, lon, ok := requestCoordinates(ctx); !ok || lat != 0 || lon != 0 {
+			t.Errorf("requestCoordinates() = %v, %v, %v; want 0, 0, true", lat, lon, ok)
+		}
+		if units := requestUnits(ctx); units != UnitsStandard {
+			t.Errorf("requestUnits() = %q, want %q", units, UnitsStandard)
+		}
+	})
+}
+
+func TestWeatherHandlerRequestValues(t *testing.T) {
+	tests := []struct {
+		name            string
+		target          string
+		header          http.Header
+		wantCoordinates bool
+		wantLat         float64
+		wantLon         float64
+		wantUnits       string
+	}{
+		{name: "coordinates", target: "/weather?lat=51.51&lon=-0.13", wantCoordinates: true, wantLat: 51.51, wantLon: -0.13, wantUnits: UnitsMetric},
+		{name: "combined coordinates", target: "/weather?latlon=48.86,2.35&units=standard", wantCoordinates: true, wantLat: 48.86, wantLon: 2.35, wantUnits: UnitsStandard},
+		{name: "favorite", target: "/weather?location=Home", wantCoordinates: true, wantLat: 40.71, wantLon: -74.01, wantUnits: UnitsMetric},
+		{name: "city", target: "/weather?city=Paris", wantCoordinates: true, wantLat: 48.8566, wantLon: 2.3522, wantUnits: UnitsMetric},
+		{
+			name:            "units from the language",
+			target:          "/weather?lat=51.51&lon=-0.13",
+			header:          http.Header{"Accept-Language": {"en-US"}},
+			wantCoordinates: true, wantLat: 51.51, wantLon: -0.13, wantUnits: UnitsImperial,
+		},
+		{name: "zip code", target: "/weather?zip=94040", wantCoordinates: true, wantLat: 37.3855, wantLon: -122.088, wantUnits: UnitsMetric},
+		{name: "invalid request", target: "/weather?lat=91&lon=-0.13"},
+		{name: "unknown favorite", target: "/weather?location=Garage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetFavorites(map[string]Location{"Home": {Lat: 40.71, Lon: -74.01}})
+			SetGeocoder(&stubGeocoder{places: map[string]Location{"Paris": {Lat: 48.8566, Lon: 2.3522}}})
+			newUpstream(t, map[string]http.HandlerFunc{
+				currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather),
+				"/geo/1.0/zip":     respond(http.StatusOK, `{"zip":"94040","name":"Mountain View","lat":37.3855,"lon":-122.088,"country":"US"}`),
+			})
+			ctx := withRequestValues(context.Background())
+			request := httptest.NewRequest(http.MethodGet, tt.target, nil).WithContext(ctx)
+			for name, values := range tt.header {
+				request.Header[name] = values
+			}
+
+			WeatherHandler(httptest.NewRecorder(), request)
+
+			lat, lon, ok := requestCoordinates(ctx)
+			if ok != tt.wantCoordinates || lat != tt.wantLat || lon != tt.wantLon {
+				t.Errorf("requestCoordinates() = %v, %v, %v; want %v, %v, %v", lat, lon, ok, tt.wantLat, tt.wantLon, tt.wantCoordinates)
+			}
+			if units := requestUnits(ctx); units != tt.wantUnits {
+				t.Errorf("requestUnits() = %q, want %q", units, tt.wantUnits)
+			}
+		})
+	}
+}
+
+func TestLoggingMiddlewareRequestValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		want    string
+	}{
+		{
+			name:    "values recorded by the handler",
+			handler: WeatherHandler,
+			target:  "/weather?location=Home&units=imperial",
+			want:    `query="location=Home&units=imperial" location=40.71,-74.01 units=imperial status=200 `,
+		},
+		{name: "rounded coordinates", handler: WeatherHandler, target: "/weather?lat=51.5074&lon=-0.1278", want: ` location=51.51,-0.13 units=metric status=200 `},
+		{name: "invalid request", handler: WeatherHandler, target: "/weather?lat=north&lon=-0.13", want: `query="lat=north&lon=-0.13" status=400 `},
+		{name: "handler recording nothing", handler: IndexHandler, target: "/", want: `query="" status=200 `},
+		{
+			name: "values read within the call chain",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				setRequestCoordinates(r.Context(), 10, 20)
+				if lat, lon, ok := requestCoordinates(r.Context()); !ok || lat != 10 || lon != 20 {
+					t.Errorf("requestCoordinates() = %v, %v, %v within the handler", lat, lon, ok)
+				}
+			},
+			target: "/custom",
+			want:   ` location=10.00,20.00 status=200 `,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetFavorites(map[string]Location{"Home": {Lat: 40.71, Lon: -74.01}})
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+			logs := captureLog(t)
+
+			LoggingMiddleware(tt.handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if !strings.Contains(logs.String(), tt.want) {
+				t.Errorf("log %q does not contain %q", logs, tt.want)
+			}
+		})
+	}
+}
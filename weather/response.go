@@ -0,0 +1,210 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported response content types.
+const (
+	contentTypeJSON = "application/json"
+	contentTypeXML  = "application/xml"
+)
+
+// negotiateContentType is a helper function that picks the response content type from the request's Accept header.
+// JSON is used when the header is absent or accepts anything; XML is used when it is preferred by the client.
+// Media ranges are ranked by their quality value, with earlier entries winning ties.
+// The second return value is false when the client accepts none of the supported types.
+func negotiateContentType(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return contentTypeJSON, true
+	}
+
+	best, bestQuality := "", 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		// Split the media range from its parameters and read the optional quality value
+		parts := strings.Split(mediaRange, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(parts[0]))
+		quality := 1.0
+		for _, param := range parts[1:] {
+			name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.EqualFold(name, "q") {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		// Map the media range onto one of the supported content types
+		var contentType string
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			contentType = contentTypeJSON
+		case "application/xml", "text/xml":
+			contentType = contentTypeXML
+		default:
+			continue
+		}
+		if quality > bestQuality {
+			best, bestQuality = contentType, quality
+		}
+	}
+	return best, best != ""
+}
+
+// writeWeatherData is a helper function that encodes the weather data, or a projection of it, in the negotiated
+// content type and writes it to the response writer along with the matching Content-Type header.
+// When pretty is true the output is indented for readability; otherwise it is compact for machine clients.
+func writeWeatherData(w http.ResponseWriter, contentType string, weatherData interface{}, pretty bool) {
+	w.Header().Set("Content-Type", contentType)
+	encodeWeatherData(w, contentType, weatherData, pretty)
+}
+
+// encodeWeatherData is a helper function that encodes the weather data, or a projection of it, in the given content
+// type into w, see writeWeatherData.
+func encodeWeatherData(w io.Writer, contentType string, weatherData interface{}, pretty bool) {
+	if contentType == contentTypeXML {
+		w.Write([]byte(xml.Header))
+		encoder := xml.NewEncoder(w)
+		if pretty {
+			encoder.Indent("", "  ")
+		}
+		encoder.Encode(weatherData)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	if pretty {
+		encoder.SetIndent("", "  ")
+	}
+	encoder.Encode(weatherData)
+}
+
+// Response modes selected with the mode query parameter.
+const (
+	modeFull    = "full"    // Every field of WeatherData
+	modeCompact = "compact" // Only the essentials, see CompactWeatherData
+
+	// modeClassification is selected with classify_only=true rather than the mode parameter
+	modeClassification = "classification" // Only the weather type and the temperature, see ClassificationData
+)
+
+// CompactWeatherData is the trimmed response returned in compact mode, holding only the essential fields of WeatherData.
+type CompactWeatherData struct {
+	XMLName            xml.Name `json:"-" xml:"weather"`
+	WeatherDescription string   `json:"weather_condition" xml:"weather_condition"`                       // Description of the weather condition
+	Temperature        string   `json:"temperature" xml:"temperature"`                                   // Temperature in the requested units
+	WeatherType        string   `json:"weather_type" xml:"weather_type"`                                 // Type of weather condition (e.g., cold, moderate, hot)
+	TemperatureBucket  string   `json:"temperature_bucket,omitempty" xml:"temperature_bucket,omitempty"` // Range containing the temperature, only with bucket=N
+	TemperatureKelvin  string   `json:"temperature_kelvin,omitempty" xml:"temperature_kelvin,omitempty"` // Temperature in Kelvin, only with kelvin=true
+	TemperatureTrend   string   `json:"temperature_trend,omitempty" xml:"temperature_trend,omitempty"`   // Rising, falling or steady, only with trend=true
+	ComfortLevel       string   `json:"comfort_level,omitempty" xml:"comfort_level,omitempty"`           // How the weather feels, only with comfort=true
+}
+
+// ClassificationData is the minimal response returned with classify_only=true, e.g. for traffic-light displays that
+// only need the weather type. Unlike in the other responses, the temperature is a plain number in the requested units.
+type ClassificationData struct {
+	XMLName     xml.Name    `json:"-" xml:"weather"`
+	WeatherType string      `json:"weather_type" xml:"weather_type"` // Type of weather condition (e.g., cold, moderate, hot)
+	Temperature json.Number `json:"temperature" xml:"temperature"`   // Temperature in the requested units, rounded to Config.NumberPrecision
+}
+
+// parseMode is a helper function that validates the mode query parameter, defaulting to full mode when it is empty.
+func parseMode(mode string) (string, bool) {
+	switch mode {
+	case "", modeFull:
+		return modeFull, true
+	case modeCompact:
+		return modeCompact, true
+	}
+	return "", false
+}
+
+// projectWeatherData is a helper function that returns the representation of the weather data for the given mode.
+func projectWeatherData(weatherData *WeatherData, mode string) interface{} {
+	if mode == modeClassification {
+		return &ClassificationData{
+			WeatherType: weatherData.WeatherType,
+			Temperature: json.Number(formatNumber(weatherData.temperature)),
+		}
+	}
+	if mode == modeCompact {
+		return &CompactWeatherData{
+			WeatherDescription: weatherData.WeatherDescription,
+			Temperature:        weatherData.Temperature,
+			WeatherType:        weatherData.WeatherType,
+			TemperatureBucket:  weatherData.TemperatureBucket,
+			TemperatureKelvin:  weatherData.TemperatureKelvin,
+			TemperatureTrend:   weatherData.TemperatureTrend,
+			ComfortLevel:       weatherData.ComfortLevel,
+		}
+	}
+	return weatherData
+}
+
+// writeFetchError is a helper function that maps an error from the weather data retrieval onto an HTTP error response.
+// Timeouts are reported as 504 so clients can tell them apart from an unreachable or misbehaving upstream (502),
+// a location the upstream does not know (404) and other failures (500).
+// Hitting the upstream call limit in fail-fast mode is reported as 503, since retrying later may succeed, and so is
+// data missing from the cache in offline mode. An upstream rate limit is passed through as 429, along with the
+// upstream Retry-After header when there is one, so clients can back off.
+func writeFetchError(w http.ResponseWriter, err error) {
+	message, status := describeFetchError(err)
+	if retryAfter := upstreamRetryAfter(err); status == http.StatusTooManyRequests && retryAfter != "" {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+	http.Error(w, message, status)
+}
+
+// describeFetchError is a helper function that returns the client-facing message and HTTP status code for an error
+// from the weather data retrieval, without exposing the underlying error details.
+func describeFetchError(err error) (string, int) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "Timed out fetching weather data", http.StatusGatewayTimeout
+	case errors.Is(err, ErrOffline):
+		return "Weather data not cached and upstream disabled in offline mode", http.StatusServiceUnavailable
+	case errors.Is(err, errUpstreamLimitReached):
+		return "Too many concurrent requests to weather provider", http.StatusServiceUnavailable
+	case errors.Is(err, ErrLocationNotFound):
+		return "Location not found", http.StatusNotFound
+	case errors.Is(err, ErrUpstreamRateLimited):
+		return "Weather provider rate limit reached", http.StatusTooManyRequests
+	case errors.Is(err, ErrUpstreamUnavailable):
+		return "Weather provider unavailable", http.StatusBadGateway
+	case errors.Is(err, ErrInvalidResponse):
+		return "Bad response from weather provider", http.StatusBadGateway
+	}
+	return "Failed to fetch weather data", http.StatusInternalServerError
+}
+
+// remainingTTL is a helper function that returns how much longer the server caches the weather data, so that clients
+// holding on to a response served from an older cache entry do not keep it beyond the server's own expiry. Data whose
+// expiry is unknown, e.g. from a cache backend that does not keep it, is assumed to be fresh and cached for ttl.
+func remainingTTL(weatherData *WeatherData, ttl time.Duration) time.Duration {
+	if weatherData.cachedUntil.IsZero() {
+		return ttl
+	}
+	return min(max(weatherData.cachedUntil.Sub(now()), 0), ttl)
+}
+
+// setCacheHeaders is a helper function that lets clients and CDNs cache a successful response for ttl, matching how long
+// the server itself caches the weather data, see remainingTTL. Vary names the request headers that change the response,
+// since the content type is negotiated from Accept and the default units from Accept-Language. Private responses depend
+// on who sent the request, e.g. a geolocated client, and are only cached by the client itself and never by a CDN.
+func setCacheHeaders(w http.ResponseWriter, ttl time.Duration, private bool) {
+	cacheControl := fmt.Sprintf("max-age=%d", int(ttl.Seconds()))
+	if private {
+		cacheControl = "private, " + cacheControl
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Expires", now().Add(ttl).UTC().Format(http.TimeFormat))
+	w.Header().Set("Vary", "Accept, Accept-Language")
+}
@@ -0,0 +1,386 @@
+package weather
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+		wantOK bool
+	}{
+		{accept: "", want: contentTypeJSON, wantOK: true},
+		{accept: "*/*", want: contentTypeJSON, wantOK: true},
+		{accept: "application/json", want: contentTypeJSON, wantOK: true},
+		{accept: "application/xml", want: contentTypeXML, wantOK: true},
+		{accept: "text/xml", want: contentTypeXML, wantOK: true},
+		{accept: "Application/XML; charset=utf-8", want: contentTypeXML, wantOK: true},
+		{accept: "application/json;q=0.5, application/xml", want: contentTypeXML, wantOK: true},
+		{accept: "application/xml;q=0.9, application/json;q=0.9", want: contentTypeXML, wantOK: true},
+		{accept: "text/html, application/xml;q=0.8, */*;q=0.1", want: contentTypeXML, wantOK: true},
+		{accept: "text/html", wantOK: false},
+		{accept: "application/xml;q=0", wantOK: false},
+	}
+	for _, tt := range tests {
+		got, ok := negotiateContentType(tt.accept)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("negotiateContentType(%q) = %q, %v; want %q, %v", tt.accept, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestWeatherHandlerContentNegotiation(t *testing.T) {
+	tests := []struct {
+		accept          string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{accept: "", wantStatus: http.StatusOK, wantContentType: contentTypeJSON, wantBody: `"temperature":"18.4 Celsius"`},
+		{accept: "application/xml", wantStatus: http.StatusOK, wantContentType: contentTypeXML, wantBody: "<temperature>18.4 Celsius</temperature>"},
+		{accept: "text/html", wantStatus: http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			setupTest(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", http.Header{"Accept": {tt.accept}})
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus == http.StatusNotAcceptable {
+				if len(upstream.calls(currentWeatherPath)) != 0 {
+					t.Error("unacceptable request called the upstream")
+				}
+				return
+			}
+			if got := recorder.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("body %s does not contain %s", recorder.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerMode(t *testing.T) {
+	tests := []struct {
+		mode       string
+		wantStatus int
+		wantFields []string
+		wantNot    []string
+	}{
+		{mode: "", wantStatus: http.StatusOK, wantFields: []string{`"temperature"`, `"wind_speed"`, `"summary"`}},
+		{mode: modeFull, wantStatus: http.StatusOK, wantFields: []string{`"temperature"`, `"wind_speed"`, `"summary"`}},
+		{mode: modeCompact, wantStatus: http.StatusOK, wantFields: []string{`"weather_condition"`, `"temperature"`, `"weather_type"`}, wantNot: []string{`"wind_speed"`, `"summary"`, `"sunrise"`}},
+		{mode: "verbose", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13&mode="+tt.mode, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			body := recorder.Body.String()
+			for _, field := range tt.wantFields {
+				if !strings.Contains(body, field) {
+					t.Errorf("body %s lacks %s", body, field)
+				}
+			}
+			for _, field := range tt.wantNot {
+				if strings.Contains(body, field) {
+					t.Errorf("body %s contains %s", body, field)
+				}
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerClassifyOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		accept     string
+		precision  int
+		classifier Classifier
+		wantStatus int
+		wantBody   string // Whole body, or the error code of a Bad Request
+	}{
+		{name: "minimal", query: "&classify_only=true", wantStatus: http.StatusOK, wantBody: `{"weather_type":"moderate","temperature":18.4}`},
+		{name: "as a number flag", query: "&classify_only=1", wantStatus: http.StatusOK, wantBody: `{"weather_type":"moderate","temperature":18.4}`},
+		// The temperature is a plain number in the requested units
+		{name: "imperial units", query: "&classify_only=true&units=imperial", wantStatus: http.StatusOK, wantBody: `{"weather_type":"cold","temperature":18.4}`},
+		{name: "number precision", query: "&classify_only=true", precision: 2, wantStatus: http.StatusOK, wantBody: `{"weather_type":"moderate","temperature":18.40}`},
+		{name: "custom classifier", query: "&classify_only=true", classifier: &clothingClassifier{}, wantStatus: http.StatusOK, wantBody: `{"weather_type":"t-shirt","temperature":18.4}`},
+		{
+			name:       "xml",
+			query:      "&classify_only=true",
+			accept:     contentTypeXML,
+			wantStatus: http.StatusOK,
+			wantBody:   xml.Header + "<weather><weather_type>moderate</weather_type><temperature>18.4</temperature></weather>",
+		},
+		// Flags adding fields to the full response leave the minimal one unchanged
+		{name: "with other flags", query: "&classify_only=true&kelvin=true&comfort=true", wantStatus: http.StatusOK, wantBody: `{"weather_type":"moderate","temperature":18.4}`},
+		{name: "combined with mode", query: "&classify_only=true&mode=compact", wantStatus: http.StatusBadRequest, wantBody: "conflicting_classify_only"},
+		{name: "turned off with mode", query: "&classify_only=false&mode=compact", wantStatus: http.StatusOK},
+		{name: "invalid flag", query: "&classify_only=perhaps", wantStatus: http.StatusBadRequest, wantBody: "invalid_classify_only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			if tt.precision != 0 {
+				configure(t, func(cfg *Config) { cfg.NumberPrecision = tt.precision })
+			}
+			if tt.classifier != nil {
+				SetClassifier(tt.classifier)
+			}
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+			header := http.Header{}
+			if tt.accept != "" {
+				header.Set("Accept", tt.accept)
+			}
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13"+tt.query, header)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			switch {
+			case tt.wantStatus == http.StatusBadRequest:
+				var errs []FieldError
+				if err := json.Unmarshal(recorder.Body.Bytes(), &errs); err != nil || len(errs) != 1 || errs[0].Code != tt.wantBody {
+					t.Errorf("errors = %s, want code %s", recorder.Body, tt.wantBody)
+				}
+				if calls := upstream.calls(currentWeatherPath); len(calls) != 0 {
+					t.Errorf("upstream calls = %v, want none", calls)
+				}
+			case tt.wantBody != "":
+				if got := strings.TrimSuffix(recorder.Body.String(), "\n"); got != tt.wantBody {
+					t.Errorf("body = %s, want %s", got, tt.wantBody)
+				}
+			default:
+				if strings.Contains(recorder.Body.String(), `"temperature":18.4`) {
+					t.Errorf("body %s, want the temperature with its unit", recorder.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerClassifyOnlyDefault(t *testing.T) {
+	setupTest(t)
+	newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+	minimal := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13&classify_only=true", nil)
+
+	// The minimal response is a projection, so the full one served from the same cache entry is left intact
+	full := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(minimal.Body.Bytes(), &fields); err != nil || len(fields) != 2 {
+		t.Errorf("minimal body %s, want exactly two fields", minimal.Body)
+	}
+	var weatherData WeatherData
+	if err := json.Unmarshal(full.Body.Bytes(), &weatherData); err != nil {
+		t.Fatal(err)
+	}
+	if weatherData.Temperature != "18.4 Celsius" || weatherData.WeatherType != "moderate" || weatherData.WindSpeed == "" || weatherData.Summary == "" {
+		t.Errorf("default response = %+v, want the full weather data", weatherData)
+	}
+}
+
+func TestWeatherHandlerPretty(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		accept     string
+		wantStatus int
+		wantPrefix string
+	}{
+		{name: "compact by default", wantStatus: http.StatusOK, wantPrefix: `{"`},
+		{name: "pretty", query: "&pretty=true", wantStatus: http.StatusOK, wantPrefix: "{\n  \""},
+		{name: "pretty as a number", query: "&pretty=1", wantStatus: http.StatusOK, wantPrefix: "{\n  \""},
+		{name: "explicitly compact", query: "&pretty=false", wantStatus: http.StatusOK, wantPrefix: `{"`},
+		{name: "pretty XML", query: "&pretty=true", accept: contentTypeXML, wantStatus: http.StatusOK, wantPrefix: xml.Header + "<weather>\n  <"},
+		{name: "compact XML", accept: contentTypeXML, wantStatus: http.StatusOK, wantPrefix: xml.Header + "<weather><"},
+		{name: "invalid flag", query: "&pretty=maybe", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+			header := http.Header{}
+			if tt.accept != "" {
+				header.Set("Accept", tt.accept)
+			}
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13"+tt.query, header)
+			compact := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", header)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			body := recorder.Body.String()
+			if !strings.HasPrefix(body, tt.wantPrefix) {
+				t.Errorf("body %q does not start with %q", body, tt.wantPrefix)
+			}
+			// Indentation must not change the data itself
+			if tt.accept == "" {
+				var indented bytes.Buffer
+				if err := json.Compact(&indented, recorder.Body.Bytes()); err != nil {
+					t.Fatal(err)
+				}
+				if strings.TrimSpace(indented.String()) != strings.TrimSpace(compact.Body.String()) {
+					t.Errorf("pretty output %s differs from compact output %s", indented.String(), compact.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestDescribeFetchError(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+	}{
+		{err: fmt.Errorf("openweathermap: %w", ErrLocationNotFound), wantStatus: http.StatusNotFound},
+		{err: fmt.Errorf("openweathermap: %w", ErrUpstreamUnavailable), wantStatus: http.StatusBadGateway},
+		{err: fmt.Errorf("openweathermap: %w: %w", ErrUpstreamRateLimited, ErrUpstreamUnavailable), wantStatus: http.StatusTooManyRequests},
+		{err: fmt.Errorf("openweathermap: %w", ErrInvalidResponse), wantStatus: http.StatusBadGateway},
+		{err: ErrOffline, wantStatus: http.StatusServiceUnavailable},
+		{err: errUpstreamLimitReached, wantStatus: http.StatusServiceUnavailable},
+		{err: fmt.Errorf("openweathermap: %w", context.DeadlineExceeded), wantStatus: http.StatusGatewayTimeout},
+		{err: errors.New("something else"), wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		message, status := describeFetchError(tt.err)
+		if status != tt.wantStatus {
+			t.Errorf("describeFetchError(%v) status = %d, want %d", tt.err, status, tt.wantStatus)
+		}
+		// Client-facing messages never leak the underlying error
+		if strings.Contains(message, "openweathermap") || strings.Contains(message, "something else") {
+			t.Errorf("describeFetchError(%v) message %q exposes the error details", tt.err, message)
+		}
+	}
+}
+
+func TestWeatherHandlerCacheHeaders(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		elapsed    time.Duration // Time since the data was cached by an earlier request, none when zero
+		target     string
+		upstream   http.HandlerFunc
+		wantStatus int
+		wantMaxAge string // Cache-Control value, empty when no caching headers are expected
+	}{
+		{
+			name:       "default TTL",
+			ttl:        defaultCacheTTL,
+			target:     "/weather?lat=51.51&lon=-0.13",
+			upstream:   respond(http.StatusOK, sampleCurrentWeather),
+			wantStatus: http.StatusOK,
+			wantMaxAge: fmt.Sprintf("max-age=%d", int(defaultCacheTTL.Seconds())),
+		},
+		{
+			name:       "configured TTL",
+			ttl:        90 * time.Second,
+			target:     "/weather?lat=51.51&lon=-0.13",
+			upstream:   respond(http.StatusOK, sampleCurrentWeather),
+			wantStatus: http.StatusOK,
+			wantMaxAge: "max-age=90",
+		},
+		{
+			name:       "cached entry",
+			ttl:        10 * time.Minute,
+			elapsed:    4 * time.Minute,
+			target:     "/weather?lat=51.51&lon=-0.13",
+			upstream:   respond(http.StatusOK, sampleCurrentWeather),
+			wantStatus: http.StatusOK,
+			wantMaxAge: "max-age=360",
+		},
+		{
+			name:       "cached entry about to expire",
+			ttl:        10 * time.Minute,
+			elapsed:    10 * time.Minute,
+			target:     "/weather?lat=51.51&lon=-0.13",
+			upstream:   respond(http.StatusOK, sampleCurrentWeather),
+			wantStatus: http.StatusOK,
+			wantMaxAge: "max-age=0",
+		},
+		{
+			name:       "smoothed responses change with every poll",
+			ttl:        defaultCacheTTL,
+			target:     "/weather?lat=51.51&lon=-0.13&smooth=true",
+			upstream:   respond(http.StatusOK, sampleCurrentWeather),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "upstream error",
+			ttl:        defaultCacheTTL,
+			target:     "/weather?lat=51.51&lon=-0.13",
+			upstream:   respond(http.StatusNotFound, `{"cod":"404","message":"city not found"}`),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid parameters",
+			ttl:        defaultCacheTTL,
+			target:     "/weather?lat=north&lon=-0.13",
+			upstream:   respond(http.StatusOK, sampleCurrentWeather),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetClock(FixedClock(at))
+			configure(t, func(cfg *Config) { cfg.CacheTTL = tt.ttl })
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: tt.upstream})
+			if tt.elapsed > 0 {
+				serve(WeatherHandler, http.MethodGet, tt.target, nil)
+				SetClock(FixedClock(at.Add(tt.elapsed)))
+			}
+
+			recorder := serve(WeatherHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if calls := len(upstream.calls(currentWeatherPath)); tt.elapsed > 0 && calls != 1 {
+				t.Fatalf("upstream calls = %d, want the data served from the cache", calls)
+			}
+			header := recorder.Header()
+			if got := header.Get("Cache-Control"); got != tt.wantMaxAge {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantMaxAge)
+			}
+			// Clients are let to cache the data as long as the server does, and no longer
+			wantExpires := ""
+			if tt.wantMaxAge != "" {
+				wantExpires = at.Add(tt.ttl).Format(http.TimeFormat)
+			}
+			if got := header.Get("Expires"); got != wantExpires {
+				t.Errorf("Expires = %q, want %q", got, wantExpires)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// MaxUpstreamAttempts is the maximum number of attempts made for a single call to OpenWeatherMap, including the first one.
+// Retries are only made for transient failures and only while the request deadline leaves room for them.
+// It can be changed at startup before the server begins handling requests; 1 disables retries.
+var MaxUpstreamAttempts = 3
+
+// RetryBackoff is the wait before the first retry. It doubles for every further retry.
+var RetryBackoff = 200 * time.Millisecond
+
+// isTransient is a helper function that reports whether a failed upstream call is worth retrying.
+// Only ErrUpstreamUnavailable failures such as network errors and server errors are transient, and not once the
+// context is done or in offline mode. Rate limiting is not retried: retrying within milliseconds ignores the upstream
+// Retry-After and spends more of the quota, so the limit is passed on to the client instead. Calls that can switch to
+// another API key are the exception, see retryableWithAnotherKey.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrOffline) || errors.Is(err, ErrUpstreamRateLimited) {
+		return false
+	}
+	return errors.Is(err, ErrUpstreamUnavailable)
+}
+
+// retryController retries a call while the context deadline leaves enough time for another attempt.
+// The clock is injectable so the budget accounting does not depend on real time.
+type retryController struct {
+	maxAttempts int
+	backoff     time.Duration
+	retryable   func(err error) bool // Whether a failed attempt is worth retrying, usually isTransient
+	now         func() time.Time
+	sleep       func(ctx context.Context, d time.Duration) error
+}
+
+// newRetryController is a helper function that creates a retry controller from MaxUpstreamAttempts and RetryBackoff
+// using the real clock, retrying the failures retryable reports.
+func newRetryController(retryable func(err error) bool) *retryController {
+	return &retryController{
+		maxAttempts: MaxUpstreamAttempts,
+		backoff:     RetryBackoff,
+		retryable:   retryable,
+		now:         time.Now,
+		sleep:       sleepContext,
+	}
+}
+
+// do calls attempt until it succeeds, fails with an error that is not retryable or the attempts run out.
+// Before retrying it checks the remaining time against the context deadline: the backoff plus the duration of the
+// previous attempt, used as an estimate of the next one, must fit, otherwise the last error is returned immediately
+// instead of overshooting the deadline. The second return value is the number of attempts made.
+func (c *retryController) do(ctx context.Context, attempt func(ctx context.Context) error) (int, error) {
+	backoff := c.backoff
+	for attempts := 1; ; attempts++ {
+		started := c.now()
+		err := attempt(ctx)
+		if err == nil || attempts >= c.maxAttempts || !c.retryable(err) {
+			return attempts, err
+		}
+
+		// Give up when another attempt would not finish before the deadline
+		if deadline, ok := ctx.Deadline(); ok {
+			elapsed := c.now().Sub(started)
+			if deadline.Sub(c.now()) < backoff+elapsed {
+				return attempts, err
+			}
+		}
+
+		if sleepErr := c.sleep(ctx, backoff); sleepErr != nil {
+			return attempts, err
+		}
+		backoff *= 2
+	}
+}
+
+// sleepContext is a helper function that waits for d, returning early with the context error when ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetchWithRetries is a helper function that runs fetch under a retry controller retrying the failures retryable
+// reports, and logs the number of attempts whenever more than one was needed.
+func fetchWithRetries(ctx context.Context, retryable func(err error) bool, fetch func(ctx context.Context) (*WeatherData, error)) (*WeatherData, error) {
+	var weatherData *WeatherData
+	attempts, err := newRetryController(retryable).do(ctx, func(ctx context.Context) error {
+		var err error
+		weatherData, err = fetch(ctx)
+		return err
+	})
+	if attempts > 1 {
+		log.Printf("OpenWeatherMap call took %d attempts, last error: %v", attempts, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return weatherData, nil
+}
@@ -0,0 +1,159 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeRetryClock is a clock for the retry controller that only moves when attempts run and backoffs are slept.
+type fakeRetryClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+// sleep records the backoff and moves the clock past it.
+func (c *fakeRetryClock) sleep(ctx context.Context, d time.Duration) error {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func TestRetryControllerDo(t *testing.T) {
+	unavailable := fmt.Errorf("openweathermap: %w: 500 Internal Server Error", ErrUpstreamUnavailable)
+	tests := []struct {
+		name         string
+		budget       time.Duration // Time until the deadline, none when zero
+		attemptTakes time.Duration
+		errs         []error // Results of consecutive attempts, the last one repeating
+		wantAttempts int
+		wantSleeps   []time.Duration
+		wantErr      error
+	}{
+		{name: "first attempt succeeds", budget: 5 * time.Second, errs: []error{nil}, wantAttempts: 1},
+		{
+			name:         "transient failure is retried",
+			budget:       5 * time.Second,
+			attemptTakes: 100 * time.Millisecond,
+			errs:         []error{unavailable, nil},
+			wantAttempts: 2,
+			wantSleeps:   []time.Duration{200 * time.Millisecond},
+		},
+		{
+			name:         "attempts run out",
+			budget:       5 * time.Second,
+			attemptTakes: 100 * time.Millisecond,
+			errs:         []error{unavailable},
+			wantAttempts: 3,
+			wantSleeps:   []time.Duration{200 * time.Millisecond, 400 * time.Millisecond},
+			wantErr:      ErrUpstreamUnavailable,
+		},
+		{
+			name:         "budget exhausted",
+			budget:       time.Second,
+			attemptTakes: 300 * time.Millisecond,
+			errs:         []error{unavailable},
+			wantAttempts: 2,
+			wantSleeps:   []time.Duration{200 * time.Millisecond},
+			wantErr:      ErrUpstreamUnavailable,
+		},
+		{
+			name:         "no room for a single retry",
+			budget:       time.Second,
+			attemptTakes: 900 * time.Millisecond,
+			errs:         []error{unavailable},
+			wantAttempts: 1,
+			wantErr:      ErrUpstreamUnavailable,
+		},
+		{
+			name:         "no deadline",
+			attemptTakes: time.Minute,
+			errs:         []error{unavailable},
+			wantAttempts: 3,
+			wantSleeps:   []time.Duration{200 * time.Millisecond, 400 * time.Millisecond},
+			wantErr:      ErrUpstreamUnavailable,
+		},
+		{name: "location not found", budget: 5 * time.Second, errs: []error{ErrLocationNotFound}, wantAttempts: 1, wantErr: ErrLocationNotFound},
+		{name: "rate limited", budget: 5 * time.Second, errs: []error{ErrUpstreamRateLimited}, wantAttempts: 1, wantErr: ErrUpstreamRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The deadline is measured from the real time the fake clock starts at; the test finishes long before it.
+			clock := &fakeRetryClock{now: time.Now()}
+			ctx := context.Background()
+			if tt.budget > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, clock.now.Add(tt.budget))
+				defer cancel()
+			}
+			controller := &retryController{
+				maxAttempts: 3,
+				backoff:     200 * time.Millisecond,
+				retryable:   isTransient,
+				now:         func() time.Time { return clock.now },
+				sleep:       clock.sleep,
+			}
+
+			calls := 0
+			attempts, err := controller.do(ctx, func(ctx context.Context) error {
+				clock.now = clock.now.Add(tt.attemptTakes)
+				err := tt.errs[min(calls, len(tt.errs)-1)]
+				calls++
+				return err
+			})
+
+			if attempts != tt.wantAttempts || calls != tt.wantAttempts {
+				t.Errorf("attempts = %d with %d calls, want %d", attempts, calls, tt.wantAttempts)
+			}
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("do() error = %v, want %v", err, tt.wantErr)
+			}
+			if fmt.Sprint(clock.sleeps) != fmt.Sprint(tt.wantSleeps) {
+				t.Errorf("backoffs = %v, want %v", clock.sleeps, tt.wantSleeps)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int // Upstream status codes of consecutive calls, the last one repeating
+		wantStatus int
+		wantCalls  int
+	}{
+		{name: "success", statuses: []int{http.StatusOK}, wantStatus: http.StatusOK, wantCalls: 1},
+		{name: "recovers from a server error", statuses: []int{http.StatusBadGateway, http.StatusOK}, wantStatus: http.StatusOK, wantCalls: 2},
+		{name: "persistent server error", statuses: []int{http.StatusInternalServerError}, wantStatus: http.StatusBadGateway, wantCalls: 3},
+		{name: "rate limited", statuses: []int{http.StatusTooManyRequests}, wantStatus: http.StatusTooManyRequests, wantCalls: 1},
+		{name: "unknown location", statuses: []int{http.StatusNotFound}, wantStatus: http.StatusNotFound, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			RetryBackoff = time.Millisecond
+			var calls atomic.Int32
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[min(int(calls.Add(1))-1, len(tt.statuses)-1)]
+				if status != http.StatusOK {
+					respond(status, fmt.Sprintf(`{"cod":%d,"message":"%s"}`, status, http.StatusText(status)))(w, r)
+					return
+				}
+				respond(http.StatusOK, sampleCurrentWeather)(w, r)
+			}})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if got := len(upstream.calls(currentWeatherPath)); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
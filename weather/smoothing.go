@@ -0,0 +1,57 @@
+package weather
+
+import (
+	"sync"
+	"time"
+)
+
+// smoothingStateTTL is how long the smoothed value of a location is kept without new readings
+// before smoothing starts over from the next raw reading.
+const smoothingStateTTL = time.Hour
+
+// smoothingState is the smoothed value of a location together with the time it was last updated.
+type smoothingState struct {
+	value   float64
+	updated time.Time
+}
+
+// smoother maintains an exponentially smoothed value per key. It is safe for concurrent use.
+type smoother struct {
+	mu     sync.Mutex
+	states map[string]smoothingState
+}
+
+// newSmoother creates a smoother without any history.
+func newSmoother() *smoother {
+	return &smoother{states: make(map[string]smoothingState)}
+}
+
+// temperatureSmoother holds the smoothed temperatures of the locations polled with smooth=true.
+// Keys include the unit system, so readings in different units are never mixed.
+var temperatureSmoother = newSmoother()
+
+// update feeds a new reading for key into the smoother and returns the smoothed value.
+// The first reading, or the first one after the state has expired, is returned unchanged.
+func (s *smoother) update(key string, value, factor float64) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := now()
+	if state, ok := s.states[key]; ok && current.Sub(state.updated) < smoothingStateTTL {
+		value = exponentialSmoothing(state.value, value, factor)
+	}
+	s.states[key] = smoothingState{value: value, updated: current}
+
+	// Drop states that have not been updated for a while so locations polled once do not accumulate
+	for k, state := range s.states {
+		if current.Sub(state.updated) >= smoothingStateTTL {
+			delete(s.states, k)
+		}
+	}
+	return value
+}
+
+// exponentialSmoothing is a helper function that blends a new reading into the previous smoothed value.
+func exponentialSmoothing(previous, current, factor float64) float64 {
+	return factor*current + (1-factor)*previous
+}
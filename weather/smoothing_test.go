@@ -0,0 +1,108 @@
+package weather
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSmootherUpdate(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// reading is one value fed into the smoother for a key after elapsed time since the start
+	type reading struct {
+		key     string
+		elapsed time.Duration
+		value   float64
+		want    float64
+	}
+	tests := []struct {
+		name     string
+		factor   float64
+		readings []reading
+	}{
+		{
+			name:   "first reading is returned unchanged",
+			factor: 0.3,
+			readings: []reading{
+				{key: "a", value: 20, want: 20},
+			},
+		},
+		{
+			name:   "later readings are blended in",
+			factor: 0.3,
+			readings: []reading{
+				{key: "a", value: 20, want: 20},
+				{key: "a", elapsed: time.Minute, value: 30, want: 23},
+				{key: "a", elapsed: 2 * time.Minute, value: 23, want: 23},
+			},
+		},
+		{
+			name:   "factor one follows the readings",
+			factor: 1,
+			readings: []reading{
+				{key: "a", value: 20, want: 20},
+				{key: "a", elapsed: time.Minute, value: 30, want: 30},
+			},
+		},
+		{
+			name:   "keys are independent",
+			factor: 0.5,
+			readings: []reading{
+				{key: "a", value: 20, want: 20},
+				{key: "b", value: 10, want: 10},
+				{key: "a", elapsed: time.Minute, value: 30, want: 25},
+			},
+		},
+		{
+			name:   "expired state starts over",
+			factor: 0.5,
+			readings: []reading{
+				{key: "a", value: 20, want: 20},
+				{key: "a", elapsed: smoothingStateTTL, value: 30, want: 30},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			s := newSmoother()
+			for i, r := range tt.readings {
+				SetClock(FixedClock(start.Add(r.elapsed)))
+				if got := s.update(r.key, r.value, tt.factor); math.Abs(got-r.want) > 1e-9 {
+					t.Errorf("reading %d: update(%q, %v) = %v, want %v", i, r.key, r.value, got, r.want)
+				}
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerSmooth(t *testing.T) {
+	tests := []struct {
+		target           string
+		wantSmoothed     bool
+		wantCacheControl bool
+	}{
+		{target: "/weather?lat=51.51&lon=-0.13", wantCacheControl: true},
+		{target: "/weather?lat=51.51&lon=-0.13&smooth=true", wantSmoothed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			if got := strings.Contains(recorder.Body.String(), `"smoothed_temperature":"18.4 Celsius"`); got != tt.wantSmoothed {
+				t.Errorf("smoothed temperature reported %v, want %v; body %s", got, tt.wantSmoothed, recorder.Body)
+			}
+			if got := recorder.Header().Get("Cache-Control") != ""; got != tt.wantCacheControl {
+				t.Errorf("Cache-Control set %v, want %v", got, tt.wantCacheControl)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Polling intervals of the /weather/stream endpoint.
+const (
+	defaultStreamInterval = time.Minute
+	// minStreamInterval protects the upstream quota from clients asking for very frequent updates
+	minStreamInterval = 10 * time.Second
+)
+
+// StreamHandler is an HTTP handler function that pushes the current weather of a location as Server-Sent Events.
+// It accepts the same lat, lon, lang and units parameters and X-API-Key header as WeatherHandler, plus an optional
+// interval parameter with a Go duration such as "30s" (one minute by default, at least minStreamInterval).
+// The connection is held open and a "data:" event with fresh WeatherData JSON is sent right away and then at every
+// interval until the client disconnects. A failed fetch is reported as an "error" event and the stream carries on.
+// Invalid parameters result in a Bad Request status code (400) before the stream starts.
+func StreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Validate every parameter, reporting all problems in a single response
+	query := r.URL.Query()
+	cfg := currentConfig()
+	v := &validator{}
+	lat, lon := parseLatLon(v, query, cfg)
+	opts := parseFetchOptions(v, r, cfg)
+	interval := defaultStreamInterval
+	if value := query.Get("interval"); value != "" {
+		var err error
+		interval, err = time.ParseDuration(value)
+		switch {
+		case err != nil:
+			v.invalid("interval", "Invalid interval, it must be a duration such as 30s")
+		case interval < minStreamInterval:
+			v.outOfRange("interval", fmt.Sprintf("Invalid interval, it must be at least %v", minStreamInterval))
+		}
+	}
+	if !v.valid() {
+		v.write(w)
+		return
+	}
+
+	// Lift the server's write timeout for this long-lived response; writers without deadline support keep their own
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Flush every event on its own so the client sees it immediately
+		if err := writeStreamEvent(r.Context(), w, lat, lon, opts, cfg.timeout(EndpointStream)); err != nil {
+			return
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+
+		// Wait for the next tick or stop once the client disconnects
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeStreamEvent is a helper function that fetches the weather once and writes it as a Server-Sent Event.
+// Each fetch is bounded by timeout on its own. A failed fetch is written as an "error" event; the returned error is
+// only set when the write itself fails.
+func writeStreamEvent(ctx context.Context, w http.ResponseWriter, lat, lon float64, opts fetchOptions, timeout time.Duration) error {
+	// Bound each fetch like a regular request, and cancel it when the client disconnects
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	weatherData, err := getWeatherWithContext(ctx, lat, lon, opts)
+	if err != nil {
+		message, _ := describeFetchError(err)
+		_, err = fmt.Fprintf(w, "event: error\ndata: %s\n\n", message)
+		return err
+	}
+	localizeWeatherData(weatherData, opts.lang)
+	data, err := json.Marshal(weatherData)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
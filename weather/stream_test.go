@@ -0,0 +1,106 @@
+package weather
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		upstream  http.HandlerFunc
+		wantEvent string // Event type of the first event, empty for plain data
+		check     func(data string) bool
+	}{
+		{
+			name:     "weather data",
+			upstream: respond(http.StatusOK, sampleCurrentWeather),
+			check: func(data string) bool {
+				var weatherData WeatherData
+				return json.Unmarshal([]byte(data), &weatherData) == nil && weatherData.Temperature == "18.4 Celsius"
+			},
+		},
+		{
+			name:      "failed fetch",
+			upstream:  respond(http.StatusNotFound, `{"cod":"404","message":"city not found"}`),
+			wantEvent: "error",
+			check:     func(data string) bool { return data == "Location not found" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: tt.upstream})
+			server := httptest.NewServer(http.HandlerFunc(StreamHandler))
+			defer server.Close()
+
+			// Disconnect once the first event has been read
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/weather/stream?lat=51.51&lon=-0.13&interval=1m", nil)
+			response, err := server.Client().Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+
+			if response.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d", response.StatusCode)
+			}
+			if got := response.Header.Get("Content-Type"); got != "text/event-stream" {
+				t.Errorf("Content-Type = %q, want text/event-stream", got)
+			}
+			if got := response.Header.Get("Cache-Control"); got != "no-cache" {
+				t.Errorf("Cache-Control = %q, want no-cache", got)
+			}
+			var event, data string
+			scanner := bufio.NewScanner(response.Body)
+			for scanner.Scan() && scanner.Text() != "" {
+				field, value, _ := strings.Cut(scanner.Text(), ": ")
+				switch field {
+				case "event":
+					event = value
+				case "data":
+					data = value
+				}
+			}
+			if event != tt.wantEvent || !tt.check(data) {
+				t.Errorf("first event %q with data %s, want event %q", event, data, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestStreamHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{name: "interval too short", method: http.MethodGet, target: "/weather/stream?lat=51.51&lon=-0.13&interval=1s", wantStatus: http.StatusBadRequest},
+		{name: "invalid interval", method: http.MethodGet, target: "/weather/stream?lat=51.51&lon=-0.13&interval=often", wantStatus: http.StatusBadRequest},
+		{name: "missing coordinates", method: http.MethodGet, target: "/weather/stream?interval=30s", wantStatus: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodPost, target: "/weather/stream?lat=51.51&lon=-0.13", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(StreamHandler, tt.method, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if len(upstream.calls(currentWeatherPath)) != 0 {
+				t.Errorf("rejected request called the upstream")
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package weather
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// windStrengths maps wind speeds in meters per second onto the words used in summaries, following the Beaufort
+// scale: calm below force 1, light up to force 2, moderate up to force 4, strong up to force 6 and gale-force above.
+var windStrengths = []struct {
+	below float64
+	words string
+}{
+	{0.5, "calm winds"},
+	{3.4, "light winds"},
+	{8.0, "moderate winds"},
+	{13.9, "strong winds"},
+}
+
+// windWords is a helper function that describes a wind speed in meters per second in words, e.g. "light winds".
+func windWords(speed float64) string {
+	for _, strength := range windStrengths {
+		if speed < strength.below {
+			return strength.words
+		}
+	}
+	return "gale-force winds"
+}
+
+// shortTemperature is a helper function that formats a temperature rounded to a whole number with its unit symbol,
+// e.g. "21°C", "70°F" or "294 K". Temperatures just below zero read "0°C" rather than "-0°C".
+func shortTemperature(temperature float64, units string) string {
+	// Adding zero turns the negative zero that rounding leaves for such temperatures into a positive one
+	temperature = math.Round(temperature) + 0
+	switch units {
+	case UnitsImperial:
+		return fmt.Sprintf("%.0f°F", temperature)
+	case UnitsStandard:
+		return fmt.Sprintf("%.0f K", temperature)
+	}
+	return fmt.Sprintf("%.0f°C", temperature)
+}
+
+// weatherSummary is a helper function that describes the weather in one English sentence for voice assistants and
+// notifications, e.g. "It's 21°C with scattered clouds and light winds in London."
+// The temperature and wind speed are in the given unit system. The description, the wind (when hasWind is false) and
+// the place are optional and simply left out of the sentence when missing.
+func weatherSummary(description string, temperature float64, units string, windSpeed float64, hasWind bool, place string) string {
+	var details []string
+	if description != "" {
+		details = append(details, description)
+	}
+	if hasWind {
+		details = append(details, windWords(toMetersPerSecond(windSpeed, units)))
+	}
+
+	sentence := "It's " + shortTemperature(temperature, units)
+	if len(details) > 0 {
+		sentence += " with " + strings.Join(details, " and ")
+	}
+	if place != "" {
+		sentence += " in " + place
+	}
+	return sentence + "."
+}
@@ -0,0 +1,97 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWindWords(t *testing.T) {
+	tests := []struct {
+		speed float64
+		want  string
+	}{
+		{speed: 0, want: "calm winds"},
+		{speed: 0.49, want: "calm winds"},
+		{speed: 0.5, want: "light winds"},
+		{speed: 3.39, want: "light winds"},
+		{speed: 3.4, want: "moderate winds"},
+		{speed: 7.99, want: "moderate winds"},
+		{speed: 8, want: "strong winds"},
+		{speed: 13.89, want: "strong winds"},
+		{speed: 13.9, want: "gale-force winds"},
+		{speed: 32.7, want: "gale-force winds"},
+	}
+	for _, tt := range tests {
+		if got := windWords(tt.speed); got != tt.want {
+			t.Errorf("windWords(%v) = %q, want %q", tt.speed, got, tt.want)
+		}
+	}
+}
+
+func TestWeatherSummary(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		temperature float64
+		units       string
+		windSpeed   float64
+		hasWind     bool
+		place       string
+		want        string
+	}{
+		{name: "everything", description: "scattered clouds", temperature: 21.3, units: UnitsMetric, windSpeed: 2.1, hasWind: true, place: "London", want: "It's 21°C with scattered clouds and light winds in London."},
+		{name: "imperial units", description: "clear sky", temperature: 70.4, units: UnitsImperial, windSpeed: 12, hasWind: true, place: "Denver", want: "It's 70°F with clear sky and moderate winds in Denver."},
+		{name: "standard units", description: "light rain", temperature: 283.6, units: UnitsStandard, place: "Oslo", want: "It's 284 K with light rain in Oslo."},
+		{name: "no description", temperature: 18.4, units: UnitsMetric, windSpeed: 15, hasWind: true, place: "Wellington", want: "It's 18°C with gale-force winds in Wellington."},
+		{name: "calm", description: "mist", temperature: 4, units: UnitsMetric, hasWind: true, want: "It's 4°C with mist and calm winds."},
+		{name: "temperature only", temperature: 18.4, units: UnitsMetric, want: "It's 18°C."},
+		{name: "just below zero", description: "fog", temperature: -0.4, units: UnitsMetric, want: "It's 0°C with fog."},
+		{name: "frost", temperature: -3.6, units: UnitsMetric, place: "Tromsø", want: "It's -4°C in Tromsø."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := weatherSummary(tt.description, tt.temperature, tt.units, tt.windSpeed, tt.hasWind, tt.place)
+			if got != tt.want {
+				t.Errorf("weatherSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		path    string
+		body    string
+		query   string
+		want    string
+	}{
+		{name: "current weather", version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather, want: "It's 18°C with broken clouds and moderate winds in London."},
+		{name: "imperial units", version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather, query: "&units=imperial", want: "It's 18°F with broken clouds and light winds in London."},
+		{name: "no wind or name", version: OWMAPIVersion25, path: currentWeatherPath, body: strings.NewReplacer(`"wind":{"speed":4.1,"deg":250},`, "", `"name":"London",`, "").Replace(sampleCurrentWeather), want: "It's 18°C with broken clouds."},
+		{name: "one call", version: OWMAPIVersion30, path: oneCallPath, body: sampleOneCall, want: "It's 18°C with broken clouds and moderate winds."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13"+tt.query, nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Summary != tt.want {
+				t.Errorf("summary = %q, want %q", got.Summary, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package weather
+
+import (
+	"math"
+	"time"
+)
+
+// maxTimezoneDistance is the largest distance in kilometers between the queried location and a reference city
+// for the city's timezone to be reported. Beyond it the timezone is left empty rather than guessed.
+const maxTimezoneDistance = 1500
+
+// timezoneReference is a representative location of an IANA timezone used by lookupTimezone.
+type timezoneReference struct {
+	name     string
+	lat, lon float64
+}
+
+// timezoneReferences is a coarse table of IANA timezones and a representative location within each.
+// It favours populous zones and is intentionally small; locations far from every entry get no timezone.
+var timezoneReferences = []timezoneReference{
+	// Europe
+	{"Europe/London", 51.51, -0.13},
+	{"Europe/Dublin", 53.35, -6.26},
+	{"Europe/Lisbon", 38.72, -9.14},
+	{"Europe/Madrid", 40.42, -3.70},
+	{"Europe/Paris", 48.86, 2.35},
+	{"Europe/Brussels", 50.85, 4.35},
+	{"Europe/Amsterdam", 52.37, 4.90},
+	{"Europe/Berlin", 52.52, 13.40},
+	{"Europe/Zurich", 47.37, 8.54},
+	{"Europe/Rome", 41.90, 12.50},
+	{"Europe/Vienna", 48.21, 16.37},
+	{"Europe/Prague", 50.08, 14.44},
+	{"Europe/Warsaw", 52.23, 21.01},
+	{"Europe/Stockholm", 59.33, 18.07},
+	{"Europe/Oslo", 59.91, 10.75},
+	{"Europe/Copenhagen", 55.68, 12.57},
+	{"Europe/Helsinki", 60.17, 24.94},
+	{"Europe/Athens", 37.98, 23.73},
+	{"Europe/Bucharest", 44.43, 26.10},
+	{"Europe/Kyiv", 50.45, 30.52},
+	{"Europe/Istanbul", 41.01, 28.98},
+	{"Europe/Moscow", 55.76, 37.62},
+	{"Atlantic/Reykjavik", 64.15, -21.94},
+	// Africa
+	{"Africa/Casablanca", 33.57, -7.59},
+	{"Africa/Lagos", 6.52, 3.38},
+	{"Africa/Cairo", 30.04, 31.24},
+	{"Africa/Nairobi", -1.29, 36.82},
+	{"Africa/Johannesburg", -26.20, 28.05},
+	{"Africa/Kinshasa", -4.44, 15.27},
+	{"Africa/Algiers", 36.75, 3.06},
+	// Asia
+	{"Asia/Dubai", 25.20, 55.27},
+	{"Asia/Riyadh", 24.71, 46.68},
+	{"Asia/Tehran", 35.69, 51.39},
+	{"Asia/Karachi", 24.86, 67.01},
+	{"Asia/Kolkata", 28.61, 77.21},
+	{"Asia/Kathmandu", 27.72, 85.32},
+	{"Asia/Dhaka", 23.81, 90.41},
+	{"Asia/Bangkok", 13.76, 100.50},
+	{"Asia/Jakarta", -6.21, 106.85},
+	{"Asia/Singapore", 1.35, 103.82},
+	{"Asia/Shanghai", 31.23, 121.47},
+	{"Asia/Hong_Kong", 22.32, 114.17},
+	{"Asia/Manila", 14.60, 120.98},
+	{"Asia/Seoul", 37.57, 126.98},
+	{"Asia/Tokyo", 35.68, 139.69},
+	{"Asia/Almaty", 43.24, 76.89},
+	{"Asia/Tashkent", 41.30, 69.24},
+	{"Asia/Yekaterinburg", 56.84, 60.61},
+	{"Asia/Novosibirsk", 55.01, 82.93},
+	{"Asia/Vladivostok", 43.12, 131.89},
+	// Oceania
+	{"Australia/Perth", -31.95, 115.86},
+	{"Australia/Adelaide", -34.93, 138.60},
+	{"Australia/Brisbane", -27.47, 153.03},
+	{"Australia/Sydney", -33.87, 151.21},
+	{"Pacific/Auckland", -36.85, 174.76},
+	{"Pacific/Honolulu", 21.31, -157.86},
+	// Americas
+	{"America/Anchorage", 61.22, -149.90},
+	{"America/Vancouver", 49.28, -123.12},
+	{"America/Los_Angeles", 34.05, -118.24},
+	{"America/Phoenix", 33.45, -112.07},
+	{"America/Denver", 39.74, -104.99},
+	{"America/Chicago", 41.88, -87.63},
+	{"America/Mexico_City", 19.43, -99.13},
+	{"America/Toronto", 43.65, -79.38},
+	{"America/New_York", 40.71, -74.01},
+	{"America/Halifax", 44.65, -63.58},
+	{"America/Bogota", 4.71, -74.07},
+	{"America/Lima", -12.05, -77.04},
+	{"America/Caracas", 10.48, -66.90},
+	{"America/Santiago", -33.45, -70.67},
+	{"America/Argentina/Buenos_Aires", -34.60, -58.38},
+	{"America/Sao_Paulo", -23.55, -46.63},
+}
+
+// lookupTimezone is a helper function that makes a best-effort guess of the IANA timezone name for a location.
+// It picks the nearest reference city within maxTimezoneDistance whose current UTC offset matches offsetSeconds,
+// the offset reported by the upstream API. When hasOffset is false, or the timezone database is unavailable for
+// a reference, the offset check is skipped. An empty string is returned when no reference qualifies.
+func lookupTimezone(lat, lon float64, offsetSeconds int, hasOffset bool) string {
+	best, bestDistance := "", math.Inf(1)
+	current := now()
+	for _, reference := range timezoneReferences {
+		distance := haversineDistance(lat, lon, reference.lat, reference.lon)
+		if distance > maxTimezoneDistance || distance >= bestDistance {
+			continue
+		}
+		if hasOffset {
+			if location, err := time.LoadLocation(reference.name); err == nil {
+				if _, offset := current.In(location).Zone(); offset != offsetSeconds {
+					continue
+				}
+			}
+		}
+		best, bestDistance = reference.name, distance
+	}
+	return best
+}
+
+// haversineDistance is a helper function that returns the great-circle distance in kilometers between two coordinates.
+func haversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371.0
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(math.Min(1, a)))
+}
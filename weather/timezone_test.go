@@ -0,0 +1,54 @@
+package weather
+
+import (
+	"math"
+	"testing"
+	"time"
+	_ "time/tzdata" // Makes the offset checks independent of the timezone database of the machine
+)
+
+func TestLookupTimezone(t *testing.T) {
+	summer := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	winter := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		at        time.Time
+		lat, lon  float64
+		offset    int
+		hasOffset bool
+		want      string
+	}{
+		{name: "nearest reference", at: summer, lat: 51.5, lon: -0.1, offset: 3600, hasOffset: true, want: "Europe/London"},
+		{name: "winter offset", at: winter, lat: 51.5, lon: -0.1, offset: 0, hasOffset: true, want: "Europe/London"},
+		{name: "without offset", at: summer, lat: 48.9, lon: 2.3, want: "Europe/Paris"},
+		{name: "offset rules out the nearest reference", at: summer, lat: 48.9, lon: 2.3, offset: 3600, hasOffset: true, want: "Europe/London"},
+		{name: "far from every reference", at: summer, lat: 0, lon: -150, offset: -36000, hasOffset: true, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetClock(FixedClock(tt.at))
+			if got := lookupTimezone(tt.lat, tt.lon, tt.offset, tt.hasOffset); got != tt.want {
+				t.Errorf("lookupTimezone(%v, %v, %d, %v) = %q, want %q", tt.lat, tt.lon, tt.offset, tt.hasOffset, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHaversineDistance(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{name: "same point", lat1: 51.51, lon1: -0.13, lat2: 51.51, lon2: -0.13, want: 0},
+		{name: "London to Paris", lat1: 51.51, lon1: -0.13, lat2: 48.86, lon2: 2.35, want: 343},
+		{name: "across the antimeridian", lat1: 0, lon1: 179.5, lat2: 0, lon2: -179.5, want: 111},
+		{name: "pole to pole", lat1: 90, lon1: 0, lat2: -90, lon2: 0, want: 20015},
+	}
+	for _, tt := range tests {
+		if got := haversineDistance(tt.lat1, tt.lon1, tt.lat2, tt.lon2); math.Abs(got-tt.want) > 1 {
+			t.Errorf("%s: distance = %.1f km, want %.0f km", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the phases reported in the Server-Timing header.
+const (
+	timingCache    = "cache"    // Looking the weather data up in the cache
+	timingUpstream = "upstream" // Fetching the weather data from the providers, including waiting for a shared fetch
+	timingEncode   = "encode"   // Encoding the response body
+)
+
+// serverTiming collects how long the phases of one request took, for the Server-Timing header.
+// Durations are measured with the wall clock rather than the active Clock, which may be pinned.
+// A nil *serverTiming records nothing, so instrumented code does not need to check whether timing is enabled.
+type serverTiming struct {
+	mu      sync.Mutex
+	metrics []timingMetric
+}
+
+// timingMetric is the duration of one phase of a request.
+type timingMetric struct {
+	name     string
+	duration time.Duration
+}
+
+// record adds the time elapsed since start as the duration of the named phase.
+func (t *serverTiming) record(name string, start time.Time) {
+	if t == nil {
+		return
+	}
+	elapsed := time.Since(start)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metrics = append(t.metrics, timingMetric{name, elapsed})
+}
+
+// header formats the recorded phases in the order they were recorded as a Server-Timing header value with durations
+// in milliseconds, e.g. "cache;dur=0.012, upstream;dur=153.402, encode;dur=0.031".
+func (t *serverTiming) header() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries := make([]string, len(t.metrics))
+	for i, metric := range t.metrics {
+		entries[i] = fmt.Sprintf("%s;dur=%.3f", metric.name, float64(metric.duration)/float64(time.Millisecond))
+	}
+	return strings.Join(entries, ", ")
+}
+
+// serverTimingContextKey is the context key under which the timing of a request is stored.
+type serverTimingContextKey struct{}
+
+// withServerTiming returns a copy of ctx carrying the timing that the fetch path records its phases in.
+func withServerTiming(ctx context.Context, t *serverTiming) context.Context {
+	return context.WithValue(ctx, serverTimingContextKey{}, t)
+}
+
+// serverTimingFromContext returns the timing stored in ctx, or nil when the request is not timed.
+func serverTimingFromContext(ctx context.Context) *serverTiming {
+	t, _ := ctx.Value(serverTimingContextKey{}).(*serverTiming)
+	return t
+}
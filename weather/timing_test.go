@@ -0,0 +1,134 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serverTimingEntry matches one metric of a Server-Timing header as written by serverTiming.header.
+var serverTimingEntry = regexp.MustCompile(`^([a-z]+);dur=(\d+\.\d{3})$`)
+
+// timingNames returns the metric names of a Server-Timing header in order, failing the test on malformed entries.
+func timingNames(t *testing.T, header string) []string {
+	t.Helper()
+	var names []string
+	for _, entry := range strings.Split(header, ", ") {
+		match := serverTimingEntry.FindStringSubmatch(entry)
+		if match == nil {
+			t.Fatalf("Server-Timing entry %q of %q is malformed", entry, header)
+		}
+		names = append(names, match[1])
+	}
+	return names
+}
+
+func TestServerTiming(t *testing.T) {
+	t.Run("nil records nothing", func(t *testing.T) {
+		var timing *serverTiming
+		timing.record(timingCache, time.Now())
+		if got := serverTimingFromContext(context.Background()); got != nil {
+			t.Errorf("serverTimingFromContext() = %v, want nil without timing", got)
+		}
+	})
+	t.Run("header", func(t *testing.T) {
+		timing := &serverTiming{metrics: []timingMetric{
+			{timingCache, 12 * time.Microsecond},
+			{timingUpstream, 153402 * time.Microsecond},
+			{timingEncode, 0},
+		}}
+		if got, want := timing.header(), "cache;dur=0.012, upstream;dur=153.402, encode;dur=0.000"; got != want {
+			t.Errorf("header() = %q, want %q", got, want)
+		}
+	})
+	t.Run("context", func(t *testing.T) {
+		timing := &serverTiming{}
+		ctx := withServerTiming(context.Background(), timing)
+		serverTimingFromContext(ctx).record(timingUpstream, time.Now().Add(-time.Second))
+		if len(timing.metrics) != 1 || timing.metrics[0].name != timingUpstream || timing.metrics[0].duration < time.Second {
+			t.Errorf("metrics = %+v, want one upstream metric of at least a second", timing.metrics)
+		}
+	})
+}
+
+func TestWeatherHandlerServerTiming(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		header     http.Header
+		debug      bool
+		cached     bool // Whether the weather data is cached by an earlier request
+		upstream   http.HandlerFunc
+		wantStatus int
+		want       []string // Metric names in order, no header when nil
+	}{
+		{name: "off by default", target: "/weather?lat=51.51&lon=-0.13", wantStatus: http.StatusOK},
+		{name: "turned off", target: "/weather?lat=51.51&lon=-0.13&timing=false", wantStatus: http.StatusOK},
+		{name: "fresh", target: "/weather?lat=51.51&lon=-0.13&timing=true", wantStatus: http.StatusOK, want: []string{"cache", "upstream", "encode"}},
+		{name: "cached", target: "/weather?lat=51.51&lon=-0.13&timing=true", cached: true, wantStatus: http.StatusOK, want: []string{"cache", "encode"}},
+		{name: "debug mode", target: "/weather?lat=51.51&lon=-0.13", debug: true, wantStatus: http.StatusOK, want: []string{"cache", "upstream", "encode"}},
+		{name: "zip code", target: "/weather?zip=94040&timing=true", wantStatus: http.StatusOK, want: []string{"cache", "upstream", "encode"}},
+		{
+			name:       "xml",
+			target:     "/weather?lat=51.51&lon=-0.13&timing=true",
+			header:     http.Header{"Accept": {"application/xml"}},
+			wantStatus: http.StatusOK,
+			want:       []string{"cache", "upstream", "encode"},
+		},
+		{
+			name:       "upstream failure",
+			target:     "/weather?lat=51.51&lon=-0.13&timing=true",
+			upstream:   respond(http.StatusBadGateway, ``),
+			wantStatus: http.StatusBadGateway,
+			want:       []string{"cache", "upstream"},
+		},
+		{name: "invalid flag", target: "/weather?lat=51.51&lon=-0.13&timing=yes-please", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			captureLog(t)
+			MaxUpstreamAttempts = 1
+			upstream := tt.upstream
+			if upstream == nil {
+				upstream = respond(http.StatusOK, sampleCurrentWeather)
+			}
+			newUpstream(t, map[string]http.HandlerFunc{
+				currentWeatherPath: upstream,
+				"/geo/1.0/zip":     respond(http.StatusOK, `{"zip":"94040","name":"Mountain View","lat":37.3855,"lon":-122.088,"country":"US"}`),
+			})
+			if tt.cached {
+				serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+			}
+			SetDebugLogging(tt.debug)
+
+			recorder := serve(WeatherHandler, http.MethodGet, tt.target, tt.header)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			header := recorder.Header().Get("Server-Timing")
+			if tt.want == nil {
+				if header != "" {
+					t.Errorf("Server-Timing = %q, want none", header)
+				}
+			} else if got := timingNames(t, header); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Server-Timing metrics = %q, want %q", got, tt.want)
+			}
+			if tt.wantStatus == http.StatusBadRequest {
+				var errs []FieldError
+				if err := json.Unmarshal(recorder.Body.Bytes(), &errs); err != nil || len(errs) != 1 || errs[0].Code != "invalid_timing" {
+					t.Errorf("errors = %s, want code invalid_timing", recorder.Body)
+				}
+			}
+			// The body is written in full after the header reporting its encoding
+			if tt.wantStatus == http.StatusOK && !strings.Contains(recorder.Body.String(), "broken clouds") {
+				t.Errorf("body %s, want the weather data", recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package weather
+
+import (
+	"sync"
+	"time"
+)
+
+// Temperature trends reported in WeatherData.TemperatureTrend.
+const (
+	trendRising  = "rising"
+	trendFalling = "falling"
+	trendSteady  = "steady"
+)
+
+// trendStateTTL is how long the last observation of a location is kept without new readings before the trend
+// starts over, since a comparison with a much older observation says little about the current trend.
+const trendStateTTL = time.Hour
+
+// trendState holds the last two distinct observations of a location, in Celsius, and when they were last seen.
+type trendState struct {
+	previous    float64
+	hasPrevious bool
+	current     float64
+	observedAt  time.Time // Upstream timestamp of the current observation
+	updated     time.Time
+}
+
+// trendTracker remembers the latest observations per key to tell whether the temperature is rising or falling.
+// It is safe for concurrent use.
+type trendTracker struct {
+	mu     sync.Mutex
+	states map[string]trendState
+}
+
+// newTrendTracker creates a trend tracker without any history.
+func newTrendTracker() *trendTracker {
+	return &trendTracker{states: make(map[string]trendState)}
+}
+
+// temperatureTrends holds the recent observations of the locations polled with trend=true.
+var temperatureTrends = newTrendTracker()
+
+// update records the observation of key made at observedAt with the temperature in Celsius, and returns the trend
+// from the previous distinct observation within the deadband in Celsius. Repeated polls of the same observation, e.g.
+// answered from the cache, keep reporting the trend of that observation rather than "steady".
+// It returns an empty string while there is no previous observation to compare with.
+func (t *trendTracker) update(key string, temperature float64, observedAt time.Time, deadband float64) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := now()
+	state, ok := t.states[key]
+	switch {
+	case !ok || current.Sub(state.updated) >= trendStateTTL:
+		state = trendState{current: temperature, observedAt: observedAt}
+	case !observedAt.Equal(state.observedAt):
+		state = trendState{previous: state.current, hasPrevious: true, current: temperature, observedAt: observedAt}
+	}
+	state.updated = current
+	t.states[key] = state
+
+	// Drop states that have not been updated for a while so locations polled once do not accumulate
+	for k, s := range t.states {
+		if current.Sub(s.updated) >= trendStateTTL {
+			delete(t.states, k)
+		}
+	}
+
+	if !state.hasPrevious {
+		return ""
+	}
+	return classifyTrend(state.previous, state.current, deadband)
+}
+
+// classifyTrend is a helper function that compares two temperatures, treating changes no larger than deadband as steady.
+func classifyTrend(previous, current, deadband float64) string {
+	switch delta := current - previous; {
+	case delta > deadband:
+		return trendRising
+	case delta < -deadband:
+		return trendFalling
+	}
+	return trendSteady
+}
@@ -0,0 +1,195 @@
+package weather
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyTrend(t *testing.T) {
+	tests := []struct {
+		previous, current, deadband float64
+		want                        string
+	}{
+		{previous: 18, current: 19, deadband: 0.5, want: trendRising},
+		{previous: 18, current: 17, deadband: 0.5, want: trendFalling},
+		{previous: 18, current: 18.5, deadband: 0.5, want: trendSteady},
+		{previous: 18, current: 17.5, deadband: 0.5, want: trendSteady},
+		{previous: 18, current: 18, deadband: 0, want: trendSteady},
+		{previous: 18, current: 18.1, deadband: 0, want: trendRising},
+		{previous: -3, current: -5, deadband: 1, want: trendFalling},
+	}
+	for _, tt := range tests {
+		if got := classifyTrend(tt.previous, tt.current, tt.deadband); got != tt.want {
+			t.Errorf("classifyTrend(%v, %v, %v) = %q, want %q", tt.previous, tt.current, tt.deadband, got, tt.want)
+		}
+	}
+}
+
+func TestTrendTrackerUpdate(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// observation is one temperature of a key fed into the tracker; it was made at observed minutes after the start
+	// and is polled elapsed after the start
+	type observation struct {
+		key         string
+		observed    int
+		elapsed     time.Duration
+		temperature float64
+		want        string
+	}
+	tests := []struct {
+		name         string
+		observations []observation
+	}{
+		{
+			name: "first observation has no trend",
+			observations: []observation{
+				{key: "a", temperature: 18, want: ""},
+			},
+		},
+		{
+			name: "sequence",
+			observations: []observation{
+				{key: "a", temperature: 18, want: ""},
+				{key: "a", observed: 10, elapsed: 10 * time.Minute, temperature: 19, want: trendRising},
+				{key: "a", observed: 20, elapsed: 20 * time.Minute, temperature: 19.3, want: trendSteady},
+				{key: "a", observed: 30, elapsed: 30 * time.Minute, temperature: 17, want: trendFalling},
+				{key: "a", observed: 40, elapsed: 40 * time.Minute, temperature: 17.5, want: trendSteady},
+			},
+		},
+		{
+			name: "repeated poll of the same observation keeps its trend",
+			observations: []observation{
+				{key: "a", temperature: 18, want: ""},
+				{key: "a", observed: 10, elapsed: 10 * time.Minute, temperature: 20, want: trendRising},
+				{key: "a", observed: 10, elapsed: 12 * time.Minute, temperature: 20, want: trendRising},
+				{key: "a", observed: 10, elapsed: 14 * time.Minute, temperature: 20, want: trendRising},
+			},
+		},
+		{
+			name: "keys are independent",
+			observations: []observation{
+				{key: "a", temperature: 18, want: ""},
+				{key: "b", temperature: 25, want: ""},
+				{key: "a", observed: 10, elapsed: 10 * time.Minute, temperature: 16, want: trendFalling},
+				{key: "b", observed: 10, elapsed: 10 * time.Minute, temperature: 27, want: trendRising},
+			},
+		},
+		{
+			name: "expired history starts over",
+			observations: []observation{
+				{key: "a", temperature: 18, want: ""},
+				{key: "a", observed: 90, elapsed: trendStateTTL, temperature: 25, want: ""},
+				{key: "a", observed: 100, elapsed: trendStateTTL + 10*time.Minute, temperature: 24, want: trendFalling},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			tracker := newTrendTracker()
+			for i, o := range tt.observations {
+				SetClock(FixedClock(start.Add(o.elapsed)))
+				observedAt := start.Add(time.Duration(o.observed) * time.Minute)
+				if got := tracker.update(o.key, o.temperature, observedAt, 0.5); got != o.want {
+					t.Errorf("observation %d: update(%q, %v) = %q, want %q", i, o.key, o.temperature, got, o.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTrendTrackerForgetsIdleKeys(t *testing.T) {
+	setupTest(t)
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tracker := newTrendTracker()
+	SetClock(FixedClock(start))
+	tracker.update("once", 18, start, 0.5)
+	SetClock(FixedClock(start.Add(trendStateTTL)))
+
+	tracker.update("other", 18, start, 0.5)
+
+	if _, ok := tracker.states["once"]; ok || len(tracker.states) != 1 {
+		t.Errorf("states = %v, want only the recently updated key", tracker.states)
+	}
+}
+
+func TestWeatherHandlerTrend(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// poll is a request made while the upstream reports the temperature observed at the given number of minutes
+	type poll struct {
+		query       string
+		temperature string
+		observed    int
+		want        string
+	}
+	tests := []struct {
+		name  string
+		polls []poll
+	}{
+		{
+			name: "rising then falling",
+			polls: []poll{
+				{query: "&trend=true", temperature: "18.4"},
+				{query: "&trend=true", temperature: "19.6", observed: 15, want: trendRising},
+				{query: "&trend=true", temperature: "18.1", observed: 30, want: trendFalling},
+			},
+		},
+		{
+			name: "units share the history",
+			polls: []poll{
+				{query: "&trend=true", temperature: "18.4"},
+				// 65.9 Fahrenheit is 18.8 Celsius, within the deadband
+				{query: "&trend=true&units=imperial", temperature: "65.9", observed: 15, want: trendSteady},
+				// 61 Fahrenheit is 16.1 Celsius
+				{query: "&trend=true&units=imperial", temperature: "61", observed: 30, want: trendFalling},
+			},
+		},
+		{
+			name: "polls without the flag are not tracked",
+			polls: []poll{
+				{query: "", temperature: "10"},
+				{query: "&trend=true", temperature: "18.4", observed: 15},
+				{query: "&trend=false", temperature: "25", observed: 30},
+				{query: "&trend=true", temperature: "18.6", observed: 45, want: trendSteady},
+			},
+		},
+		{name: "invalid flag", polls: []poll{{query: "&trend=up", want: "invalid_trend"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetCache(noCache{})
+			var current poll
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+				body := strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":`+current.temperature, 1)
+				body = strings.Replace(body, `"dt":1717243200`, fmt.Sprintf(`"dt":%d`, start.Add(time.Duration(current.observed)*time.Minute).Unix()), 1)
+				respond(http.StatusOK, body)(w, r)
+			}})
+
+			for i, p := range tt.polls {
+				current = p
+				// Poll after the previous observation is no longer protected by the minimum fetch interval
+				SetClock(FixedClock(start.Add(time.Duration(i) * 15 * time.Minute)))
+				recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13"+p.query, nil)
+
+				if recorder.Code == http.StatusBadRequest {
+					if !strings.Contains(recorder.Body.String(), `"code":"`+p.want+`"`) {
+						t.Errorf("poll %d: body %s, want %s", i, recorder.Body, p.want)
+					}
+					continue
+				}
+				var got WeatherData
+				if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+					t.Fatalf("poll %d: %v; body %s", i, err, recorder.Body)
+				}
+				if got.TemperatureTrend != p.want {
+					t.Errorf("poll %d: trend = %q, want %q", i, got.TemperatureTrend, p.want)
+				}
+			}
+		})
+	}
+}
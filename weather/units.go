@@ -0,0 +1,202 @@
+package weather
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Unit systems supported by the OpenWeatherMap API.
+// Reference https://openweathermap.org/current - Units of measurement section
+const (
+	UnitsMetric   = "metric"   // Temperatures in Celsius
+	UnitsImperial = "imperial" // Temperatures in Fahrenheit
+	UnitsStandard = "standard" // Temperatures in Kelvin
+)
+
+// imperialRegions lists the regions, as they appear in Accept-Language tags, that customarily use imperial units.
+var imperialRegions = []string{"US", "LR", "MM"}
+
+// resolveUnits is a helper function that determines the effective unit system of a request.
+// The precedence is:
+//  1. the explicit units query parameter, which must name a supported unit system;
+//  2. the region of the preferred language in the Accept-Language header, e.g. "en-US" selects imperial units
+//     while "en-GB" selects metric units;
+//  3. defaultUnits, the configured Config.DefaultUnits, when neither of the above applies.
+func resolveUnits(explicit, acceptLanguage, defaultUnits string) (string, error) {
+	if explicit != "" {
+		if !validUnits(explicit) {
+			return "", fmt.Errorf("unsupported units %q", explicit)
+		}
+		return explicit, nil
+	}
+	if region := preferredRegion(acceptLanguage); region != "" {
+		if containsString(imperialRegions, region) {
+			return UnitsImperial, nil
+		}
+		return UnitsMetric, nil
+	}
+	return defaultUnits, nil
+}
+
+// preferredRegion is a helper function that returns the uppercase region subtag of the most preferred language
+// in an Accept-Language header, or an empty string when the header is empty or the language has no region.
+func preferredRegion(acceptLanguage string) string {
+	best, bestQuality := "", 0.0
+	for _, languageRange := range strings.Split(acceptLanguage, ",") {
+		parts := strings.Split(languageRange, ";")
+		tag := strings.TrimSpace(parts[0])
+		quality := 1.0
+		for _, param := range parts[1:] {
+			name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && strings.EqualFold(name, "q") {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if tag != "" && tag != "*" && quality > bestQuality {
+			best, bestQuality = tag, quality
+		}
+	}
+
+	// The region is the first two-letter subtag after the language, e.g. "US" in "en-US" or "zh-Hant-TW"
+	subtags := strings.Split(best, "-")
+	for _, subtag := range subtags[1:] {
+		if len(subtag) == 2 {
+			return strings.ToUpper(subtag)
+		}
+	}
+	return ""
+}
+
+// validUnits is a helper function that reports whether units names a supported unit system.
+func validUnits(units string) bool {
+	switch units {
+	case UnitsMetric, UnitsImperial, UnitsStandard:
+		return true
+	}
+	return false
+}
+
+// temperatureUnitLabel is a helper function that returns the label used for temperatures in the given unit system.
+func temperatureUnitLabel(units string) string {
+	switch units {
+	case UnitsImperial:
+		return "Fahrenheit"
+	case UnitsStandard:
+		return "Kelvin"
+	}
+	return "Celsius"
+}
+
+// formatTemperature is a helper function that formats a temperature in the given unit system, e.g. "21.3 Celsius".
+func formatTemperature(temperature float64, units string) string {
+	return fmt.Sprintf("%s %s", formatNumber(temperature), temperatureUnitLabel(units))
+}
+
+// temperatureBucket is a helper function that returns the range of the given width containing a temperature, e.g.
+// "20-25" for 21.3 with a width of 5. Ranges include their lower bound and exclude their upper bound, so 25 falls
+// into "25-30". The bounds are multiples of the width and in the same units as the temperature.
+// Fractional widths such as 0.1 are not exact in binary, so the quotient is snapped to a whole number when it is
+// within rounding error of one and the bounds are formatted with at most bucketDecimals decimal places; otherwise 0.3
+// would fall into "0.2-0.30000000000000004".
+func temperatureBucket(temperature, width float64) string {
+	index := temperature / width
+	if rounded := math.Round(index); math.Abs(index-rounded) < 1e-9 {
+		index = rounded
+	}
+	lower := math.Floor(index) * width
+	return fmt.Sprintf("%s-%s", formatBucketBound(lower), formatBucketBound(lower+width))
+}
+
+// bucketDecimals is the largest number of decimal places of a temperature bucket bound, see temperatureBucket.
+const bucketDecimals = 9
+
+// formatBucketBound is a helper function that formats a temperature bucket bound with at most bucketDecimals decimal
+// places and without trailing zeros or a negative sign on zero.
+func formatBucketBound(bound float64) string {
+	formatted := strconv.FormatFloat(bound, 'f', bucketDecimals, 64)
+	formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	if formatted == "-0" {
+		return "0"
+	}
+	return formatted
+}
+
+// metersPerMile is the length of an international mile in meters.
+const metersPerMile = 1609.344
+
+// formatVisibility is a helper function that formats a visibility given in meters in the distance unit of the
+// given unit system, e.g. "9.7 KM" for metric and standard units or "6.0 MI" for imperial units.
+func formatVisibility(meters float64, units string) string {
+	if units == UnitsImperial {
+		return fmt.Sprintf("%s MI", formatNumber(meters/metersPerMile))
+	}
+	return fmt.Sprintf("%s KM", formatNumber(meters/1000))
+}
+
+// metersPerSecondPerMph is the speed of one mile per hour in meters per second.
+const metersPerSecondPerMph = metersPerMile / 3600
+
+// windSpeedUnitLabel is a helper function that returns the label used for wind speeds in the given unit system.
+// The API reports wind speeds in miles per hour for imperial units and in meters per second otherwise.
+func windSpeedUnitLabel(units string) string {
+	if units == UnitsImperial {
+		return "mph"
+	}
+	return "m/s"
+}
+
+// formatWindSpeed is a helper function that formats a wind speed in the given unit system, e.g. "4.1 m/s" for
+// metric and standard units or "9.2 mph" for imperial units.
+func formatWindSpeed(speed float64, units string) string {
+	return fmt.Sprintf("%s %s", formatNumber(speed), windSpeedUnitLabel(units))
+}
+
+// toMetersPerSecond is a helper function that converts a wind speed from the given unit system into meters per second.
+func toMetersPerSecond(speed float64, units string) float64 {
+	if units == UnitsImperial {
+		return speed * metersPerSecondPerMph
+	}
+	return speed
+}
+
+// fromMetersPerSecond is a helper function that converts a wind speed in meters per second into the given unit system.
+func fromMetersPerSecond(speed float64, units string) float64 {
+	if units == UnitsImperial {
+		return speed / metersPerSecondPerMph
+	}
+	return speed
+}
+
+// toCelsius is a helper function that converts a temperature from the given unit system into Celsius.
+func toCelsius(temperature float64, units string) float64 {
+	switch units {
+	case UnitsImperial:
+		return (temperature - 32) * 5 / 9
+	case UnitsStandard:
+		return temperature - 273.15
+	}
+	return temperature
+}
+
+// toKelvin is a helper function that converts a temperature from the given unit system into Kelvin.
+func toKelvin(temperature float64, units string) float64 {
+	if units == UnitsStandard {
+		return temperature
+	}
+	return fromCelsius(toCelsius(temperature, units), UnitsStandard)
+}
+
+// fromCelsius is a helper function that converts a temperature in Celsius into the given unit system.
+func fromCelsius(temperature float64, units string) float64 {
+	switch units {
+	case UnitsImperial:
+		return temperature*9/5 + 32
+	case UnitsStandard:
+		return temperature + 273.15
+	}
+	return temperature
+}
@@ -0,0 +1,317 @@
+package weather
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTemperatureConversions(t *testing.T) {
+	tests := []struct {
+		units                   string
+		value                   float64
+		wantCelsius, wantKelvin float64
+	}{
+		{units: UnitsMetric, value: 20, wantCelsius: 20, wantKelvin: 293.15},
+		{units: UnitsImperial, value: 68, wantCelsius: 20, wantKelvin: 293.15},
+		{units: UnitsImperial, value: -40, wantCelsius: -40, wantKelvin: 233.15},
+		{units: UnitsStandard, value: 273.15, wantCelsius: 0, wantKelvin: 273.15},
+	}
+	for _, tt := range tests {
+		if got := toCelsius(tt.value, tt.units); math.Abs(got-tt.wantCelsius) > 1e-9 {
+			t.Errorf("toCelsius(%v, %s) = %v, want %v", tt.value, tt.units, got, tt.wantCelsius)
+		}
+		if got := toKelvin(tt.value, tt.units); math.Abs(got-tt.wantKelvin) > 1e-9 {
+			t.Errorf("toKelvin(%v, %s) = %v, want %v", tt.value, tt.units, got, tt.wantKelvin)
+		}
+		if got := fromCelsius(tt.wantCelsius, tt.units); math.Abs(got-tt.value) > 1e-9 {
+			t.Errorf("fromCelsius(%v, %s) = %v, want %v", tt.wantCelsius, tt.units, got, tt.value)
+		}
+	}
+}
+
+func TestWindSpeedConversions(t *testing.T) {
+	tests := []struct {
+		units        string
+		metersPerSec float64
+		want         float64
+	}{
+		{units: UnitsMetric, metersPerSec: 4.1, want: 4.1},
+		{units: UnitsStandard, metersPerSec: 4.1, want: 4.1},
+		{units: UnitsImperial, metersPerSec: metersPerSecondPerMph * 10, want: 10},
+	}
+	for _, tt := range tests {
+		got := fromMetersPerSecond(tt.metersPerSec, tt.units)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("fromMetersPerSecond(%v, %s) = %v, want %v", tt.metersPerSec, tt.units, got, tt.want)
+		}
+		if back := toMetersPerSecond(got, tt.units); math.Abs(back-tt.metersPerSec) > 1e-9 {
+			t.Errorf("toMetersPerSecond(%v, %s) = %v, want %v", got, tt.units, back, tt.metersPerSec)
+		}
+	}
+}
+
+func TestFormatVisibility(t *testing.T) {
+	tests := []struct {
+		units     string
+		meters    float64
+		precision int
+		want      string
+	}{
+		{units: UnitsMetric, meters: 10000, precision: 1, want: "10.0 KM"},
+		{units: UnitsMetric, meters: 2345, precision: 1, want: "2.3 KM"},
+		{units: UnitsMetric, meters: 2345, precision: 3, want: "2.345 KM"},
+		{units: UnitsStandard, meters: 800, precision: 1, want: "0.8 KM"},
+		{units: UnitsImperial, meters: 10000, precision: 1, want: "6.2 MI"},
+		{units: UnitsImperial, meters: 1609.344, precision: 2, want: "1.00 MI"},
+		{units: UnitsImperial, meters: 0, precision: 1, want: "0.0 MI"},
+	}
+	for _, tt := range tests {
+		setupTest(t)
+		configure(t, func(cfg *Config) { cfg.NumberPrecision = tt.precision })
+		if got := formatVisibility(tt.meters, tt.units); got != tt.want {
+			t.Errorf("formatVisibility(%v, %s) with precision %d = %q, want %q", tt.meters, tt.units, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestResolveUnits(t *testing.T) {
+	tests := []struct {
+		name                             string
+		explicit, acceptLanguage, config string
+		want                             string
+		wantErr                          bool
+	}{
+		{name: "explicit wins", explicit: UnitsStandard, acceptLanguage: "en-US", config: UnitsMetric, want: UnitsStandard},
+		{name: "unsupported explicit", explicit: "kelvin", config: UnitsMetric, wantErr: true},
+		{name: "imperial region", acceptLanguage: "en-US,en;q=0.9", config: UnitsMetric, want: UnitsImperial},
+		{name: "metric region", acceptLanguage: "en-GB", config: UnitsImperial, want: UnitsMetric},
+		{name: "preferred language decides", acceptLanguage: "de-DE;q=0.5, en-US;q=0.8", config: UnitsMetric, want: UnitsImperial},
+		{name: "script subtag", acceptLanguage: "my-Mymr-MM", config: UnitsMetric, want: UnitsImperial},
+		{name: "language without region", acceptLanguage: "en", config: UnitsImperial, want: UnitsImperial},
+		{name: "wildcard", acceptLanguage: "*", config: UnitsStandard, want: UnitsStandard},
+		{name: "no header", config: UnitsMetric, want: UnitsMetric},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveUnits(tt.explicit, tt.acceptLanguage, tt.config)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("resolveUnits(%q, %q, %q) = %q, %v; want %q, error %v", tt.explicit, tt.acceptLanguage, tt.config, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerUnitsFromAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		wantUnits      string
+	}{
+		{acceptLanguage: "en-US", wantUnits: UnitsImperial},
+		{acceptLanguage: "fr-FR", wantUnits: UnitsMetric},
+		{acceptLanguage: "", wantUnits: UnitsMetric},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			setupTest(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", http.Header{"Accept-Language": {tt.acceptLanguage}})
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			if calls := upstream.calls(currentWeatherPath); len(calls) != 1 || calls[0].Query().Get("units") != tt.wantUnits {
+				t.Errorf("upstream calls = %v, want one with units=%s", calls, tt.wantUnits)
+			}
+		})
+	}
+}
+
+func TestTemperatureBucket(t *testing.T) {
+	tests := []struct {
+		temperature, width float64
+		want               string
+	}{
+		{temperature: 21.3, width: 5, want: "20-25"},
+		{temperature: 20, width: 5, want: "20-25"},
+		{temperature: 24.999, width: 5, want: "20-25"},
+		{temperature: 25, width: 5, want: "25-30"},
+		{temperature: 18.4, width: 10, want: "10-20"},
+		{temperature: 18.4, width: 2.5, want: "17.5-20"},
+		{temperature: -3, width: 5, want: "-5-0"},
+		{temperature: -5, width: 5, want: "-5-0"},
+		{temperature: -0.01, width: 5, want: "-5-0"},
+		{temperature: math.Copysign(0, -1), width: 5, want: "0-5"},
+		{temperature: 0.3, width: 0.1, want: "0.3-0.4"},
+		{temperature: 18.4, width: 0.1, want: "18.4-18.5"},
+		{temperature: 291.55, width: 1, want: "291-292"},
+	}
+	for _, tt := range tests {
+		if got := temperatureBucket(tt.temperature, tt.width); got != tt.want {
+			t.Errorf("temperatureBucket(%v, %v) = %q, want %q", tt.temperature, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestWeatherHandlerBucket(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantTemp   string
+		wantBucket string
+	}{
+		{name: "no bucketing", query: "", wantStatus: http.StatusOK, wantTemp: "18.4 Celsius"},
+		{name: "five degrees", query: "&bucket=5", wantStatus: http.StatusOK, wantTemp: "18.4 Celsius", wantBucket: "15-20"},
+		{name: "fractional width", query: "&bucket=0.5", wantStatus: http.StatusOK, wantTemp: "18.4 Celsius", wantBucket: "18-18.5"},
+		{name: "in the requested units", query: "&bucket=10&units=imperial", wantStatus: http.StatusOK, wantTemp: "18.4 Fahrenheit", wantBucket: "10-20"},
+		{name: "zero", query: "&bucket=0", wantStatus: http.StatusBadRequest},
+		{name: "negative", query: "&bucket=-5", wantStatus: http.StatusBadRequest},
+		{name: "not a number", query: "&bucket=five", wantStatus: http.StatusBadRequest},
+		{name: "NaN", query: "&bucket=NaN", wantStatus: http.StatusBadRequest},
+		{name: "infinite", query: "&bucket=Inf", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13"+tt.query, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Temperature != tt.wantTemp || got.TemperatureBucket != tt.wantBucket {
+				t.Errorf("temperature %q in bucket %q, want %q in %q", got.Temperature, got.TemperatureBucket, tt.wantTemp, tt.wantBucket)
+			}
+		})
+	}
+}
+
+func TestFormatWindSpeed(t *testing.T) {
+	tests := []struct {
+		speed float64
+		units string
+		want  string
+	}{
+		{speed: 4.1, units: UnitsMetric, want: "4.1 m/s"},
+		{speed: 4.1, units: UnitsStandard, want: "4.1 m/s"},
+		{speed: 9.17, units: UnitsImperial, want: "9.2 mph"},
+		{speed: 0, units: UnitsImperial, want: "0.0 mph"},
+	}
+	for _, tt := range tests {
+		if got := formatWindSpeed(tt.speed, tt.units); got != tt.want {
+			t.Errorf("formatWindSpeed(%v, %s) = %q, want %q", tt.speed, tt.units, got, tt.want)
+		}
+	}
+}
+
+func TestWeatherHandlerWindSpeedUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider Provider
+		version  string
+		path     string
+		body     string
+		units    string
+		want     string
+	}{
+		// OpenWeatherMap converts wind speeds itself, so the value is reported as it is with the label of the units
+		{name: "current weather in metric units", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather, units: UnitsMetric, want: "4.1 m/s"},
+		{name: "current weather in standard units", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather, units: UnitsStandard, want: "4.1 m/s"},
+		{name: "current weather in imperial units", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion25, path: currentWeatherPath, body: sampleCurrentWeather, units: UnitsImperial, want: "4.1 mph"},
+		{name: "one call in imperial units", provider: OpenWeatherMapProvider{}, version: OWMAPIVersion30, path: oneCallPath, body: sampleOneCall, units: UnitsImperial, want: "4.1 mph"},
+		// Open-Meteo is always asked for meters per second, which are converted for imperial units
+		{name: "open-meteo in metric units", provider: OpenMeteoProvider{}, version: OWMAPIVersion25, path: openMeteoPath, body: sampleOpenMeteo, units: UnitsMetric, want: "4.1 m/s"},
+		{name: "open-meteo in imperial units", provider: OpenMeteoProvider{}, version: OWMAPIVersion25, path: openMeteoPath, body: sampleOpenMeteo, units: UnitsImperial, want: "9.2 mph"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.OWMAPIVersion = tt.version })
+			providersMu.Lock()
+			providers = []Provider{tt.provider}
+			providersMu.Unlock()
+			upstream := newUpstream(t, map[string]http.HandlerFunc{tt.path: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13&units="+tt.units, nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var got WeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.WindSpeed != tt.want {
+				t.Errorf("wind speed = %q, want %q", got.WindSpeed, tt.want)
+			}
+			// OpenWeatherMap is asked for the requested units, Open-Meteo for meters per second
+			param, want := "units", tt.units
+			if tt.provider == (OpenMeteoProvider{}) {
+				param, want = "wind_speed_unit", "ms"
+			}
+			if calls := upstream.calls(tt.path); len(calls) != 1 || calls[0].Query().Get(param) != want {
+				t.Errorf("upstream calls = %v, want one with %s=%s", calls, param, want)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerKelvin(t *testing.T) {
+	// The upstream reports 295 K in whichever units it is asked for
+	temperatures := map[string]string{UnitsMetric: "21.85", UnitsImperial: "71.33", UnitsStandard: "295"}
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantTemp   string
+		wantKelvin string
+	}{
+		{name: "not asked for", query: "", wantStatus: http.StatusOK, wantTemp: "21.9 Celsius"},
+		{name: "turned off", query: "&kelvin=false", wantStatus: http.StatusOK, wantTemp: "21.9 Celsius"},
+		{name: "from metric data", query: "&kelvin=true", wantStatus: http.StatusOK, wantTemp: "21.9 Celsius", wantKelvin: "295.0 Kelvin"},
+		{name: "from imperial data", query: "&kelvin=true&units=imperial", wantStatus: http.StatusOK, wantTemp: "71.3 Fahrenheit", wantKelvin: "295.0 Kelvin"},
+		{name: "from standard data", query: "&kelvin=1&units=standard", wantStatus: http.StatusOK, wantTemp: "295.0 Kelvin", wantKelvin: "295.0 Kelvin"},
+		{name: "in compact mode", query: "&kelvin=true&units=imperial&mode=compact", wantStatus: http.StatusOK, wantTemp: "71.3 Fahrenheit", wantKelvin: "295.0 Kelvin"},
+		{name: "invalid flag", query: "&kelvin=always", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+				body := strings.Replace(sampleCurrentWeather, `"temp":18.4`, `"temp":`+temperatures[r.URL.Query().Get("units")], 1)
+				respond(http.StatusOK, body)(w, r)
+			}})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13"+tt.query, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got CompactWeatherData
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Temperature != tt.wantTemp || got.TemperatureKelvin != tt.wantKelvin {
+				t.Errorf("temperature %q and %q in Kelvin, want %q and %q", got.Temperature, got.TemperatureKelvin, tt.wantTemp, tt.wantKelvin)
+			}
+			if tt.wantKelvin == "" && strings.Contains(recorder.Body.String(), "temperature_kelvin") {
+				t.Errorf("body %s has a Kelvin temperature", recorder.Body)
+			}
+		})
+	}
+}
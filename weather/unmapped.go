@@ -0,0 +1,56 @@
+package weather
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// unmappedFields is a helper function meant for maintainers that compares an upstream JSON body with the typed value
+// it was decoded into and lists the fields of the body that the type does not mirror, such as "main.feels_like" or
+// "weather[].icon", so that data dropped on the way into WeatherData can be spotted, e.g. after upstream schema
+// changes. Nested objects are compared field by field; the elements of arrays are all compared with the first element
+// of the typed value. The paths are sorted. It returns nil when the body is not a JSON object.
+func unmappedFields(body []byte, mapped interface{}) []string {
+	// Decode both sides generically; re-encoding the typed value yields every field it mirrors, null when unset
+	var received, known interface{}
+	if err := json.Unmarshal(body, &received); err != nil {
+		return nil
+	}
+	encoded, err := json.Marshal(mapped)
+	if err != nil || json.Unmarshal(encoded, &known) != nil {
+		return nil
+	}
+	var fields []string
+	collectUnmappedFields("", received, known, &fields)
+	slices.Sort(fields)
+	return slices.Compact(fields)
+}
+
+// collectUnmappedFields is a helper function that appends to fields the paths below path present in received but not in known.
+func collectUnmappedFields(path string, received, known interface{}, fields *[]string) {
+	switch received := received.(type) {
+	case map[string]interface{}:
+		knownObject, _ := known.(map[string]interface{})
+		for name, value := range received {
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			knownValue, ok := knownObject[name]
+			if !ok {
+				*fields = append(*fields, fieldPath)
+				continue
+			}
+			collectUnmappedFields(fieldPath, value, knownValue, fields)
+		}
+	case []interface{}:
+		// The mirror of an array element is only known when the typed value decoded at least one element
+		knownArray, _ := known.([]interface{})
+		if len(knownArray) == 0 {
+			return
+		}
+		for _, element := range received {
+			collectUnmappedFields(path+"[]", element, knownArray[0], fields)
+		}
+	}
+}
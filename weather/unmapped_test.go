@@ -0,0 +1,97 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmappedFields(t *testing.T) {
+	type condition struct {
+		Description string `json:"description"`
+	}
+	type response struct {
+		Name    string      `json:"name"`
+		Weather []condition `json:"weather"`
+		Main    *struct {
+			Temp *float64 `json:"temp"`
+		} `json:"main"`
+	}
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "everything mapped", body: `{"name":"London","weather":[{"description":"fog"}],"main":{"temp":3}}`},
+		{name: "top level field", body: `{"name":"London","cod":200,"base":"stations"}`, want: []string{"base", "cod"}},
+		{name: "nested field", body: `{"main":{"temp":3,"feels_like":1,"pressure":1012}}`, want: []string{"main.feels_like", "main.pressure"}},
+		{name: "nested object missing from the body", body: `{"main":null,"wind":{"speed":4.1}}`, want: []string{"wind"}},
+		{
+			name: "every array element",
+			body: `{"weather":[{"description":"fog","icon":"50n"},{"description":"mist","id":701}]}`,
+			want: []string{"weather[].icon", "weather[].id"},
+		},
+		{name: "empty array", body: `{"weather":[]}`},
+		{name: "not an object", body: `[{"name":"London"}]`},
+		{name: "not JSON", body: `<current><city name="London"/></current>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mapped response
+			if strings.HasPrefix(tt.body, "{") {
+				if err := json.Unmarshal([]byte(tt.body), &mapped); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := unmappedFields([]byte(tt.body), &mapped); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unmappedFields() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerLogsUnmappedFields(t *testing.T) {
+	// Reference https://openweathermap.org/current - Example of API response section, fields the service ignores included
+	extended := strings.Replace(sampleCurrentWeather, `"main":{"temp":18.4,"humidity":64}`,
+		`"base":"stations","main":{"temp":18.4,"feels_like":17.9,"pressure":1015,"humidity":64}`, 1)
+	extended = strings.Replace(extended, `"wind":{"speed":4.1,"deg":250}`, `"wind":{"speed":4.1,"deg":250,"gust":7.2}`, 1)
+	tests := []struct {
+		name    string
+		body    string
+		debug   bool
+		wantLog string // Logged list of unmapped fields, none when empty
+	}{
+		{name: "debug logging off", body: extended},
+		{name: "sample response", body: sampleCurrentWeather, debug: true, wantLog: "cod, sys.country, weather[].id, weather[].main"},
+		{
+			name:    "extra fields",
+			body:    extended,
+			debug:   true,
+			wantLog: "base, cod, main.feels_like, main.pressure, sys.country, weather[].id, weather[].main, wind.gust",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			SetDebugLogging(tt.debug)
+			logs := captureLog(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			const prefix = "OpenWeatherMap response fields not mapped into WeatherData: "
+			if logged := strings.Contains(logs.String(), prefix); logged != (tt.wantLog != "") {
+				t.Fatalf("unmapped fields logged %v, want %v; log %q", logged, tt.wantLog != "", logs)
+			}
+			if tt.wantLog != "" && !strings.Contains(logs.String(), prefix+tt.wantLog+"\n") {
+				t.Errorf("log %q does not list %s", logs, tt.wantLog)
+			}
+		})
+	}
+}
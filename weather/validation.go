@@ -0,0 +1,67 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// FieldError describes one invalid request parameter in a Bad Request response.
+// Code is stable across releases so that clients can branch on it without matching the human-readable message.
+// It is built from the field name and the kind of problem: missing_<field> for a required parameter that is absent,
+// invalid_<field> for a value that cannot be parsed, <field>_out_of_range for a parsed value outside the accepted
+// range, and conflicting_<field> for a parameter that cannot be combined with another one.
+type FieldError struct {
+	Field   string `json:"field"`   // Name of the query parameter or header
+	Code    string `json:"code"`    // Machine-readable error code, e.g. lat_out_of_range
+	Message string `json:"message"` // What is wrong with it
+}
+
+// validator accumulates the problems found while parsing a request, so that a client sending several invalid
+// parameters learns about all of them at once instead of fixing them one at a time.
+type validator struct {
+	errors []FieldError
+}
+
+// add records a problem with the named field under the given error code.
+func (v *validator) add(field, code, message string) {
+	v.errors = append(v.errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// missing records that the required named field is absent.
+func (v *validator) missing(field, message string) {
+	v.add(field, "missing_"+field, message)
+}
+
+// invalid records that the value of the named field cannot be parsed.
+func (v *validator) invalid(field, message string) {
+	v.add(field, "invalid_"+field, message)
+}
+
+// outOfRange records that the parsed value of the named field is outside the accepted range.
+func (v *validator) outOfRange(field, message string) {
+	v.add(field, field+"_out_of_range", message)
+}
+
+// conflict records that the named field cannot be combined with another parameter of the request.
+func (v *validator) conflict(field, message string) {
+	v.add(field, "conflicting_"+field, message)
+}
+
+// valid reports whether no problem has been recorded.
+func (v *validator) valid() bool {
+	return len(v.errors) == 0
+}
+
+// write responds with a Bad Request status code (400) and the recorded problems as a JSON array of FieldError objects.
+func (v *validator) write(w http.ResponseWriter) {
+	writeFieldErrors(w, http.StatusBadRequest, v.errors)
+}
+
+// writeFieldErrors is a helper function that responds with the given status code and the problems as a JSON array
+// of FieldError objects, the structured error format shared by the endpoints.
+func writeFieldErrors(w http.ResponseWriter, status int, errors []FieldError) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errors)
+}
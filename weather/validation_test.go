@@ -0,0 +1,114 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestValidationErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		target    string
+		wantCodes []string
+	}{
+		{name: "missing coordinates", handler: WeatherHandler, target: "/weather", wantCodes: []string{"missing_lat", "missing_lon"}},
+		{name: "bad latitude and longitude", handler: WeatherHandler, target: "/weather?lat=north&lon=500", wantCodes: []string{"invalid_lat", "lon_out_of_range"}},
+		{
+			name:      "every parameter wrong",
+			handler:   WeatherHandler,
+			target:    "/weather?lat=91&lon=west&units=celsius&lang=deutsch&pretty=maybe",
+			wantCodes: []string{"invalid_lang", "invalid_units", "invalid_pretty", "lat_out_of_range", "invalid_lon"},
+		},
+		{name: "conflicting forms", handler: WeatherHandler, target: "/weather?latlon=51.5,-0.12&lat=51.5", wantCodes: []string{"conflicting_latlon"}},
+		{name: "both compared locations", handler: CompareHandler, target: "/weather/compare?lat1=91&lon1=0&lon2=x", wantCodes: []string{"lat1_out_of_range", "missing_lat2", "invalid_lon2"}},
+		{name: "one call", handler: OneCallHandler, target: "/onecall?lat=x&lon=0&exclude=weekly", wantCodes: []string{"invalid_lat", "invalid_exclude"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			// Any upstream call fails the test: nothing is fetched until every parameter is valid
+			newUpstream(t, map[string]http.HandlerFunc{})
+
+			recorder := serve(tt.handler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, http.StatusBadRequest, recorder.Body)
+			}
+			if got := recorder.Header().Get("Content-Type"); got != contentTypeJSON {
+				t.Errorf("Content-Type = %q, want %q", got, contentTypeJSON)
+			}
+			var errs []FieldError
+			if err := json.Unmarshal(recorder.Body.Bytes(), &errs); err != nil {
+				t.Fatal(err)
+			}
+			var codes []string
+			for _, fieldErr := range errs {
+				if fieldErr.Field == "" || fieldErr.Message == "" {
+					t.Errorf("incomplete field error %+v", fieldErr)
+				}
+				codes = append(codes, fieldErr.Code)
+			}
+			if !reflect.DeepEqual(codes, tt.wantCodes) {
+				t.Errorf("codes = %q, want %q", codes, tt.wantCodes)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerErrorCodes(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantField string
+		wantCode  string
+	}{
+		{query: "lon=-0.13", wantField: "lat", wantCode: "missing_lat"},
+		{query: "lat=&lon=-0.13", wantField: "lat", wantCode: "missing_lat"},
+		{query: "lat=north&lon=-0.13", wantField: "lat", wantCode: "invalid_lat"},
+		{query: "lat=NaN&lon=-0.13", wantField: "lat", wantCode: "invalid_lat"},
+		{query: "lat=90.5&lon=-0.13", wantField: "lat", wantCode: "lat_out_of_range"},
+		{query: "lat=-Inf&lon=-0.13", wantField: "lat", wantCode: "lat_out_of_range"},
+		{query: "lat=51.51", wantField: "lon", wantCode: "missing_lon"},
+		{query: "lat=51.51&lon=west", wantField: "lon", wantCode: "invalid_lon"},
+		{query: "lat=51.51&lon=nan", wantField: "lon", wantCode: "invalid_lon"},
+		{query: "lat=51.51&lon=180.01", wantField: "lon", wantCode: "lon_out_of_range"},
+		{query: "latlon=51.51", wantField: "latlon", wantCode: "invalid_latlon"},
+		{query: "latlon=NaN,-0.13", wantField: "latlon", wantCode: "invalid_latlon"},
+		{query: "latlon=95,-0.13", wantField: "latlon", wantCode: "latlon_out_of_range"},
+		{query: "latlon=51.51,-0.13&lon=-0.13", wantField: "latlon", wantCode: "conflicting_latlon"},
+		{query: "zip=%3F%3F", wantField: "zip", wantCode: "invalid_zip"},
+		{query: "zip=94040,us&lat=51.51&lon=-0.13", wantField: "zip", wantCode: "conflicting_zip"},
+		{query: "city=%20", wantField: "city", wantCode: "missing_city"},
+		{query: "city=London&lat=51.51&lon=-0.13", wantField: "city", wantCode: "conflicting_city"},
+		{query: "location=home&lat=51.51&lon=-0.13", wantField: "location", wantCode: "conflicting_location"},
+		{query: "lat=51.51&lon=-0.13&units=celsius", wantField: "units", wantCode: "invalid_units"},
+		{query: "lat=51.51&lon=-0.13&lang=deutsch", wantField: "lang", wantCode: "invalid_lang"},
+		{query: "lat=51.51&lon=-0.13&mode=verbose", wantField: "mode", wantCode: "invalid_mode"},
+		{query: "lat=51.51&lon=-0.13&time_format=iso", wantField: "time_format", wantCode: "invalid_time_format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?"+tt.query, nil)
+
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, http.StatusBadRequest, recorder.Body)
+			}
+			var errs []FieldError
+			if err := json.Unmarshal(recorder.Body.Bytes(), &errs); err != nil {
+				t.Fatal(err)
+			}
+			want := FieldError{Field: tt.wantField, Code: tt.wantCode}
+			if len(errs) != 1 || errs[0].Message == "" {
+				t.Fatalf("errors = %+v, want only %+v with a message", errs, want)
+			}
+			if errs[0].Message = ""; errs[0] != want {
+				t.Errorf("error = %+v, want %+v", errs[0], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+)
+
+// BuildInfo describes the deployed build as reported by the /version endpoint.
+type BuildInfo struct {
+	Version   string `json:"version"`    // Release version, "dev" for local builds
+	Commit    string `json:"commit"`     // Git commit the binary was built from
+	BuildDate string `json:"build_date"` // Time the binary was built
+	GoVersion string `json:"go_version"` // Go toolchain used for the build
+}
+
+// withBuildInfoFallback returns a copy of the build info in which the fields still holding their defaults are filled
+// from the information embedded by the Go toolchain, when available: the main module version, and the VCS revision
+// and commit time recorded for builds inside a git checkout.
+func (info BuildInfo) withBuildInfoFallback(defaultVersion, unknown string) BuildInfo {
+	embedded, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = embedded.GoVersion
+	if info.Version == defaultVersion && embedded.Main.Version != "" && embedded.Main.Version != "(devel)" {
+		info.Version = embedded.Main.Version
+	}
+	for _, setting := range embedded.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == unknown:
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.BuildDate == unknown:
+			info.BuildDate = setting.Value
+		}
+	}
+	return info
+}
+
+// VersionHandler returns an HTTP handler function that reports the build info as JSON.
+// Fields set to "dev" (the version) or "unknown" (the commit and build date) are filled from the information embedded
+// by the Go toolchain where possible, so builds without -ldflags still report something useful.
+func VersionHandler(info BuildInfo) http.HandlerFunc {
+	info = info.withBuildInfoFallback("dev", "unknown")
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Reject methods other than GET and HEAD, advertising the supported ones in the Allow header
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentTypeJSON)
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+	}
+}
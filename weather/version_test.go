@@ -0,0 +1,70 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+)
+
+func TestVersionHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		info BuildInfo
+		want BuildInfo
+	}{
+		{
+			name: "set at link time",
+			info: BuildInfo{Version: "v1.4.0", Commit: "3f2c1ab", BuildDate: "2024-06-01T12:00:00Z"},
+			want: BuildInfo{Version: "v1.4.0", Commit: "3f2c1ab", BuildDate: "2024-06-01T12:00:00Z", GoVersion: runtime.Version()},
+		},
+		{
+			// Test binaries embed no module version, so the default stays
+			name: "defaults",
+			info: BuildInfo{Version: "dev", Commit: "unknown", BuildDate: "unknown"},
+			want: BuildInfo{Version: "dev", Commit: "unknown", BuildDate: "unknown", GoVersion: runtime.Version()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := serve(VersionHandler(tt.info), http.MethodGet, "/version", nil)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+			}
+			var fields map[string]string
+			if err := json.Unmarshal(recorder.Body.Bytes(), &fields); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"version", "commit", "build_date", "go_version"} {
+				if _, ok := fields[name]; !ok {
+					t.Errorf("body %s has no %s field", recorder.Body, name)
+				}
+			}
+			var got BuildInfo
+			json.Unmarshal(recorder.Body.Bytes(), &got)
+			// The VCS settings are only embedded in binaries built inside a checkout
+			if got.Version != tt.want.Version || got.GoVersion != tt.want.GoVersion || (tt.info.Commit != "unknown" && got != tt.want) {
+				t.Errorf("build info = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionHandlerMethods(t *testing.T) {
+	tests := []struct {
+		method     string
+		wantStatus int
+		wantBody   bool
+	}{
+		{method: http.MethodGet, wantStatus: http.StatusOK, wantBody: true},
+		{method: http.MethodHead, wantStatus: http.StatusOK},
+		{method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed, wantBody: true},
+	}
+	for _, tt := range tests {
+		recorder := serve(VersionHandler(BuildInfo{Version: "v1.4.0"}), tt.method, "/version", nil)
+		if recorder.Code != tt.wantStatus || (recorder.Body.Len() > 0) != tt.wantBody {
+			t.Errorf("%s status = %d with body %q, want %d", tt.method, recorder.Code, recorder.Body, tt.wantStatus)
+		}
+	}
+}
@@ -1,90 +1,663 @@
 package weather
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
 // WeatherData represents the structure of weather data obtained from the OpenWeatherMap API.
 // It is constructed based on the JSON response format documented at https://openweathermap.org/current.
 type WeatherData struct {
-	WeatherDescription string    `json:"weather_condition"` // Description of the weather condition
-	Temperature        string    `json:"temperature"`       // Temperature in Celsius
-	WeatherType        string    `json:"weather_type"`      // Type of weather condition (e.g., cold, moderate, hot)
-	Visibility         string    `json:"visibility"`        // Visibility in kilometers
-	WindSpeed          string    `json:"wind_speed"`        // Wind speed in meters per second
-	WindDirection      string    `json:"wind_direction"`    // Wind direction in degrees
-	CloudCoverage      string    `json:"cloud_coverage"`    // Cloud coverage in percentage
-	Sunrise            time.Time `json:"sunrise"`           // Time of sunrise
-	Sunset             time.Time `json:"sunset"`            // Time of sunset
+	XMLName             xml.Name  `json:"-" xml:"weather"`
+	WeatherDescription  string    `json:"weather_condition,omitempty" xml:"weather_condition,omitempty"`       // Description of the weather condition
+	Temperature         string    `json:"temperature" xml:"temperature"`                                       // Temperature in the requested units (Celsius by default)
+	WeatherType         string    `json:"weather_type" xml:"weather_type"`                                     // Type of weather condition (e.g., cold, moderate, hot)
+	Summary             string    `json:"summary" xml:"summary"`                                               // One English sentence describing the weather, e.g. for voice assistants
+	LocationName        string    `json:"location_name,omitempty" xml:"location_name,omitempty"`               // Name of the place reported by the upstream, or of the nearest place with reverse_geocode=true
+	Extreme             bool      `json:"extreme" xml:"extreme"`                                               // Whether the temperature is outside the configured extreme thresholds
+	ExtremeReason       string    `json:"extreme_reason,omitempty" xml:"extreme_reason,omitempty"`             // Which extreme threshold was crossed, when Extreme is set
+	Visibility          string    `json:"visibility,omitempty" xml:"visibility,omitempty"`                     // Visibility in kilometers, or miles for imperial units
+	WindSpeed           string    `json:"wind_speed,omitempty" xml:"wind_speed,omitempty"`                     // Wind speed in meters per second, or miles per hour for imperial units
+	WindDirection       string    `json:"wind_direction,omitempty" xml:"wind_direction,omitempty"`             // Wind direction in degrees
+	WindDirectionLabel  string    `json:"wind_direction_label,omitempty" xml:"wind_direction_label,omitempty"` // Wind direction as a 16-point compass label (e.g., ESE)
+	CloudCoverage       string    `json:"cloud_coverage,omitempty" xml:"cloud_coverage,omitempty"`             // Cloud coverage in percentage
+	Humidity            string    `json:"humidity,omitempty" xml:"humidity,omitempty"`                         // Relative humidity in percentage
+	DewPoint            string    `json:"dew_point,omitempty" xml:"dew_point,omitempty"`                       // Dew point in the requested units, derived from temperature and humidity
+	RainVolume          string    `json:"rain_volume,omitempty" xml:"rain_volume,omitempty"`                   // Rain volume for the last hour in millimeters
+	SnowVolume          string    `json:"snow_volume,omitempty" xml:"snow_volume,omitempty"`                   // Snow volume for the last hour in millimeters
+	Sunrise             time.Time `json:"sunrise,omitzero" xml:"sunrise"`                                      // Time of sunrise
+	Sunset              time.Time `json:"sunset,omitzero" xml:"sunset"`                                        // Time of sunset
+	SunriseUnix         int64     `json:"sunrise_unix,omitempty" xml:"sunrise_unix,omitempty"`                 // Time of sunrise in Unix seconds, only with time_format=unix
+	SunsetUnix          int64     `json:"sunset_unix,omitempty" xml:"sunset_unix,omitempty"`                   // Time of sunset in Unix seconds, only with time_format=unix
+	DataTimestamp       time.Time `json:"data_timestamp,omitzero" xml:"data_timestamp"`                        // Time the upstream observation was made
+	UVIndex             string    `json:"uv_index,omitempty" xml:"uv_index,omitempty"`                         // UV index, only from data sources that provide it such as /onecall
+	UVRisk              string    `json:"uv_risk,omitempty" xml:"uv_risk,omitempty"`                           // Risk category of the UV index (low, moderate, high, very high, extreme)
+	PartOfDay           string    `json:"part_of_day,omitempty" xml:"part_of_day,omitempty"`                   // Whether it is "day" or "night" at the location, when it can be determined
+	Timezone            string    `json:"timezone,omitempty" xml:"timezone,omitempty"`                         // IANA timezone name of the location, when it can be determined
+	SmoothedTemperature string    `json:"smoothed_temperature,omitempty" xml:"smoothed_temperature,omitempty"` // Exponentially smoothed temperature, only with smooth=true
+	TemperatureBucket   string    `json:"temperature_bucket,omitempty" xml:"temperature_bucket,omitempty"`     // Range of width bucket containing the temperature (e.g., 20-25), only with bucket=N
+	TemperatureKelvin   string    `json:"temperature_kelvin,omitempty" xml:"temperature_kelvin,omitempty"`     // Temperature in Kelvin whatever the requested units, only with kelvin=true
+	TemperatureTrend    string    `json:"temperature_trend,omitempty" xml:"temperature_trend,omitempty"`       // Whether the temperature is rising, falling or steady since the previous observation, only with trend=true
+	ComfortLevel        string    `json:"comfort_level,omitempty" xml:"comfort_level,omitempty"`               // How the weather feels from the heat index or wind chill (e.g., comfortable, muggy, frigid), only with comfort=true
+
+	temperature float64   // Raw temperature value in units, used by features that need the number rather than the label
+	units       string    // Unit system of the temperature values
+	comfort     string    // Comfort level computed when fetching, reported as ComfortLevel when asked for
+	raw         []byte    // Unmodified upstream JSON body, only kept for responses from OpenWeatherMap
+	stale       bool      // Served from an expired cache entry because fetching fresh data failed
+	cachedUntil time.Time // Time the cached copy of the data expires, zero when unknown
 }
 
+// Formats of the sunrise and sunset times selected with the time_format parameter of WeatherHandler.
+const (
+	timeFormatRFC3339 = "rfc3339" // RFC 3339 strings only, the default
+	timeFormatUnix    = "unix"    // Unix seconds in addition to the RFC 3339 strings
+)
+
 // WeatherHandler is an HTTP handler function that processes incoming HTTP requests to fetch weather data.
-// It expects latitude and longitude parameters in the request URL query string.
-// If the latitude or longitude parameters are missing or invalid, it responds with a Bad Request status code (400).
-// It then calls the getWeatherWithContext function to retrieve weather data based on the provided latitude and longitude.
-// If there is an error during the weather data retrieval process, it responds with an Internal Server Error status code (500).
-// Otherwise, it encodes the retrieved weather data into JSON format and writes it to the response writer.
+// Only GET and HEAD requests are accepted; any other method is rejected with a Method Not Allowed status code (405).
+// It expects either latitude and longitude parameters (lat and lon, or a combined latlon such as "51.5,-0.12"),
+// a zip parameter (e.g., "94040,US"), a city parameter (e.g., "London,GB") resolved into coordinates by the active
+// Geocoder, or the name of a configured favorite location in a location parameter (e.g., "home") in the request URL query string.
+// The forms are mutually exclusive: a request combining them is rejected rather than silently preferring one.
+// An unknown favorite location or a city the geocoder cannot find results in a Not Found status code (404).
+// A request naming no location at all uses the configured default location, if any; explicit parameters always win.
+// With geolocate=true or the configured Geolocate, such a request is instead answered for the client's location as
+// resolved from its IP address (see clientIP) by the active Geolocator; if that fails, it results in a Bad Request
+// status code (400) with the geolocation_failed code.
+// If the parameters are missing, invalid, out of range or combined, it responds with a Bad Request status code (400)
+// whose JSON body lists every problem found with its field, a stable error code (see FieldError) and a message.
+// An optional lang parameter (e.g., "de" or "pt_br") localizes the weather description and, for the languages of
+// unitLabels, the unit labels such as "percentage"; it defaults to English.
+// An optional units parameter (metric, imperial or standard) selects the unit system; without it, clients whose
+// Accept-Language names a region such as "en-US" get that region's customary units, and everyone else gets the configured default units.
+// With smooth=true, the response also carries a temperature exponentially smoothed over the location's recent polls.
+// With a positive bucket parameter such as bucket=5, the response also carries the range of that width containing the
+// temperature for coarse displays such as heatmaps; the exact temperature is still reported.
+// With kelvin=true, the response also carries the temperature in Kelvin, whatever the requested units.
+// With trend=true, the response also tells whether the temperature is rising, falling or steady compared with the
+// previous observation of the location, within the configured deadband; it is left out until two were seen.
+// With comfort=true, the response also says how the weather feels, e.g. "comfortable", "muggy" or "frigid", based on
+// the heat index in hot weather, the wind chill in cold weather and the temperature in between (see comfortLevel);
+// it is left out when the upstream does not report the humidity or wind speed the index needs.
+// With reverse_geocode=true, a response whose upstream reports no location name is given the name of the nearest place
+// as found by the active Geocoder, if it implements ReverseGeocoder. It costs an extra upstream call, so it is off by default.
+// With timing=true, or while debug logging is on, the response carries a Server-Timing header with the time spent on
+// the cache lookup, the upstream call and the encoding of the body, for performance investigations.
+// With time_format=unix, the response also carries the sunrise and sunset times as Unix seconds for clients that
+// format times themselves; the default time_format=rfc3339 only reports them as RFC 3339 strings.
+// Successful responses carry Cache-Control and Expires headers matching the configured cache TTL, except smoothed ones.
+// When the upstream fails, recently expired cached data may be served instead, flagged with an X-Cache: STALE header.
+// With pretty=true, the response is indented for reading in a browser.
+// An optional mode parameter selects the full response (the default) or a compact one with only the essential fields.
+// With classify_only=true, the response is narrowed down further to the weather type and the temperature as a number,
+// e.g. {"weather_type":"moderate","temperature":21.3}; it cannot be combined with mode.
+// Callers may supply their own OpenWeatherMap API key in the X-API-Key header; otherwise the configured default key is used.
+// ZIP codes are resolved into coordinates first, see resolveZip.
+// It then calls the getWeatherWithContext function to retrieve the weather data.
+// If the weather data retrieval times out, it responds with a Gateway Timeout status code (504); if the upstream does not
+// know the location, it responds with a Not Found status code (404); if the upstream rate limits the request, it
+// responds with a Too Many Requests status code (429), passing on its Retry-After header; if the upstream is unreachable
+// or answers with an error or an unreadable body, it responds with a Bad Gateway status code (502); any other failure
+// during the retrieval process results in an Internal Server Error status code (500). See describeFetchError for the full mapping.
+// The response format is negotiated from the Accept header: JSON by default, XML when the client asks for application/xml.
+// If the client only accepts unsupported types, it responds with a Not Acceptable status code (406) before fetching anything.
+// Otherwise, it encodes the retrieved weather data in the negotiated format and writes it to the response writer.
+// HEAD requests go through the same validation and fetch, so their status code tells whether a GET would succeed,
+// but only the headers are written. The fetch is usually answered from the cache, which keeps liveness probes cheap.
 func WeatherHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse latitude and longitude from the request URL query parameters
-	lat, err := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
-	if err != nil {
-		http.Error(w, "Invalid latitude", http.StatusBadRequest)
+	// Reject methods other than GET and HEAD, advertising the supported ones in the Allow header
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	lon, err := strconv.ParseFloat(r.URL.Query().Get("lon"), 64)
+
+	// Negotiate the response format up front so unsupported clients are rejected without an upstream call
+	contentType, ok := negotiateContentType(r.Header.Get("Accept"))
+	if !ok {
+		http.Error(w, "Not acceptable, supported types are application/json and application/xml", http.StatusNotAcceptable)
+		return
+	}
+
+	// Take one snapshot of the configuration so a concurrent reload cannot change settings halfway through the request
+	cfg := currentConfig()
+
+	// Validate every parameter before doing anything else, so that all problems are reported in a single response
+	query := r.URL.Query()
+	v := &validator{}
+	opts := parseFetchOptions(v, r, cfg)
+
+	// Parse the response mode, which selects between the full and the compact response
+	mode, ok := parseMode(query.Get("mode"))
+	if !ok {
+		v.invalid("mode", "Invalid mode, supported modes are full and compact")
+	}
+
+	// Narrow the response down to the classification when asked for; it replaces the mode, so both cannot be given
+	classifyOnly, err := parseBoolParam(query, "classify_only")
+	switch {
+	case err != nil:
+		v.invalid("classify_only", "Invalid classify_only flag")
+	case classifyOnly && query.Get("mode") != "":
+		v.conflict("classify_only", "classify_only cannot be combined with mode")
+	case classifyOnly:
+		mode = modeClassification
+	}
+
+	// Parse the optional smoothing flag, the optional flag asking for indented output and the optional Kelvin, trend,
+	// comfort and timing flags
+	smooth, err := parseBoolParam(query, "smooth")
+	if err != nil {
+		v.invalid("smooth", "Invalid smooth flag")
+	}
+	pretty, err := parseBoolParam(query, "pretty")
+	if err != nil {
+		v.invalid("pretty", "Invalid pretty flag")
+	}
+	kelvin, err := parseBoolParam(query, "kelvin")
+	if err != nil {
+		v.invalid("kelvin", "Invalid kelvin flag")
+	}
+	trend, err := parseBoolParam(query, "trend")
 	if err != nil {
-		http.Error(w, "Invalid longitude", http.StatusBadRequest)
+		v.invalid("trend", "Invalid trend flag")
+	}
+	comfort, err := parseBoolParam(query, "comfort")
+	if err != nil {
+		v.invalid("comfort", "Invalid comfort flag")
+	}
+	timed, err := parseBoolParam(query, "timing")
+	if err != nil {
+		v.invalid("timing", "Invalid timing flag")
+	}
+
+	// Parse the optional flag asking for the nearest place name when the upstream reports none
+	reverseGeocode, err := parseBoolParam(query, "reverse_geocode")
+	if err != nil {
+		v.invalid("reverse_geocode", "Invalid reverse_geocode flag")
+	}
+
+	// Parse the optional format of the sunrise and sunset times
+	timeFormat := query.Get("time_format")
+	if timeFormat != "" && timeFormat != timeFormatRFC3339 && timeFormat != timeFormatUnix {
+		v.invalid("time_format", "Invalid time_format, supported formats are rfc3339 and unix")
+	}
+
+	// Parse the optional bucket size for coarse temperature ranges; NaN fails the positivity check
+	var bucket float64
+	if value := query.Get("bucket"); value != "" {
+		bucket, err = strconv.ParseFloat(value, 64)
+		if err != nil || !(bucket > 0) || math.IsInf(bucket, 1) {
+			v.invalid("bucket", "Invalid bucket, it must be a positive number")
+		}
+	}
+
+	// Parse the optional flag asking to locate the client by IP address when the request names no location
+	geolocate, err := parseBoolParam(query, "geolocate")
+	if err != nil {
+		v.invalid("geolocate", "Invalid geolocate flag")
+	}
+
+	// Work out the queried location; the zip, city, location and coordinate forms are mutually exclusive
+	var zip, city string
+	var lat, lon float64
+	var locateClient bool
+	switch {
+	case query.Has("zip"):
+		if hasCoordinates(query) || query.Has("location") || query.Has("city") {
+			v.conflict("zip", "zip cannot be combined with lat/lon, city or location")
+		}
+		if zip, err = parseZip(query.Get("zip")); err != nil {
+			v.invalid("zip", "Invalid zip code")
+		}
+	case query.Has("city"):
+		if hasCoordinates(query) || query.Has("location") {
+			v.conflict("city", "city cannot be combined with lat/lon or location")
+		}
+		if city = strings.TrimSpace(query.Get("city")); city == "" {
+			v.missing("city", "Missing city")
+		}
+	case query.Has("location"):
+		if hasCoordinates(query) {
+			v.conflict("location", "location cannot be combined with lat/lon")
+		}
+	case !hasCoordinates(query) && (geolocate || cfg.Geolocate):
+		// Locate the client by IP address once the parameters are valid
+		locateClient = true
+	case !hasCoordinates(query) && cfg.DefaultLocation != nil:
+		// Fall back to the configured default location when the request names none
+		lat, lon = cfg.DefaultLocation.Lat, cfg.DefaultLocation.Lon
+	default:
+		// Parse latitude and longitude from the request URL query parameters
+		lat, lon = parseLatLon(v, query, cfg)
+	}
+	if !v.valid() {
+		v.write(w)
 		return
 	}
 
-	// Create a context with a timeout of 5 seconds
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// Resolve a favorite location into its coordinates
+	if query.Has("location") {
+		location, ok := lookupFavorite(query.Get("location"))
+		if !ok {
+			http.Error(w, "Unknown location", http.StatusNotFound)
+			return
+		}
+		lat, lon = location.Lat, location.Lon
+	}
+
+	// Create a context with the configured timeout of the endpoint
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout(EndpointWeather))
 	defer cancel()
 
-	// Call getWeatherWithContext function with the created context
-	weatherData, err := getWeatherWithContext(ctx, lat, lon)
+	// Time the phases of the request when asked for or while debugging, see serverTiming
+	var timing *serverTiming
+	if timed || debugLogging.Load() {
+		timing = &serverTiming{}
+		ctx = withServerTiming(ctx, timing)
+	}
+
+	// Resolve the client IP address into coordinates with the active geolocator; without them there is nothing to
+	// fetch, so a failure is reported as a client error asking for an explicit location
+	if locateClient {
+		lat, lon, err = geolocateClient(withFetchOptions(ctx, opts), r)
+		if err != nil {
+			log.Printf("IP geolocation failed: %v", err)
+			writeFieldErrors(w, http.StatusBadRequest, []FieldError{{Field: "geolocate", Code: "geolocation_failed",
+				Message: "Could not determine your location from your IP address, pass lat and lon, latlon, zip, city or location instead"}})
+			return
+		}
+	}
+
+	// Resolve a place name into its coordinates with the active geocoder
+	if city != "" {
+		lat, lon, err = currentGeocoder().Geocode(withFetchOptions(ctx, opts), city)
+		if err != nil {
+			writeFetchError(w, err)
+			return
+		}
+	}
+
+	// Resolve a ZIP code into its coordinates, so that it is fetched and cached like any other location
+	if zip != "" {
+		lat, lon, err = resolveZip(ctx, zip, opts)
+		if err != nil {
+			writeFetchError(w, err)
+			return
+		}
+	}
+
+	// Record the resolved location and units in the request context for the logging middleware
+	setRequestCoordinates(r.Context(), lat, lon)
+	setRequestUnits(r.Context(), opts.units)
+
+	// Call getWeatherWithContext with the created context.
+	// locationKey identifies the queried location for per-location state such as smoothing
+	locationKey := formatCoordinates(lat, lon)
+	weatherData, err := getWeatherWithContext(ctx, lat, lon, opts)
+	if timing != nil {
+		w.Header().Set("Server-Timing", timing.header())
+	}
 	if err != nil {
 		// Handle error if any occurred during weather data retrieval
-		http.Error(w, "Failed to fetch weather data", http.StatusInternalServerError)
+		writeFetchError(w, err)
 		return
 	}
 
-	// Encode weather data into JSON format and write it to the response writer
-	json.NewEncoder(w).Encode(weatherData)
+	// Name the nearest place when asked for and the upstream left the name out, e.g. in remote areas
+	if reverseGeocode && weatherData.LocationName == "" {
+		if name, ok := nearestPlaceName(withFetchOptions(ctx, opts), currentGeocoder(), lat, lon); ok {
+			weatherData.LocationName = name
+		}
+	}
+
+	// Blend the reading into the location's smoothed temperature when requested
+	if smooth {
+		smoothed := temperatureSmoother.update(locationKey+","+weatherData.units, weatherData.temperature, cfg.SmoothingFactor)
+		weatherData.SmoothedTemperature = formatTemperature(smoothed, weatherData.units)
+	}
+
+	// Compare the observation with the previous one of the location when the trend is requested.
+	// Temperatures are tracked in Celsius, so requests in different units share the history
+	if trend {
+		weatherData.TemperatureTrend = temperatureTrends.update(locationKey, toCelsius(weatherData.temperature, weatherData.units), weatherData.DataTimestamp, cfg.TrendDeadband)
+	}
+
+	// Place the temperature into its range when bucketing is requested
+	if bucket > 0 {
+		weatherData.TemperatureBucket = temperatureBucket(weatherData.temperature, bucket)
+	}
+
+	// Add the temperature in Kelvin for scientific clients, converted from the fetched value in any unit system
+	if kelvin {
+		weatherData.TemperatureKelvin = formatTemperature(toKelvin(weatherData.temperature, weatherData.units), UnitsStandard)
+	}
+
+	// Report how the weather feels when asked for; it stays empty when the upstream lacks the humidity or wind it needs
+	if comfort {
+		weatherData.ComfortLevel = weatherData.comfort
+	}
+
+	// Add the sunrise and sunset times as Unix seconds when asked for; unknown times are left out
+	if timeFormat == timeFormatUnix {
+		if !weatherData.Sunrise.IsZero() && !weatherData.Sunset.IsZero() {
+			weatherData.SunriseUnix, weatherData.SunsetUnix = weatherData.Sunrise.Unix(), weatherData.Sunset.Unix()
+		}
+	}
+
+	// Translate the unit labels into the requested language; the numbers stay the same
+	localizeWeatherData(weatherData, opts.lang)
+
+	// Let clients cache the response as long as the server caches the data; smoothed responses change with every poll,
+	// and stale data is flagged instead so clients know it is a fallback during an upstream failure. Geolocated
+	// responses depend on the client address, so shared caches must not serve them to other clients
+	switch {
+	case weatherData.stale:
+		w.Header().Set("X-Cache", "STALE")
+	case !smooth:
+		setCacheHeaders(w, remainingTTL(weatherData, opts.cacheTTL), locateClient)
+	}
+
+	// Answer HEAD requests with the headers only
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Encode weather data in the negotiated format and write it to the response writer. A timed response is encoded
+	// up front, since the header reporting the encoding time has to be written before the body
+	if timing != nil {
+		var body bytes.Buffer
+		start := time.Now()
+		encodeWeatherData(&body, contentType, projectWeatherData(weatherData, mode), pretty)
+		timing.record(timingEncode, start)
+		w.Header().Set("Server-Timing", timing.header())
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body.Bytes())
+		return
+	}
+	writeWeatherData(w, contentType, projectWeatherData(weatherData, mode), pretty)
+}
+
+// parseBoolParam is a helper function that parses an optional boolean query parameter such as "pretty=true".
+// A missing or empty parameter is false; any value accepted by strconv.ParseBool is allowed otherwise.
+func parseBoolParam(query url.Values, name string) (bool, error) {
+	value := query.Get(name)
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// hasCoordinates is a helper function that reports whether the query names coordinates in either supported form.
+func hasCoordinates(query url.Values) bool {
+	return query.Has("lat") || query.Has("lon") || query.Has("latlon")
+}
+
+// parseLatLon is a helper function that parses the coordinates from either the lat and lon query parameters or
+// a single latlon parameter of the form "51.5,-0.12". The two forms are mutually exclusive.
+// Coordinates that are missing, malformed, not numbers, out of range or given in both forms are recorded in v.
+// With the configured LenientCoordinates, longitudes beyond the antimeridian are wrapped instead, see normalizeLongitude.
+func parseLatLon(v *validator, query url.Values, cfg *Config) (float64, float64) {
+	if query.Has("latlon") {
+		if query.Has("lat") || query.Has("lon") {
+			v.conflict("latlon", "latlon cannot be combined with lat/lon")
+			return 0, 0
+		}
+		latText, lonText, found := strings.Cut(query.Get("latlon"), ",")
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(latText), 64)
+		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(lonText), 64)
+		if !found || latErr != nil || lonErr != nil || math.IsNaN(lat) || math.IsNaN(lon) {
+			v.invalid("latlon", "Invalid latlon, expected \"<latitude>,<longitude>\"")
+			return 0, 0
+		}
+		lon, lonOK := normalizeLongitude(lon, cfg.LenientCoordinates)
+		if !inRange(lat, 90) || !lonOK {
+			v.outOfRange("latlon", "Invalid latlon, latitude must be between -90 and 90 and longitude between -180 and 180")
+		}
+		return lat, lon
+	}
+
+	lat := parseCoordinate(v, query, "lat", "latitude", 90, false)
+	lon := parseCoordinate(v, query, "lon", "longitude", 180, cfg.LenientCoordinates)
+	return lat, lon
+}
+
+// parseCoordinate is a helper function that parses the named coordinate query parameter, which must lie between
+// -limit and limit. With wrap set, the coordinate is a longitude that is wrapped into that range instead.
+// The problem found, if any, is recorded in v under the parameter name; label names the coordinate in the messages,
+// e.g. "latitude".
+func parseCoordinate(v *validator, query url.Values, field, label string, limit float64, wrap bool) float64 {
+	value := query.Get(field)
+	if value == "" {
+		v.missing(field, "Missing "+label)
+		return 0
+	}
+	// NaN parses as a float but is not a number, so it is invalid rather than out of range
+	coordinate, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(coordinate) {
+		v.invalid(field, "Invalid "+label)
+		return 0
+	}
+	if wrap {
+		var ok bool
+		if coordinate, ok = normalizeLongitude(coordinate, true); ok {
+			return coordinate
+		}
+	}
+	if !inRange(coordinate, limit) {
+		v.outOfRange(field, fmt.Sprintf("Invalid %s, it must be between %v and %v", label, -limit, limit))
+	}
+	return coordinate
+}
+
+// normalizeLongitude is a helper function that checks a longitude, reporting whether it can be used.
+// Longitudes between -180 and 180 are used as they are; both ends name the antimeridian. In lenient mode, any other
+// finite longitude is wrapped around the globe into that range, so 181 becomes -179 and 540 becomes -180.
+// Latitudes are never normalized: beyond a pole there is no equivalent latitude without also moving the longitude
+// by 180 degrees, so a latitude outside -90 to 90 is always rejected, while exactly 90 or -90 is a pole.
+func normalizeLongitude(lon float64, lenient bool) (float64, bool) {
+	if inRange(lon, 180) {
+		return lon, true
+	}
+	if !lenient || math.IsInf(lon, 0) || math.IsNaN(lon) {
+		return lon, false
+	}
+	lon = math.Mod(lon+180, 360)
+	if lon < 0 {
+		lon += 360
+	}
+	return lon - 180, true
+}
+
+// inRange is a helper function that reports whether value lies between -limit and limit. NaN is never in range.
+func inRange(value, limit float64) bool {
+	return value >= -limit && value <= limit
 }
 
-// getWeatherWithContext retrieves weather data with a deadline context
-func getWeatherWithContext(ctx context.Context, lat, lon float64) (*WeatherData, error) {
-	// Create channels to communicate results and errors
-	ch := make(chan *WeatherData, 1)
-	errCh := make(chan error, 1)
+// parseFetchOptions is a helper function that builds the fetch options for a request from its headers and query parameters.
+// The caller's API key is taken from the X-API-Key header, and the optional lang parameter selects the description language.
+// The unit system is resolved by resolveUnits from the units parameter, the Accept-Language header and the configured
+// default units, in that order. The cache TTL, minimum fetch interval and staleness windows are taken from the same
+// configuration snapshot.
+// Invalid parameters are recorded in v.
+func parseFetchOptions(v *validator, r *http.Request, cfg *Config) fetchOptions {
+	// Use the caller's API key when provided; an empty key falls back to the configured default key
+	opts := fetchOptions{apiKey: r.Header.Get("X-API-Key"), cacheTTL: cfg.CacheTTL, minFetchInterval: cfg.MinFetchInterval, maxStaleness: cfg.MaxStaleness, revalidateWindow: cfg.StaleWhileRevalidate}
 
-	// Execute getWeather function asynchronously
-	go func() {
-		weatherData, err := getWeather(lat, lon)
+	// Parse the optional language of the weather description
+	query := r.URL.Query()
+	if query.Has("lang") {
+		lang, err := parseLang(query.Get("lang"))
 		if err != nil {
-			// Send error to the error channel if any occurred
-			errCh <- err
-			return
+			v.invalid("lang", "Invalid language code")
+		}
+		opts.lang = lang
+	}
+
+	// Resolve the unit system from the explicit parameter, the client's language region or the configured default
+	units, err := resolveUnits(query.Get("units"), r.Header.Get("Accept-Language"), cfg.DefaultUnits)
+	if err != nil {
+		v.invalid("units", "Invalid units, supported units are metric, imperial and standard")
+	}
+	opts.units = units
+	return opts.withDefaults()
+}
+
+// flightGroup deduplicates concurrent fetches for the same coordinates so that they share a single upstream call.
+var flightGroup = &singleflight.Group{}
+
+// cacheKey is a helper function that builds the cache and deduplication key for the given coordinates and fetch options.
+// Coordinates are rounded to CoordinatePrecision, so nearby requests share a key and exact locations are never kept.
+// A fingerprint of the API key is part of the key so that callers with different keys never share each other's
+// upstream calls, without the key itself ever being stored in a cache backend. The keys of the pool set with
+// SetAPIKeys all stand for the server's own account and share one fingerprint.
+func cacheKey(lat, lon float64, opts fetchOptions) string {
+	account := opts.apiKey
+	if activeAPIKeys.contains(account) {
+		account = API_KEY
+	}
+	fingerprint := sha256.Sum256([]byte(account))
+	return fmt.Sprintf("%s,%s,%s,%x", formatCoordinates(lat, lon), opts.units, opts.lang, fingerprint[:8])
+}
+
+// serveStale is a helper function that falls back to expired cached data after fetching fresh data for key failed
+// with err. The stale data is returned only if the cache supports it, the entry expired no longer than the options'
+// maximum staleness ago, and the upstream did not report the location as unknown; otherwise err is returned.
+func serveStale(cache Cache, key string, opts fetchOptions, err error) (*WeatherData, error) {
+	staleCache, ok := cache.(StaleCache)
+	if !ok || opts.maxStaleness <= 0 || errors.Is(err, ErrLocationNotFound) {
+		return nil, err
+	}
+	weatherData, ok := staleCache.GetStale(key, opts.maxStaleness)
+	if !ok {
+		return nil, err
+	}
+	log.Printf("Serving stale data after failed fetch: %v", err)
+	weatherData.stale = true
+	return weatherData, nil
+}
+
+// revalidate is a helper function that returns the data cached for key if it expired no longer than the options'
+// revalidation window ago, marked as stale, after calling refresh to fetch a fresh copy in the background.
+// It returns false when the window is disabled, the cache cannot tell the age of its entries or the entry is too old.
+func revalidate(cache Cache, key string, opts fetchOptions, refresh func()) (*WeatherData, bool) {
+	revalidatingCache, ok := cache.(RevalidatingCache)
+	if !ok || opts.revalidateWindow <= 0 {
+		return nil, false
+	}
+	weatherData, expiresAt, ok := revalidatingCache.Peek(key)
+	if !ok || now().After(expiresAt.Add(opts.revalidateWindow)) {
+		return nil, false
+	}
+	refresh()
+	weatherData.stale = true
+	return weatherData, true
+}
+
+// fetchBudget is a helper function that returns how long a fetch made for ctx may take: the time left until the
+// deadline of ctx, which the handlers set from the configured timeout of their endpoint, or the configured timeout of
+// the weather endpoint when ctx has no deadline.
+func fetchBudget(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return currentConfig().timeout(EndpointWeather)
+}
+
+// startFetch is a helper function that joins the in-flight fetch for key or starts a new one, which queries the
+// providers for the coordinates and caches the result. The fetch is detached from ctx, apart from its values, since
+// it no longer follows any individual caller; it is bounded by the fetch budget of ctx instead, see fetchBudget.
+func startFetch(ctx context.Context, cache Cache, key string, lat, lon float64, opts fetchOptions) <-chan singleflight.Result {
+	return flightGroup.DoChan(key, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(withFetchOptions(context.WithoutCancel(ctx), opts), fetchBudget(ctx))
+		defer cancel()
+		weatherData, err := fetchFromProviders(fetchCtx, registeredProviders(), lat, lon)
+		if err != nil {
+			return nil, err
 		}
-		// Send weather data to the result channel
-		ch <- weatherData
-	}()
+		// The raw upstream body is only needed by RawHandler, which bypasses the cache
+		weatherData.raw = nil
+		weatherData.cachedUntil = now().Add(opts.cacheTTL)
+		cache.Set(key, weatherData, opts.cacheTTL)
+		upstreamGuard.record(key, weatherData, opts.minFetchInterval)
+		return weatherData, nil
+	})
+}
+
+// getWeatherWithContext retrieves weather data with a deadline context.
+// Data found in the active cache is returned without an upstream call; fetched data is cached for the options' cache TTL.
+// A cache miss within the minimum fetch interval of the previous fetch with the same key is answered with that fetch's result.
+// Otherwise the registered providers are tried in order, so a fallback provider answers when the primary one fails or times out.
+// Concurrent calls for the same coordinates are deduplicated and share the result of one upstream fetch.
+// The shared fetch is detached from the callers' contexts, so a caller that gives up early does not cancel it for the others.
+// When the fetch fails or times out, data that expired from the cache no longer than the options' maximum staleness ago
+// is returned instead, marked as stale; see serveStale.
+// Data that expired no longer than the options' revalidation window ago is returned right away, marked as stale,
+// while a background fetch refreshes it; see revalidate.
+// In offline mode, a cache miss fails with ErrOffline without any upstream call, unless stale data can be served.
+// The fetch options are passed to the providers through the context.
+func getWeatherWithContext(ctx context.Context, lat, lon float64, opts fetchOptions) (*WeatherData, error) {
+	opts = opts.withDefaults()
+	key := cacheKey(lat, lon, opts)
+
+	// Serve from the cache when possible
+	timing := serverTimingFromContext(ctx)
+	cache := currentCache()
+	start := time.Now()
+	weatherData, ok := cache.Get(key)
+	timing.record(timingCache, start)
+	if ok {
+		return weatherData, nil
+	}
+
+	// In offline mode the cache is the only source, so a miss is only answered with stale data, if any
+	if currentConfig().Offline {
+		return serveStale(cache, key, opts, ErrOffline)
+	}
+
+	// Answer identical requests in quick succession with the previous upstream result
+	if weatherData, ok := upstreamGuard.recent(key, opts.minFetchInterval); ok {
+		log.Printf("Coalesced request for %s with the fetch made less than %v ago", formatCoordinates(lat, lon), opts.minFetchInterval)
+		return weatherData, nil
+	}
+
+	// Serve recently expired data immediately and refresh it in the background, if the cache can tell its age
+	if weatherData, ok := revalidate(cache, key, opts, func() { startFetch(ctx, cache, key, lat, lon, opts) }); ok {
+		return weatherData, nil
+	}
+
+	// Join an in-flight fetch for the same coordinates or start a new one
+	defer timing.record(timingUpstream, time.Now())
+	ch := startFetch(ctx, cache, key, lat, lon, opts)
 
 	// Select block to wait for results or errors
 	select {
 	case <-ctx.Done():
 		// Return error if context deadline is reached
-		return nil, ctx.Err()
-	case err := <-errCh:
-		// Return error if any occurred during weather data retrieval
-		return nil, err
-	case weatherData := <-ch:
-		// Return weather data if retrieved successfully
-		return weatherData, nil
+		return serveStale(cache, key, opts, ctx.Err())
+	case result := <-ch:
+		if result.Err != nil {
+			// Return error if any occurred during weather data retrieval
+			return serveStale(cache, key, opts, result.Err)
+		}
+		// Return a copy of the shared weather data so callers can modify their result independently
+		weatherData := *result.Val.(*WeatherData)
+		return &weatherData, nil
 	}
 }
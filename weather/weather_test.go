@@ -0,0 +1,446 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWeatherHandlerMethods(t *testing.T) {
+	tests := []struct {
+		method     string
+		wantStatus int
+		wantAllow  string
+	}{
+		{method: http.MethodGet, wantStatus: http.StatusOK},
+		{method: http.MethodHead, wantStatus: http.StatusOK},
+		{method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, HEAD"},
+		{method: http.MethodPut, wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, HEAD"},
+		{method: http.MethodDelete, wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, HEAD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			setupTest(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(WeatherHandler, tt.method, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if got := recorder.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			if tt.wantAllow != "" && len(upstream.calls(currentWeatherPath)) != 0 {
+				t.Errorf("rejected %s request called the upstream", tt.method)
+			}
+		})
+	}
+}
+
+func TestGetWeatherWithContextDeduplicates(t *testing.T) {
+	tests := []struct {
+		name      string
+		units     []string
+		wantCalls int
+	}{
+		{name: "identical requests", units: []string{UnitsMetric, UnitsMetric, UnitsMetric, UnitsMetric}, wantCalls: 1},
+		{name: "different units", units: []string{UnitsMetric, UnitsImperial, UnitsMetric, UnitsImperial}, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			release := make(chan struct{})
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+				<-release
+				respond(http.StatusOK, sampleCurrentWeather)(w, r)
+			}})
+
+			var wg sync.WaitGroup
+			results := make([]*WeatherData, len(tt.units))
+			for i, units := range tt.units {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var err error
+					results[i], err = getWeatherWithContext(context.Background(), 51.51, -0.13, fetchOptions{units: units})
+					if err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			// Hold the upstream until every caller has had the time to join an in-flight fetch
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if got := len(upstream.calls(currentWeatherPath)); got != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", got, tt.wantCalls)
+			}
+			// Callers sharing a fetch get copies they can change on their own
+			if results[0] != nil && results[1] != nil && results[0] == results[1] {
+				t.Error("callers share the same WeatherData")
+			}
+		})
+	}
+}
+
+func TestGetWeatherWithContextCallerGivesUp(t *testing.T) {
+	setupTest(t)
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		respond(http.StatusOK, sampleCurrentWeather)(w, r)
+	}})
+
+	// A caller joining the fetch gives up while it is in flight, which must not cancel it for the caller that started it
+	patient := make(chan error, 1)
+	go func() {
+		_, err := getWeatherWithContext(context.Background(), 51.51, -0.13, fetchOptions{})
+		patient <- err
+	}()
+	<-started
+	impatient, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := getWeatherWithContext(impatient, 51.51, -0.13, fetchOptions{}); err == nil {
+		t.Error("impatient caller got data before the upstream answered")
+	}
+	close(release)
+
+	if err := <-patient; err != nil {
+		t.Errorf("patient caller failed: %v", err)
+	}
+	if got := len(upstream.calls(currentWeatherPath)); got != 1 {
+		t.Errorf("upstream calls = %d, want 1", got)
+	}
+}
+
+func TestWeatherHandlerAPIKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		keys      []string // X-API-Key headers of consecutive requests for the same location, "" for none
+		wantAppID []string // API keys received by the upstream, in order
+	}{
+		{name: "default key", keys: []string{""}, wantAppID: []string{API_KEY}},
+		{name: "caller key", keys: []string{"tenant-a"}, wantAppID: []string{"tenant-a"}},
+		{name: "same caller is cached", keys: []string{"tenant-a", "tenant-a"}, wantAppID: []string{"tenant-a"}},
+		{name: "callers do not share data", keys: []string{"tenant-a", "tenant-b", ""}, wantAppID: []string{"tenant-a", "tenant-b", API_KEY}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.MinFetchInterval = 0 })
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			for _, key := range tt.keys {
+				header := http.Header{}
+				if key != "" {
+					header.Set("X-API-Key", key)
+				}
+				if recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", header); recorder.Code != http.StatusOK {
+					t.Fatalf("status = %d; body %s", recorder.Code, recorder.Body)
+				}
+			}
+
+			var got []string
+			for _, call := range upstream.calls(currentWeatherPath) {
+				got = append(got, call.Query().Get("appid"))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantAppID, ",") {
+				t.Errorf("upstream API keys = %q, want %q", got, tt.wantAppID)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		delay      time.Duration
+		wantStatus int
+	}{
+		{name: "in time", delay: 0, wantStatus: http.StatusOK},
+		{name: "too slow", delay: time.Second, wantStatus: http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			MaxUpstreamAttempts = 1
+			configure(t, func(cfg *Config) { cfg.Timeouts[EndpointWeather] = 100 * time.Millisecond })
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(tt.delay):
+					respond(http.StatusOK, sampleCurrentWeather)(w, r)
+				case <-r.Context().Done():
+				}
+			}})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13", nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestHeadRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		target     string
+		header     http.Header
+		upstream   http.HandlerFunc
+		wantStatus int
+		wantType   string
+	}{
+		{
+			name:       "weather",
+			handler:    WeatherHandler,
+			target:     "/weather?lat=51.51&lon=-0.13",
+			upstream:   respond(http.StatusOK, sampleCurrentWeather),
+			wantStatus: http.StatusOK,
+			wantType:   contentTypeJSON,
+		},
+		{
+			name:       "weather as XML",
+			handler:    WeatherHandler,
+			target:     "/weather?lat=51.51&lon=-0.13",
+			header:     http.Header{"Accept": {"application/xml"}},
+			upstream:   respond(http.StatusOK, sampleCurrentWeather),
+			wantStatus: http.StatusOK,
+			wantType:   contentTypeXML,
+		},
+		{
+			name:       "weather with invalid parameters",
+			handler:    WeatherHandler,
+			target:     "/weather?lat=north&lon=-0.13",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "weather for an unknown location",
+			handler:    WeatherHandler,
+			target:     "/weather?lat=51.51&lon=-0.13",
+			upstream:   respond(http.StatusNotFound, `{"cod":"404","message":"city not found"}`),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "one call",
+			handler:    OneCallHandler,
+			target:     "/onecall?lat=51.51&lon=-0.13",
+			upstream:   respond(http.StatusOK, sampleOneCall),
+			wantStatus: http.StatusOK,
+			wantType:   contentTypeJSON,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			routes := map[string]http.HandlerFunc{}
+			if tt.upstream != nil {
+				routes[currentWeatherPath] = tt.upstream
+				routes[oneCallPath] = tt.upstream
+			}
+			newUpstream(t, routes)
+
+			recorder := serve(tt.handler, http.MethodHead, tt.target, tt.header)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := recorder.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if recorder.Body.Len() != 0 {
+				t.Errorf("HEAD response has a body: %s", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestParseLatLon(t *testing.T) {
+	tests := []struct {
+		query            string
+		lenient          bool
+		wantLat, wantLon float64
+		wantInvalidField string // Parameter reported as invalid, empty when the query is valid
+	}{
+		{query: "lat=51.5&lon=-0.12", wantLat: 51.5, wantLon: -0.12},
+		{query: "latlon=51.5,-0.12", wantLat: 51.5, wantLon: -0.12},
+		{query: "latlon=51.5,%20-0.12", wantLat: 51.5, wantLon: -0.12},
+		{query: "latlon=-33.87,151.21", wantLat: -33.87, wantLon: 151.21},
+		{query: "latlon=51.5,181", lenient: true, wantLat: 51.5, wantLon: -179},
+		{query: "latlon=51.5", wantInvalidField: "latlon"},
+		{query: "latlon=51.5,west", wantInvalidField: "latlon"},
+		{query: "latlon=,", wantInvalidField: "latlon"},
+		{query: "latlon=91,0", wantInvalidField: "latlon"},
+		{query: "latlon=51.5,181", wantInvalidField: "latlon"},
+		{query: "latlon=51.5,-0.12&lat=40", wantInvalidField: "latlon"},
+		{query: "latlon=51.5,-0.12&lon=40", wantInvalidField: "latlon"},
+		{query: "lat=51.5", wantInvalidField: "lon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.LenientCoordinates = tt.lenient })
+			query, _ := url.ParseQuery(tt.query)
+			v := &validator{}
+
+			lat, lon := parseLatLon(v, query, currentConfig())
+
+			if tt.wantInvalidField != "" {
+				if len(v.errors) != 1 || v.errors[0].Field != tt.wantInvalidField {
+					t.Errorf("errors = %v, want one for %s", v.errors, tt.wantInvalidField)
+				}
+				return
+			}
+			if !v.valid() || math.Abs(lat-tt.wantLat) > 1e-9 || math.Abs(lon-tt.wantLon) > 1e-9 {
+				t.Errorf("parseLatLon() = %v, %v with errors %v; want %v, %v", lat, lon, v.errors, tt.wantLat, tt.wantLon)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerLatLon(t *testing.T) {
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantLat    string // lat of the upstream call
+	}{
+		{target: "/weather?latlon=51.51,-0.13", wantStatus: http.StatusOK, wantLat: "51.510000"},
+		{target: "/weather?lat=51.51&lon=-0.13", wantStatus: http.StatusOK, wantLat: "51.510000"},
+		{target: "/weather?latlon=51.51;-0.13", wantStatus: http.StatusBadRequest},
+		{target: "/weather?latlon=51.51,-0.13&lat=10&lon=10", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			setupTest(t)
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			calls := upstream.calls(currentWeatherPath)
+			if tt.wantLat == "" {
+				if len(calls) != 0 {
+					t.Errorf("rejected request called the upstream")
+				}
+				return
+			}
+			if len(calls) != 1 || calls[0].Query().Get("lat") != tt.wantLat {
+				t.Errorf("upstream calls = %v, want one for lat %s", calls, tt.wantLat)
+			}
+		})
+	}
+}
+
+func TestWeatherHandlerDefaultLocation(t *testing.T) {
+	kiosk := &Location{Lat: 48.8566, Lon: 2.3522}
+	tests := []struct {
+		name       string
+		location   *Location // Configured default location
+		target     string
+		wantStatus int
+		wantLat    string // lat of the upstream call
+	}{
+		{name: "default used", location: kiosk, target: "/weather", wantStatus: http.StatusOK, wantLat: "48.856600"},
+		{name: "explicit coordinates win", location: kiosk, target: "/weather?lat=51.51&lon=-0.13", wantStatus: http.StatusOK, wantLat: "51.510000"},
+		{name: "explicit latlon wins", location: kiosk, target: "/weather?latlon=51.51,-0.13", wantStatus: http.StatusOK, wantLat: "51.510000"},
+		{name: "incomplete coordinates are not completed", location: kiosk, target: "/weather?lat=51.51", wantStatus: http.StatusBadRequest},
+		{name: "no default", target: "/weather", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			configure(t, func(cfg *Config) { cfg.DefaultLocation = tt.location })
+			upstream := newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, sampleCurrentWeather)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, tt.target, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			calls := upstream.calls(currentWeatherPath)
+			if tt.wantLat == "" {
+				if len(calls) != 0 {
+					t.Errorf("rejected request called the upstream")
+				}
+				return
+			}
+			if len(calls) != 1 || calls[0].Query().Get("lat") != tt.wantLat {
+				t.Errorf("upstream calls = %v, want one for lat %s", calls, tt.wantLat)
+			}
+		})
+	}
+}
+
+func TestSetConfigDefaultLocationRange(t *testing.T) {
+	setupTest(t)
+	for _, location := range []Location{{Lat: 91, Lon: 0}, {Lat: 0, Lon: -181}} {
+		cfg := DefaultConfig()
+		cfg.DefaultLocation = &location
+		if err := SetConfig(cfg); err == nil {
+			t.Errorf("SetConfig() accepted the default location %+v", location)
+		}
+	}
+}
+
+func TestWeatherHandlerTimeFormat(t *testing.T) {
+	withoutSun := strings.Replace(sampleCurrentWeather, `,"sunrise":1717213671,"sunset":1717272614`, "", 1)
+	tests := []struct {
+		name       string
+		query      string
+		body       string
+		wantStatus int
+		wantTimes  bool // Whether the RFC 3339 sunrise and sunset are reported
+		wantUnix   bool // Whether sunrise_unix and sunset_unix are reported
+	}{
+		{name: "default", body: sampleCurrentWeather, wantStatus: http.StatusOK, wantTimes: true},
+		{name: "rfc3339", query: "&time_format=rfc3339", body: sampleCurrentWeather, wantStatus: http.StatusOK, wantTimes: true},
+		{name: "unix", query: "&time_format=unix", body: sampleCurrentWeather, wantStatus: http.StatusOK, wantTimes: true, wantUnix: true},
+		{name: "unix without known sun times", query: "&time_format=unix", body: withoutSun, wantStatus: http.StatusOK},
+		{name: "unsupported format", query: "&time_format=epoch", body: sampleCurrentWeather, wantStatus: http.StatusBadRequest},
+		{name: "case sensitive", query: "&time_format=UNIX", body: sampleCurrentWeather, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			newUpstream(t, map[string]http.HandlerFunc{currentWeatherPath: respond(http.StatusOK, tt.body)})
+
+			recorder := serve(WeatherHandler, http.MethodGet, "/weather?lat=51.51&lon=-0.13"+tt.query, nil)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got map[string]json.RawMessage
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			for field, want := range map[string]int64{"sunrise": 1717213671, "sunset": 1717272614} {
+				var at time.Time
+				if raw, ok := got[field]; ok != tt.wantTimes || ok && (json.Unmarshal(raw, &at) != nil || at.Unix() != want) {
+					t.Errorf("%s = %s, want the time %d reported %v", field, got[field], want, tt.wantTimes)
+				}
+				var seconds int64
+				if raw, ok := got[field+"_unix"]; ok != tt.wantUnix || ok && (json.Unmarshal(raw, &seconds) != nil || seconds != want) {
+					t.Errorf("%s_unix = %s, want %d reported %v", field, got[field+"_unix"], want, tt.wantUnix)
+				}
+			}
+		})
+	}
+}